@@ -70,6 +70,12 @@ type ExecutionContext struct {
 	// The template being executed (provides config, inheritance, and TemplateSet access).
 	template *Template
 
+	// inheritance is the template inheritance chain being executed, from the
+	// root template (the one being executed) to the most-derived child. Blocks
+	// are resolved along this chain, as templates are shared between children
+	// and don't know which of them extends them.
+	inheritance []*Template
+
 	// Tracks recursive macro call depth; errors if exceeding maxMacroDepth.
 	macroDepth int
 
@@ -95,6 +101,18 @@ type ExecutionContext struct {
 	// shared across all child contexts within a single execution, so tags
 	// maintain consistent state regardless of nesting depth.
 	tagState map[any]any
+
+	// part is the part of the output rendered in parallel using this
+	// context (nil if it's rendered by the goroutine executing the
+	// template). parallelLimit limits the number of goroutines rendering
+	// parts during the execution (see executeParallel).
+	part          *parallelPart
+	parallelLimit chan struct{}
+
+	// loaders are the loaders of the template set pinned when the execution
+	// started (see SnapshotTemplateLoader), nil if none of them is a
+	// SnapshotTemplateLoader. Templates loaded at runtime use them.
+	loaders []TemplateLoader
 }
 
 var pongo2MetaContext = Context{
@@ -124,12 +142,18 @@ func newExecutionContext(tpl *Template, ctx Context) *ExecutionContext {
 // to create isolated scopes while maintaining access to the template's data.
 func NewChildExecutionContext(parent *ExecutionContext) *ExecutionContext {
 	newctx := &ExecutionContext{
-		template: parent.template,
+		template:    parent.template,
+		inheritance: parent.inheritance,
+		macroDepth:  parent.macroDepth,
 
 		Public:     parent.Public,
 		Private:    make(Context),
 		Autoescape: parent.Autoescape,
 		tagState:   parent.tagState,
+
+		part:          parent.part,
+		parallelLimit: parent.parallelLimit,
+		loaders:       parent.loaders,
 	}
 	newctx.Shared = parent.Shared
 
@@ -143,7 +167,19 @@ func (ctx *ExecutionContext) Error(msg string, token *Token) error {
 	return ctx.OrigError(errors.New(msg), token)
 }
 
+// errorOfKind works like Error, but sets the given kind on the returned error.
+func (ctx *ExecutionContext) errorOfKind(kind error, msg string, token *Token) error {
+	err := ctx.newError(errors.New(msg), token)
+	err.Kind = kind
+	return err
+}
+
 func (ctx *ExecutionContext) OrigError(err error, token *Token) error {
+	return ctx.newError(err, token)
+}
+
+// newError creates an execution *Error wrapping err at the token's position.
+func (ctx *ExecutionContext) newError(err error, token *Token) *Error {
 	filename := ctx.template.name
 	var line, col int
 	if token != nil {
@@ -164,6 +200,23 @@ func (ctx *ExecutionContext) OrigError(err error, token *Token) error {
 	}
 }
 
+// fieldNames returns the strategy to look up struct fields with (see
+// TemplateSet.FieldNames).
+func (ctx *ExecutionContext) fieldNames() FieldNames {
+	if ctx == nil || ctx.template == nil {
+		return 0
+	}
+	return ctx.template.set.FieldNames
+}
+
+// GetItem is Value.GetItem looking up struct fields using the strategy of
+// the template set (see TemplateSet.FieldNames), like templates do. Filters
+// depending on it are registered using TemplateSet.RegisterContextFilter.
+// A nil ctx looks up struct fields by their Go name and pongo2 tag only.
+func (ctx *ExecutionContext) GetItem(v, key *Value) *Value {
+	return v.getItem(key, ctx.fieldNames())
+}
+
 func (ctx *ExecutionContext) Logf(format string, args ...any) {
 	ctx.template.set.logf(format, args...)
 }
@@ -2,17 +2,126 @@ package pongo2
 
 import (
 	"bufio"
+	"cmp"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"slices"
+	"strings"
 )
 
+// Error kinds allow to handle errors programmatically without matching error
+// messages. Every *Error returned by pongo2 carries one of them in its Kind
+// field (if applicable) and matches it with errors.Is, for example:
+//
+//	tpl, err := set.FromFile(name)
+//	if errors.Is(err, pongo2.ErrTemplateNotFound) {
+//		http.NotFound(w, r)
+//		return
+//	}
+var (
+	// ErrSyntax is the kind of all lexer and parser errors caused by
+	// malformed template syntax.
+	ErrSyntax = errors.New("syntax error")
+
+	// ErrTemplateNotFound is the kind of errors returned when no loader of
+	// a template set can provide a requested template (FromFile, FromCache,
+	// {% include %}, {% extends %}, {% import %} or {% ssi %}).
+	ErrTemplateNotFound = errors.New("template not found")
+
+	// ErrTagNotFound is the kind of errors returned when a template uses a
+	// tag that isn't registered in its template set.
+	ErrTagNotFound = errors.New("tag not found")
+
+	// ErrFilterNotFound is the kind of errors returned when a filter is used
+	// or applied which isn't registered in its template set.
+	ErrFilterNotFound = errors.New("filter not found")
+
+	// ErrSandboxViolation is the kind of errors returned when a template uses
+	// a tag or a filter which was banned using BanTag or BanFilter.
+	ErrSandboxViolation = errors.New("sandbox violation")
+
+	// ErrDivisionByZero is the kind of errors returned when an expression
+	// divides by zero during execution.
+	ErrDivisionByZero = errors.New("division by zero")
+
+	// ErrIncomparable is the kind of errors returned when the operands of
+	// <, <=, > or >= can't be compared (e.g. a string and a number).
+	ErrIncomparable = errors.New("incomparable operands")
+
+	// ErrMacroRecursion is the kind of errors returned when macro calls are
+	// nested deeper than the maximum recursion depth.
+	ErrMacroRecursion = errors.New("maximum macro recursion depth reached")
+
+	// ErrStaleTemplate is the kind of errors returned when a serialized
+	// template can't be used because its sources changed or because it was
+	// serialized by another version of pongo2 or for a template set with
+	// other tags, filters or options (see FromSerialized).
+	ErrStaleTemplate = errors.New("serialized template is stale")
+)
+
+// TemplateNotFoundError is returned (wrapped in an *Error of kind
+// ErrTemplateNotFound) when none of a template set's loaders can provide a
+// template. It lists every loader together with the path it attempted and
+// the error it returned, which can be inspected using errors.Is (for
+// example with fs.ErrNotExist or fs.ErrPermission).
+type TemplateNotFoundError struct {
+	// Name is the template name as requested.
+	Name string
+
+	// Attempts contains one entry per loader in the order they were tried.
+	Attempts []LoaderAttempt
+}
+
+// LoaderAttempt describes a failed attempt of a loader to provide a template.
+type LoaderAttempt struct {
+	Loader TemplateLoader
+	Path   string
+	Err    error
+}
+
+// Error returns the requested name and the paths attempted by each loader.
+func (e *TemplateNotFoundError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "unable to resolve template '%s'", e.Name)
+	for i, attempt := range e.Attempts {
+		if i == 0 {
+			sb.WriteString(" (tried ")
+		} else {
+			sb.WriteString("; ")
+		}
+		fmt.Fprintf(&sb, "%T: '%s': %v", attempt.Loader, attempt.Path, attempt.Err)
+	}
+	if len(e.Attempts) > 0 {
+		sb.WriteString(")")
+	}
+	return sb.String()
+}
+
+// Unwrap returns the errors of all attempts for use with errors.Is and errors.As.
+func (e *TemplateNotFoundError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Attempts))
+	for _, attempt := range e.Attempts {
+		errs = append(errs, attempt.Err)
+	}
+	return errs
+}
+
+// Is reports true for ErrTemplateNotFound.
+func (e *TemplateNotFoundError) Is(target error) bool {
+	return target == ErrTemplateNotFound
+}
+
 // The Error type is being used to address an error during lexing, parsing or
 // execution. If you want to return an error object (for example in your own
 // tag or filter) fill this object with as much information as you have.
 // Make sure "Sender" is always given (if you're returning an error within
 // a filter, make Sender equals 'filter:yourfilter'; same goes for tags: 'tag:mytag').
 // It's okay if you only fill in ErrorMsg if you don't have any other details at hand.
+//
+// Kind optionally classifies the error using one of the Err* sentinel errors
+// (such as ErrTemplateNotFound); errors.Is(err, kind) reports true for it.
 type Error struct {
 	Template  *Template
 	Filename  string
@@ -21,6 +130,7 @@ type Error struct {
 	Token     *Token
 	Sender    string
 	OrigError error
+	Kind      error
 }
 
 // updateFromTokenIfNeeded updates the error with template and token information
@@ -58,6 +168,11 @@ func (e *Error) Unwrap() error {
 	return e.OrigError
 }
 
+// Is reports whether target is the error's Kind. It's used by errors.Is.
+func (e *Error) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
 // Returns a nice formatted error string.
 func (e *Error) Error() string {
 	s := "[Error"
@@ -78,6 +193,82 @@ func (e *Error) Error() string {
 	return s
 }
 
+// ErrorList is returned by the template compilation functions (FromString,
+// FromFile, FromCache, ...) when a template contains more than one problem.
+// The lexer and the parser resynchronize at the next {{ }} or {% %} boundary
+// after an error, so a single compilation reports every problem it can find,
+// sorted by their position in the template (errors without a position come
+// last).
+//
+// Use errors.As to retrieve the list. errors.As with a *Error target yields
+// the first error of the list. A template with exactly one problem still
+// returns that problem directly (usually a *Error), not a list.
+type ErrorList []*Error
+
+// Error returns all errors of the list, one per line.
+func (l ErrorList) Error() string {
+	msgs := make([]string, 0, len(l))
+	for _, e := range l {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the errors of the list for use with errors.Is and errors.As.
+func (l ErrorList) Unwrap() []error {
+	errs := make([]error, 0, len(l))
+	for _, e := range l {
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+// add appends err to the list. Nested lists are flattened and errors which
+// aren't of type *Error are wrapped into one using the given filename and sender.
+func (l ErrorList) add(filename, sender string, err error) ErrorList {
+	switch e := err.(type) {
+	case nil:
+		return l
+	case ErrorList:
+		return append(l, e...)
+	case *Error:
+		return append(l, e)
+	default:
+		return append(l, &Error{
+			Filename:  filename,
+			Sender:    sender,
+			OrigError: err,
+		})
+	}
+}
+
+// newCompileError combines the errors collected while compiling a template
+// into the error returned to the caller: nil if there are none, the error
+// itself if there is only one and an ErrorList otherwise. As the lexer and
+// the parser report their errors separately, the list is sorted by position.
+func newCompileError(filename string, errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	var list ErrorList
+	for _, err := range errs {
+		list = list.add(filename, "parser", err)
+	}
+	slices.SortStableFunc(list, func(a, b *Error) int {
+		if (a.Line <= 0) != (b.Line <= 0) {
+			if a.Line <= 0 {
+				return 1
+			}
+			return -1
+		}
+		return cmp.Or(cmp.Compare(a.Line, b.Line), cmp.Compare(a.Column, b.Column))
+	})
+	return list
+}
+
 // RawLine returns the affected line from the original template, if available.
 func (e *Error) RawLine() (line string, available bool, outErr error) {
 	if e.Line <= 0 || e.Filename == "<string>" {
@@ -3,6 +3,7 @@ package pongo2
 import (
 	"errors"
 	"os"
+	"strings"
 	"testing"
 	"testing/fstest"
 )
@@ -132,3 +133,193 @@ func TestErrorRawLine(t *testing.T) {
 		}
 	})
 }
+
+func TestErrorListRecovery(t *testing.T) {
+	set := NewSet("test", MustNewLocalFileSystemLoader(""))
+
+	tests := []struct {
+		name  string
+		tpl   string
+		lines []int
+	}{
+		{
+			name:  "parser errors",
+			tpl:   "{{ (1 - 1 }}\nok {{ name }}\n{{ 1|float: }}\n{% if %}{% endif %}",
+			lines: []int{1, 3, 4},
+		},
+		{
+			name:  "lexer errors",
+			tpl:   "{{ \"unclosed }}\nok\n{{ 'a\\q' }}{# broken\n#}",
+			lines: []int{1, 3, 3},
+		},
+		{
+			name:  "lexer and parser errors",
+			tpl:   "{{ \"unclosed }}\n{{ \"ok\"|nonexistent }}",
+			lines: []int{1, 2},
+		},
+		{
+			name:  "parser error before lexer error",
+			tpl:   "{{ (1 - 1 }}\nok\n{{ 'unclosed }}",
+			lines: []int{1, 3},
+		},
+		{
+			name:  "same line sorted by column",
+			tpl:   "{{ (1 }} {{ 'unclosed }}",
+			lines: []int{1, 1},
+		},
+		{
+			name:  "errors within blocks",
+			tpl:   "{% for x in xs %}\n{{ x| }}\n{% if (x %}{% endif %}\n{% endfor %}",
+			lines: []int{2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := set.FromString(tt.tpl)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			var list ErrorList
+			if !errors.As(err, &list) {
+				t.Fatalf("expected an ErrorList, got %T: %v", err, err)
+			}
+			if len(list) != len(tt.lines) {
+				t.Fatalf("got %d errors, want %d: %v", len(list), len(tt.lines), err)
+			}
+			for i, line := range tt.lines {
+				if list[i].Line != line {
+					t.Errorf("error %d: got line %d, want %d (%v)", i, list[i].Line, line, list[i])
+				}
+				if i > 0 && list[i-1].Line == line && list[i-1].Column > list[i].Column {
+					t.Errorf("error %d: column %d before column %d", i, list[i-1].Column, list[i].Column)
+				}
+			}
+
+			var first *Error
+			if !errors.As(err, &first) || first != list[0] {
+				t.Error("errors.As with *Error should yield the first error")
+			}
+			if got := strings.Count(err.Error(), "\n") + 1; got != len(tt.lines) {
+				t.Errorf("Error() should list every error on its own line, got %d lines", got)
+			}
+		})
+	}
+
+	t.Run("single error is not a list", func(t *testing.T) {
+		_, err := set.FromString("ok {{ (1 - 1 }} ok")
+		if _, ok := err.(*Error); !ok {
+			t.Fatalf("expected *Error, got %T: %v", err, err)
+		}
+	})
+
+	t.Run("valid template after errors is not reported", func(t *testing.T) {
+		_, err := set.FromString("{% if (1 %}a{% else %}b{% endif %}{{ x }}")
+		if _, ok := err.(*Error); !ok {
+			t.Fatalf("expected a single *Error, got %T: %v", err, err)
+		}
+	})
+}
+
+func TestErrorKinds(t *testing.T) {
+	newSet := func() *TemplateSet {
+		return NewSet("test", NewFSLoader(fstest.MapFS{
+			"macro.tpl": {Data: []byte("{% macro rec() %}{{ rec() }}{% endmacro %}{{ rec() }}")},
+		}))
+	}
+
+	compileTests := []struct {
+		name string
+		tpl  string
+		kind error
+	}{
+		{"lexer", `{{ "unclosed }}`, ErrSyntax},
+		{"parser", "{{ (1 - 1 }}", ErrSyntax},
+		{"tag not found", "{% nonexistent %}", ErrTagNotFound},
+		{"filter not found", "{{ 1|nonexistent }}", ErrFilterNotFound},
+		{"include not found", `{% include "missing.tpl" %}`, ErrTemplateNotFound},
+		{"extends not found", `{% extends "missing.tpl" %}`, ErrTemplateNotFound},
+		{"ssi not found", `{% ssi "missing.tpl" %}`, ErrTemplateNotFound},
+	}
+	for _, tt := range compileTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newSet().FromString(tt.tpl)
+			if !errors.Is(err, tt.kind) {
+				t.Fatalf("expected error of kind %v, got: %v", tt.kind, err)
+			}
+			var e *Error
+			if !errors.As(err, &e) || e.Kind != tt.kind {
+				t.Fatalf("expected *Error with Kind %v, got: %v", tt.kind, err)
+			}
+		})
+	}
+
+	t.Run("FromFile not found", func(t *testing.T) {
+		_, err := newSet().FromFile("missing.tpl")
+		if !errors.Is(err, ErrTemplateNotFound) {
+			t.Fatalf("expected ErrTemplateNotFound, got: %v", err)
+		}
+	})
+
+	t.Run("sandbox", func(t *testing.T) {
+		set := newSet()
+		if err := set.BanTag("lorem"); err != nil {
+			t.Fatal(err)
+		}
+		if err := set.BanFilter("upper"); err != nil {
+			t.Fatal(err)
+		}
+		for _, tpl := range []string{
+			"{% lorem %}",
+			"{{ 'a'|upper }}",
+			"{{ 'a'|lower|upper }}",
+			"{% filter upper %}a{% endfilter %}",
+		} {
+			_, err := set.FromString(tpl)
+			if !errors.Is(err, ErrSandboxViolation) {
+				t.Errorf("%s: expected ErrSandboxViolation, got: %v", tpl, err)
+			}
+		}
+	})
+
+	executionTests := []struct {
+		name string
+		tpl  string
+		kind error
+	}{
+		{"integer division", "{{ 1 / zero }}", ErrDivisionByZero},
+		{"float division", "{{ 1.5 / zero }}", ErrDivisionByZero},
+		{"modulo", "{{ 1 % zero }}", ErrDivisionByZero},
+		{"filter tag", "{% filter nonexistent %}a{% endfilter %}", ErrFilterNotFound},
+		{"macro recursion", `{% include "macro.tpl" %}`, ErrMacroRecursion},
+	}
+	for _, tt := range executionTests {
+		t.Run(tt.name, func(t *testing.T) {
+			tpl, err := newSet().FromString(tt.tpl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = tpl.Execute(Context{"zero": 0})
+			if !errors.Is(err, tt.kind) {
+				t.Fatalf("expected error of kind %v, got: %v", tt.kind, err)
+			}
+		})
+	}
+
+	t.Run("ApplyFilter", func(t *testing.T) {
+		if _, err := ApplyFilter("nonexistent", AsValue(1), nil); !errors.Is(err, ErrFilterNotFound) {
+			t.Errorf("expected ErrFilterNotFound, got: %v", err)
+		}
+		if _, err := newSet().ApplyFilter("nonexistent", AsValue(1), nil); !errors.Is(err, ErrFilterNotFound) {
+			t.Errorf("expected ErrFilterNotFound, got: %v", err)
+		}
+	})
+
+	t.Run("kinds don't match each other", func(t *testing.T) {
+		_, err := newSet().FromString("{% nonexistent %}")
+		if errors.Is(err, ErrSyntax) || errors.Is(err, ErrTemplateNotFound) {
+			t.Errorf("unexpected kind match: %v", err)
+		}
+	})
+}
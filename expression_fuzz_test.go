@@ -140,6 +140,9 @@ func FuzzExpressionParsing(f *testing.F) {
 			return
 		}
 
+		// The VM must evaluate compiled expressions like the expression tree
+		checkVMMatchesTree(t, expr, tpl, Context{})
+
 		// Execute with empty context
 		var buf bytes.Buffer
 		err = tpl.ExecuteWriter(Context{}, &buf)
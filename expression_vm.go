@@ -0,0 +1,562 @@
+package pongo2
+
+import (
+	"cmp"
+	"errors"
+	"math"
+)
+
+// compiledExpression is an expression compiled into instructions for the
+// expression VM (see vmProgram). The parser returns it for all expressions
+// containing operators; the expression tree is kept for FilterApplied,
+// GetPositionToken and serialization.
+type compiledExpression struct {
+	tree IEvaluator
+	prog *vmProgram
+}
+
+// compileExpression returns the compiled expression e, or e itself if it
+// doesn't contain any operators (the VM can't evaluate it faster then).
+func compileExpression(e IEvaluator) IEvaluator {
+	switch e.(type) {
+	case *compiledExpression, *nodeFilteredVariable, *variableResolver,
+		*stringResolver, *intResolver, *floatResolver, *boolResolver:
+		return e
+	}
+	return &compiledExpression{tree: e, prog: newVMProgram(e)}
+}
+
+func (expr *compiledExpression) Evaluate(ctx *ExecutionContext) (*Value, error) {
+	return expr.prog.run(ctx)
+}
+
+func (expr *compiledExpression) Execute(ctx *ExecutionContext, writer TemplateWriter) error {
+	return executeEvaluator(expr, ctx, writer)
+}
+
+func (expr *compiledExpression) FilterApplied(name string) bool {
+	return expr.tree.FilterApplied(name)
+}
+
+func (expr *compiledExpression) GetPositionToken() *Token {
+	return expr.tree.GetPositionToken()
+}
+
+func (expr *compiledExpression) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteEvaluator(expr.tree)
+	return nil
+}
+
+func (expr *compiledExpression) DecodeNode(dec *NodeDecoder) error {
+	expr.tree = dec.ReadEvaluator()
+	if dec.err != nil {
+		return nil
+	}
+	if expr.tree == nil {
+		return errSerializedCorrupt
+	}
+	expr.prog = newVMProgram(expr.tree)
+	return nil
+}
+
+type vmOp uint8
+
+const (
+	vmInt   vmOp = iota // push the int arg
+	vmFloat             // push floats[arg]
+	vmBool              // push arg != 0
+	vmConst             // push consts[arg]
+	vmEval              // push the result of evaluators[arg]
+	vmAnd               // jump to arg if the top is false, pop it otherwise
+	vmOr                // jump to arg if the top is true, pop it otherwise
+	vmNot               // negate the top
+	vmNeg               // negative sign on the top; tokens[arg] for errors
+	vmFail              // fail with failures[arg]
+	vmEqual             // binary operators: pop two values, push the result; tokens[arg] for errors
+	vmNotEqual
+	vmLess
+	vmLessEqual
+	vmGreater
+	vmGreaterEqual
+	vmIn
+	vmAdd
+	vmSub
+	vmMul
+	vmDiv
+	vmMod
+	vmPow
+)
+
+// binaryOperators are the binary operators by their token (except for "and"
+// and "or", which don't evaluate both operands).
+var binaryOperators = map[string]vmOp{
+	"==": vmEqual,
+	"!=": vmNotEqual,
+	"<>": vmNotEqual,
+	"<":  vmLess,
+	"<=": vmLessEqual,
+	">":  vmGreater,
+	">=": vmGreaterEqual,
+	"in": vmIn,
+	"+":  vmAdd,
+	"-":  vmSub,
+	"*":  vmMul,
+	"/":  vmDiv,
+	"%":  vmMod,
+	"^":  vmPow,
+}
+
+type vmInstr struct {
+	op  vmOp
+	arg int
+}
+
+// vmFailure is an error of an unimplemented operator, raised when the
+// instruction is executed just like the expression tree does.
+type vmFailure struct {
+	msg   string
+	token *Token
+}
+
+// vmProgram is an expression compiled into a flat list of instructions for
+// a stack machine. Evaluating it avoids the interface calls of the
+// expression tree, and ints, floats and bools computed by operators are only
+// converted to a *Value for the result (see vmSlot). The operators are
+// evaluated by the same functions as in the expression tree (see
+// evalOperator), and the evaluation order is the same. Operands which aren't
+// literals or operators, like variables and filter chains, are evaluated by
+// their node.
+type vmProgram struct {
+	code       []vmInstr
+	floats     []float64
+	consts     []*Value
+	evaluators []IEvaluator
+	tokens     []*Token
+	failures   []vmFailure
+	stackSize  int
+	depth      int
+}
+
+func newVMProgram(e IEvaluator) *vmProgram {
+	prog := &vmProgram{}
+	prog.compile(e)
+	return prog
+}
+
+func (prog *vmProgram) emit(op vmOp, arg int) int {
+	prog.code = append(prog.code, vmInstr{op: op, arg: arg})
+	return len(prog.code) - 1
+}
+
+// push emits an instruction which pushes a value.
+func (prog *vmProgram) push(op vmOp, arg int) {
+	prog.emit(op, arg)
+	prog.depth++
+	prog.stackSize = max(prog.stackSize, prog.depth)
+}
+
+// emitBinary emits the binary operator op with the given token, or fails
+// with msg if op isn't a binary operator.
+func (prog *vmProgram) emitBinary(op string, t *Token, msg string, msgToken *Token) {
+	binaryOp, ok := binaryOperators[op]
+	if !ok {
+		prog.fail(msg, msgToken)
+		return
+	}
+	prog.emit(binaryOp, prog.token(t))
+	prog.depth--
+}
+
+func (prog *vmProgram) token(t *Token) int {
+	prog.tokens = append(prog.tokens, t)
+	return len(prog.tokens) - 1
+}
+
+func (prog *vmProgram) fail(msg string, t *Token) {
+	prog.failures = append(prog.failures, vmFailure{msg: msg, token: t})
+	prog.emit(vmFail, len(prog.failures)-1)
+}
+
+func (prog *vmProgram) compile(e IEvaluator) {
+	switch e := e.(type) {
+	case *compiledExpression:
+		prog.compile(e.tree)
+	case *intResolver:
+		prog.push(vmInt, e.val)
+	case *floatResolver:
+		prog.floats = append(prog.floats, e.val)
+		prog.push(vmFloat, len(prog.floats)-1)
+	case *boolResolver:
+		if e.val {
+			prog.push(vmBool, 1)
+		} else {
+			prog.push(vmBool, 0)
+		}
+	case *stringResolver:
+		prog.consts = append(prog.consts, AsValue(e.val))
+		prog.push(vmConst, len(prog.consts)-1)
+	case *nodeFilteredVariable:
+		if len(e.filterChain) > 0 {
+			// Filter chains are evaluated faster by their node
+			prog.evaluators = append(prog.evaluators, e)
+			prog.push(vmEval, len(prog.evaluators)-1)
+			return
+		}
+		prog.compile(e.resolver)
+	case *Expression:
+		prog.compile(e.expr1)
+		if e.expr2 == nil {
+			return
+		}
+		var op vmOp
+		switch e.opToken.Val {
+		case "and", "&&":
+			op = vmAnd
+		case "or", "||":
+			op = vmOr
+		default:
+			prog.fail("unimplemented: "+e.opToken.Val, e.opToken)
+			return
+		}
+		jump := prog.emit(op, 0)
+		prog.depth--
+		prog.compile(e.expr2)
+		prog.code[jump].arg = len(prog.code)
+	case *relationalExpression:
+		prog.compile(e.expr1)
+		if e.expr2 == nil {
+			return
+		}
+		prog.compile(e.expr2)
+		prog.emitBinary(e.opToken.Val, e.opToken, "unimplemented: "+e.opToken.Val, e.opToken)
+	case *notExpression:
+		prog.compile(e.expr)
+		prog.emit(vmNot, 0)
+	case *simpleExpression:
+		prog.compile(e.term1)
+		if e.negativeSign {
+			prog.emit(vmNeg, prog.token(e.GetPositionToken()))
+		}
+		if e.term2 == nil {
+			return
+		}
+		prog.compile(e.term2)
+		prog.emitBinary(e.opToken.Val, e.opToken, "Unimplemented", e.GetPositionToken())
+	case *term:
+		prog.compile(e.factor1)
+		if e.factor2 == nil {
+			return
+		}
+		prog.compile(e.factor2)
+		prog.emitBinary(e.opToken.Val, e.factor2.GetPositionToken(), "unimplemented", e.opToken)
+	case *power:
+		prog.compile(e.power1)
+		if e.power2 == nil {
+			return
+		}
+		prog.compile(e.power2)
+		prog.emitBinary("^", nil, "", nil)
+	default:
+		prog.evaluators = append(prog.evaluators, e)
+		prog.push(vmEval, len(prog.evaluators)-1)
+	}
+}
+
+type vmSlotKind uint8
+
+const (
+	vmSlotValue vmSlotKind = iota
+	vmSlotInt
+	vmSlotFloat
+	vmSlotBool
+)
+
+// vmSlot is a value on the stack of the VM: either a *Value or an unboxed
+// int, float64 or bool stored in n. Its methods behave like the ones of
+// Value.
+type vmSlot struct {
+	kind vmSlotKind
+	n    uint64
+	v    *Value
+}
+
+func vmIntSlot(i int) vmSlot {
+	return vmSlot{kind: vmSlotInt, n: uint64(i)}
+}
+
+func vmFloatSlot(f float64) vmSlot {
+	return vmSlot{kind: vmSlotFloat, n: math.Float64bits(f)}
+}
+
+func vmBoolSlot(b bool) vmSlot {
+	if b {
+		return vmSlot{kind: vmSlotBool, n: 1}
+	}
+	return vmSlot{kind: vmSlotBool}
+}
+
+func (s *vmSlot) value() *Value {
+	switch s.kind {
+	case vmSlotInt:
+		return intValue(int(s.n))
+	case vmSlotFloat:
+		return floatValue(math.Float64frombits(s.n))
+	case vmSlotBool:
+		return boolValue(s.n != 0)
+	}
+	return s.v
+}
+
+func (s *vmSlot) isFloat() bool {
+	switch s.kind {
+	case vmSlotFloat:
+		return true
+	case vmSlotValue:
+		return s.v.IsFloat()
+	}
+	return false
+}
+
+func (s *vmSlot) isNumber() bool {
+	switch s.kind {
+	case vmSlotInt, vmSlotFloat:
+		return true
+	case vmSlotValue:
+		return s.v.IsNumber()
+	}
+	return false
+}
+
+func (s *vmSlot) isString() bool {
+	return s.kind == vmSlotValue && s.v.IsString()
+}
+
+func (s *vmSlot) isTime() bool {
+	return s.kind == vmSlotValue && s.v.IsTime()
+}
+
+func (s *vmSlot) isTrue() bool {
+	switch s.kind {
+	case vmSlotInt, vmSlotBool:
+		return s.n != 0
+	case vmSlotFloat:
+		return math.Float64frombits(s.n) != 0
+	}
+	return s.v.IsTrue()
+}
+
+func (s *vmSlot) integer() int {
+	switch s.kind {
+	case vmSlotInt:
+		return int(s.n)
+	case vmSlotFloat:
+		return int(math.Float64frombits(s.n))
+	}
+	return s.value().Integer()
+}
+
+func (s *vmSlot) float() float64 {
+	switch s.kind {
+	case vmSlotInt:
+		return float64(int(s.n))
+	case vmSlotFloat:
+		return math.Float64frombits(s.n)
+	}
+	return s.value().Float()
+}
+
+func (s *vmSlot) negate() vmSlot {
+	switch s.kind {
+	case vmSlotInt:
+		if s.n != 0 {
+			return vmIntSlot(0)
+		}
+		return vmIntSlot(1)
+	case vmSlotFloat:
+		if s.float() != 0 {
+			return vmFloatSlot(0)
+		}
+		return vmFloatSlot(1)
+	case vmSlotBool:
+		return vmBoolSlot(s.n == 0)
+	}
+	return vmSlot{v: s.v.Negate()}
+}
+
+// equal works like Value.EqualValueTo.
+func (s *vmSlot) equal(other *vmSlot) bool {
+	if s.kind != vmSlotValue && s.kind != vmSlotBool && other.kind != vmSlotValue && other.kind != vmSlotBool {
+		if s.kind == vmSlotFloat || other.kind == vmSlotFloat {
+			return s.float() == other.float()
+		}
+		return s.n == other.n
+	}
+	return s.value().EqualValueTo(other.value())
+}
+
+// vmCompare evaluates the ordering operator op like relationalExpression
+// (see compareValues). Unboxed numbers are compared directly.
+func vmCompare(op vmOp, a, b *vmSlot) (bool, error) {
+	var c int
+	switch {
+	case a.kind == vmSlotInt && b.kind == vmSlotInt:
+		c = cmp.Compare(a.integer(), b.integer())
+	case (a.kind == vmSlotInt || a.kind == vmSlotFloat) && (b.kind == vmSlotInt || b.kind == vmSlotFloat):
+		if math.IsNaN(a.float()) || math.IsNaN(b.float()) {
+			return false, nil
+		}
+		c = cmp.Compare(a.float(), b.float())
+	default:
+		var err error
+		if c, err = compareValues(a.value(), b.value()); errors.Is(err, errUnordered) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+	}
+	switch op {
+	case vmLess:
+		return c < 0, nil
+	case vmLessEqual:
+		return c <= 0, nil
+	case vmGreater:
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+// vmStackSize is the stack size of the VM which doesn't need an allocation.
+const vmStackSize = 8
+
+func (prog *vmProgram) run(ctx *ExecutionContext) (*Value, error) {
+	var buf [vmStackSize]vmSlot
+	stack := buf[:0]
+	if prog.stackSize > vmStackSize {
+		stack = make([]vmSlot, 0, prog.stackSize)
+	}
+
+	for pc := 0; pc < len(prog.code); pc++ {
+		instr := prog.code[pc]
+		switch instr.op {
+		case vmInt:
+			stack = append(stack, vmIntSlot(instr.arg))
+		case vmFloat:
+			stack = append(stack, vmFloatSlot(prog.floats[instr.arg]))
+		case vmBool:
+			stack = append(stack, vmBoolSlot(instr.arg != 0))
+		case vmConst:
+			stack = append(stack, vmSlot{v: prog.consts[instr.arg]})
+		case vmEval:
+			v, err := prog.evaluators[instr.arg].Evaluate(ctx)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, vmSlot{v: v})
+		case vmAnd:
+			if !stack[len(stack)-1].isTrue() {
+				pc = instr.arg - 1
+				continue
+			}
+			stack = stack[:len(stack)-1]
+		case vmOr:
+			if stack[len(stack)-1].isTrue() {
+				pc = instr.arg - 1
+				continue
+			}
+			stack = stack[:len(stack)-1]
+		case vmNot:
+			top := &stack[len(stack)-1]
+			*top = top.negate()
+		case vmNeg:
+			top := &stack[len(stack)-1]
+			result, err := negativeSign(top, prog.tokens[instr.arg], ctx)
+			if err != nil {
+				return nil, err
+			}
+			*top = result
+		case vmFail:
+			failure := prog.failures[instr.arg]
+			return nil, ctx.Error(failure.msg, failure.token)
+		default:
+			a, b := &stack[len(stack)-2], &stack[len(stack)-1]
+			result, err := evalOperator(instr.op, a, b, prog.tokens[instr.arg], ctx)
+			if err != nil {
+				return nil, err
+			}
+			stack = stack[:len(stack)-1]
+			stack[len(stack)-1] = result
+		}
+	}
+	return stack[len(stack)-1].value(), nil
+}
+
+// negativeSign evaluates the negative sign on a. t is the token for errors.
+func negativeSign(a *vmSlot, t *Token, ctx *ExecutionContext) (vmSlot, error) {
+	if !a.isNumber() {
+		return vmSlot{}, ctx.Error("Negative sign on a non-number expression", t)
+	}
+	if a.isFloat() {
+		return vmFloatSlot(-1 * a.float()), nil
+	}
+	return vmIntSlot(-1 * a.integer()), nil
+}
+
+// evalOperator evaluates the binary operator op (see binaryOperators) on
+// a and b. t is the token for errors. It's used by both the VM and the
+// expression tree, so they share the semantics of the operators.
+func evalOperator(op vmOp, a, b *vmSlot, t *Token, ctx *ExecutionContext) (vmSlot, error) {
+	switch op {
+	case vmEqual:
+		return vmBoolSlot(a.equal(b)), nil
+	case vmNotEqual:
+		return vmBoolSlot(!a.equal(b)), nil
+	case vmLess, vmLessEqual, vmGreater, vmGreaterEqual:
+		result, err := vmCompare(op, a, b)
+		if err != nil {
+			return vmSlot{}, ctx.errorOfKind(ErrIncomparable, err.Error(), t)
+		}
+		return vmBoolSlot(result), nil
+	case vmIn:
+		return vmBoolSlot(b.value().contains(a.value(), ctx.fieldNames())), nil
+	case vmAdd:
+		if a.isString() || b.isString() {
+			return vmSlot{v: AsValue(a.value().String() + b.value().String())}, nil
+		}
+		if a.isFloat() || b.isFloat() {
+			return vmFloatSlot(a.float() + b.float()), nil
+		}
+		return vmIntSlot(a.integer() + b.integer()), nil
+	case vmSub:
+		if a.isFloat() || b.isFloat() {
+			return vmFloatSlot(a.float() - b.float()), nil
+		}
+		return vmIntSlot(a.integer() - b.integer()), nil
+	case vmMul:
+		if a.isFloat() || b.isFloat() {
+			return vmFloatSlot(a.float() * b.float()), nil
+		}
+		return vmIntSlot(a.integer() * b.integer()), nil
+	case vmDiv:
+		if a.isFloat() || b.isFloat() {
+			divisor := b.float()
+			if divisor == 0 {
+				return vmSlot{}, ctx.errorOfKind(ErrDivisionByZero, "float divide by zero", t)
+			}
+			return vmFloatSlot(a.float() / divisor), nil
+		}
+		divisor := b.integer()
+		if divisor == 0 {
+			return vmSlot{}, ctx.errorOfKind(ErrDivisionByZero, "integer divide by zero", t)
+		}
+		return vmIntSlot(a.integer() / divisor), nil
+	case vmMod:
+		divisor := b.integer()
+		if divisor == 0 {
+			return vmSlot{}, ctx.errorOfKind(ErrDivisionByZero, "integer divide by zero", t)
+		}
+		return vmIntSlot(a.integer() % divisor), nil
+	default: // vmPow
+		return vmFloatSlot(math.Pow(a.float(), b.float())), nil
+	}
+}
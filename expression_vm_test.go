@@ -0,0 +1,201 @@
+package pongo2
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// checkVMMatchesTree evaluates the expressions of tpl's variable nodes using
+// the VM and the expression tree and reports differences for name.
+func checkVMMatchesTree(t *testing.T, name string, tpl *Template, context Context) {
+	t.Helper()
+	ctx := newExecutionContext(tpl, context)
+	for _, node := range tpl.root.Nodes {
+		nv, ok := node.(*nodeVariable)
+		if !ok {
+			continue
+		}
+		expr, ok := nv.expr.(*compiledExpression)
+		if !ok {
+			continue
+		}
+		got, gotErr := expr.Evaluate(ctx)
+		want, wantErr := expr.tree.Evaluate(ctx)
+		if fmt.Sprint(gotErr) != fmt.Sprint(wantErr) {
+			t.Errorf("%s: VM error = %v; tree error = %v", name, gotErr, wantErr)
+			continue
+		}
+		if gotErr != nil {
+			continue
+		}
+		gotVal, wantVal := got.reflectValue(), want.reflectValue()
+		if got.safe != want.safe || gotVal.Kind() != wantVal.Kind() ||
+			(gotVal.IsValid() && gotVal.Type() != wantVal.Type()) ||
+			got.String() != want.String() {
+			t.Errorf("%s: VM = %#v (%s); tree = %#v (%s)", name, got.Interface(), got.String(), want.Interface(), want.String())
+		}
+	}
+}
+
+var vmTestContext = Context{
+	"i":     7,
+	"zero":  0,
+	"u":     uint8(3),
+	"big":   uint64(1 << 63),
+	"f":     2.5,
+	"s":     "abc",
+	"num":   "12",
+	"empty": "",
+	"t":     true,
+	"no":    false,
+	"list":  []int{1, 2, 3},
+	"m":     map[string]int{"a": 1},
+	"now":   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	"later": time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+	"nil":   nil,
+	"html":  "<b>",
+}
+
+func TestExpressionVM(t *testing.T) {
+	exprs := []string{
+		"1 + 2 * 3 - 4 / 2 % 3",
+		"i * f + u - big",
+		"-i + f",
+		"-f - 1",
+		"i ^ 2 + 2 ^ 0.5",
+		"i / zero",
+		"f / 0",
+		"i % zero",
+		"-s",
+		"-(i > 1)",
+		"s + i + f + t",
+		"num + 1",
+		"num * 2",
+		"i == 7.0 and u == 3 and s == 'abc'",
+		"i != f or nil == nil",
+		"nil == zero",
+		"t == 1",
+		"(i > 1) == (f > 1)",
+		"(1 > 2) + 1",
+		"i < f",
+		"i <= u",
+		"i > big",
+		"f >= i",
+		"now < later and later >= now and now <= now and not (now > later)",
+		"s < 'b'",
+		"'b' in s and 2 in list and 'a' in m and not (4 in list)",
+		"not i and not empty or not list",
+		"zero or empty or no or f",
+		"i and s and list",
+		"no and i / zero",
+		"t or i / zero",
+		"not not not f",
+		"not 0.0",
+		"s|upper + html",
+		"html|safe + html|safe",
+		"html + 1",
+		"i|add:2 * 2",
+		"list.1 + 1",
+		"1.5 * 2 == 3",
+		"2 ^ 62 + 1",
+		"(((i))) + 0",
+	}
+	set := NewSet("vm", &DummyLoader{})
+	for _, expr := range exprs {
+		tpl, err := set.FromString("{{ " + expr + " }}")
+		if err != nil {
+			t.Fatalf("%s: %v", expr, err)
+		}
+		if _, ok := tpl.root.Nodes[0].(*nodeVariable).expr.(*compiledExpression); !ok {
+			t.Errorf("%s: expected expression to be compiled", expr)
+		}
+		checkVMMatchesTree(t, expr, tpl, vmTestContext)
+	}
+
+	t.Run("stack", func(t *testing.T) {
+		expr := "1"
+		for i := range 2 * vmStackSize {
+			expr = fmt.Sprintf("%d + (%s)", i, expr)
+		}
+		tpl, err := set.FromString("{{ " + expr + " }}")
+		if err != nil {
+			t.Fatal(err)
+		}
+		prog := tpl.root.Nodes[0].(*nodeVariable).expr.(*compiledExpression).prog
+		if prog.stackSize <= vmStackSize {
+			t.Errorf("expected stack size > %d, got %d", vmStackSize, prog.stackSize)
+		}
+		checkVMMatchesTree(t, expr, tpl, nil)
+	})
+
+	t.Run("filter chains", func(t *testing.T) {
+		tpl, err := set.FromString("{{ s|upper + 1 }}")
+		if err != nil {
+			t.Fatal(err)
+		}
+		prog := tpl.root.Nodes[0].(*nodeVariable).expr.(*compiledExpression).prog
+		want := []vmInstr{{op: vmEval}, {op: vmInt, arg: 1}, {op: vmAdd}}
+		if !reflect.DeepEqual(prog.code, want) {
+			t.Errorf("expected the filter chain to be evaluated by its node, got %v", prog.code)
+		}
+	})
+
+	t.Run("serialized", func(t *testing.T) {
+		tpl, err := set.FromString("{{ i * 2 + 1 }}")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := tpl.Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := set.FromSerialized(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := decoded.Execute(Context{"i": 3}); err != nil || got != "7" {
+			t.Errorf("Execute = %q, %v; want 7", got, err)
+		}
+		if !reflect.DeepEqual(decoded.root.Nodes[0].(*nodeVariable).expr.(*compiledExpression).prog.code,
+			tpl.root.Nodes[0].(*nodeVariable).expr.(*compiledExpression).prog.code) {
+			t.Error("expected the decoded expression to be compiled again")
+		}
+	})
+}
+
+func benchmarkExpression(b *testing.B, expr string, evaluate func(*compiledExpression, *ExecutionContext) (*Value, error)) {
+	tpl, err := NewSet("vm", &DummyLoader{}).FromString("{{ " + expr + " }}")
+	if err != nil {
+		b.Fatal(err)
+	}
+	compiled := tpl.root.Nodes[0].(*nodeVariable).expr.(*compiledExpression)
+	ctx := newExecutionContext(tpl, Context{"a": 3, "b": 4.5, "items": []int{1, 2, 3}, "name": "pongo2"})
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := evaluate(compiled, ctx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExpression(b *testing.B) {
+	exprs := map[string]string{
+		"arithmetic": "a * 2 + b / 3 - 1",
+		"condition":  "a > 1 and b < 10 or not items",
+		"filters":    "name|upper|length + a",
+	}
+	for name, expr := range exprs {
+		b.Run(name+"/vm", func(b *testing.B) {
+			benchmarkExpression(b, expr, func(e *compiledExpression, ctx *ExecutionContext) (*Value, error) {
+				return e.Evaluate(ctx)
+			})
+		})
+		b.Run(name+"/tree", func(b *testing.B) {
+			benchmarkExpression(b, expr, func(e *compiledExpression, ctx *ExecutionContext) (*Value, error) {
+				return e.tree.Evaluate(ctx)
+			})
+		})
+	}
+}
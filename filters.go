@@ -8,11 +8,29 @@ import (
 // FilterFunction is the type filter functions must fulfil
 type FilterFunction func(in *Value, param *Value) (out *Value, err error)
 
-var builtinFilters = make(map[string]FilterFunction)
+// ContextFilterFunction is the type of filter functions depending on the
+// execution context, for example looking up struct fields using the
+// strategy of the template set (see ExecutionContext.GetItem). ctx is nil if
+// the filter is applied outside of a template execution (see ApplyFilter).
+type ContextFilterFunction func(ctx *ExecutionContext, in *Value, param *Value) (out *Value, err error)
+
+// withoutContext adapts fn to a ContextFilterFunction ignoring the context.
+// All filters are stored as ContextFilterFunctions.
+func withoutContext(fn FilterFunction) ContextFilterFunction {
+	return func(_ *ExecutionContext, in *Value, param *Value) (*Value, error) {
+		return fn(in, param)
+	}
+}
+
+var builtinFilters = make(map[string]ContextFilterFunction)
+
+// builtinPureFilters contains the names of the builtin filters which are
+// pure (see TemplateSet.RegisterPureFilter).
+var builtinPureFilters = make(map[string]bool)
 
 // copyFilters creates a shallow copy of a filter map.
-func copyFilters(src map[string]FilterFunction) map[string]FilterFunction {
-	dst := make(map[string]FilterFunction, len(src))
+func copyFilters(src map[string]ContextFilterFunction) map[string]ContextFilterFunction {
+	dst := make(map[string]ContextFilterFunction, len(src))
 	maps.Copy(dst, src)
 	return dst
 }
@@ -33,7 +51,7 @@ func BuiltinTagExists(name string) bool {
 
 // registerFilterBuiltin registers a new filter to the global filter map.
 // This is used during package initialization to register builtin filters.
-func registerFilterBuiltin(name string, fn FilterFunction) error {
+func registerFilterBuiltin(name string, fn ContextFilterFunction) error {
 	if BuiltinFilterExists(name) {
 		return fmt.Errorf("filter with name '%s' is already registered", name)
 	}
@@ -60,6 +78,7 @@ func ApplyFilter(name string, value *Value, param *Value) (*Value, error) {
 		return nil, &Error{
 			Sender:    "applyfilter",
 			OrigError: fmt.Errorf("filter with name '%s' not found", name),
+			Kind:      ErrFilterNotFound,
 		}
 	}
 
@@ -68,7 +87,7 @@ func ApplyFilter(name string, value *Value, param *Value) (*Value, error) {
 		param = AsValue(nil)
 	}
 
-	return fn(value, param)
+	return fn(nil, value, param)
 }
 
 type filterCall struct {
@@ -77,7 +96,8 @@ type filterCall struct {
 	name      string
 	parameter IEvaluator
 
-	filterFunc FilterFunction
+	filterFunc ContextFilterFunction
+	pure       bool // see TemplateSet.RegisterPureFilter
 }
 
 func (fc *filterCall) Execute(v *Value, ctx *ExecutionContext) (*Value, error) {
@@ -92,8 +112,12 @@ func (fc *filterCall) Execute(v *Value, ctx *ExecutionContext) (*Value, error) {
 	} else {
 		param = AsValue(nil)
 	}
+	return fc.apply(v, param, ctx)
+}
 
-	filteredValue, err := fc.filterFunc(v, param)
+// apply applies the filter to v using the evaluated parameter param.
+func (fc *filterCall) apply(v, param *Value, ctx *ExecutionContext) (*Value, error) {
+	filteredValue, err := fc.filterFunc(ctx, v, param)
 	if err != nil {
 		return nil, updateErrorToken(err, ctx.template, fc.token)
 	}
@@ -116,16 +140,18 @@ func (p *Parser) parseFilter() (*filterCall, error) {
 
 	// Check sandbox filter restriction
 	if _, isBanned := p.template.set.bannedFilters[identToken.Val]; isBanned {
-		return nil, p.Error(fmt.Sprintf("Usage of filter '%s' is not allowed (sandbox restriction active).", identToken.Val), identToken)
+		return nil, p.errorOfKind(ErrSandboxViolation,
+			fmt.Sprintf("Usage of filter '%s' is not allowed (sandbox restriction active).", identToken.Val), identToken)
 	}
 
 	// Get the appropriate filter function and bind it
 	filterFn, exists := p.template.set.filters[identToken.Val]
 	if !exists {
-		return nil, p.Error(fmt.Sprintf("Filter '%s' does not exist.", identToken.Val), identToken)
+		return nil, p.errorOfKind(ErrFilterNotFound, fmt.Sprintf("Filter '%s' does not exist.", identToken.Val), identToken)
 	}
 
 	filter.filterFunc = filterFn
+	filter.pure = p.template.set.pureFilters[identToken.Val]
 
 	// Check for filter-argument (2 tokens needed: ':' ARG)
 	if p.Match(TokenSymbol, ":") != nil {
@@ -143,3 +169,26 @@ func (p *Parser) parseFilter() (*filterCall, error) {
 
 	return filter, nil
 }
+
+// encode writes the filter call. The filter function is looked up by name
+// again when decoding it (see decodeFilterCall).
+func (fc *filterCall) encode(enc *NodeEncoder) {
+	enc.WriteToken(fc.token)
+	enc.WriteString(fc.name)
+	enc.WriteEvaluator(fc.parameter)
+}
+
+// decodeFilterCall reads a filter call written by filterCall.encode.
+func decodeFilterCall(dec *NodeDecoder) *filterCall {
+	fc := &filterCall{
+		token:     dec.ReadToken(),
+		name:      dec.ReadString(),
+		parameter: dec.ReadEvaluator(),
+	}
+	fc.filterFunc = dec.set.filters[fc.name]
+	fc.pure = dec.set.pureFilters[fc.name]
+	if fc.filterFunc == nil && dec.err == nil {
+		dec.fail(fmt.Errorf("filter '%s' does not exist", fc.name))
+	}
+	return fc
+}
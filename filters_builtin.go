@@ -117,11 +117,24 @@ import (
 )
 
 func mustRegisterFilter(name string, fn FilterFunction) {
+	mustRegisterContextFilter(name, withoutContext(fn))
+}
+
+// mustRegisterContextFilter registers a builtin filter depending on the
+// execution context (see ContextFilterFunction).
+func mustRegisterContextFilter(name string, fn ContextFilterFunction) {
 	if err := registerFilterBuiltin(name, fn); err != nil {
 		panic(err)
 	}
 }
 
+// mustRegisterPureFilter registers a builtin filter whose output depends on
+// its input and parameter only (see TemplateSet.RegisterPureFilter).
+func mustRegisterPureFilter(name string, fn FilterFunction) {
+	mustRegisterFilter(name, fn)
+	builtinPureFilters[name] = true
+}
+
 // htmlEscapeReplacer is a pre-compiled replacer for HTML escaping.
 // Using a single Replacer is more efficient than multiple strings.Replace calls
 // because it processes the string in a single pass.
@@ -163,69 +176,69 @@ var addslashesReplacer = strings.NewReplacer(
 )
 
 func init() {
-	mustRegisterFilter("escape", filterEscape)
-	mustRegisterFilter("e", filterEscape) // alias of `escape`
-	mustRegisterFilter("safe", filterSafe)
-	mustRegisterFilter("escapejs", filterEscapejs)
-
-	mustRegisterFilter("add", filterAdd)
-	mustRegisterFilter("addslashes", filterAddslashes)
-	mustRegisterFilter("capfirst", filterCapfirst)
-	mustRegisterFilter("center", filterCenter)
-	mustRegisterFilter("cut", filterCut)
-	mustRegisterFilter("date", filterDate)
-	mustRegisterFilter("default", filterDefault)
-	mustRegisterFilter("default_if_none", filterDefaultIfNone)
-	mustRegisterFilter("divisibleby", filterDivisibleby)
-	mustRegisterFilter("first", filterFirst)
-	mustRegisterFilter("floatformat", filterFloatformat)
-	mustRegisterFilter("get_digit", filterGetdigit)
-	mustRegisterFilter("iriencode", filterIriencode)
-	mustRegisterFilter("join", filterJoin)
-	mustRegisterFilter("last", filterLast)
-	mustRegisterFilter("length", filterLength)
-	mustRegisterFilter("length_is", filterLengthis)
-	mustRegisterFilter("linebreaks", filterLinebreaks)
-	mustRegisterFilter("linebreaksbr", filterLinebreaksbr)
-	mustRegisterFilter("linenumbers", filterLinenumbers)
-	mustRegisterFilter("ljust", filterLjust)
-	mustRegisterFilter("lower", filterLower)
-	mustRegisterFilter("make_list", filterMakelist)
-	mustRegisterFilter("phone2numeric", filterPhone2numeric)
-	mustRegisterFilter("pluralize", filterPluralize)
+	mustRegisterPureFilter("escape", filterEscape)
+	mustRegisterPureFilter("e", filterEscape) // alias of `escape`
+	mustRegisterPureFilter("safe", filterSafe)
+	mustRegisterPureFilter("escapejs", filterEscapejs)
+
+	mustRegisterPureFilter("add", filterAdd)
+	mustRegisterPureFilter("addslashes", filterAddslashes)
+	mustRegisterPureFilter("capfirst", filterCapfirst)
+	mustRegisterPureFilter("center", filterCenter)
+	mustRegisterPureFilter("cut", filterCut)
+	mustRegisterPureFilter("date", filterDate)
+	mustRegisterPureFilter("default", filterDefault)
+	mustRegisterPureFilter("default_if_none", filterDefaultIfNone)
+	mustRegisterPureFilter("divisibleby", filterDivisibleby)
+	mustRegisterPureFilter("first", filterFirst)
+	mustRegisterPureFilter("floatformat", filterFloatformat)
+	mustRegisterPureFilter("get_digit", filterGetdigit)
+	mustRegisterPureFilter("iriencode", filterIriencode)
+	mustRegisterPureFilter("join", filterJoin)
+	mustRegisterPureFilter("last", filterLast)
+	mustRegisterPureFilter("length", filterLength)
+	mustRegisterPureFilter("length_is", filterLengthis)
+	mustRegisterPureFilter("linebreaks", filterLinebreaks)
+	mustRegisterPureFilter("linebreaksbr", filterLinebreaksbr)
+	mustRegisterPureFilter("linenumbers", filterLinenumbers)
+	mustRegisterPureFilter("ljust", filterLjust)
+	mustRegisterPureFilter("lower", filterLower)
+	mustRegisterPureFilter("make_list", filterMakelist)
+	mustRegisterPureFilter("phone2numeric", filterPhone2numeric)
+	mustRegisterPureFilter("pluralize", filterPluralize)
 	mustRegisterFilter("random", filterRandom)
-	mustRegisterFilter("removetags", filterRemovetags)
-	mustRegisterFilter("rjust", filterRjust)
-	mustRegisterFilter("slice", filterSlice)
-	mustRegisterFilter("split", filterSplit)
-	mustRegisterFilter("stringformat", filterStringformat)
-	mustRegisterFilter("striptags", filterStriptags)
-	mustRegisterFilter("time", filterDate) // time uses filterDate (same golang-format)
-	mustRegisterFilter("title", filterTitle)
-	mustRegisterFilter("truncatechars", filterTruncatechars)
-	mustRegisterFilter("truncatechars_html", filterTruncatecharsHTML)
-	mustRegisterFilter("truncatewords", filterTruncatewords)
-	mustRegisterFilter("truncatewords_html", filterTruncatewordsHTML)
-	mustRegisterFilter("upper", filterUpper)
-	mustRegisterFilter("urlencode", filterUrlencode)
-	mustRegisterFilter("urlize", filterUrlize)
-	mustRegisterFilter("urlizetrunc", filterUrlizetrunc)
-	mustRegisterFilter("wordcount", filterWordcount)
-	mustRegisterFilter("wordwrap", filterWordwrap)
-	mustRegisterFilter("yesno", filterYesno)
+	mustRegisterPureFilter("removetags", filterRemovetags)
+	mustRegisterPureFilter("rjust", filterRjust)
+	mustRegisterPureFilter("slice", filterSlice)
+	mustRegisterPureFilter("split", filterSplit)
+	mustRegisterPureFilter("stringformat", filterStringformat)
+	mustRegisterPureFilter("striptags", filterStriptags)
+	mustRegisterPureFilter("time", filterDate) // time uses filterDate (same golang-format)
+	mustRegisterPureFilter("title", filterTitle)
+	mustRegisterPureFilter("truncatechars", filterTruncatechars)
+	mustRegisterPureFilter("truncatechars_html", filterTruncatecharsHTML)
+	mustRegisterPureFilter("truncatewords", filterTruncatewords)
+	mustRegisterPureFilter("truncatewords_html", filterTruncatewordsHTML)
+	mustRegisterPureFilter("upper", filterUpper)
+	mustRegisterPureFilter("urlencode", filterUrlencode)
+	mustRegisterPureFilter("urlize", filterUrlize)
+	mustRegisterPureFilter("urlizetrunc", filterUrlizetrunc)
+	mustRegisterPureFilter("wordcount", filterWordcount)
+	mustRegisterPureFilter("wordwrap", filterWordwrap)
+	mustRegisterPureFilter("yesno", filterYesno)
 	mustRegisterFilter("timesince", filterTimesince)
 	mustRegisterFilter("timeuntil", filterTimeuntil)
-	mustRegisterFilter("dictsort", filterDictsort)
-	mustRegisterFilter("dictsortreversed", filterDictsortReversed)
-	mustRegisterFilter("unordered_list", filterUnorderedList)
-	mustRegisterFilter("slugify", filterSlugify)
-	mustRegisterFilter("filesizeformat", filterFilesizeformat)
-	mustRegisterFilter("safeseq", filterSafeseq)
-	mustRegisterFilter("escapeseq", filterEscapeseq)
-	mustRegisterFilter("json_script", filterJSONScript)
+	mustRegisterContextFilter("dictsort", filterDictsort)
+	mustRegisterContextFilter("dictsortreversed", filterDictsortReversed)
+	mustRegisterPureFilter("unordered_list", filterUnorderedList)
+	mustRegisterPureFilter("slugify", filterSlugify)
+	mustRegisterPureFilter("filesizeformat", filterFilesizeformat)
+	mustRegisterPureFilter("safeseq", filterSafeseq)
+	mustRegisterPureFilter("escapeseq", filterEscapeseq)
+	mustRegisterPureFilter("json_script", filterJSONScript)
 
-	mustRegisterFilter("float", filterFloat)     // pongo-specific
-	mustRegisterFilter("integer", filterInteger) // pongo-specific
+	mustRegisterPureFilter("float", filterFloat)     // pongo-specific
+	mustRegisterPureFilter("integer", filterInteger) // pongo-specific
 }
 
 const ellipsis = "…"
@@ -732,7 +745,8 @@ func filterCut(in *Value, param *Value) (*Value, error) {
 }
 
 // filterLength returns the length of the value. Works with strings (character count),
-// slices, arrays, and maps.
+// slices, arrays, and maps. Range-over-func iterators and channels aren't consumed;
+// their length is 0 unless they implement PongoLener.
 //
 // Usage with strings:
 //
@@ -832,7 +846,19 @@ func filterDivisibleby(in *Value, param *Value) (*Value, error) {
 //	{{ "Hello"|first }}
 //
 // Output: "H"
+//
+// Iterators and channels are consumed up to their first item.
 func filterFirst(in *Value, param *Value) (*Value, error) {
+	if in.isSeq() {
+		first := AsValue("")
+		if rv := in.getResolvedValue(); !rv.IsNil() {
+			rangeSeq(rv, func(key, value *Value) bool {
+				first = key
+				return false
+			})
+		}
+		return first, nil
+	}
 	if in.CanSlice() && in.Len() > 0 {
 		return in.Index(0), nil
 	}
@@ -996,7 +1022,20 @@ func filterIriencode(in *Value, param *Value) (*Value, error) {
 //	{{ "abc"|join:"-" }}
 //
 // Output: "a-b-c"
+//
+// Iterators and channels are joined while consuming them.
 func filterJoin(in *Value, param *Value) (*Value, error) {
+	if in.isSeq() {
+		var sb strings.Builder
+		in.Iterate(func(idx, count int, key, value *Value) bool {
+			if idx > 0 {
+				sb.WriteString(param.String())
+			}
+			sb.WriteString(key.String())
+			return true
+		}, func() {})
+		return AsValue(sb.String()), nil
+	}
 	if !in.CanSlice() {
 		return in, nil
 	}
@@ -1038,7 +1077,17 @@ func filterJoin(in *Value, param *Value) (*Value, error) {
 //	{{ "Hello"|last }}
 //
 // Output: "o"
+//
+// Iterators and channels are consumed entirely.
 func filterLast(in *Value, param *Value) (*Value, error) {
+	if in.isSeq() {
+		last := AsValue("")
+		in.Iterate(func(idx, count int, key, value *Value) bool {
+			last = key
+			return true
+		}, func() {})
+		return last, nil
+	}
 	if in.CanSlice() && in.Len() > 0 {
 		return in.Index(in.Len() - 1), nil
 	}
@@ -2199,9 +2248,10 @@ func isLeapYear(year int) bool {
 //	{{ items|dictsort:"name" }}
 //
 // For a list of maps, this sorts by the value of the specified key.
-// For a list of structs, this sorts by the specified field name.
-func filterDictsort(in *Value, param *Value) (*Value, error) {
-	return dictsortHelper(in, param, false)
+// For a list of structs, this sorts by the specified field, which is looked
+// up using the strategy of the template set (see TemplateSet.FieldNames).
+func filterDictsort(ctx *ExecutionContext, in *Value, param *Value) (*Value, error) {
+	return dictsortHelper(ctx, in, param, false)
 }
 
 // filterDictsortReversed sorts a list of maps or structs by the specified key in reverse order.
@@ -2209,31 +2259,27 @@ func filterDictsort(in *Value, param *Value) (*Value, error) {
 // Usage:
 //
 //	{{ items|dictsortreversed:"name" }}
-func filterDictsortReversed(in *Value, param *Value) (*Value, error) {
-	return dictsortHelper(in, param, true)
+func filterDictsortReversed(ctx *ExecutionContext, in *Value, param *Value) (*Value, error) {
+	return dictsortHelper(ctx, in, param, true)
 }
 
 // dictsortItems implements sort.Interface for sorting by key.
-// It uses type-aware comparison: numeric keys are compared numerically,
-// all other keys are compared as strings.
+// Keys are ordered like values compared using < (see compareValues); items
+// without the key come first.
 type dictsortItems struct {
 	entries []struct {
 		item   *Value
 		sortBy *Value
 	}
-	allNumeric bool
 }
 
 func (d dictsortItems) Len() int      { return len(d.entries) }
 func (d dictsortItems) Swap(i, j int) { d.entries[i], d.entries[j] = d.entries[j], d.entries[i] }
 func (d dictsortItems) Less(i, j int) bool {
-	if d.allNumeric {
-		return d.entries[i].sortBy.Float() < d.entries[j].sortBy.Float()
-	}
-	return d.entries[i].sortBy.String() < d.entries[j].sortBy.String()
+	return sortCompare(d.entries[i].sortBy, d.entries[j].sortBy) < 0
 }
 
-func dictsortHelper(in *Value, param *Value, reverse bool) (*Value, error) {
+func dictsortHelper(ctx *ExecutionContext, in *Value, param *Value, reverse bool) (*Value, error) {
 	if !in.CanSlice() {
 		return in, nil
 	}
@@ -2243,7 +2289,7 @@ func dictsortHelper(in *Value, param *Value, reverse bool) (*Value, error) {
 	}
 
 	// Collect items with their sort keys
-	items := dictsortItems{allNumeric: true}
+	var items dictsortItems
 
 	in.Iterate(func(idx, count int, k, value *Value) bool {
 		// Get the item (value for maps, key for slices/arrays)
@@ -2253,16 +2299,9 @@ func dictsortHelper(in *Value, param *Value, reverse bool) (*Value, error) {
 		}
 
 		// Get the sort key value using Value methods
-		sortBy := AsValue("")
+		sortBy := AsValue(nil)
 		if item.IsMap() || item.IsStruct() {
-			sortVal := item.GetItem(param)
-			if !sortVal.IsNil() {
-				sortBy = sortVal
-			}
-		}
-
-		if items.allNumeric && !sortBy.IsNumber() {
-			items.allNumeric = false
+			sortBy = ctx.GetItem(item, param)
 		}
 
 		items.entries = append(items.entries, struct {
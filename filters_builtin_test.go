@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"iter"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -474,7 +476,7 @@ func TestFilterDictsort(t *testing.T) {
 				param = AsValue(tt.key)
 			}
 
-			result, err := filterDictsort(AsValue(tt.input), param)
+			result, err := filterDictsort(nil, AsValue(tt.input), param)
 			if tt.wantErr {
 				if err == nil {
 					t.Error("expected error but got none")
@@ -512,7 +514,7 @@ func TestFilterDictsort(t *testing.T) {
 func TestFilterDictsortNonMapInput(t *testing.T) {
 	// Test with integer - not sliceable
 	intInput := 42
-	result, err := filterDictsort(AsValue(intInput), AsValue("name"))
+	result, err := filterDictsort(nil, AsValue(intInput), AsValue("name"))
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -522,7 +524,7 @@ func TestFilterDictsortNonMapInput(t *testing.T) {
 	}
 
 	// Test with nil
-	result, err = filterDictsort(AsValue(nil), AsValue("name"))
+	result, err = filterDictsort(nil, AsValue(nil), AsValue("name"))
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -562,7 +564,7 @@ func TestFilterDictsortReversed(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := filterDictsortReversed(AsValue(tt.input), AsValue(tt.key))
+			result, err := filterDictsortReversed(nil, AsValue(tt.input), AsValue(tt.key))
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
@@ -603,7 +605,7 @@ func TestFilterDictsortWithStructs(t *testing.T) {
 	}
 
 	t.Run("sort structs by Name field", func(t *testing.T) {
-		result, err := filterDictsort(AsValue(input), AsValue("Name"))
+		result, err := filterDictsort(nil, AsValue(input), AsValue("Name"))
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -626,7 +628,7 @@ func TestFilterDictsortWithStructs(t *testing.T) {
 	})
 
 	t.Run("sort structs by Age field", func(t *testing.T) {
-		result, err := filterDictsort(AsValue(input), AsValue("Age"))
+		result, err := filterDictsort(nil, AsValue(input), AsValue("Age"))
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -649,7 +651,7 @@ func TestFilterDictsortWithStructs(t *testing.T) {
 	})
 
 	t.Run("sort structs by non-existent field", func(t *testing.T) {
-		result, err := filterDictsort(AsValue(input), AsValue("NonExistent"))
+		result, err := filterDictsort(nil, AsValue(input), AsValue("NonExistent"))
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -674,7 +676,7 @@ func TestFilterDictsortWithPointers(t *testing.T) {
 		{Name: "Bob", Age: 20},
 	}
 
-	result, err := filterDictsort(AsValue(input), AsValue("Name"))
+	result, err := filterDictsort(nil, AsValue(input), AsValue("Name"))
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -1128,7 +1130,6 @@ func TestDictsortItemsSortInterface(t *testing.T) {
 
 	t.Run("numeric keys sort numerically", func(t *testing.T) {
 		items := dictsortItems{
-			allNumeric: true,
 			entries: []struct {
 				item   *Value
 				sortBy *Value
@@ -1156,7 +1157,7 @@ func TestDictsortItemsSortInterface(t *testing.T) {
 func TestDictsortHelperEdgeCases(t *testing.T) {
 	t.Run("string input (sliceable but not map/struct items)", func(t *testing.T) {
 		// Strings are sliceable, but individual characters are not maps/structs
-		result, err := filterDictsort(AsValue("hello"), AsValue("key"))
+		result, err := filterDictsort(nil, AsValue("hello"), AsValue("key"))
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -1168,7 +1169,7 @@ func TestDictsortHelperEdgeCases(t *testing.T) {
 
 	t.Run("slice of integers (not map/struct)", func(t *testing.T) {
 		input := []int{3, 1, 2}
-		result, err := filterDictsort(AsValue(input), AsValue("key"))
+		result, err := filterDictsort(nil, AsValue(input), AsValue("key"))
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -1181,7 +1182,7 @@ func TestDictsortHelperEdgeCases(t *testing.T) {
 
 	t.Run("slice of strings (not map/struct)", func(t *testing.T) {
 		input := []string{"charlie", "alice", "bob"}
-		result, err := filterDictsort(AsValue(input), AsValue("key"))
+		result, err := filterDictsort(nil, AsValue(input), AsValue("key"))
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -1197,7 +1198,7 @@ func TestDictsortHelperEdgeCases(t *testing.T) {
 			"not a map",
 			map[string]any{"name": "Bob"},
 		}
-		result, err := filterDictsort(AsValue(input), AsValue("name"))
+		result, err := filterDictsort(nil, AsValue(input), AsValue("name"))
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -1213,7 +1214,7 @@ func TestDictsortHelperEdgeCases(t *testing.T) {
 			{"name": "Alice", "value": "string"},
 			{"name": "Bob", "value": true},
 		}
-		result, err := filterDictsort(AsValue(input), AsValue("name"))
+		result, err := filterDictsort(nil, AsValue(input), AsValue("name"))
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -1240,7 +1241,7 @@ func TestDictsortHelperEdgeCases(t *testing.T) {
 		m3 := map[string]any{"name": "Bob"}
 		input := []*map[string]any{&m1, &m2, &m3}
 
-		result, err := filterDictsort(AsValue(input), AsValue("name"))
+		result, err := filterDictsort(nil, AsValue(input), AsValue("name"))
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -1267,7 +1268,7 @@ func TestDictsortHelperEdgeCases(t *testing.T) {
 			{"name": "Same", "id": 2},
 			{"name": "Same", "id": 3},
 		}
-		result, err := filterDictsort(AsValue(input), AsValue("name"))
+		result, err := filterDictsort(nil, AsValue(input), AsValue("name"))
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -1288,7 +1289,7 @@ func TestDictsortHelperEdgeCases(t *testing.T) {
 
 	t.Run("bool value", func(t *testing.T) {
 		// Bool is not sliceable, should return unchanged
-		result, err := filterDictsort(AsValue(true), AsValue("key"))
+		result, err := filterDictsort(nil, AsValue(true), AsValue("key"))
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -1308,7 +1309,7 @@ func TestDictsortHelperEdgeCases(t *testing.T) {
 			{Name: "Bob"},
 		}
 
-		result, err := filterDictsort(AsValue(input), AsValue("Name"))
+		result, err := filterDictsort(nil, AsValue(input), AsValue("Name"))
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -1334,7 +1335,7 @@ func TestDictsortHelperEdgeCases(t *testing.T) {
 func TestDictsortReversedEdgeCases(t *testing.T) {
 	t.Run("nil key parameter", func(t *testing.T) {
 		input := []map[string]any{{"name": "Alice"}}
-		_, err := filterDictsortReversed(AsValue(input), AsValue(nil))
+		_, err := filterDictsortReversed(nil, AsValue(input), AsValue(nil))
 		if err == nil {
 			t.Error("expected error for nil key parameter")
 		}
@@ -1342,7 +1343,7 @@ func TestDictsortReversedEdgeCases(t *testing.T) {
 
 	t.Run("empty slice", func(t *testing.T) {
 		input := []map[string]any{}
-		result, err := filterDictsortReversed(AsValue(input), AsValue("name"))
+		result, err := filterDictsortReversed(nil, AsValue(input), AsValue("name"))
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -1353,7 +1354,7 @@ func TestDictsortReversedEdgeCases(t *testing.T) {
 
 	t.Run("single element", func(t *testing.T) {
 		input := []map[string]any{{"name": "Only"}}
-		result, err := filterDictsortReversed(AsValue(input), AsValue("name"))
+		result, err := filterDictsortReversed(nil, AsValue(input), AsValue("name"))
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -1377,7 +1378,7 @@ func TestDictsortReversedEdgeCases(t *testing.T) {
 			{"name": "Bob"},
 			{"name": "Charlie"},
 		}
-		result, err := filterDictsortReversed(AsValue(input), AsValue("name"))
+		result, err := filterDictsortReversed(nil, AsValue(input), AsValue("name"))
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -1399,7 +1400,7 @@ func TestDictsortReversedEdgeCases(t *testing.T) {
 	})
 
 	t.Run("non-sliceable input", func(t *testing.T) {
-		result, err := filterDictsortReversed(AsValue(42), AsValue("key"))
+		result, err := filterDictsortReversed(nil, AsValue(42), AsValue("key"))
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -1417,7 +1418,7 @@ func TestDictsortWithSpecialCharKeys(t *testing.T) {
 			{"name": "中国"},
 			{"name": "한국"},
 		}
-		result, err := filterDictsort(AsValue(input), AsValue("name"))
+		result, err := filterDictsort(nil, AsValue(input), AsValue("name"))
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -1434,7 +1435,7 @@ func TestDictsortWithSpecialCharKeys(t *testing.T) {
 			{"name": "Bob"},
 			{"name": ""},
 		}
-		result, err := filterDictsort(AsValue(input), AsValue("name"))
+		result, err := filterDictsort(nil, AsValue(input), AsValue("name"))
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -1459,7 +1460,7 @@ func TestDictsortWithSpecialCharKeys(t *testing.T) {
 			{"name": "a"},
 			{"name": " b"},
 		}
-		result, err := filterDictsort(AsValue(input), AsValue("name"))
+		result, err := filterDictsort(nil, AsValue(input), AsValue("name"))
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -1492,7 +1493,7 @@ func TestDictsortWithNestedValues(t *testing.T) {
 			{"name": "Alice", "info": map[string]any{"age": 30}},
 			{"name": "Bob", "info": map[string]any{"age": 20}},
 		}
-		result, err := filterDictsort(AsValue(input), AsValue("name"))
+		result, err := filterDictsort(nil, AsValue(input), AsValue("name"))
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -1522,7 +1523,7 @@ func TestDictsortInterfaceSlice(t *testing.T) {
 			map[string]any{"name": "Alice"},
 			map[string]any{"name": "Bob"},
 		}
-		result, err := filterDictsort(AsValue(input), AsValue("name"))
+		result, err := filterDictsort(nil, AsValue(input), AsValue("name"))
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -2514,6 +2515,59 @@ func TestFilterWordwrapCharacterBased(t *testing.T) {
 	}
 }
 
+// sizedSeq is an iterator knowing its length.
+type sizedSeq iter.Seq[string]
+
+func (s sizedSeq) PongoLen() int {
+	n := 0
+	for range s {
+		n++
+	}
+	return n
+}
+
+func TestFiltersSeq(t *testing.T) {
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{`{{ items|join:", " }}`, "a, b, c"},
+		{`{{ items|join:"" }}`, "abc"},
+		{`{{ items|first }}`, "a"},
+		{`{{ items|last }}`, "c"},
+		{`{{ items|length }}`, "0"},
+		{`{% if items|length %}-{% endif %}{% for i in items %}{{ i }}{% endfor %}`, "abc"},
+		{`{{ sized|length }}|{% if sized|length_is:3 %}{% for i in sized %}{{ i }}{% endfor %}{% endif %}`, "3|abc"},
+		{`{{ empty|join:", " }}|{{ empty|first }}|{{ empty|last }}|{{ empty|length }}`, "|||0"},
+	}
+	for _, test := range tests {
+		tpl, err := FromString(test.template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tpl.Execute(Context{
+			"items": slices.Values([]string{"a", "b", "c"}),
+			"sized": sizedSeq(slices.Values([]string{"a", "b", "c"})),
+			"empty": slices.Values([]string(nil)),
+		})
+		if err != nil || out != test.expected {
+			t.Errorf("%s: got %q, %v; want %q", test.template, out, err, test.expected)
+		}
+	}
+
+	// first doesn't read ahead
+	ch := make(chan string, 3)
+	ch <- "a"
+	ch <- "b"
+	close(ch)
+	if out, err := filterFirst(AsValue(ch), nil); err != nil || out.String() != "a" || len(ch) != 1 {
+		t.Errorf("first of channel = %q, %v (%d items left)", out, err, len(ch))
+	}
+	if n := AsValue(ch).Len(); n != 0 || len(ch) != 1 {
+		t.Errorf("length of channel = %d (%d items left), want 0", n, len(ch))
+	}
+}
+
 // TestFilterJoinNonSliceable tests join with non-sliceable input
 func TestFilterJoinNonSliceable(t *testing.T) {
 	result, err := filterJoin(AsValue(42), AsValue(","))
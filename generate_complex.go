@@ -0,0 +1,33 @@
+//go:build ignore
+
+// generate_complex.go compiles template_tests/complex.tpl to Go for
+// BenchmarkExecuteComplexGenerated. Run it using go generate.
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/flosch/pongo2/v7"
+)
+
+func main() {
+	buf, err := os.ReadFile("template_tests/complex.tpl")
+	if err != nil {
+		log.Fatal(err)
+	}
+	// The template is loaded from memory, so the generated code doesn't
+	// depend on the location of the repository.
+	set := pongo2.NewSet("generated", pongo2.NewMapLoader(map[string]string{"complex.tpl": string(buf)}))
+	tpl, err := set.FromFile("complex.tpl")
+	if err != nil {
+		log.Fatal(err)
+	}
+	src, err := pongo2.GenerateGo("pongo2_test", map[string]*pongo2.Template{"generatedComplex": tpl})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("generated_complex_test.go", src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
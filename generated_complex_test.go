@@ -0,0 +1,221 @@
+// Code generated by pongo2.GenerateGo. DO NOT EDIT.
+
+package pongo2_test
+
+import "github.com/flosch/pongo2/v7"
+
+// generatedComplex is the template 'complex.tpl' compiled to Go.
+var generatedComplex = &pongo2.GeneratedTemplate{
+	Data: "pongo2\x00T\x03\x00\r7.0.0-alpha.1\x00\x101c56e3304516ff47\x01\x00\vcomplex.tpl\x02\x03\x00\x00\x00\x00\x03\xf6\f\x00\x00\x00\x01\x00\x03\x00\x1022f8271f380c4b74\x00\x02\x00(github.com/flosch/pongo2/v7.nodeDocument\x05\x02\x00$github.com/flosch/pongo2/v7.nodeHTML\x02\x03\x02\x00v\n<!DOCTYPE html>\n<html>\n\n<head>\n\t<title>My blog page</title>\n</head>\n\n<body>\n\t<h1>Blogpost</h1>\n\t<div id=\"content\">\n\t\t\x02\x9c\x01\x00\x00\x00\x02\x00(github.com/flosch/pongo2/v7.nodeVariable\x02\x03\f\x00\x02{{\x18\x06\x00\x02\x000github.com/flosch/pongo2/v7.nodeFilteredVariable\x02\x03\x06\x00\acomplex\x18\f\x00\x02\x00,github.com/flosch/pongo2/v7.variableResolver\x01\a\x03\x02\f\x00\x00\x00\x00\x00\x02\x00\x04post\x00\x00\x00\x00\x00\x02\x00\x04Text\x00\x00\x00\x00\x00\x01\x02\x03\x06\x00\x04safe\x180\x00\x10\x00\x02\a\x02\x03\x02\x00\x1f\n\t</div>\n\n\t<h1>Comments</h1>\n\n\t\x18>\x00\x00\x00\x02\x00&github.com/flosch/pongo2/v7.tagForNode\x00\acomment\x04\x02\v\x02\x03\x06\f\"(\x00\x02\r\x01\x0e\x02\x02\f\x00\x00\x00\x00\x00\x02\x00\bcomments\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x06endfor\x11\x02\a\x02\x03\x02\x00\a\n\t\t<h2>\"N\x00\x00\x00\x02\t\x02\x03\f\n$\x0e\x00\x02\v\x02\x03\x06\x00\aforloop$\x14\x00\x02\r\x01\x16\x02\x02\x17\x00\x00\x00\x00\x00\x02\x00\aCounter\x00\x00\x00\x00\x00\x00\x02\a\x02\x03\x02\x00\v. Comment ($8\x00\x00\x00\x02\t\x02\x03\f\n$N\x00\x02\v\x02\x03\x06\x17$T\x00\x02\r\x01\x1d\x02\x02\x17\x00\x00\x00\x00\x00\x02\x00\nRevcounter\x00\x00\x00\x00\x00\x00\x02\a\x02\x03\x02\x00\b comment$|\x00\x00\x00\x02\t\x02\x03\f\n$\x8c\x01\x00\x02\v\x02\x03\x06\x17$\x92\x01\x00\x02\r\x01$\x02\x02\x17\x00\x00\x00\x00\x00\x02\x1a\x00\x00\x00\x00\x00\x01\x02\x03\x06\x00\tpluralize$\xb8\x01\x00\x1c\x02\x00*github.com/flosch/pongo2/v7.stringResolver\x02\x03\b\x00\x01s$\xcc\x01\x00\x1e\x02\a\x02\x03\x02\x00\x17 left)</h2>\n\t\t<p>From: $\xd8\x01\x00\x00\x00\x02\t\x02\x03\f\n&\x18\x00\x02\v\x02\x03\x06\x13&\x1e\x00\x02\r\x01.\x03\x02\x13\x00\x00\x00\x00\x00\x02\x00\x06Author\x00\x00\x00\x00\x00\x02\x00\x04Name\x00\x00\x00\x00\x00\x00\x02\a\x02\x03\x02\x00\x02 (&J\x00\x00\x00\x02\t\x02\x03\f\n&N\x00\x02\v\x02\x03\x06\x13&T\x00\x02\r\x015\x03\x02\x13\x00\x00\x00\x00\x00\x02 \x00\x00\x00\x00\x00\x02\x00\tValidated\x00\x00\x00\x00\x00\x01\x02\x03\x06\x00\x05yesno&\x86\x01\x00$\x02\x1d\x02\x03\b\x001validated,not validated,unknown validation status&\x92\x01\x00%\x02\a\x02\x03\x02\x00\t)</p>\n\n\t\t&\xfe\x01\x00\x00\x00\x02\x00%github.com/flosch/pongo2/v7.tagIfNode\x01\x02\v\x02\x03\x06\f*\x12\x00\x02\r\x01>\x02\x02\f\x00\x00\x00\x00\x00\x02\x00\bis_admin\x00\x00\x00\x01\x01\x02\v\x02\x03\x06\x13*4\x00\x02\r\x01A\x02\x02\x13\x00\x00\x00\x00\x00\x02 \x00\x00\x00\x00\x00\x00\x00\x02\x02\x00\x04else\x03\x02\a\x02\x03\x02\x00&\n\t\t\t<p>This user is an admin (verify: *X\x00\x00\x00\x02\t\x02\x03\f\n,L\x00\x02\v\x02\x03\x06\x13,R\x00\x02\r\x01I\x03\x02\x13\x00\x00\x00\x00\x00\x02 \x00\x00\x00\x00\x00\x02\x00\bIs_admin\x00\x00\x00\x00\x00\x00\x02\a\x02\x03\x02\x00\t)!</p>\n\t\t,\x86\x01\x00\x00\x00\x02\x00\x05endif\x01\x02\a\x02\x03\x02\x00%\n\t\t\t<p>This user is not admin!</p>\n\t\t.\x1a\x00\x00\x00\x02\a\x02\x03\x02\x00\x0f\n\n\t\t<p>Written 2\x1c\x00\x00\x00\x02\t\x02\x03\f\n6\x1c\x00\x02\v\x02\x03\x06\x136\"\x00\x02\r\x01U\x02\x02\x13\x00\x00\x00\x00\x00\x02\x00\x04Date\x00\x00\x00\x00\x00\x00\x02\a\x02\x03\x02\x00\n</p>\n\t\t<p>6@\x00\x00\x00\x02\t\x02\x03\f\n8\f\x00\x02\v\x02\x03\x06\x138\x12\x00\x02\r\x01\\\x02\x02\x13\x00\x00\x00\x00\x00\x02\x0f\x00\x00\x00\x00\x00\x01\x02\x03\x06\x00\tstriptags8,\x002\x00\x02\a\x02\x03\x02\x00\x06</p>\n\t8D\x00\x00\x00\x00\x02\a\x02\x03\x02\x00\x11\n</body>\n\n</html>:\x1c\x00\x00\x00\x00\x00\x00@\x19%C",
+	Funcs: map[int]pongo2.GeneratedFunc{
+		1: rendergeneratedComplex_1,
+	},
+}
+
+func rendergeneratedComplex_1(nodes *pongo2.GeneratedNodes, ctx *pongo2.ExecutionContext, writer pongo2.TemplateWriter) error {
+	if _, err := writer.WriteString("\n<!DOCTYPE html>\n<html>\n\n<head>\n\t<title>My blog page</title>\n</head>\n\n<body>\n\t<h1>Blogpost</h1>\n\t<div id=\"content\">\n\t\t"); err != nil {
+		return err
+	}
+	v1, err := nodes.Resolve(8, 0, ctx, nil)
+	if err != nil {
+		return err
+	}
+	v1, err = nodes.Resolve(8, 1, ctx, v1)
+	if err != nil {
+		return err
+	}
+	v1, err = nodes.Resolve(8, 2, ctx, v1)
+	if err != nil {
+		return err
+	}
+	v2, err := nodes.Filter(6, 0, ctx, v1, nil)
+	if err != nil {
+		return err
+	}
+	if err := nodes.Write(4, ctx, writer, v2); err != nil {
+		return err
+	}
+	if _, err := writer.WriteString("\n\t</div>\n\n\t<h1>Comments</h1>\n\n\t"); err != nil {
+		return err
+	}
+	if err := nodes.For(12, ctx, func(ctx *pongo2.ExecutionContext) (*pongo2.Value, error) {
+		v3, err := nodes.Resolve(15, 0, ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		v3, err = nodes.Resolve(15, 1, ctx, v3)
+		if err != nil {
+			return nil, err
+		}
+		return v3, nil
+	}, func(ctx *pongo2.ExecutionContext) error {
+		if _, err := writer.WriteString("\n\t\t<h2>"); err != nil {
+			return err
+		}
+		v4, err := nodes.Resolve(23, 0, ctx, nil)
+		if err != nil {
+			return err
+		}
+		v4, err = nodes.Resolve(23, 1, ctx, v4)
+		if err != nil {
+			return err
+		}
+		if err := nodes.Write(19, ctx, writer, v4); err != nil {
+			return err
+		}
+		if _, err := writer.WriteString(". Comment ("); err != nil {
+			return err
+		}
+		v5, err := nodes.Resolve(30, 0, ctx, nil)
+		if err != nil {
+			return err
+		}
+		v5, err = nodes.Resolve(30, 1, ctx, v5)
+		if err != nil {
+			return err
+		}
+		if err := nodes.Write(26, ctx, writer, v5); err != nil {
+			return err
+		}
+		if _, err := writer.WriteString(" comment"); err != nil {
+			return err
+		}
+		v6, err := nodes.Resolve(37, 0, ctx, nil)
+		if err != nil {
+			return err
+		}
+		v6, err = nodes.Resolve(37, 1, ctx, v6)
+		if err != nil {
+			return err
+		}
+		v7 := pongo2.AsValue("s")
+		v8, err := nodes.Filter(35, 0, ctx, v6, v7)
+		if err != nil {
+			return err
+		}
+		if err := nodes.Write(33, ctx, writer, v8); err != nil {
+			return err
+		}
+		if _, err := writer.WriteString(" left)</h2>\n\t\t<p>From: "); err != nil {
+			return err
+		}
+		v9, err := nodes.Resolve(47, 0, ctx, nil)
+		if err != nil {
+			return err
+		}
+		v9, err = nodes.Resolve(47, 1, ctx, v9)
+		if err != nil {
+			return err
+		}
+		v9, err = nodes.Resolve(47, 2, ctx, v9)
+		if err != nil {
+			return err
+		}
+		if err := nodes.Write(43, ctx, writer, v9); err != nil {
+			return err
+		}
+		if _, err := writer.WriteString(" ("); err != nil {
+			return err
+		}
+		v10, err := nodes.Resolve(54, 0, ctx, nil)
+		if err != nil {
+			return err
+		}
+		v10, err = nodes.Resolve(54, 1, ctx, v10)
+		if err != nil {
+			return err
+		}
+		v10, err = nodes.Resolve(54, 2, ctx, v10)
+		if err != nil {
+			return err
+		}
+		v11 := pongo2.AsValue("validated,not validated,unknown validation status")
+		v12, err := nodes.Filter(52, 0, ctx, v10, v11)
+		if err != nil {
+			return err
+		}
+		if err := nodes.Write(50, ctx, writer, v12); err != nil {
+			return err
+		}
+		if _, err := writer.WriteString(")</p>\n\n\t\t"); err != nil {
+			return err
+		}
+		v13, err := nodes.Resolve(63, 0, ctx, nil)
+		if err != nil {
+			return err
+		}
+		v13, err = nodes.Resolve(63, 1, ctx, v13)
+		if err != nil {
+			return err
+		}
+		if v13.IsTrue() {
+			if _, err := writer.WriteString("\n\t\t\t<p>This user is an admin (verify: "); err != nil {
+				return err
+			}
+			v14, err := nodes.Resolve(74, 0, ctx, nil)
+			if err != nil {
+				return err
+			}
+			v14, err = nodes.Resolve(74, 1, ctx, v14)
+			if err != nil {
+				return err
+			}
+			v14, err = nodes.Resolve(74, 2, ctx, v14)
+			if err != nil {
+				return err
+			}
+			if err := nodes.Write(70, ctx, writer, v14); err != nil {
+				return err
+			}
+			if _, err := writer.WriteString(")!</p>\n\t\t"); err != nil {
+				return err
+			}
+		} else {
+			if _, err := writer.WriteString("\n\t\t\t<p>This user is not admin!</p>\n\t\t"); err != nil {
+				return err
+			}
+		}
+		if _, err := writer.WriteString("\n\n\t\t<p>Written "); err != nil {
+			return err
+		}
+		v15, err := nodes.Resolve(86, 0, ctx, nil)
+		if err != nil {
+			return err
+		}
+		v15, err = nodes.Resolve(86, 1, ctx, v15)
+		if err != nil {
+			return err
+		}
+		if err := nodes.Write(82, ctx, writer, v15); err != nil {
+			return err
+		}
+		if _, err := writer.WriteString("</p>\n\t\t<p>"); err != nil {
+			return err
+		}
+		v16, err := nodes.Resolve(93, 0, ctx, nil)
+		if err != nil {
+			return err
+		}
+		v16, err = nodes.Resolve(93, 1, ctx, v16)
+		if err != nil {
+			return err
+		}
+		v17, err := nodes.Filter(91, 0, ctx, v16, nil)
+		if err != nil {
+			return err
+		}
+		if err := nodes.Write(89, ctx, writer, v17); err != nil {
+			return err
+		}
+		if _, err := writer.WriteString("</p>\n\t"); err != nil {
+			return err
+		}
+		return nil
+	}, nil); err != nil {
+		return err
+	}
+	if _, err := writer.WriteString("\n</body>\n\n</html>"); err != nil {
+		return err
+	}
+	return nil
+}
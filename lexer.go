@@ -185,10 +185,14 @@ type lexer struct {
 	// tokens accumulates all tokens produced during lexing.
 	tokens []*Token
 
-	// errored is set to true when a lexical error occurs.
-	// The error details are stored in the last token (TokenError).
+	// errored is set to true when a lexical error occurs and reset once the
+	// lexer has resynchronized at the next tag/variable boundary.
 	errored bool
 
+	// errors collects all lexical errors (as TokenError tokens) in the order
+	// they were encountered.
+	errors []*Token
+
 	// startline is the line number where the current token begins.
 	startline int
 
@@ -248,7 +252,9 @@ func (t *Token) String() string {
 //   - name: The template name/filename (used for error messages)
 //   - input: The complete template source to tokenize
 //
-// Returns the token slice on success, or an Error with location info on failure.
+// Returns the token slice on success. On failure, the lexer skips the broken
+// tag or comment and keeps going; all errors found are returned (as one *Error
+// or as an ErrorList) together with the tokens of the remaining, valid input.
 func lex(name string, input string) ([]*Token, error) {
 	l := &lexer{
 		name:      name,
@@ -260,15 +266,19 @@ func lex(name string, input string) ([]*Token, error) {
 		startcol:  1,
 	}
 	l.run()
-	if l.errored {
-		errtoken := l.tokens[len(l.tokens)-1]
-		return nil, &Error{
-			Filename:  name,
-			Line:      errtoken.Line,
-			Column:    errtoken.Col,
-			Sender:    "lexer",
-			OrigError: errors.New(errtoken.Val),
+	if len(l.errors) > 0 {
+		errs := make([]error, 0, len(l.errors))
+		for _, errtoken := range l.errors {
+			errs = append(errs, &Error{
+				Filename:  name,
+				Line:      errtoken.Line,
+				Column:    errtoken.Col,
+				Sender:    "lexer",
+				OrigError: errors.New(errtoken.Val),
+				Kind:      ErrSyntax,
+			})
 		}
+		return l.tokens, newCompileError(name, errs)
 	}
 	return l.tokens, nil
 }
@@ -381,7 +391,8 @@ func (l *lexer) acceptRun(what string) {
 
 // errorf records a lexical error and terminates the current state.
 // Creates a TokenError with the formatted message and sets the errored flag.
-// Always returns nil to signal that lexing should stop.
+// Always returns nil to signal that lexing of the current tag should stop;
+// run() then resynchronizes using recover().
 func (l *lexer) errorf(format string, args ...any) lexerStateFn {
 	t := &Token{
 		Filename: l.name,
@@ -390,13 +401,40 @@ func (l *lexer) errorf(format string, args ...any) lexerStateFn {
 		Line:     l.startline,
 		Col:      l.startcol,
 	}
-	l.tokens = append(l.tokens, t)
+	l.errors = append(l.errors, t)
 	l.errored = true
 	l.startline = l.line
 	l.startcol = l.col
 	return nil
 }
 
+// recover resynchronizes the lexer after an error. All tokens emitted for the
+// broken tag (starting at index mark) are dropped and the input is skipped up
+// to the next {{, {% or {# (or EOF), where lexing continues normally.
+func (l *lexer) recover(mark int) {
+	l.tokens = l.tokens[:mark]
+	l.errored = false
+
+	// A newline consumed within a tag hasn't been counted yet; step back
+	// so that the loop below accounts for it.
+	if l.pos > 0 && l.input[l.pos-1] == '\n' {
+		l.pos--
+	}
+
+	for !strings.HasPrefix(l.input[l.pos:], "{{") &&
+		!strings.HasPrefix(l.input[l.pos:], "{%") &&
+		!strings.HasPrefix(l.input[l.pos:], "{#") {
+		if l.peek() == '\n' {
+			l.line++
+			l.col = 0
+		}
+		if l.next() == EOF {
+			break
+		}
+	}
+	l.ignore()
+}
+
 // emitRemainingHTML emits any accumulated HTML content as a TokenHTML.
 // Called before entering a template tag or at end of input to flush
 // any raw HTML that was being collected.
@@ -472,7 +510,8 @@ func (l *lexer) processVerbatimTag() {
 // and template tags ({{ }} and {% %}). Raw HTML content between tags
 // is accumulated and emitted as TokenHTML.
 //
-// The loop terminates when EOF is reached or an error occurs.
+// The loop terminates when EOF is reached. Errors are recorded and the
+// lexer resynchronizes at the next tag/variable/comment boundary.
 func (l *lexer) run() {
 	for {
 		l.processVerbatimTag()
@@ -481,15 +520,17 @@ func (l *lexer) run() {
 			// Ignore single-line comments {# ... #}
 			l.ignoreSingleLineComment()
 			if l.errored {
-				return
+				l.recover(len(l.tokens))
+				continue
 			}
 
 			if strings.HasPrefix(l.input[l.pos:], "{{") || // variable
 				strings.HasPrefix(l.input[l.pos:], "{%") { // tag
 				l.emitRemainingHTML()
+				mark := len(l.tokens)
 				l.tokenizeTemplateCode()
 				if l.errored {
-					return
+					l.recover(mark)
 				}
 				continue
 			}
@@ -14,3 +14,13 @@ func (doc *nodeDocument) Execute(ctx *ExecutionContext, writer TemplateWriter) e
 	}
 	return nil
 }
+
+func (doc *nodeDocument) EncodeNode(enc *NodeEncoder) error {
+	enc.writeNodes(doc.Nodes)
+	return nil
+}
+
+func (doc *nodeDocument) DecodeNode(dec *NodeDecoder) error {
+	doc.Nodes = dec.readNodes()
+	return nil
+}
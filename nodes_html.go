@@ -11,6 +11,12 @@ type nodeHTML struct {
 }
 
 func (n *nodeHTML) Execute(ctx *ExecutionContext, writer TemplateWriter) error {
+	_, err := writer.WriteString(n.value())
+	return err
+}
+
+// value returns the HTML with the whitespace control applied.
+func (n *nodeHTML) value() string {
 	res := n.token.Val
 	if n.trimLeft {
 		res = strings.TrimLeft(res, tokenSpaceChars)
@@ -18,6 +24,19 @@ func (n *nodeHTML) Execute(ctx *ExecutionContext, writer TemplateWriter) error {
 	if n.trimRight {
 		res = strings.TrimRight(res, tokenSpaceChars)
 	}
-	_, err := writer.WriteString(res)
-	return err
+	return res
+}
+
+func (n *nodeHTML) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteToken(n.token)
+	enc.WriteBool(n.trimLeft)
+	enc.WriteBool(n.trimRight)
+	return nil
+}
+
+func (n *nodeHTML) DecodeNode(dec *NodeDecoder) error {
+	n.token = dec.ReadToken()
+	n.trimLeft = dec.ReadBool()
+	n.trimRight = dec.ReadBool()
+	return nil
 }
@@ -40,6 +40,10 @@ type Parser struct {
 	// if the parser parses a template document, here will be
 	// a reference to it (needed to access the template through Tags)
 	template *Template
+
+	// errs collects the errors of all document elements which failed to
+	// parse; the parser resynchronizes after each of them (see recover).
+	errs []error
 }
 
 // Creates a new parser to parse tokens.
@@ -184,7 +188,13 @@ func (p *Parser) GetR(shift int) *Token {
 // The 'token'-argument is optional. If provided, it will take
 // the token's position information. If not provided, it will
 // automatically use the CURRENT token's position information.
+// The returned error is of kind ErrSyntax.
 func (p *Parser) Error(msg string, token *Token) *Error {
+	return p.errorOfKind(ErrSyntax, msg, token)
+}
+
+// errorOfKind works like Error, but sets the given kind on the returned error.
+func (p *Parser) errorOfKind(kind error, msg string, token *Token) *Error {
 	if token == nil {
 		// Set current token
 		token = p.Current()
@@ -208,7 +218,46 @@ func (p *Parser) Error(msg string, token *Token) *Error {
 		Column:    col,
 		Token:     token,
 		OrigError: errors.New(msg),
+		Kind:      kind,
+	}
+}
+
+// recover records err, which occurred while parsing the document element
+// starting at token index start, and resynchronizes the parser at the next
+// "{{" or "{%" token so that parsing can continue after a broken element.
+//
+// Unknown end tags (like {% endif %}) following an earlier error are most
+// likely leftovers of a broken block tag and aren't reported again.
+func (p *Parser) recover(start int, err error) {
+	if len(p.errs) == 0 || !p.isStrayEndTag(start) {
+		p.errs = append(p.errs, err)
+	}
+	if p.idx <= start {
+		p.idx = start + 1
+	}
+	for p.Remaining() > 0 && p.PeekOne(TokenSymbol, "{{", "{%") == nil {
+		p.Consume()
+	}
+}
+
+// isStrayEndTag reports whether the tokens at index start form an unknown
+// end or intermediate tag such as {% endfor %}, {% else %} or {% empty %}.
+func (p *Parser) isStrayEndTag(start int) bool {
+	if p.Get(start) == nil || p.Get(start).Typ != TokenSymbol || p.Get(start).Val != "{%" {
+		return false
+	}
+	name := p.Get(start + 1)
+	if name == nil || name.Typ != TokenIdentifier {
+		return false
+	}
+	if _, exists := p.template.set.tags[name.Val]; exists {
+		return false
+	}
+	switch name.Val {
+	case "else", "elif", "empty":
+		return true
 	}
+	return strings.HasPrefix(name.Val, "end")
 }
 
 // Wraps all nodes between starting tag and "{% endtag %}" and provides
@@ -238,6 +287,9 @@ func (p *Parser) WrapUntilTag(names ...string) (*NodeWrapper, *Parser, error) {
 						if p.Match(TokenSymbol, "%}") != nil {
 							// Okay, end the wrapping here
 							wrapper.Endtag = tagIdent.Val
+							if p.template != nil {
+								p.template.wrappers = append(p.template.wrappers, wrapper)
+							}
 							return wrapper, newParser(p.template.name, tagArgs, p.template), nil
 						}
 						t := p.Current()
@@ -253,9 +305,13 @@ func (p *Parser) WrapUntilTag(names ...string) (*NodeWrapper, *Parser, error) {
 		}
 
 		// Otherwise process next element to be wrapped
+		start := p.idx
 		node, err := p.parseDocElement()
 		if err != nil {
-			return nil, nil, err
+			// Keep wrapping to find the end tag; the error is reported
+			// once the whole document has been parsed.
+			p.recover(start, err)
+			continue
 		}
 		wrapper.nodes = append(wrapper.nodes, node)
 	}
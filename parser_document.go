@@ -44,16 +44,25 @@ func (tpl *Template) parse() error {
 	return nil
 }
 
+// parseDocument parses all tokens into a document. It does not stop at the
+// first broken element but resynchronizes at the next tag/variable and
+// reports all errors at once (see newCompileError).
 func (p *Parser) parseDocument() (*nodeDocument, error) {
 	doc := &nodeDocument{}
 
 	for p.Remaining() > 0 {
+		start := p.idx
 		node, err := p.parseDocElement()
 		if err != nil {
-			return nil, err
+			p.recover(start, err)
+			continue
 		}
 		doc.Nodes = append(doc.Nodes, node)
 	}
 
+	if len(p.errs) > 0 {
+		return nil, newCompileError(p.name, p.errs)
+	}
+
 	return doc, nil
 }
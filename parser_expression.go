@@ -2,7 +2,6 @@ package pongo2
 
 import (
 	"fmt"
-	"math"
 )
 
 type Expression struct {
@@ -160,58 +159,10 @@ func (expr *relationalExpression) Evaluate(ctx *ExecutionContext) (*Value, error
 	if err != nil {
 		return nil, err
 	}
-	if expr.expr2 != nil {
-		v2, err := expr.expr2.Evaluate(ctx)
-		if err != nil {
-			return nil, err
-		}
-		switch expr.opToken.Val {
-		case "<=":
-			if v1.IsFloat() || v2.IsFloat() {
-				return AsValue(v1.Float() <= v2.Float()), nil
-			}
-			if v1.IsTime() && v2.IsTime() {
-				tm1, tm2 := v1.Time(), v2.Time()
-				return AsValue(tm1.Before(tm2) || tm1.Equal(tm2)), nil
-			}
-			return AsValue(v1.Integer() <= v2.Integer()), nil
-		case ">=":
-			if v1.IsFloat() || v2.IsFloat() {
-				return AsValue(v1.Float() >= v2.Float()), nil
-			}
-			if v1.IsTime() && v2.IsTime() {
-				tm1, tm2 := v1.Time(), v2.Time()
-				return AsValue(tm1.After(tm2) || tm1.Equal(tm2)), nil
-			}
-			return AsValue(v1.Integer() >= v2.Integer()), nil
-		case "==":
-			return AsValue(v1.EqualValueTo(v2)), nil
-		case ">":
-			if v1.IsFloat() || v2.IsFloat() {
-				return AsValue(v1.Float() > v2.Float()), nil
-			}
-			if v1.IsTime() && v2.IsTime() {
-				return AsValue(v1.Time().After(v2.Time())), nil
-			}
-			return AsValue(v1.Integer() > v2.Integer()), nil
-		case "<":
-			if v1.IsFloat() || v2.IsFloat() {
-				return AsValue(v1.Float() < v2.Float()), nil
-			}
-			if v1.IsTime() && v2.IsTime() {
-				return AsValue(v1.Time().Before(v2.Time())), nil
-			}
-			return AsValue(v1.Integer() < v2.Integer()), nil
-		case "!=", "<>":
-			return AsValue(!v1.EqualValueTo(v2)), nil
-		case "in":
-			return AsValue(v2.Contains(v1)), nil
-		default:
-			return nil, ctx.Error(fmt.Sprintf("unimplemented: %s", expr.opToken.Val), expr.opToken)
-		}
-	} else {
+	if expr.expr2 == nil {
 		return v1, nil
 	}
+	return evalTreeOperator(ctx, v1, expr.expr2, expr.opToken.Val, expr.opToken, "unimplemented: "+expr.opToken.Val, expr.opToken)
 }
 
 func (expr *notExpression) Evaluate(ctx *ExecutionContext) (*Value, error) {
@@ -227,53 +178,17 @@ func (expr *simpleExpression) Evaluate(ctx *ExecutionContext) (*Value, error) {
 	if err != nil {
 		return nil, err
 	}
-	result := t1
-
 	if expr.negativeSign {
-		if result.IsNumber() {
-			switch {
-			case result.IsFloat():
-				result = AsValue(-1 * result.Float())
-			case result.IsInteger():
-				result = AsValue(-1 * result.Integer())
-			default:
-				return nil, ctx.Error("Operation between a number and a non-(float/integer) is not possible", nil)
-			}
-		} else {
-			return nil, ctx.Error("Negative sign on a non-number expression", expr.GetPositionToken())
-		}
-	}
-
-	if expr.term2 != nil {
-		t2, err := expr.term2.Evaluate(ctx)
+		result, err := negativeSign(&vmSlot{v: t1}, expr.GetPositionToken(), ctx)
 		if err != nil {
 			return nil, err
 		}
-		switch expr.opToken.Val {
-		case "+":
-			if result.IsString() || t2.IsString() {
-				// Result will be a string
-				return AsValue(result.String() + t2.String()), nil
-			}
-			if result.IsFloat() || t2.IsFloat() {
-				// Result will be a float
-				return AsValue(result.Float() + t2.Float()), nil
-			}
-			// Result will be an integer
-			return AsValue(result.Integer() + t2.Integer()), nil
-		case "-":
-			if result.IsFloat() || t2.IsFloat() {
-				// Result will be a float
-				return AsValue(result.Float() - t2.Float()), nil
-			}
-			// Result will be an integer
-			return AsValue(result.Integer() - t2.Integer()), nil
-		default:
-			return nil, ctx.Error("Unimplemented", expr.GetPositionToken())
-		}
+		t1 = result.value()
 	}
-
-	return result, nil
+	if expr.term2 == nil {
+		return t1, nil
+	}
+	return evalTreeOperator(ctx, t1, expr.term2, expr.opToken.Val, expr.opToken, "Unimplemented", expr.GetPositionToken())
 }
 
 func (expr *term) Evaluate(ctx *ExecutionContext) (*Value, error) {
@@ -281,47 +196,10 @@ func (expr *term) Evaluate(ctx *ExecutionContext) (*Value, error) {
 	if err != nil {
 		return nil, err
 	}
-	if expr.factor2 != nil {
-		f2, err := expr.factor2.Evaluate(ctx)
-		if err != nil {
-			return nil, err
-		}
-		switch expr.opToken.Val {
-		case "*":
-			if f1.IsFloat() || f2.IsFloat() {
-				// Result will be float
-				return AsValue(f1.Float() * f2.Float()), nil
-			}
-			// Result will be int
-			return AsValue(f1.Integer() * f2.Integer()), nil
-		case "/":
-			if f1.IsFloat() || f2.IsFloat() {
-				// Result will be float
-				divisor := f2.Float()
-				if divisor == 0 {
-					return nil, ctx.Error("float divide by zero", expr.factor2.GetPositionToken())
-				}
-				return AsValue(f1.Float() / divisor), nil
-			}
-			// Result will be int
-			divisor := f2.Integer()
-			if divisor == 0 {
-				return nil, ctx.Error("integer divide by zero", expr.factor2.GetPositionToken())
-			}
-			return AsValue(f1.Integer() / divisor), nil
-		case "%":
-			// Result will be int
-			divisor := f2.Integer()
-			if divisor == 0 {
-				return nil, ctx.Error("integer divide by zero", expr.factor2.GetPositionToken())
-			}
-			return AsValue(f1.Integer() % divisor), nil
-		default:
-			return nil, ctx.Error("unimplemented", expr.opToken)
-		}
-	} else {
+	if expr.factor2 == nil {
 		return f1, nil
 	}
+	return evalTreeOperator(ctx, f1, expr.factor2, expr.opToken.Val, expr.factor2.GetPositionToken(), "unimplemented", expr.opToken)
 }
 
 func (expr *power) Evaluate(ctx *ExecutionContext) (*Value, error) {
@@ -329,14 +207,30 @@ func (expr *power) Evaluate(ctx *ExecutionContext) (*Value, error) {
 	if err != nil {
 		return nil, err
 	}
-	if expr.power2 != nil {
-		p2, err := expr.power2.Evaluate(ctx)
-		if err != nil {
-			return nil, err
-		}
-		return AsValue(math.Pow(p1.Float(), p2.Float())), nil
+	if expr.power2 == nil {
+		return p1, nil
+	}
+	return evalTreeOperator(ctx, p1, expr.power2, "^", nil, "", nil)
+}
+
+// evalTreeOperator evaluates the binary operator op of an expression node
+// with the left operand v1 and the right operand e2 using evalOperator, like
+// the VM does. t is the token for errors of the operator; if op isn't a
+// binary operator, the node fails with msg at msgToken.
+func evalTreeOperator(ctx *ExecutionContext, v1 *Value, e2 IEvaluator, op string, t *Token, msg string, msgToken *Token) (*Value, error) {
+	v2, err := e2.Evaluate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	binaryOp, ok := binaryOperators[op]
+	if !ok {
+		return nil, ctx.Error(msg, msgToken)
+	}
+	result, err := evalOperator(binaryOp, &vmSlot{v: v1}, &vmSlot{v: v2}, t, ctx)
+	if err != nil {
+		return nil, err
 	}
-	return p1, nil
+	return result.value(), nil
 }
 
 func (p *Parser) parseFactor() (IEvaluator, error) {
@@ -532,8 +426,88 @@ func (p *Parser) ParseExpression() (IEvaluator, error) {
 
 	if exp.expr2 == nil {
 		// Shortcut for faster evaluation
-		return exp.expr1, nil
+		return compileExpression(exp.expr1), nil
 	}
 
-	return exp, nil
+	return compileExpression(exp), nil
+}
+
+func (expr *Expression) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteEvaluator(expr.expr1)
+	enc.WriteEvaluator(expr.expr2)
+	enc.WriteToken(expr.opToken)
+	return nil
+}
+
+func (expr *Expression) DecodeNode(dec *NodeDecoder) error {
+	expr.expr1 = dec.readRequiredEvaluator()
+	expr.expr2 = dec.ReadEvaluator()
+	expr.opToken = dec.ReadToken()
+	return nil
+}
+
+func (expr *relationalExpression) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteEvaluator(expr.expr1)
+	enc.WriteEvaluator(expr.expr2)
+	enc.WriteToken(expr.opToken)
+	return nil
+}
+
+func (expr *relationalExpression) DecodeNode(dec *NodeDecoder) error {
+	expr.expr1 = dec.readRequiredEvaluator()
+	expr.expr2 = dec.ReadEvaluator()
+	expr.opToken = dec.ReadToken()
+	return nil
+}
+
+func (expr *notExpression) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteEvaluator(expr.expr)
+	return nil
+}
+
+func (expr *notExpression) DecodeNode(dec *NodeDecoder) error {
+	expr.expr = dec.readRequiredEvaluator()
+	return nil
+}
+
+func (expr *simpleExpression) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteBool(expr.negativeSign)
+	enc.WriteEvaluator(expr.term1)
+	enc.WriteEvaluator(expr.term2)
+	enc.WriteToken(expr.opToken)
+	return nil
+}
+
+func (expr *simpleExpression) DecodeNode(dec *NodeDecoder) error {
+	expr.negativeSign = dec.ReadBool()
+	expr.term1 = dec.readRequiredEvaluator()
+	expr.term2 = dec.ReadEvaluator()
+	expr.opToken = dec.ReadToken()
+	return nil
+}
+
+func (expr *term) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteEvaluator(expr.factor1)
+	enc.WriteEvaluator(expr.factor2)
+	enc.WriteToken(expr.opToken)
+	return nil
+}
+
+func (expr *term) DecodeNode(dec *NodeDecoder) error {
+	expr.factor1 = dec.readRequiredEvaluator()
+	expr.factor2 = dec.ReadEvaluator()
+	expr.opToken = dec.ReadToken()
+	return nil
+}
+
+func (expr *power) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteEvaluator(expr.power1)
+	enc.WriteEvaluator(expr.power2)
+	return nil
+}
+
+func (expr *power) DecodeNode(dec *NodeDecoder) error {
+	expr.power1 = dec.readRequiredEvaluator()
+	expr.power2 = dec.ReadEvaluator()
+	return nil
 }
@@ -0,0 +1,91 @@
+//go:build pongo2_generate
+
+package pongo2_test
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/flosch/pongo2/v7"
+)
+
+// TestGeneratedTemplates compiles the templates of template_tests to Go
+// (see GenerateGo) and runs TestGeneratedCorpus with them. The generated
+// code is built in a copy of the module in a temporary directory, together
+// with the fixtures of pongo2_template_test.go. It takes a while, so it's
+// only built with the pongo2_generate build tag:
+//
+//	go test -tags pongo2_generate -run '^TestGeneratedTemplates$' .
+func TestGeneratedTemplates(t *testing.T) {
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not available")
+	}
+
+	matches, err := filepath.Glob("./template_tests/*.tpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates := make(map[string]*pongo2.Template)
+	var index strings.Builder
+	index.WriteString("\nvar generatedCorpus = map[string]*pongo2.GeneratedTemplate{\n")
+	for idx, match := range matches {
+		tpl, err := pongo2.FromFile(match)
+		if err != nil {
+			t.Fatalf("Error on FromFile('%s'): %s", match, err.Error())
+		}
+		optsStr, _ := os.ReadFile(fmt.Sprintf("%s.options", match))
+		tpl.Options.TrimBlocks = strings.Contains(string(optsStr), "TrimBlocks=true")
+		tpl.Options.LStripBlocks = strings.Contains(string(optsStr), "LStripBlocks=true")
+
+		name := fmt.Sprintf("corpus%03d", idx+1)
+		templates[name] = tpl
+		fmt.Fprintf(&index, "\t%q: %s,\n", match, name)
+	}
+	index.WriteString("}\n")
+
+	src, err := pongo2.GenerateGo("pongo2_test", templates)
+	if err != nil {
+		t.Fatalf("Error on GenerateGo: %s", err.Error())
+	}
+	src = append([]byte("//go:build pongo2_generated\n\n"), src...)
+	src = append(src, index.String()...)
+
+	// The package is copied, so the types registered by the fixtures (see
+	// RegisterEncodableNode) have the same names as in this package.
+	repo, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	files := map[string][]byte{"zz_generated_corpus_test.go": src}
+	for _, name := range append(sources, "go.mod", "go.sum") {
+		if strings.HasSuffix(name, "_test.go") && !slices.Contains([]string{"pongo2_template_test.go", "pongo2_generated_test.go", generatedComplexFile}, name) {
+			continue
+		}
+		if files[name], err = os.ReadFile(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command(goTool, "test", "-count=1", "-tags", "pongo2_generated", "-run", "^TestGeneratedCorpus$", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOWORK=off", "PONGO2_TEST_DIR="+repo)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("TestGeneratedCorpus failed: %s\n%s", err, out)
+	}
+}
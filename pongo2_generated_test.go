@@ -0,0 +1,43 @@
+//go:build pongo2_generated
+
+package pongo2_test
+
+import (
+	"bytes"
+	"maps"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/flosch/pongo2/v7"
+)
+
+// TestGeneratedCorpus is run by TestGeneratedTemplates with the templates of
+// template_tests compiled to Go (generatedCorpus). It's built in a copy
+// of the module and runs in the directory PONGO2_TEST_DIR (the repository).
+func TestGeneratedCorpus(t *testing.T) {
+	t.Chdir(os.Getenv("PONGO2_TEST_DIR"))
+	pongo2.Globals["this_is_a_global_variable"] = "this is a global text"
+
+	for _, match := range slices.Sorted(maps.Keys(generatedCorpus)) {
+		t.Run(match, func(t *testing.T) {
+			tpl, err := pongo2.DefaultSet.FromGenerated(generatedCorpus[match])
+			if err != nil {
+				t.Fatalf("Error on FromGenerated('%s'): %s", match, err.Error())
+			}
+
+			testOut, err := os.ReadFile(match + ".out")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tplOut, err := tpl.ExecuteBytes(tplContext)
+			if err != nil {
+				t.Fatalf("Error on Execute('%s'): %s", match, err.Error())
+			}
+			tplOut = testTemplateFixes.fixIfNeeded(match, tplOut)
+			if !bytes.Equal(testOut, tplOut) {
+				t.Errorf("Failed: test_out != tpl_out for generated %s:\n%s", match, tplOut)
+			}
+		})
+	}
+}
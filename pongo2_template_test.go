@@ -77,6 +77,14 @@ func (node *tagSandboxDemoTag) Execute(ctx *pongo2.ExecutionContext, writer pong
 	return err
 }
 
+func (node *tagSandboxDemoTag) EncodeNode(enc *pongo2.NodeEncoder) error {
+	return nil
+}
+
+func (node *tagSandboxDemoTag) DecodeNode(dec *pongo2.NodeDecoder) error {
+	return nil
+}
+
 func tagSandboxDemoTagParser(doc *pongo2.Parser, start *pongo2.Token, arguments *pongo2.Parser) (pongo2.INodeTag, error) {
 	return &tagSandboxDemoTag{}, nil
 }
@@ -92,6 +100,7 @@ func init() {
 	pongo2.RegisterFilter("unbanned_filter", BannedFilterFn)    //nolint:errcheck
 	pongo2.RegisterTag("banned_tag", tagSandboxDemoTagParser)   //nolint:errcheck
 	pongo2.RegisterTag("unbanned_tag", tagSandboxDemoTagParser) //nolint:errcheck
+	pongo2.RegisterEncodableNode(&tagSandboxDemoTag{})          //nolint:errcheck
 
 	pongo2.DefaultSet.BanFilter("banned_filter") //nolint:errcheck
 	pongo2.DefaultSet.BanTag("banned_tag")       //nolint:errcheck
@@ -416,6 +425,49 @@ func TestTemplates(t *testing.T) {
 	}
 }
 
+func TestSerializedTemplates(t *testing.T) {
+	pongo2.Globals["this_is_a_global_variable"] = "this is a global text"
+
+	matches, err := filepath.Glob("./template_tests/*.tpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for idx, match := range matches {
+		t.Run(fmt.Sprintf("%03d-%s", idx+1, match), func(t *testing.T) {
+			tpl, err := pongo2.FromFile(match)
+			if err != nil {
+				t.Fatalf("Error on FromFile('%s'): %s", match, err.Error())
+			}
+
+			optsStr, _ := os.ReadFile(fmt.Sprintf("%s.options", match))
+			tpl.Options.TrimBlocks = strings.Contains(string(optsStr), "TrimBlocks=true")
+			tpl.Options.LStripBlocks = strings.Contains(string(optsStr), "LStripBlocks=true")
+
+			data, err := tpl.Serialize()
+			if err != nil {
+				t.Fatalf("Error on Serialize('%s'): %s", match, err.Error())
+			}
+			decoded, err := pongo2.DefaultSet.FromSerialized(data)
+			if err != nil {
+				t.Fatalf("Error on FromSerialized('%s'): %s", match, err.Error())
+			}
+
+			testOut, err := os.ReadFile(fmt.Sprintf("%s.out", match))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tplOut, err := decoded.ExecuteBytes(tplContext)
+			if err != nil {
+				t.Fatalf("Error on Execute('%s'): %s", match, err.Error())
+			}
+			tplOut = testTemplateFixes.fixIfNeeded(match, tplOut)
+			if !bytes.Equal(testOut, tplOut) {
+				t.Errorf("Failed: test_out != tpl_out for serialized %s:\n%s", match, tplOut)
+			}
+		})
+	}
+}
+
 func TestBlockTemplates(t *testing.T) {
 	// debug = true
 
@@ -624,6 +676,24 @@ func TestBaseDirectory(t *testing.T) {
 	}
 }
 
+//go:generate go run generate_complex.go
+
+// generatedComplexFile contains template_tests/complex.tpl compiled to Go
+// (generatedComplex) for BenchmarkExecuteComplexGenerated. It's generated
+// by generate_complex.go; run go generate after changing the template
+// or the code generator.
+const generatedComplexFile = "generated_complex_test.go"
+
+// newGeneratedComplexSet returns the set template_tests/complex.tpl is
+// compiled to Go for (see generate_complex.go).
+func newGeneratedComplexSet(tb testing.TB) *pongo2.TemplateSet {
+	buf, err := os.ReadFile("template_tests/complex.tpl")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return pongo2.NewSet("generated", pongo2.NewMapLoader(map[string]string{"complex.tpl": string(buf)}))
+}
+
 func BenchmarkCache(b *testing.B) {
 	cacheSet := pongo2.NewSet("cache set", pongo2.MustNewLocalFileSystemLoader(""))
 	for b.Loop() {
@@ -667,6 +737,36 @@ func BenchmarkExecuteComplex(b *testing.B) {
 	}
 }
 
+// BenchmarkExecuteComplexGenerated executes template_tests/complex.tpl
+// compiled to Go, compare with BenchmarkExecuteComplexInterpreted.
+func BenchmarkExecuteComplexGenerated(b *testing.B) {
+	tpl, err := newGeneratedComplexSet(b).FromGenerated(generatedComplex)
+	if err != nil {
+		b.Fatalf("%s (run go generate to update %s)", err, generatedComplexFile)
+	}
+	for b.Loop() {
+		err = tpl.ExecuteWriterUnbuffered(tplContext, io.Discard)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkExecuteComplexInterpreted executes the template of
+// BenchmarkExecuteComplexGenerated using the interpreter.
+func BenchmarkExecuteComplexInterpreted(b *testing.B) {
+	tpl, err := newGeneratedComplexSet(b).FromFile("complex.tpl")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for b.Loop() {
+		err = tpl.ExecuteWriterUnbuffered(tplContext, io.Discard)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func BenchmarkCompileAndExecuteComplex(b *testing.B) {
 	set := pongo2.NewSet("bench", pongo2.MustNewLocalFileSystemLoader(""))
 	buf, err := os.ReadFile("template_tests/complex.tpl")
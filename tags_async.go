@@ -0,0 +1,67 @@
+package pongo2
+
+// tagAsyncNode represents the {% async %} tag.
+//
+// The async tag renders its content in parallel with the rest of the
+// template. The output is inserted at the tag's position, so the output of
+// the template is the same as without the tag. It's meant for parts of a
+// page calling slow functions (e.g. fetching data from other services):
+//
+//	{% async %}{{ weather(city) }}{% endasync %}
+//	{% async %}{{ news(5) }}{% endasync %}
+//
+// The content is rendered by another goroutine using a copy of the current
+// context: variables set within it (e.g. using {% set %}) aren't visible
+// after the tag and tags like cycle or ifchanged keep their state
+// separately. Macros called within the tag are executed using its context.
+// The functions called must be safe for concurrent use.
+//
+// The number of goroutines rendering at the same time is limited per
+// execution by TemplateSet.MaxParallel. If the limit is reached, or within
+// tags capturing their content (like filter or spaceless) and macros, the
+// content is rendered immediately instead (with the same output). If
+// rendering fails, the first error in document order is returned.
+//
+// Use {% include ... parallel %} to render an included template in parallel.
+type tagAsyncNode struct {
+	wrapper *NodeWrapper
+}
+
+// Execute renders the content in parallel (see executeParallel).
+func (node *tagAsyncNode) Execute(ctx *ExecutionContext, writer TemplateWriter) error {
+	return executeParallel(ctx, writer, node.wrapper.Execute)
+}
+
+// tagAsyncParser parses the {% async %} tag. It takes no arguments and wraps
+// content until {% endasync %}.
+func tagAsyncParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, error) {
+	if arguments.Remaining() > 0 {
+		return nil, arguments.Error("Tag 'async' does not take any argument.", nil)
+	}
+
+	wrapper, endargs, err := doc.WrapUntilTag("endasync")
+	if err != nil {
+		return nil, err
+	}
+	if endargs.Remaining() > 0 {
+		return nil, endargs.Error("Tag 'endasync' does not take any argument.", nil)
+	}
+	doc.template.parallel = true
+
+	return &tagAsyncNode{wrapper: wrapper}, nil
+}
+
+func (node *tagAsyncNode) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteWrapper(node.wrapper)
+	return nil
+}
+
+func (node *tagAsyncNode) DecodeNode(dec *NodeDecoder) error {
+	node.wrapper = dec.ReadWrapper()
+	return nil
+}
+
+func init() {
+	mustRegisterTag("async", tagAsyncParser)
+	mustRegisterEncodableNode(&tagAsyncNode{})
+}
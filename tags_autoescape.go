@@ -70,6 +70,19 @@ func tagAutoescapeParser(doc *Parser, start *Token, arguments *Parser) (INodeTag
 	return autoescapeNode, nil
 }
 
+func (node *tagAutoescapeNode) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteWrapper(node.wrapper)
+	enc.WriteBool(node.autoescape)
+	return nil
+}
+
+func (node *tagAutoescapeNode) DecodeNode(dec *NodeDecoder) error {
+	node.wrapper = dec.ReadWrapper()
+	node.autoescape = dec.ReadBool()
+	return nil
+}
+
 func init() {
 	mustRegisterTag("autoescape", tagAutoescapeParser)
+	mustRegisterEncodableNode(&tagAutoescapeNode{})
 }
@@ -45,18 +45,19 @@ type tagBlockNode struct {
 }
 
 // getBlockWrappers collects all block wrappers with the same name from the
-// template inheritance chain. It walks from the current template down through
-// all child templates, gathering overriding block definitions.
-func (node *tagBlockNode) getBlockWrappers(tpl *Template) []*NodeWrapper {
+// template inheritance chain being executed. It walks from the root template
+// down through all child templates, gathering overriding block definitions.
+func (node *tagBlockNode) getBlockWrappers(ctx *ExecutionContext) []*NodeWrapper {
 	nodeWrappers := make([]*NodeWrapper, 0)
-	var t *NodeWrapper
 
-	for tpl != nil {
-		t = tpl.blocks[node.name]
-		if t != nil {
+	inheritance := ctx.inheritance
+	if inheritance == nil {
+		inheritance = []*Template{ctx.template}
+	}
+	for _, tpl := range inheritance {
+		if t := tpl.blocks[node.name]; t != nil {
 			nodeWrappers = append(nodeWrappers, t)
 		}
-		tpl = tpl.child
 	}
 
 	return nodeWrappers
@@ -65,13 +66,12 @@ func (node *tagBlockNode) getBlockWrappers(tpl *Template) []*NodeWrapper {
 // Execute renders the most-derived (child-most) version of this block.
 // It sets up the block context with Super() support for accessing parent blocks.
 func (node *tagBlockNode) Execute(ctx *ExecutionContext, writer TemplateWriter) error {
-	tpl := ctx.template
-	if tpl == nil {
+	if ctx.template == nil {
 		panic("internal error: tpl == nil")
 	}
 
 	// Determine the block to execute
-	blockWrappers := node.getBlockWrappers(tpl)
+	blockWrappers := node.getBlockWrappers(ctx)
 	lenBlockWrappers := len(blockWrappers)
 
 	if lenBlockWrappers == 0 {
@@ -88,6 +88,10 @@ func (node *tagBlockNode) Execute(ctx *ExecutionContext, writer TemplateWriter)
 		return err
 	}
 
+	// Block boundaries are flush points when streaming (see StreamOptions)
+	if fw, ok := writer.(flushWriter); ok {
+		return fw.flush(true)
+	}
 	return nil
 }
 
@@ -171,6 +175,19 @@ func tagBlockParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, err
 	return &tagBlockNode{name: nameToken.Val}, nil
 }
 
+// EncodeNode writes the block's name. Its content is stored by the template
+// (see Template.blocks).
+func (node *tagBlockNode) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteString(node.name)
+	return nil
+}
+
+func (node *tagBlockNode) DecodeNode(dec *NodeDecoder) error {
+	node.name = dec.ReadString()
+	return nil
+}
+
 func init() {
 	mustRegisterTag("block", tagBlockParser)
+	mustRegisterEncodableNode(&tagBlockNode{})
 }
@@ -54,6 +54,15 @@ func tagCommentParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, e
 	return commentNode, nil
 }
 
+func (node *tagCommentNode) EncodeNode(enc *NodeEncoder) error {
+	return nil
+}
+
+func (node *tagCommentNode) DecodeNode(dec *NodeDecoder) error {
+	return nil
+}
+
 func init() {
 	mustRegisterTag("comment", tagCommentParser)
+	mustRegisterEncodableNode(&tagCommentNode{})
 }
@@ -170,6 +170,23 @@ func tagCycleParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, err
 	return cycleNode, nil
 }
 
+func (node *tagCycleNode) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteToken(node.position)
+	enc.writeEvaluators(node.args)
+	enc.WriteString(node.asName)
+	enc.WriteBool(node.silent)
+	return nil
+}
+
+func (node *tagCycleNode) DecodeNode(dec *NodeDecoder) error {
+	node.position = dec.ReadToken()
+	node.args = dec.readEvaluators()
+	node.asName = dec.ReadString()
+	node.silent = dec.ReadBool()
+	return nil
+}
+
 func init() {
 	mustRegisterTag("cycle", tagCycleParser)
+	mustRegisterEncodableNode(&tagCycleNode{})
 }
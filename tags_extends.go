@@ -33,6 +33,16 @@ package pongo2
 //	    <h1>Welcome to my page!</h1>
 //	{% endblock %}
 //
+// To override a template provided by a later loader of the template set (e.g. a
+// theme overriding the default templates), extend the template of the same name
+// provided by the next loader using "super":
+//
+//	{% extends super %}
+//	{% block footer %}Custom footer{% endblock %}
+//
+// A template extending itself (directly or through other templates) fails to
+// compile.
+//
 // Note: Only one extends tag is allowed per template, and it must be at the root level.
 type tagExtendsNode struct {
 	filename string
@@ -45,7 +55,7 @@ func (node *tagExtendsNode) Execute(ctx *ExecutionContext, writer TemplateWriter
 }
 
 // tagExtendsParser parses the {% extends %} tag. It requires a string filename
-// argument and establishes the parent-child template relationship at parse time.
+// argument (or "super") and establishes the parent-child template relationship at parse time.
 func tagExtendsParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, error) {
 	extendsNode := &tagExtendsNode{}
 
@@ -58,26 +68,46 @@ func tagExtendsParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, e
 		return nil, arguments.Error("This template has already one parent.", start)
 	}
 
+	var (
+		parentTemplate *Template
+		parentFilename string
+	)
 	if filenameToken := arguments.MatchType(TokenString); filenameToken != nil {
 		// prepared, static template
 
 		// Get parent's filename
-		parentFilename := doc.template.set.resolveFilename(doc.template, filenameToken.Val)
+		parentFilename = doc.template.set.resolveFilename(doc.template, filenameToken.Val)
 
 		// Parse the parent
-		parentTemplate, err := doc.template.set.FromFile(parentFilename)
+		var err error
+		parentTemplate, err = doc.template.set.fromFile(doc.template, filenameToken.Val)
 		if err != nil {
 			return nil, err
 		}
+	} else if superToken := arguments.Match(TokenIdentifier, "super"); superToken != nil {
+		// The template of the same name provided by the next loader
+		if doc.template.isTplString {
+			return nil, arguments.Error("Tag 'extends super' cannot be used in string templates.", superToken)
+		}
+		origin := doc.template.origin
+		lookup := origin.lookup
+		lookup.from = doc.template
 
-		// Keep track of things
-		parentTemplate.child = doc.template
-		doc.template.parent = parentTemplate
-		extendsNode.filename = parentFilename
+		var err error
+		parentTemplate, err = doc.template.set.loadTemplate(lookup, origin.loader+1, doc.template.dependencyMode())
+		if err != nil {
+			return nil, updateErrorToken(err, doc.template, superToken)
+		}
+		doc.template.addDependencies(parentTemplate)
+		parentFilename = parentTemplate.name
 	} else {
-		return nil, arguments.Error("Tag 'extends' requires a template filename as string.", nil)
+		return nil, arguments.Error("Tag 'extends' requires a template filename as string or 'super'.", nil)
 	}
 
+	// Keep track of things
+	doc.template.parent = parentTemplate
+	extendsNode.filename = parentFilename
+
 	if arguments.Remaining() > 0 {
 		return nil, arguments.Error("Tag 'extends' does only take 1 argument.", nil)
 	}
@@ -85,6 +115,19 @@ func tagExtendsParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, e
 	return extendsNode, nil
 }
 
+// EncodeNode writes the parent's filename. The parent itself is stored by
+// the template (see Template.parent).
+func (node *tagExtendsNode) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteString(node.filename)
+	return nil
+}
+
+func (node *tagExtendsNode) DecodeNode(dec *NodeDecoder) error {
+	node.filename = dec.ReadString()
+	return nil
+}
+
 func init() {
 	mustRegisterTag("extends", tagExtendsParser)
+	mustRegisterEncodableNode(&tagExtendsNode{})
 }
@@ -2,6 +2,7 @@ package pongo2
 
 import (
 	"bytes"
+	"fmt"
 )
 
 // nodeFilterCall represents a single filter call with its name and optional parameter.
@@ -76,9 +77,9 @@ func (node *tagFilterNode) Execute(ctx *ExecutionContext, writer TemplateWriter)
 		} else {
 			param = AsValue(nil)
 		}
-		value, err = ctx.template.set.ApplyFilter(call.name, value, param)
+		value, err = ctx.template.set.applyFilter(ctx, call.name, value, param)
 		if err != nil {
-			return ctx.Error(err.Error(), node.position)
+			return ctx.OrigError(err, node.position)
 		}
 	}
 
@@ -113,6 +114,12 @@ func tagFilterParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, er
 		}
 		filterCall.name = nameToken.Val
 
+		// Check sandbox filter restriction
+		if _, isBanned := doc.template.set.bannedFilters[nameToken.Val]; isBanned {
+			return nil, arguments.errorOfKind(ErrSandboxViolation,
+				fmt.Sprintf("Usage of filter '%s' is not allowed (sandbox restriction active).", nameToken.Val), nameToken)
+		}
+
 		if arguments.MatchOne(TokenSymbol, ":") != nil {
 			// Filter parameter
 			// NOTICE: we can't use ParseExpression() here, because it would parse the next filter "|..." as well in the argument list
@@ -137,6 +144,31 @@ func tagFilterParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, er
 	return filterNode, nil
 }
 
+func (node *tagFilterNode) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteToken(node.position)
+	enc.WriteWrapper(node.bodyWrapper)
+	enc.writeUvarint(uint64(len(node.filterChain)))
+	for _, call := range node.filterChain {
+		enc.WriteString(call.name)
+		enc.WriteEvaluator(call.paramExpr)
+	}
+	return nil
+}
+
+func (node *tagFilterNode) DecodeNode(dec *NodeDecoder) error {
+	node.position = dec.ReadToken()
+	node.bodyWrapper = dec.ReadWrapper()
+	node.filterChain = make([]*nodeFilterCall, dec.readCount())
+	for i := range node.filterChain {
+		node.filterChain[i] = &nodeFilterCall{
+			name:      dec.ReadString(),
+			paramExpr: dec.ReadEvaluator(),
+		}
+	}
+	return nil
+}
+
 func init() {
 	mustRegisterTag("filter", tagFilterParser)
+	mustRegisterEncodableNode(&tagFilterNode{})
 }
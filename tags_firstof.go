@@ -80,6 +80,19 @@ func tagFirstofParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, e
 	return firstofNode, nil
 }
 
+func (node *tagFirstofNode) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteToken(node.position)
+	enc.writeEvaluators(node.args)
+	return nil
+}
+
+func (node *tagFirstofNode) DecodeNode(dec *NodeDecoder) error {
+	node.position = dec.ReadToken()
+	node.args = dec.readEvaluators()
+	return nil
+}
+
 func init() {
 	mustRegisterTag("firstof", tagFirstofParser)
+	mustRegisterEncodableNode(&tagFirstofNode{})
 }
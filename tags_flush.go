@@ -0,0 +1,47 @@
+package pongo2
+
+// tagFlushNode represents the {% flush %} tag.
+//
+// The flush tag sends the output rendered so far to the client when the
+// template is executed using Template.ExecuteStream. The browser can then
+// start loading stylesheets and scripts while the rest of the page is
+// rendered:
+//
+//	<head>
+//	    <link rel="stylesheet" href="/style.css">
+//	</head>
+//	{% flush %}
+//	<body>{{ slow_function() }}</body>
+//
+// The tag is a no-op when using the other Execute methods and within tags
+// capturing their content (like filter or spaceless).
+type tagFlushNode struct{}
+
+// Execute flushes the output if the writer supports it.
+func (node *tagFlushNode) Execute(ctx *ExecutionContext, writer TemplateWriter) error {
+	if fw, ok := writer.(flushWriter); ok {
+		return fw.flush(false)
+	}
+	return nil
+}
+
+// tagFlushParser parses the {% flush %} tag, which takes no arguments.
+func tagFlushParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, error) {
+	if arguments.Remaining() > 0 {
+		return nil, arguments.Error("Tag 'flush' does not take any argument.", nil)
+	}
+	return &tagFlushNode{}, nil
+}
+
+func (node *tagFlushNode) EncodeNode(enc *NodeEncoder) error {
+	return nil
+}
+
+func (node *tagFlushNode) DecodeNode(dec *NodeDecoder) error {
+	return nil
+}
+
+func init() {
+	mustRegisterTag("flush", tagFlushParser)
+	mustRegisterEncodableNode(&tagFlushNode{})
+}
@@ -2,8 +2,9 @@ package pongo2
 
 // tagForNode represents the {% for %} tag.
 //
-// The for tag loops over each item in a sequence (slice, array, map, or string).
-// It provides loop variables through the special "forloop" object.
+// The for tag loops over each item in a sequence (slice, array, map, string,
+// range-over-func iterator or channel). It provides loop variables through
+// the special "forloop" object.
 //
 // Basic usage:
 //
@@ -53,9 +54,15 @@ package pongo2
 //	    <li>{{ forloop.Counter }}. {{ item }}</li>
 //	    {% if forloop.Last %}</ul>{% endif %}
 //	{% endfor %}
+//
+// Iterators (iter.Seq and iter.Seq2, iterated like slices and maps) and
+// channels are consumed lazily, one item ahead of the loop body to know the
+// last item. As the number of items is unknown before, forloop.Revcounter and
+// forloop.Revcounter0 are -1 except for the last item. Using "reversed" or
+// "sorted" consumes them entirely before the first iteration.
 type tagForNode struct {
 	key             string
-	value           string // only for maps: for key, value in map
+	value           string // only for maps and iter.Seq2: for key, value in map
 	objectEvaluator IEvaluator
 	reversed        bool
 	sorted          bool
@@ -77,7 +84,22 @@ type tagForLoopInformation struct {
 
 // Execute iterates over the object and renders the body for each item.
 // If the object is empty, it renders the empty wrapper (if present).
-func (node *tagForNode) Execute(ctx *ExecutionContext, writer TemplateWriter) (forError error) {
+func (node *tagForNode) Execute(ctx *ExecutionContext, writer TemplateWriter) error {
+	var empty func(*ExecutionContext) error
+	if node.emptyWrapper != nil {
+		empty = func(forCtx *ExecutionContext) error {
+			return node.emptyWrapper.Execute(forCtx, writer)
+		}
+	}
+	return node.iterate(ctx, node.objectEvaluator.Evaluate, func(forCtx *ExecutionContext) error {
+		return node.bodyWrapper.Execute(forCtx, writer)
+	}, empty)
+}
+
+// iterate iterates over the object evaluated by object and calls body for
+// each item. If the object is empty, it calls empty (if not nil). object,
+// body and empty are called with the context of the loop.
+func (node *tagForNode) iterate(ctx *ExecutionContext, object func(*ExecutionContext) (*Value, error), body, empty func(*ExecutionContext) error) (forError error) {
 	// Backup forloop (as parentloop in public context), key-name and value-name
 	forCtx := NewChildExecutionContext(ctx)
 	parentloop := forCtx.Private["forloop"]
@@ -95,7 +117,7 @@ func (node *tagForNode) Execute(ctx *ExecutionContext, writer TemplateWriter) (f
 	// Register loopInfo in public context
 	forCtx.Private["forloop"] = loopInfo
 
-	obj, err := node.objectEvaluator.Evaluate(forCtx)
+	obj, err := object(forCtx)
 	if err != nil {
 		return err
 	}
@@ -116,11 +138,16 @@ func (node *tagForNode) Execute(ctx *ExecutionContext, writer TemplateWriter) (f
 		if idx+1 == count {
 			loopInfo.Last = true
 		}
-		loopInfo.Revcounter = count - idx
-		loopInfo.Revcounter0 = count - (idx + 1)
+		if count < 0 {
+			// Unknown until the last item (iterators and channels)
+			loopInfo.Revcounter, loopInfo.Revcounter0 = -1, -1
+		} else {
+			loopInfo.Revcounter = count - idx
+			loopInfo.Revcounter0 = count - (idx + 1)
+		}
 
 		// Render elements with updated context
-		err := node.bodyWrapper.Execute(forCtx, writer)
+		err := body(forCtx)
 		if err != nil {
 			forError = err
 			return false
@@ -128,8 +155,8 @@ func (node *tagForNode) Execute(ctx *ExecutionContext, writer TemplateWriter) (f
 		return true
 	}, func() {
 		// Nothing to iterate over (maybe wrong type or no items)
-		if node.emptyWrapper != nil {
-			err := node.emptyWrapper.Execute(forCtx, writer)
+		if empty != nil {
+			err := empty(forCtx)
 			if err != nil {
 				forError = err
 			}
@@ -212,6 +239,29 @@ func tagForParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, error
 	return forNode, nil
 }
 
+func (node *tagForNode) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteString(node.key)
+	enc.WriteString(node.value)
+	enc.WriteEvaluator(node.objectEvaluator)
+	enc.WriteBool(node.reversed)
+	enc.WriteBool(node.sorted)
+	enc.WriteWrapper(node.bodyWrapper)
+	enc.WriteWrapper(node.emptyWrapper)
+	return nil
+}
+
+func (node *tagForNode) DecodeNode(dec *NodeDecoder) error {
+	node.key = dec.ReadString()
+	node.value = dec.ReadString()
+	node.objectEvaluator = dec.readRequiredEvaluator()
+	node.reversed = dec.ReadBool()
+	node.sorted = dec.ReadBool()
+	node.bodyWrapper = dec.ReadWrapper()
+	node.emptyWrapper = dec.ReadWrapper()
+	return nil
+}
+
 func init() {
 	mustRegisterTag("for", tagForParser)
+	mustRegisterEncodableNode(&tagForNode{})
 }
@@ -124,6 +124,19 @@ func tagIfParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, error)
 	return ifNode, nil
 }
 
+func (node *tagIfNode) EncodeNode(enc *NodeEncoder) error {
+	enc.writeEvaluators(node.conditions)
+	enc.writeWrappers(node.wrappers)
+	return nil
+}
+
+func (node *tagIfNode) DecodeNode(dec *NodeDecoder) error {
+	node.conditions = dec.readEvaluators()
+	node.wrappers = dec.readWrappers()
+	return nil
+}
+
 func init() {
 	mustRegisterTag("if", tagIfParser)
+	mustRegisterEncodableNode(&tagIfNode{})
 }
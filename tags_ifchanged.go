@@ -188,6 +188,21 @@ func tagIfchangedParser(doc *Parser, start *Token, arguments *Parser) (INodeTag,
 	return ifchangedNode, nil
 }
 
+func (node *tagIfchangedNode) EncodeNode(enc *NodeEncoder) error {
+	enc.writeEvaluators(node.watchedExpr)
+	enc.WriteWrapper(node.thenWrapper)
+	enc.WriteWrapper(node.elseWrapper)
+	return nil
+}
+
+func (node *tagIfchangedNode) DecodeNode(dec *NodeDecoder) error {
+	node.watchedExpr = dec.readEvaluators()
+	node.thenWrapper = dec.ReadWrapper()
+	node.elseWrapper = dec.ReadWrapper()
+	return nil
+}
+
 func init() {
 	mustRegisterTag("ifchanged", tagIfchangedParser)
+	mustRegisterEncodableNode(&tagIfchangedNode{})
 }
@@ -97,6 +97,23 @@ func tagIfNotEqualParser(doc *Parser, start *Token, arguments *Parser) (INodeTag
 	return ifnotequalNode, nil
 }
 
+func (node *tagIfNotEqualNode) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteEvaluator(node.var1)
+	enc.WriteEvaluator(node.var2)
+	enc.WriteWrapper(node.thenWrapper)
+	enc.WriteWrapper(node.elseWrapper)
+	return nil
+}
+
+func (node *tagIfNotEqualNode) DecodeNode(dec *NodeDecoder) error {
+	node.var1 = dec.readRequiredEvaluator()
+	node.var2 = dec.readRequiredEvaluator()
+	node.thenWrapper = dec.ReadWrapper()
+	node.elseWrapper = dec.ReadWrapper()
+	return nil
+}
+
 func init() {
 	mustRegisterTag("ifnotequal", tagIfNotEqualParser)
+	mustRegisterEncodableNode(&tagIfNotEqualNode{})
 }
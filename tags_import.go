@@ -2,6 +2,8 @@ package pongo2
 
 import (
 	"fmt"
+	"maps"
+	"slices"
 )
 
 // tagImportNode represents the {% import %} tag.
@@ -46,8 +48,8 @@ type tagImportNode struct {
 func (node *tagImportNode) Execute(ctx *ExecutionContext, writer TemplateWriter) error {
 	for name, macro := range node.macros {
 		func(name string, macro *tagMacroNode) {
-			ctx.Private[name] = func(args ...*Value) (*Value, error) {
-				return macro.call(ctx, args...)
+			ctx.Private[name] = func(caller *ExecutionContext, args ...*Value) (*Value, error) {
+				return macro.call(ctx.macroContext(caller), args...)
 			}
 		}(name, macro)
 	}
@@ -74,11 +76,14 @@ func tagImportParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, er
 	}
 
 	// Compile the given template
-	tpl, err := doc.template.set.FromFile(importNode.filename)
+	tpl, err := doc.template.set.fromFile(doc.template, filenameToken.Val)
 	if err != nil {
 		return nil, updateErrorToken(err, doc.template, start)
 	}
 
+	// The imported macros are executed without executing the template
+	tpl.prepare()
+
 	for arguments.Remaining() > 0 {
 		macroNameToken := arguments.MatchType(TokenIdentifier)
 		if macroNameToken == nil {
@@ -114,6 +119,32 @@ func tagImportParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, er
 	return importNode, nil
 }
 
+// EncodeNode writes the imported macros, which are shared with the imported
+// template.
+func (node *tagImportNode) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteToken(node.position)
+	enc.WriteString(node.filename)
+	enc.writeUvarint(uint64(len(node.macros)))
+	for _, name := range slices.Sorted(maps.Keys(node.macros)) {
+		enc.WriteString(name)
+		enc.WriteNode(node.macros[name])
+	}
+	return nil
+}
+
+func (node *tagImportNode) DecodeNode(dec *NodeDecoder) error {
+	node.position = dec.ReadToken()
+	node.filename = dec.ReadString()
+	n := dec.readCount()
+	node.macros = make(map[string]*tagMacroNode, n)
+	for range n {
+		name := dec.ReadString()
+		node.macros[name] = dec.readMacro()
+	}
+	return nil
+}
+
 func init() {
 	mustRegisterTag("import", tagImportParser)
+	mustRegisterEncodableNode(&tagImportNode{})
 }
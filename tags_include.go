@@ -1,5 +1,7 @@
 package pongo2
 
+import "errors"
+
 // tagIncludeNode represents the {% include %} tag.
 //
 // The include tag renders another template and inserts its output at the
@@ -32,6 +34,16 @@ package pongo2
 //
 //	{% include "card.html" with title="Hello" subtitle="World" only %}
 //
+// Rendering the included template in parallel with the rest of the page
+// (e.g. for widgets calling slow functions); the "parallel" keyword comes
+// last:
+//
+//	{% for widget in widgets %}
+//	    {% include "widget.html" with widget=widget parallel %}
+//	{% endfor %}
+//
+// See the async tag for how templates are rendered in parallel.
+//
 // Note: Static filenames (strings) are parsed at compile time for better
 // performance. Dynamic filenames are resolved at runtime.
 type tagIncludeNode struct {
@@ -42,20 +54,22 @@ type tagIncludeNode struct {
 	filename          string
 	withPairs         map[string]IEvaluator
 	ifExists          bool
+	parallel          bool
 }
 
-// Execute renders the included template with the appropriate context.
-// For lazy includes, the filename is evaluated at runtime; otherwise
-// the pre-parsed template is executed directly.
+// Execute renders the included template, in parallel if requested.
 func (node *tagIncludeNode) Execute(ctx *ExecutionContext, writer TemplateWriter) error {
-	// Building the context for the template
-	includeCtx := make(Context)
-
-	// Fill the context with all data from the parent
-	if !node.only {
-		includeCtx.Update(ctx.Public)
-		includeCtx.Update(ctx.Private)
+	if node.parallel {
+		return executeParallel(ctx, writer, node.execute)
 	}
+	return node.execute(ctx, writer)
+}
+
+// execute renders the included template with the appropriate context.
+// For lazy includes, the filename is evaluated at runtime; otherwise
+// the pre-parsed template is executed directly.
+func (node *tagIncludeNode) execute(ctx *ExecutionContext, writer TemplateWriter) error {
+	includeCtx := node.context(ctx)
 
 	// Put all custom with-pairs into the context
 	for key, value := range node.withPairs {
@@ -78,31 +92,42 @@ func (node *tagIncludeNode) Execute(ctx *ExecutionContext, writer TemplateWriter
 			return ctx.Error("Filename for 'include'-tag evaluated to an empty string.", nil)
 		}
 
-		// Get include-filename
-		includedFilename := ctx.template.set.resolveFilename(ctx.template, filename.String())
-
-		includedTpl, err2 := ctx.template.set.FromFile(includedFilename)
+		includedTpl, err2 := ctx.template.set.loadPinned(ctx, filename.String())
 		if err2 != nil {
 			// if this is ReadFile error, and "if_exists" flag is enabled
-			if e, ok := err2.(*Error); ok && node.ifExists && e.Sender == "fromfile" {
+			if node.ifExists && errors.Is(err2, ErrTemplateNotFound) {
 				return nil
 			}
 			return err2
 		}
-		err2 = includedTpl.ExecuteWriter(includeCtx, writer)
+		err2 = includedTpl.executeIncluded(ctx, includeCtx, writer)
 		if err2 != nil {
 			return err2
 		}
 		return nil
 	}
-	// Template is already parsed with static filename
-	err := node.tpl.ExecuteWriter(includeCtx, writer)
+	// Template is already parsed with static filename. It's executed
+	// into the writer directly, so {% flush %} works in included templates.
+	err := node.tpl.executeIncluded(ctx, includeCtx, writer)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// context builds the context for the included template (without the
+// with-pairs).
+func (node *tagIncludeNode) context(ctx *ExecutionContext) Context {
+	includeCtx := make(Context)
+
+	// Fill the context with all data from the parent
+	if !node.only {
+		includeCtx.Update(ctx.Public)
+		includeCtx.Update(ctx.Private)
+	}
+	return includeCtx
+}
+
 // tagIncludeEmptyNode is a placeholder node returned when a static include
 // with "if_exists" references a non-existent file at parse time.
 type tagIncludeEmptyNode struct{}
@@ -113,7 +138,8 @@ func (node *tagIncludeEmptyNode) Execute(ctx *ExecutionContext, writer TemplateW
 }
 
 // tagIncludeParser parses the {% include %} tag. It supports static or dynamic
-// filenames, "if_exists" flag, "with" context pairs, and "only" isolation.
+// filenames, "if_exists" flag, "with" context pairs, "only" isolation and
+// "parallel" rendering.
 func tagIncludeParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, error) {
 	includeNode := &tagIncludeNode{
 		withPairs: make(map[string]IEvaluator),
@@ -126,28 +152,28 @@ func tagIncludeParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, e
 		ifExists := arguments.Match(TokenIdentifier, "if_exists") != nil
 
 		// Get include-filename
-		includedFilename := doc.template.set.resolveFilename(doc.template, filenameToken.Val)
+		includeNode.filename = doc.template.set.resolveFilename(doc.template, filenameToken.Val)
 
-		// Check if this template is currently being parsed (recursive include)
-		// If so, we must use lazy evaluation to avoid infinite recursion at parse time
-		if doc.template.set.isTemplateParsing(includedFilename) {
-			// Recursive include detected - use lazy evaluation
-			includeNode.filename = includedFilename
+		// Parse the included template unless it's currently being parsed
+		// (recursive include)
+		includedTpl, parsing, err := doc.template.set.loadTemplateUnlessParsing(
+			newTemplateLookup(doc.template, filenameToken.Val), 0, doc.template.dependencyMode(), true)
+		switch {
+		case err != nil:
+			// if this is ReadFile error, and "if_exists" token presents we should create and empty node
+			if ifExists && errors.Is(err, ErrTemplateNotFound) {
+				return &tagIncludeEmptyNode{}, nil
+			}
+			return nil, updateErrorToken(err, doc.template, filenameToken)
+		case parsing:
+			// Recursive include detected - we must use lazy evaluation
+			// to avoid infinite recursion at parse time
 			includeNode.lazy = true
 			includeNode.ifExists = ifExists
 			// Create a simple evaluator that returns the static filename
 			includeNode.filenameEvaluator = &stringResolver{locationToken: filenameToken, val: filenameToken.Val}
-		} else {
-			// Parse the included template
-			includeNode.filename = includedFilename
-			includedTpl, err := doc.template.set.FromFile(includedFilename)
-			if err != nil {
-				// if this is ReadFile error, and "if_exists" token presents we should create and empty node
-				if e, ok := err.(*Error); ok && e.Sender == "fromfile" && ifExists {
-					return &tagIncludeEmptyNode{}, nil
-				}
-				return nil, updateErrorToken(err, doc.template, filenameToken)
-			}
+		default:
+			doc.template.addDependencies(includedTpl)
 			includeNode.tpl = includedTpl
 		}
 	} else {
@@ -182,7 +208,10 @@ func tagIncludeParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, e
 			// Only?
 			if arguments.Match(TokenIdentifier, "only") != nil {
 				includeNode.only = true
-				break // stop parsing arguments because it's the last option
+				break // stop parsing pairs because it's the last pair option
+			}
+			if arguments.Peek(TokenIdentifier, "parallel") != nil && arguments.PeekN(1, TokenSymbol, "=") == nil {
+				break
 			}
 		}
 	}
@@ -192,6 +221,11 @@ func tagIncludeParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, e
 		includeNode.only = true
 	}
 
+	if arguments.Match(TokenIdentifier, "parallel") != nil {
+		includeNode.parallel = true
+		doc.template.parallel = true
+	}
+
 	if arguments.Remaining() > 0 {
 		return nil, arguments.Error("Malformed 'include'-tag arguments.", nil)
 	}
@@ -199,6 +233,42 @@ func tagIncludeParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, e
 	return includeNode, nil
 }
 
+// EncodeNode writes the include including the included template (unless
+// it's included lazily).
+func (node *tagIncludeNode) EncodeNode(enc *NodeEncoder) error {
+	enc.writeTemplate(node.tpl)
+	enc.WriteEvaluator(node.filenameEvaluator)
+	enc.WriteBool(node.lazy)
+	enc.WriteBool(node.only)
+	enc.WriteString(node.filename)
+	enc.writeEvaluatorMap(node.withPairs)
+	enc.WriteBool(node.ifExists)
+	enc.WriteBool(node.parallel)
+	return nil
+}
+
+func (node *tagIncludeNode) DecodeNode(dec *NodeDecoder) error {
+	node.tpl = dec.readTemplate()
+	node.filenameEvaluator = dec.ReadEvaluator()
+	node.lazy = dec.ReadBool()
+	node.only = dec.ReadBool()
+	node.filename = dec.ReadString()
+	node.withPairs = dec.readEvaluatorMap()
+	node.ifExists = dec.ReadBool()
+	node.parallel = dec.ReadBool()
+	return nil
+}
+
+func (node *tagIncludeEmptyNode) EncodeNode(enc *NodeEncoder) error {
+	return nil
+}
+
+func (node *tagIncludeEmptyNode) DecodeNode(dec *NodeDecoder) error {
+	return nil
+}
+
 func init() {
 	mustRegisterTag("include", tagIncludeParser)
+	mustRegisterEncodableNode(&tagIncludeNode{})
+	mustRegisterEncodableNode(&tagIncludeEmptyNode{})
 }
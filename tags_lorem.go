@@ -146,8 +146,25 @@ func tagLoremParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, err
 	return loremNode, nil
 }
 
+func (node *tagLoremNode) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteToken(node.position)
+	enc.WriteInt(node.count)
+	enc.WriteString(node.method)
+	enc.WriteBool(node.random)
+	return nil
+}
+
+func (node *tagLoremNode) DecodeNode(dec *NodeDecoder) error {
+	node.position = dec.ReadToken()
+	node.count = dec.ReadInt()
+	node.method = dec.ReadString()
+	node.random = dec.ReadBool()
+	return nil
+}
+
 func init() {
 	mustRegisterTag("lorem", tagLoremParser)
+	mustRegisterEncodableNode(&tagLoremNode{})
 }
 
 //nolint:dupword // standard lorem ipsum text naturally contains repeated Latin words
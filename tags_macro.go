@@ -69,14 +69,17 @@ type tagMacroNode struct {
 // Execute registers the macro as a callable function in the private context.
 // The macro can then be called like {{ macro_name(args) }}.
 func (node *tagMacroNode) Execute(ctx *ExecutionContext, writer TemplateWriter) error {
-	ctx.Private[node.name] = func(args ...*Value) (*Value, error) {
+	definition := ctx
+	ctx.Private[node.name] = func(caller *ExecutionContext, args ...*Value) (*Value, error) {
+		ctx := definition.macroContext(caller)
 		ctx.macroDepth++
 		defer func() {
 			ctx.macroDepth--
 		}()
 
 		if ctx.macroDepth > maxMacroDepth {
-			return nil, ctx.Error(fmt.Sprintf("maximum recursive macro call depth reached (max is %v)", maxMacroDepth), node.position)
+			return nil, ctx.errorOfKind(ErrMacroRecursion,
+				fmt.Sprintf("maximum recursive macro call depth reached (max is %v)", maxMacroDepth), node.position)
 		}
 
 		return node.call(ctx, args...)
@@ -209,6 +212,27 @@ func tagMacroParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, err
 	return macroNode, nil
 }
 
+func (node *tagMacroNode) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteToken(node.position)
+	enc.WriteString(node.name)
+	enc.writeStrings(node.argsOrder)
+	enc.writeEvaluatorMap(node.args)
+	enc.WriteBool(node.exported)
+	enc.WriteWrapper(node.wrapper)
+	return nil
+}
+
+func (node *tagMacroNode) DecodeNode(dec *NodeDecoder) error {
+	node.position = dec.ReadToken()
+	node.name = dec.ReadString()
+	node.argsOrder = dec.readStrings()
+	node.args = dec.readEvaluatorMap()
+	node.exported = dec.ReadBool()
+	node.wrapper = dec.ReadWrapper()
+	return nil
+}
+
 func init() {
 	mustRegisterTag("macro", tagMacroParser)
+	mustRegisterEncodableNode(&tagMacroNode{})
 }
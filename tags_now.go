@@ -82,6 +82,21 @@ func tagNowParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, error
 	return nowNode, nil
 }
 
+func (node *tagNowNode) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteToken(node.position)
+	enc.WriteString(node.format)
+	enc.WriteBool(node.fake)
+	return nil
+}
+
+func (node *tagNowNode) DecodeNode(dec *NodeDecoder) error {
+	node.position = dec.ReadToken()
+	node.format = dec.ReadString()
+	node.fake = dec.ReadBool()
+	return nil
+}
+
 func init() {
 	mustRegisterTag("now", tagNowParser)
+	mustRegisterEncodableNode(&tagNowNode{})
 }
@@ -79,6 +79,19 @@ func tagSetParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, error
 	return node, nil
 }
 
+func (node *tagSetNode) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteString(node.name)
+	enc.WriteEvaluator(node.expression)
+	return nil
+}
+
+func (node *tagSetNode) DecodeNode(dec *NodeDecoder) error {
+	node.name = dec.ReadString()
+	node.expression = dec.readRequiredEvaluator()
+	return nil
+}
+
 func init() {
 	mustRegisterTag("set", tagSetParser)
+	mustRegisterEncodableNode(&tagSetNode{})
 }
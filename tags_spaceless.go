@@ -95,6 +95,17 @@ func tagSpacelessParser(doc *Parser, start *Token, arguments *Parser) (INodeTag,
 	return spacelessNode, nil
 }
 
+func (node *tagSpacelessNode) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteWrapper(node.wrapper)
+	return nil
+}
+
+func (node *tagSpacelessNode) DecodeNode(dec *NodeDecoder) error {
+	node.wrapper = dec.ReadWrapper()
+	return nil
+}
+
 func init() {
 	mustRegisterTag("spaceless", tagSpacelessParser)
+	mustRegisterEncodableNode(&tagSpacelessNode{})
 }
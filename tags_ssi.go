@@ -63,18 +63,19 @@ func tagSSIParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, error
 
 		if arguments.Match(TokenIdentifier, "parsed") != nil {
 			// parsed
-			temporaryTpl, err := doc.template.set.FromFile(doc.template.set.resolveFilename(doc.template, fileToken.Val))
+			temporaryTpl, err := doc.template.set.fromFile(doc.template, fileToken.Val)
 			if err != nil {
 				return nil, updateErrorToken(err, doc.template, fileToken)
 			}
 			SSINode.template = temporaryTpl
 		} else {
 			// plaintext - use the template loader to support virtual filesystems
-			_, _, fd, err := doc.template.set.resolveTemplate(doc.template, fileToken.Val)
+			name, index, fd, err := doc.template.set.resolveTemplateFrom(newTemplateLookup(doc.template, fileToken.Val), 0)
 			if err != nil {
 				return nil, updateErrorToken(&Error{
 					Sender:    "tag:ssi",
 					OrigError: err,
+					Kind:      loaderErrorKind(err),
 				}, doc.template, fileToken)
 			}
 			buf, err := io.ReadAll(fd)
@@ -90,6 +91,10 @@ func tagSSIParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, error
 				}, doc.template, fileToken)
 			}
 			SSINode.content = string(buf)
+			doc.template.sources = append(doc.template.sources, templateSource{
+				key:  templateKey{loader: index, name: name},
+				hash: contentVersion(buf),
+			})
 		}
 	} else {
 		return nil, arguments.Error("First argument must be a string.", nil)
@@ -102,6 +107,21 @@ func tagSSIParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, error
 	return SSINode, nil
 }
 
+func (node *tagSSINode) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteString(node.filename)
+	enc.WriteString(node.content)
+	enc.writeTemplate(node.template)
+	return nil
+}
+
+func (node *tagSSINode) DecodeNode(dec *NodeDecoder) error {
+	node.filename = dec.ReadString()
+	node.content = dec.ReadString()
+	node.template = dec.readTemplate()
+	return nil
+}
+
 func init() {
 	mustRegisterTag("ssi", tagSSIParser)
+	mustRegisterEncodableNode(&tagSSINode{})
 }
@@ -80,6 +80,17 @@ func tagTemplateTagParser(doc *Parser, start *Token, arguments *Parser) (INodeTa
 	return ttNode, nil
 }
 
+func (node *tagTemplateTagNode) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteString(node.content)
+	return nil
+}
+
+func (node *tagTemplateTagNode) DecodeNode(dec *NodeDecoder) error {
+	node.content = dec.ReadString()
+	return nil
+}
+
 func init() {
 	mustRegisterTag("templatetag", tagTemplateTagParser)
+	mustRegisterEncodableNode(&tagTemplateTagNode{})
 }
@@ -1,6 +1,7 @@
 package pongo2
 
 import (
+	"slices"
 	"testing"
 	"testing/fstest"
 )
@@ -648,6 +649,46 @@ func TestForLoopVariables(t *testing.T) {
 			context:  Context{"items": []int{}},
 			expected: "empty",
 		},
+		{
+			name: "iterator",
+			template: "{% for i in items %}{{ i }}:{{ forloop.Revcounter }}{% if forloop.Last %}L{% endif %} " +
+				"{% endfor %}",
+			context:  Context{"items": slices.Values([]int{1, 2, 3})},
+			expected: "1:-1 2:-1 3:1L ",
+		},
+		{
+			name:     "iterator with keys",
+			template: "{% for k, v in items %}{{ k }}={{ v }} {% endfor %}",
+			context:  Context{"items": slices.All([]string{"a", "b"})},
+			expected: "0=a 1=b ",
+		},
+		{
+			name:     "iterator reversed",
+			template: "{% for i in items reversed %}{{ i }}:{{ forloop.Revcounter }} {% endfor %}",
+			context:  Context{"items": slices.Values([]int{1, 2, 3})},
+			expected: "3:3 2:2 1:1 ",
+		},
+		{
+			name:     "empty iterator",
+			template: "{% for i in items %}{{ i }}{% empty %}empty{% endfor %}",
+			context:  Context{"items": slices.Values([]int{})},
+			expected: "empty",
+		},
+		{
+			name:     "channel",
+			template: "{% for i in items %}{{ i }}{% if forloop.Last %}L{% endif %}{% endfor %}",
+			context: Context{"items": func() chan int {
+				ch := make(chan int)
+				go func() {
+					defer close(ch)
+					for i := range 3 {
+						ch <- i
+					}
+				}()
+				return ch
+			}()},
+			expected: "012L",
+		},
 	}
 
 	for _, tt := range tests {
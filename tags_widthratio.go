@@ -127,6 +127,25 @@ func tagWidthratioParser(doc *Parser, start *Token, arguments *Parser) (INodeTag
 	return widthratioNode, nil
 }
 
+func (node *tagWidthratioNode) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteToken(node.position)
+	enc.WriteEvaluator(node.current)
+	enc.WriteEvaluator(node.max)
+	enc.WriteEvaluator(node.width)
+	enc.WriteString(node.ctxName)
+	return nil
+}
+
+func (node *tagWidthratioNode) DecodeNode(dec *NodeDecoder) error {
+	node.position = dec.ReadToken()
+	node.current = dec.readRequiredEvaluator()
+	node.max = dec.readRequiredEvaluator()
+	node.width = dec.readRequiredEvaluator()
+	node.ctxName = dec.ReadString()
+	return nil
+}
+
 func init() {
 	mustRegisterTag("widthratio", tagWidthratioParser)
+	mustRegisterEncodableNode(&tagWidthratioNode{})
 }
@@ -127,6 +127,19 @@ func tagWithParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, erro
 	return withNode, nil
 }
 
+func (node *tagWithNode) EncodeNode(enc *NodeEncoder) error {
+	enc.writeEvaluatorMap(node.withPairs)
+	enc.WriteWrapper(node.wrapper)
+	return nil
+}
+
+func (node *tagWithNode) DecodeNode(dec *NodeDecoder) error {
+	node.withPairs = dec.readEvaluatorMap()
+	node.wrapper = dec.ReadWrapper()
+	return nil
+}
+
 func init() {
 	mustRegisterTag("with", tagWithParser)
+	mustRegisterEncodableNode(&tagWithNode{})
 }
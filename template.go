@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"slices"
 	"strings"
 	"sync"
 )
@@ -61,6 +62,22 @@ type Template struct {
 	// is used in error messages and for template caching in the TemplateSet.
 	name string
 
+	// origin records which loader provided this template and how it was
+	// requested (used by {% extends super %}).
+	origin templateOrigin
+
+	// dependencies lists the templates provided by a RevalidatingTemplateLoader
+	// this template was compiled from (itself and the templates it includes,
+	// extends or imports). FromCache recompiles the template if any of them
+	// changed.
+	dependencies []templateDependency
+
+	// sources lists the templates provided by a loader this template was
+	// compiled from (itself and the templates it includes, extends, imports
+	// or embeds using {% ssi %}), with a hash of their content. It's used to
+	// detect stale serialized templates (see FromSerialized).
+	sources []templateSource
+
 	// size is the length of the template source in bytes. Used to estimate
 	// output buffer sizes (templates typically expand ~30% during rendering).
 	size int
@@ -87,13 +104,10 @@ type Template struct {
 	// parent points to the template this one extends (via {% extends %} tag).
 	// nil if this is a base template with no parent. During execution,
 	// the engine walks up this chain to find the root template to render.
+	// Parents are shared by all templates extending them (see
+	// ExecutionContext.inheritance for how blocks are resolved).
 	parent *Template
 
-	// child points to the template that extends this one. This reverse link
-	// allows parent templates to delegate block rendering to their children.
-	// nil if no template extends this one.
-	child *Template
-
 	// blocks maps block names to their NodeWrapper implementations. When a
 	// child template defines {% block name %}...{% endblock %}, it registers
 	// here. During execution, the most-derived (child-most) block is rendered.
@@ -115,16 +129,74 @@ type Template struct {
 	// Includes settings like TrimBlocks and LStripBlocks for whitespace control.
 	Options *Options
 
-	// whitespaceOnce ensures TrimBlocks/LStripBlocks whitespace trimming
-	// is applied exactly once, even under concurrent execution.
-	whitespaceOnce sync.Once
+	// wrappers lists the node wrappers of the template in the order their
+	// parsing completed (inner wrappers first). They are optimized together
+	// with root (see optimize) and released afterwards.
+	wrappers []*NodeWrapper
+
+	// parallel reports whether the template contains parts rendered in
+	// parallel ({% async %} or {% include ... parallel %}).
+	parallel bool
+
+	// parsing reports whether the template is being parsed.
+	parsing bool
+
+	// prepareOnce ensures the template is prepared for execution (see
+	// prepare) exactly once, even under concurrent execution.
+	prepareOnce sync.Once
+}
+
+// templateDependency is a template (provided by a RevalidatingTemplateLoader)
+// in the version another template was compiled from.
+type templateDependency struct {
+	loader  RevalidatingTemplateLoader
+	path    string
+	version string
+}
+
+// templateSource is a template (identified by the index of the loader which
+// provided it and its resolved name) in the version another template was
+// compiled from.
+type templateSource struct {
+	key  templateKey
+	hash string
+}
+
+// addDependencies records that tpl was compiled using other. It must only be
+// called while tpl is parsed.
+func (tpl *Template) addDependencies(other *Template) {
+	tpl.dependencies = append(tpl.dependencies, other.dependencies...)
+	tpl.sources = append(tpl.sources, other.sources...)
+}
+
+// templateOrigin describes where a template was loaded from.
+type templateOrigin struct {
+	// loader is the index of the loader (in TemplateSet.loaders) which
+	// provided the template, or -1 if it wasn't provided by a loader.
+	loader int
+
+	// lookup is the lookup which found the template.
+	lookup templateLookup
+
+	// fresh reports whether the template was compiled together with all
+	// templates it references, bypassing the template cache (see loadFresh).
+	fresh bool
+}
+
+// dependencyMode returns how the templates referenced by tpl are loaded
+// while it's parsed: fresh if tpl was compiled fresh, shared otherwise.
+func (tpl *Template) dependencyMode() loadMode {
+	if tpl.origin.fresh {
+		return loadFresh
+	}
+	return loadShared
 }
 
 // newTemplateString creates a new template from a byte slice containing template source.
 // The template is marked as a string template (not file-based), which affects path
 // resolution for include/extends tags. Returns the parsed template or an error.
 func newTemplateString(set *TemplateSet, tpl []byte) (*Template, error) {
-	return newTemplate(set, "<string>", true, tpl)
+	return newTemplate(set, "<string>", true, templateOrigin{loader: -1}, tpl)
 }
 
 // newTemplate creates a new template with the given name and source.
@@ -134,12 +206,16 @@ func newTemplateString(set *TemplateSet, tpl []byte) (*Template, error) {
 //  3. Lexes the source into tokens
 //  4. Parses tokens into an AST
 //
+// Lexing and parsing don't stop at the first error; all errors found in the
+// template are returned at once (see ErrorList).
+//
 // Parameters:
 //   - set: The TemplateSet this template belongs to
 //   - name: Template identifier (file path or "<string>")
 //   - isTplString: true if created from string, false if from file
+//   - origin: The loader which provided the template (if any)
 //   - tpl: The raw template source bytes
-func newTemplate(set *TemplateSet, name string, isTplString bool, tpl []byte) (*Template, error) {
+func newTemplate(set *TemplateSet, name string, isTplString bool, origin templateOrigin, tpl []byte) (*Template, error) {
 	strTpl := string(tpl)
 
 	// Mark that a template has been created (prevents further tag/filter banning)
@@ -153,6 +229,7 @@ func newTemplate(set *TemplateSet, name string, isTplString bool, tpl []byte) (*
 		set:            set,
 		isTplString:    isTplString,
 		name:           name,
+		origin:         origin,
 		size:           len(strTpl),
 		blocks:         make(map[string]*NodeWrapper),
 		exportedMacros: make(map[string]*tagMacroNode),
@@ -161,16 +238,24 @@ func newTemplate(set *TemplateSet, name string, isTplString bool, tpl []byte) (*
 	// Copy all settings from another Options.
 	t.Options.Update(set.Options)
 
-	// Tokenize it
+	// Tokenize it; on errors, the tokens of the remaining valid input are
+	// still parsed to report parser errors as well.
+	var errs []error
 	tokens, err := lex(name, strTpl)
 	if err != nil {
-		return nil, err
+		errs = append(errs, err)
 	}
 	t.tokens = tokens
 
 	// Parse it
-	err = t.parse()
-	if err != nil {
+	t.parsing = true
+	if err := t.parse(); err != nil {
+		errs = append(errs, err)
+	}
+	t.parsing = false
+	t.origin.lookup.from = nil
+
+	if err := newCompileError(name, errs); err != nil {
 		return nil, err
 	}
 
@@ -178,8 +263,9 @@ func newTemplate(set *TemplateSet, name string, isTplString bool, tpl []byte) (*
 }
 
 // applyWhitespaceOptions applies TrimBlocks/LStripBlocks whitespace options
-// to the template's token list. This is called once at parse time to avoid
-// race conditions with concurrent template execution.
+// to the template's token list. This is called once before the first
+// execution (see prepare) to avoid race conditions with concurrent template
+// execution.
 //
 // Issue #94 https://github.com/flosch/pongo2/issues/94
 func (tpl *Template) applyWhitespaceOptions() {
@@ -211,6 +297,17 @@ func (tpl *Template) applyWhitespaceOptions() {
 	}
 }
 
+// prepare prepares the template for execution once its options can't be
+// changed anymore: it applies the whitespace options and optimizes the node
+// tree. All templates whose nodes are executed (the template, the templates
+// it extends and the templates it imports macros from) must be prepared.
+func (tpl *Template) prepare() {
+	tpl.prepareOnce.Do(func() {
+		tpl.applyWhitespaceOptions()
+		tpl.optimize()
+	})
+}
+
 // newContextForExecution prepares the template and context for execution.
 // It performs several tasks:
 //  1. Walks up the inheritance chain to find the root parent template
@@ -220,15 +317,16 @@ func (tpl *Template) applyWhitespaceOptions() {
 //
 // Returns the root parent template to execute, the execution context, and any error.
 func (tpl *Template) newContextForExecution(context Context) (*Template, *ExecutionContext, error) {
-	// Apply TrimBlocks/LStripBlocks whitespace options exactly once.
-	// Using sync.Once ensures thread-safety for concurrent execution.
-	tpl.whitespaceOnce.Do(tpl.applyWhitespaceOptions)
-
-	// Determine the parent to be executed (for template inheritance)
-	parent := tpl
-	for parent.parent != nil {
-		parent = parent.parent
+	// Determine the parent to be executed (for template inheritance) and
+	// the inheritance chain from it down to this template. Their whitespace
+	// options are applied and their nodes optimized exactly once.
+	var inheritance []*Template
+	for t := tpl; t != nil; t = t.parent {
+		t.prepare()
+		inheritance = append(inheritance, t)
 	}
+	slices.Reverse(inheritance)
+	parent := inheritance[0]
 
 	// Create context if none is given
 	newContext := make(Context)
@@ -260,6 +358,8 @@ func (tpl *Template) newContextForExecution(context Context) (*Template, *Execut
 
 	// Create operational context
 	ctx := newExecutionContext(parent, newContext)
+	ctx.inheritance = inheritance
+	ctx.loaders = tpl.set.pinLoaders()
 
 	return parent, ctx, nil
 }
@@ -274,11 +374,21 @@ func (tpl *Template) execute(context Context, writer TemplateWriter) error {
 	}
 
 	// Run the selected document
-	if err := parent.root.Execute(ctx, writer); err != nil {
+	return executeDocument(parent.root, ctx, writer)
+}
+
+// executeIncluded executes the template included by the template executed
+// using ctx. It's part of the same execution: the limit of goroutines
+// rendering in parallel applies to it as well.
+func (tpl *Template) executeIncluded(ctx *ExecutionContext, context Context, writer TemplateWriter) error {
+	parent, includeCtx, err := tpl.newContextForExecution(context)
+	if err != nil {
 		return err
 	}
-
-	return nil
+	includeCtx.part = ctx.part
+	includeCtx.parallelLimit = ctx.parallelLimit
+	includeCtx.loaders = ctx.loaders
+	return executeDocument(parent.root, includeCtx, writer)
 }
 
 // newTemplateWriterAndExecute wraps an io.Writer in a templateWriter and executes.
@@ -287,14 +397,21 @@ func (tpl *Template) newTemplateWriterAndExecute(context Context, writer io.Writ
 	return tpl.execute(context, &templateWriter{w: writer})
 }
 
+// maxOutputSize limits the estimated output size (see Template.outputSize).
+const maxOutputSize = 1 << 20
+
+// outputSize estimates the size of the template's output to size buffers.
+// We assume that the rendered template will be 30% larger than its source.
+func (tpl *Template) outputSize() int {
+	return int(min(float64(tpl.size)*1.3, maxOutputSize))
+}
+
 // newBufferAndExecute creates a pre-sized buffer and executes the template into it.
 // The buffer is sized to 130% of the template source size, as templates typically
 // expand during rendering (variables, loops, includes, etc.).
 // Returns the filled buffer or an error if execution fails.
 func (tpl *Template) newBufferAndExecute(context Context) (*bytes.Buffer, error) {
-	// Create output buffer. We assume that the rendered template will be 30%
-	// larger
-	buffer := bytes.NewBuffer(make([]byte, 0, int(float64(tpl.size)*1.3)))
+	buffer := bytes.NewBuffer(make([]byte, 0, tpl.outputSize()))
 	if err := tpl.execute(context, buffer); err != nil {
 		return nil, err
 	}
@@ -399,11 +516,12 @@ func (tpl *Template) ExecuteBlocks(context Context, blocks []string) (map[string
 			if blockWrapper, ok := t.blocks[blockName]; ok {
 				// assign the buffer if we haven't done so
 				if buffer == nil {
-					buffer = bytes.NewBuffer(make([]byte, 0, int(float64(t.size)*1.3)))
+					buffer = bytes.NewBuffer(make([]byte, 0, t.outputSize()))
 				}
-				// assign the context if we haven't done so
+				// assign the context if we haven't done so (blocks nested
+				// in the block are resolved along tpl's inheritance chain)
 				if ctx == nil {
-					_, ctx, err = t.newContextForExecution(context)
+					_, ctx, err = tpl.newContextForExecution(context)
 					if err != nil {
 						return nil, err
 					}
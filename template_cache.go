@@ -0,0 +1,275 @@
+package pongo2
+
+import (
+	"container/list"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TemplateCache stores the compiled templates of a TemplateSet (see FromCache
+// and TemplateSet.SetCache). Keys are the resolved template names.
+// Implementations must be safe for concurrent use.
+//
+// A cache may drop templates at any time (e.g. to bound its size); FromCache
+// then compiles them again. Caches which drop templates can report the number
+// of dropped templates in CacheStats by implementing
+//
+//	Evictions() uint64
+//
+// Caches should implement
+//
+//	Keys() []string
+//
+// returning the keys of all cached templates. It's optional, but
+// TemplateSet.SerializeCache fails for caches which don't implement it.
+type TemplateCache interface {
+	// Get returns the template stored for key.
+	Get(key string) (*Template, bool)
+
+	// Add stores tpl for key, replacing any template stored for it.
+	Add(key string, tpl *Template)
+
+	// Remove removes the template stored for key (if any).
+	Remove(key string)
+
+	// Purge removes all templates.
+	Purge()
+
+	// Len returns the number of cached templates.
+	Len() int
+}
+
+// CacheStats contains the counters of a template set's cache as returned by
+// TemplateSet.CacheStats. All counters are cumulative.
+type CacheStats struct {
+	// Hits is the number of FromCache calls served from the cache.
+	Hits uint64
+
+	// Misses is the number of FromCache calls which had to compile the
+	// template (including templates which changed remotely).
+	Misses uint64
+
+	// Evictions is the number of templates the cache dropped to bound its
+	// size or because they expired (zero for caches which don't report it).
+	Evictions uint64
+
+	// Compilations is the number of templates compiled for the cache (by
+	// FromCache and PrecompileAll), CompileTime the total time it took.
+	Compilations uint64
+	CompileTime  time.Duration
+}
+
+// cacheStats contains the counters maintained by a template set.
+type cacheStats struct {
+	hits         atomic.Uint64
+	misses       atomic.Uint64
+	compilations atomic.Uint64
+	compileTime  atomic.Int64
+}
+
+// compiled records a compilation for the cache which started at start.
+func (s *cacheStats) compiled(start time.Time) {
+	s.compilations.Add(1)
+	s.compileTime.Add(int64(time.Since(start)))
+}
+
+// mapTemplateCache is the default, unbounded TemplateCache.
+type mapTemplateCache struct {
+	mu        sync.RWMutex
+	templates map[string]*Template
+}
+
+// newMapTemplateCache creates an empty mapTemplateCache.
+func newMapTemplateCache() *mapTemplateCache {
+	return &mapTemplateCache{templates: make(map[string]*Template)}
+}
+
+func (c *mapTemplateCache) Get(key string) (*Template, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	tpl, ok := c.templates[key]
+	return tpl, ok
+}
+
+func (c *mapTemplateCache) Add(key string, tpl *Template) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.templates[key] = tpl
+}
+
+func (c *mapTemplateCache) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.templates, key)
+}
+
+func (c *mapTemplateCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.templates = make(map[string]*Template, len(c.templates))
+}
+
+func (c *mapTemplateCache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.templates)
+}
+
+func (c *mapTemplateCache) Keys() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return slices.Collect(maps.Keys(c.templates))
+}
+
+// LRUCacheOptions configures an LRUTemplateCache. Zero values disable the
+// respective limit.
+type LRUCacheOptions struct {
+	// MaxEntries is the maximum number of cached templates.
+	MaxEntries int
+
+	// MaxSize is the maximum total size (in bytes of template source) of
+	// the cached templates.
+	MaxSize int
+
+	// TTL is the duration after which cached templates expire (counted
+	// from when they were added).
+	TTL time.Duration
+}
+
+// LRUTemplateCache is a TemplateCache bounded by the number and/or the total
+// source size of the cached templates. When a limit is exceeded, the least
+// recently used templates are evicted. Templates can additionally expire
+// after a TTL. Note that templates added by FromStringNamed can be evicted
+// as well; FromCache can't recompile them.
+type LRUTemplateCache struct {
+	options LRUCacheOptions
+	now     func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*list.Element
+	order     *list.List // of *lruEntry, most recently used first
+	size      int
+	evictions uint64
+}
+
+// lruEntry is a template cached by an LRUTemplateCache.
+type lruEntry struct {
+	key     string
+	tpl     *Template
+	expires time.Time
+}
+
+// NewLRUTemplateCache creates a new LRUTemplateCache with the given limits.
+func NewLRUTemplateCache(options LRUCacheOptions) *LRUTemplateCache {
+	return &LRUTemplateCache{
+		options: options,
+		now:     time.Now,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Get returns the template stored for key unless it expired.
+func (c *LRUTemplateCache) Get(key string) (*Template, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if c.options.TTL > 0 && !c.now().Before(entry.expires) {
+		c.remove(elem)
+		c.evictions++
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.tpl, true
+}
+
+// Add stores tpl for key and evicts the least recently used templates if
+// a limit is exceeded.
+func (c *LRUTemplateCache) Add(key string, tpl *Template) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	entry := &lruEntry{key: key, tpl: tpl}
+	if c.options.TTL > 0 {
+		entry.expires = c.now().Add(c.options.TTL)
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	c.size += tpl.size
+
+	for c.order.Len() > 0 &&
+		((c.options.MaxEntries > 0 && c.order.Len() > c.options.MaxEntries) ||
+			(c.options.MaxSize > 0 && c.size > c.options.MaxSize)) {
+		c.remove(c.order.Back())
+		c.evictions++
+	}
+}
+
+// Remove removes the template stored for key (if any).
+func (c *LRUTemplateCache) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+}
+
+// Purge removes all templates.
+func (c *LRUTemplateCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+	c.size = 0
+}
+
+// Len returns the number of cached templates (including expired ones which
+// weren't requested since they expired).
+func (c *LRUTemplateCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Keys returns the keys of the cached templates, most recently used first.
+func (c *LRUTemplateCache) Keys() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]string, 0, c.order.Len())
+	for elem := c.order.Front(); elem != nil; elem = elem.Next() {
+		keys = append(keys, elem.Value.(*lruEntry).key)
+	}
+	return keys
+}
+
+// Size returns the total source size of the cached templates.
+func (c *LRUTemplateCache) Size() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// Evictions returns the number of templates evicted because a limit was
+// exceeded or because they expired.
+func (c *LRUTemplateCache) Evictions() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.evictions
+}
+
+// remove removes elem from the cache. The caller must hold c.mu.
+func (c *LRUTemplateCache) remove(elem *list.Element) {
+	entry := c.order.Remove(elem).(*lruEntry)
+	delete(c.entries, entry.key)
+	c.size -= entry.tpl.size
+}
@@ -0,0 +1,299 @@
+package pongo2
+
+import (
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLRUTemplateCache(t *testing.T) {
+	tpl := func(size int) *Template {
+		return &Template{size: size}
+	}
+
+	t.Run("max entries", func(t *testing.T) {
+		c := NewLRUTemplateCache(LRUCacheOptions{MaxEntries: 2})
+		c.Add("a", tpl(1))
+		c.Add("b", tpl(1))
+		c.Get("a") // b is now the least recently used template
+		c.Add("c", tpl(1))
+
+		if _, ok := c.Get("b"); ok {
+			t.Error("b should have been evicted")
+		}
+		for _, key := range []string{"a", "c"} {
+			if _, ok := c.Get(key); !ok {
+				t.Errorf("%s should be cached", key)
+			}
+		}
+		if c.Len() != 2 || c.Evictions() != 1 {
+			t.Errorf("got Len %d, Evictions %d; want 2, 1", c.Len(), c.Evictions())
+		}
+	})
+
+	t.Run("max size", func(t *testing.T) {
+		c := NewLRUTemplateCache(LRUCacheOptions{MaxSize: 100})
+		c.Add("a", tpl(40))
+		c.Add("b", tpl(40))
+		c.Add("a", tpl(50)) // replacing doesn't count twice
+		if c.Size() != 90 || c.Len() != 2 {
+			t.Errorf("got Size %d, Len %d; want 90, 2", c.Size(), c.Len())
+		}
+		c.Add("c", tpl(30))
+		if _, ok := c.Get("b"); ok {
+			t.Error("b should have been evicted")
+		}
+		if c.Size() != 80 {
+			t.Errorf("got Size %d, want 80", c.Size())
+		}
+		c.Add("huge", tpl(200))
+		if c.Len() != 0 || c.Size() != 0 {
+			t.Errorf("template exceeding MaxSize should not be cached, got Len %d", c.Len())
+		}
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		now := time.Now()
+		c := NewLRUTemplateCache(LRUCacheOptions{TTL: time.Minute})
+		c.now = func() time.Time { return now }
+		c.Add("a", tpl(1))
+
+		now = now.Add(59 * time.Second)
+		if _, ok := c.Get("a"); !ok {
+			t.Error("a should not have expired yet")
+		}
+		now = now.Add(time.Second)
+		if _, ok := c.Get("a"); ok {
+			t.Error("a should have expired")
+		}
+		if c.Len() != 0 || c.Evictions() != 1 {
+			t.Errorf("got Len %d, Evictions %d; want 0, 1", c.Len(), c.Evictions())
+		}
+	})
+
+	t.Run("remove and purge", func(t *testing.T) {
+		c := NewLRUTemplateCache(LRUCacheOptions{})
+		c.Add("a", tpl(1))
+		c.Add("b", tpl(2))
+		c.Remove("a")
+		if c.Len() != 1 || c.Size() != 2 {
+			t.Errorf("got Len %d, Size %d; want 1, 2", c.Len(), c.Size())
+		}
+		c.Purge()
+		if c.Len() != 0 || c.Size() != 0 {
+			t.Errorf("got Len %d, Size %d; want 0, 0", c.Len(), c.Size())
+		}
+	})
+}
+
+func TestTemplateSetCacheStats(t *testing.T) {
+	loader := NewMapLoader(map[string]string{
+		"a.html": "A",
+		"b.html": strings.Repeat("B", 10),
+	})
+	set := NewSet("cache stats", loader)
+	set.SetCache(NewLRUTemplateCache(LRUCacheOptions{MaxEntries: 1}))
+
+	for _, name := range []string{"a.html", "a.html", "b.html", "a.html"} {
+		if _, err := set.FromCache(name); err != nil {
+			t.Fatalf("FromCache(%q) failed: %v", name, err)
+		}
+	}
+
+	stats := set.CacheStats()
+	if stats.Hits != 1 || stats.Misses != 3 || stats.Evictions != 2 || stats.Compilations != 3 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if stats.CompileTime <= 0 {
+		t.Errorf("expected compile time to be recorded, got %v", stats.CompileTime)
+	}
+
+	// Errors aren't counted as compilations
+	if _, err := set.FromCache("missing.html"); err == nil {
+		t.Fatal("expected error for missing template")
+	}
+	if stats := set.CacheStats(); stats.Misses != 4 || stats.Compilations != 3 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+// blockingLoader is a MapLoader whose Get blocks for "slow.html" until
+// release is closed (and panics afterwards if panics is set).
+type blockingLoader struct {
+	*MapLoader
+	started chan struct{}
+	release chan struct{}
+	gets    atomic.Int32
+	panics  bool
+}
+
+func (l *blockingLoader) Get(name string) (io.Reader, error) {
+	if name == "slow.html" {
+		if l.gets.Add(1) == 1 {
+			close(l.started)
+		}
+		<-l.release
+		if l.panics {
+			panic("loader failed")
+		}
+	}
+	return l.MapLoader.Get(name)
+}
+
+func TestTemplateSetFromCacheConcurrency(t *testing.T) {
+	loader := &blockingLoader{
+		MapLoader: NewMapLoader(map[string]string{
+			"slow.html": "Slow",
+			"fast.html": "Fast",
+		}),
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	set := NewSet("concurrency", loader)
+	if _, err := set.FromCache("fast.html"); err != nil {
+		t.Fatalf("FromCache failed: %v", err)
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	results := make([]*Template, n)
+	for i := range n {
+		wg.Go(func() {
+			tpl, err := set.FromCache("slow.html")
+			if err != nil {
+				t.Errorf("FromCache failed: %v", err)
+			}
+			results[i] = tpl
+		})
+	}
+	<-loader.started
+
+	// Cached templates and other templates aren't blocked by the compilation
+	if _, err := set.FromCache("fast.html"); err != nil {
+		t.Fatalf("FromCache failed: %v", err)
+	}
+	if _, err := set.FromCache("other.html"); err == nil {
+		t.Error("expected error for missing template")
+	}
+
+	close(loader.release)
+	wg.Wait()
+
+	if gets := loader.gets.Load(); gets != 1 {
+		t.Errorf("slow.html was loaded %d times, want 1", gets)
+	}
+	for i, tpl := range results {
+		if tpl == nil || tpl != results[0] {
+			t.Errorf("result %d differs from the first result", i)
+		}
+	}
+
+	t.Run("clean during compilation", func(t *testing.T) {
+		loader.started = make(chan struct{})
+		loader.release = make(chan struct{})
+		loader.gets.Store(0)
+		set.CleanCache()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if _, err := set.FromCache("slow.html"); err != nil {
+				t.Errorf("FromCache failed: %v", err)
+			}
+		}()
+		<-loader.started
+		set.CleanCache()
+		close(loader.release)
+		<-done
+
+		if _, ok := set.templateCache.Get("slow.html"); ok {
+			t.Error("template compiled before CleanCache should not be cached")
+		}
+	})
+
+	// restart starts compiling slow.html in the background and waits until
+	// its loading started. The returned channel receives the result.
+	restart := func(t *testing.T) <-chan error {
+		t.Helper()
+		loader.started = make(chan struct{})
+		loader.release = make(chan struct{})
+		loader.gets.Store(0)
+		set.CleanCache()
+
+		result := make(chan error, 1)
+		go func() {
+			_, err := set.FromCache("slow.html")
+			result <- err
+		}()
+		<-loader.started
+		return result
+	}
+
+	t.Run("clean other template during compilation", func(t *testing.T) {
+		result := restart(t)
+		set.CleanCache("fast.html")
+		close(loader.release)
+		if err := <-result; err != nil {
+			t.Fatalf("FromCache failed: %v", err)
+		}
+		if _, ok := set.templateCache.Get("slow.html"); !ok {
+			t.Error("cleaning another template should not prevent caching")
+		}
+	})
+
+	t.Run("clean template during compilation", func(t *testing.T) {
+		result := restart(t)
+		set.CleanCache("slow.html")
+
+		// Calls after CleanCache don't wait for the outdated compilation
+		fresh := make(chan *Template, 1)
+		go func() {
+			tpl, err := set.FromCache("slow.html")
+			if err != nil {
+				t.Errorf("FromCache failed: %v", err)
+			}
+			fresh <- tpl
+		}()
+		for loader.gets.Load() != 2 {
+			runtime.Gosched()
+		}
+		close(loader.release)
+		if err := <-result; err != nil {
+			t.Fatalf("FromCache failed: %v", err)
+		}
+		tpl := <-fresh
+		if cached, ok := set.templateCache.Get("slow.html"); !ok || cached != tpl {
+			t.Error("expected the template compiled after CleanCache to be cached")
+		}
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		loader.panics = true
+		defer func() { loader.panics = false }()
+		result := restart(t)
+
+		waiters := make(chan error, n)
+		for range n {
+			go func() {
+				tpl, err := set.FromCache("slow.html")
+				if tpl != nil {
+					t.Error("expected no template")
+				}
+				waiters <- err
+			}()
+		}
+		close(loader.release)
+		if err := <-result; err == nil || !strings.Contains(err.Error(), "loader failed") {
+			t.Errorf("expected error for panic, got: %v", err)
+		}
+		for range n {
+			if err := <-waiters; err == nil {
+				t.Error("expected error for waiter")
+			}
+		}
+	})
+}
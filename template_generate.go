@@ -0,0 +1,502 @@
+package pongo2
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// generatedImportPath is the import path of pongo2 used by generated code.
+const generatedImportPath = "github.com/flosch/pongo2/v7"
+
+// GeneratedTemplate is a template compiled to Go by GenerateGo. Load it into
+// a template set using TemplateSet.FromGenerated.
+type GeneratedTemplate struct {
+	// Data is the serialized template (see Template.Serialize).
+	Data string
+
+	// Funcs render the documents and node wrappers of the template,
+	// identified by their index in Data.
+	Funcs map[int]GeneratedFunc
+}
+
+// GeneratedFunc is the type of the functions generated by GenerateGo. They
+// use nodes to execute the nodes and to evaluate the expressions which
+// weren't compiled to Go.
+type GeneratedFunc func(nodes *GeneratedNodes, ctx *ExecutionContext, writer TemplateWriter) error
+
+// GeneratedNodes provides the functions generated by GenerateGo access to
+// the nodes of their template.
+type GeneratedNodes struct {
+	refs []any
+}
+
+// Execute executes the node with the given index.
+func (nodes *GeneratedNodes) Execute(index int, ctx *ExecutionContext, writer TemplateWriter) error {
+	node, ok := nodes.ref(index).(INode)
+	if !ok {
+		return nodes.invalidIndex(index)
+	}
+	return node.Execute(ctx, writer)
+}
+
+// Evaluate evaluates the expression with the given index.
+func (nodes *GeneratedNodes) Evaluate(index int, ctx *ExecutionContext) (*Value, error) {
+	e, ok := nodes.ref(index).(IEvaluator)
+	if !ok {
+		return nil, nodes.invalidIndex(index)
+	}
+	return e.Evaluate(ctx)
+}
+
+// Resolve resolves the part with the given index of the variable with the
+// given index. For the first part, it returns a new value. For the other
+// parts, v must be the value returned for the previous part; it's updated
+// and returned. If v is nil, it's returned unchanged (the variable is nil).
+func (nodes *GeneratedNodes) Resolve(index, part int, ctx *ExecutionContext, v *Value) (*Value, error) {
+	vr, ok := nodes.ref(index).(*variableResolver)
+	if !ok || part < 0 || part >= len(vr.parts) || (part > 0 && v == nil) {
+		return nil, nodes.invalidIndex(index)
+	}
+	var current reflect.Value
+	var isSafe bool
+	if part == 0 {
+		v = new(Value)
+	} else {
+		if !v.isValid() {
+			return v, nil
+		}
+		current, isSafe = v.reflectValue(), v.safe
+	}
+	current, isSafe, isNil, err := vr.resolvePart(ctx, part, current, isSafe)
+	if err != nil {
+		return AsValue(nil), ctx.OrigError(err, vr.locationToken)
+	}
+	if isNil {
+		current, isSafe = reflect.Value{}, false
+	}
+	v.setReflected(current, isSafe)
+	return v, nil
+}
+
+// Filter applies the filter with the given index of the filtered variable
+// with the given index to v. param is the evaluated parameter of the
+// filter (nil if it has none).
+func (nodes *GeneratedNodes) Filter(index, filter int, ctx *ExecutionContext, v, param *Value) (*Value, error) {
+	fv, ok := nodes.ref(index).(*nodeFilteredVariable)
+	if !ok || filter < 0 || filter >= len(fv.filterChain) {
+		return nil, nodes.invalidIndex(index)
+	}
+	if param == nil {
+		param = AsValue(nil)
+	}
+	return fv.filterChain[filter].apply(v, param, ctx)
+}
+
+// Write writes v, the evaluated expression of the variable node with the
+// given index, escaping it if needed.
+func (nodes *GeneratedNodes) Write(index int, ctx *ExecutionContext, writer TemplateWriter, v *Value) error {
+	nv, ok := nodes.ref(index).(*nodeVariable)
+	if !ok {
+		return nodes.invalidIndex(index)
+	}
+	return nv.write(ctx, writer, v)
+}
+
+// For executes the for tag with the given index. object evaluates the
+// object to iterate over, body renders an item and empty (if not nil)
+// renders the empty branch. They're called with the context of the loop.
+func (nodes *GeneratedNodes) For(index int, ctx *ExecutionContext, object func(*ExecutionContext) (*Value, error), body, empty func(*ExecutionContext) error) error {
+	node, ok := nodes.ref(index).(*tagForNode)
+	if !ok {
+		return nodes.invalidIndex(index)
+	}
+	return node.iterate(ctx, object, body, empty)
+}
+
+// Include executes the include tag with the given index, which must
+// include a template by a static filename and not in parallel. with are
+// the evaluated with-pairs of the tag.
+func (nodes *GeneratedNodes) Include(index int, ctx *ExecutionContext, writer TemplateWriter, with Context) error {
+	node, ok := nodes.ref(index).(*tagIncludeNode)
+	if !ok || node.lazy || node.parallel || node.tpl == nil {
+		return nodes.invalidIndex(index)
+	}
+	includeCtx := node.context(ctx)
+	includeCtx.Update(with)
+	return node.tpl.executeIncluded(ctx, includeCtx, writer)
+}
+
+func (nodes *GeneratedNodes) ref(index int) any {
+	if index < 0 || index >= len(nodes.refs) {
+		return nil
+	}
+	return nodes.refs[index]
+}
+
+func (nodes *GeneratedNodes) invalidIndex(index int) error {
+	return &Error{
+		Sender:    "generated",
+		OrigError: fmt.Errorf("generated code references invalid node %d", index),
+	}
+}
+
+// generatedNode replaces the nodes of a document or node wrapper by the
+// function generated for them.
+type generatedNode struct {
+	fn    GeneratedFunc
+	nodes *GeneratedNodes
+}
+
+func (node *generatedNode) Execute(ctx *ExecutionContext, writer TemplateWriter) error {
+	return node.fn(node.nodes, ctx, writer)
+}
+
+// FromGenerated loads a template compiled to Go by GenerateGo. The set must
+// have the same tags, filters and options as the set the template was
+// generated for, otherwise an error of kind ErrStaleTemplate is returned
+// (see FromSerialized). Unlike FromSerialized, the template's sources
+// aren't read: the generated code is the template.
+func (set *TemplateSet) FromGenerated(generated *GeneratedTemplate) (*Template, error) {
+	dec := newNodeDecoder(set, []byte(generated.Data))
+	entries, err := dec.readSerialized()
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) != 1 {
+		return nil, &Error{Sender: "deserialize", OrigError: errSerializedCorrupt}
+	}
+
+	nodes := &GeneratedNodes{refs: dec.refs}
+	for index, fn := range generated.Funcs {
+		node := &generatedNode{fn: fn, nodes: nodes}
+		switch target := nodes.ref(index).(type) {
+		case *nodeDocument:
+			target.Nodes = []INode{node}
+		case *NodeWrapper:
+			target.nodes = []INode{node}
+		default:
+			return nil, nodes.invalidIndex(index)
+		}
+	}
+	return entries[0].tpl, nil
+}
+
+// GenerateGo compiles templates to the source of a Go file of package pkg.
+// For each entry of templates, the file declares a variable of type
+// *GeneratedTemplate named by the entry's key, which must be a Go
+// identifier. Load them using TemplateSet.FromGenerated.
+//
+// The generated code writes HTML and constant expressions (literals,
+// operators and pure filters, which are evaluated during generation)
+// directly. It resolves variables, applies filters and evaluates if
+// conditions and for loops and includes of templates by a static filename
+// in Go, using the interpreter's functions (see GeneratedNodes) for the
+// individual steps, so the output is the same. All other tags and
+// expressions are executed by the interpreter on the serialized template
+// embedded into the generated code, but the contents of their bodies are
+// compiled to Go again. The templates must be serializable (see
+// Template.Serialize).
+//
+// Generated templates don't need to be parsed at startup, but they don't
+// execute faster than the interpreter: the generated code uses the same
+// (reflection based) functions to resolve variables and apply filters.
+func GenerateGo(pkg string, templates map[string]*Template) ([]byte, error) {
+	if !token.IsIdentifier(pkg) {
+		return nil, fmt.Errorf("invalid package name '%s'", pkg)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by pongo2.GenerateGo. DO NOT EDIT.\n\npackage %s\n\n", pkg)
+	fmt.Fprintf(&buf, "import %q\n", generatedImportPath)
+	for _, name := range slices.Sorted(maps.Keys(templates)) {
+		if !token.IsIdentifier(name) {
+			return nil, fmt.Errorf("invalid identifier '%s' for template", name)
+		}
+		if err := generateTemplate(&buf, name, templates[name]); err != nil {
+			return nil, err
+		}
+	}
+	return format.Source(buf.Bytes())
+}
+
+// goGenerator generates the functions of a template.
+type goGenerator struct {
+	tpl     *Template
+	enc     *NodeEncoder
+	ctx     *ExecutionContext
+	inlined map[*NodeWrapper]bool
+	body    strings.Builder
+	pending strings.Builder
+
+	// vars is the number of variables declared so far, used to name them.
+	vars int
+	// errReturn is the statement returning an error from the function
+	// currently generated.
+	errReturn string
+}
+
+func generateTemplate(buf *bytes.Buffer, name string, tpl *Template) error {
+	enc, err := tpl.encode()
+	if err != nil {
+		return err
+	}
+	g := &goGenerator{
+		tpl:       tpl,
+		enc:       enc,
+		ctx:       newExecutionContext(tpl, make(Context)),
+		inlined:   make(map[*NodeWrapper]bool),
+		errReturn: "return err",
+	}
+
+	// Nodes are referenced in pre-order, so the wrappers inlined into the
+	// function of their document or wrapper are known when reaching them.
+	funcs := make(map[int]string)
+	for index, ref := range enc.refOrder {
+		var nodes []INode
+		switch ref := ref.(type) {
+		case *nodeDocument:
+			nodes = ref.Nodes
+		case *NodeWrapper:
+			if g.inlined[ref] {
+				continue
+			}
+			nodes = ref.nodes
+		default:
+			continue
+		}
+		funcs[index] = fmt.Sprintf("render%s_%d", name, index)
+		fmt.Fprintf(&g.body, "\nfunc %s(nodes *pongo2.GeneratedNodes, ctx *pongo2.ExecutionContext, writer pongo2.TemplateWriter) error {\n", funcs[index])
+		g.nodes(nodes)
+		g.body.WriteString("return nil\n}\n")
+	}
+
+	fmt.Fprintf(buf, "\n// %s is the template '%s' compiled to Go.\n", name, tpl.name)
+	fmt.Fprintf(buf, "var %s = &pongo2.GeneratedTemplate{\nData: %s,\nFuncs: map[int]pongo2.GeneratedFunc{\n", name, strconv.Quote(string(enc.buf)))
+	for _, index := range slices.Sorted(maps.Keys(funcs)) {
+		fmt.Fprintf(buf, "%d: %s,\n", index, funcs[index])
+	}
+	buf.WriteString("},\n}\n")
+	buf.WriteString(g.body.String())
+	return nil
+}
+
+// nodes generates the code executing nodes.
+func (g *goGenerator) nodes(nodes []INode) {
+	for _, node := range nodes {
+		switch node := node.(type) {
+		case *nodeHTML:
+			g.pending.WriteString(node.value())
+		case *nodeVariable:
+			if s, ok := g.constantOutput(node); ok {
+				g.pending.WriteString(s)
+			} else {
+				g.variable(node)
+			}
+		case *tagCommentNode, *tagIncludeEmptyNode:
+		case *tagIfNode:
+			g.ifNode(node)
+		case *tagForNode:
+			g.forNode(node)
+		case *tagIncludeNode:
+			g.include(node)
+		default:
+			g.execute(node)
+		}
+	}
+	g.flush()
+}
+
+// flush generates the code writing the pending output.
+func (g *goGenerator) flush() {
+	if g.pending.Len() == 0 {
+		return
+	}
+	fmt.Fprintf(&g.body, "if _, err := writer.WriteString(%s); err != nil {\nreturn err\n}\n", strconv.Quote(g.pending.String()))
+	g.pending.Reset()
+}
+
+// execute generates the code executing node using the interpreter.
+func (g *goGenerator) execute(node INode) {
+	g.flush()
+	fmt.Fprintf(&g.body, "if err := nodes.Execute(%d, ctx, writer); err != nil {\nreturn err\n}\n", g.enc.refs[node])
+}
+
+// variable generates the code writing the expression of a variable node.
+func (g *goGenerator) variable(node *nodeVariable) {
+	g.flush()
+	v := g.expr(node.expr)
+	fmt.Fprintf(&g.body, "if err := nodes.Write(%d, ctx, writer, %s); err != nil {\nreturn err\n}\n", g.enc.refs[node], v)
+}
+
+// ifNode generates the code of an if tag. Constant conditions are evaluated
+// during generation, so only the branch taken is generated for them.
+func (g *goGenerator) ifNode(node *tagIfNode) {
+	g.flush()
+	for _, wrapper := range node.wrappers {
+		g.inlined[wrapper] = true
+	}
+
+	open := 0
+	for i, condition := range node.conditions {
+		if v, ok := g.constant(condition); ok {
+			if v.IsTrue() {
+				g.nodes(node.wrappers[i].nodes)
+				g.closeBlocks(open)
+				return
+			}
+			continue
+		}
+		v := g.expr(condition)
+		fmt.Fprintf(&g.body, "if %s.IsTrue() {\n", v)
+		g.nodes(node.wrappers[i].nodes)
+		g.body.WriteString("} else {\n")
+		open++
+	}
+	if len(node.wrappers) > len(node.conditions) {
+		g.nodes(node.wrappers[len(node.conditions)].nodes)
+	}
+	g.closeBlocks(open)
+}
+
+// forNode generates the code of a for tag. The loop itself is run by the
+// interpreter, which calls the generated object, body and empty functions.
+func (g *goGenerator) forNode(node *tagForNode) {
+	g.flush()
+	g.inlined[node.bodyWrapper] = true
+	fmt.Fprintf(&g.body, "if err := nodes.For(%d, ctx, func(ctx *pongo2.ExecutionContext) (*pongo2.Value, error) {\n", g.enc.refs[node])
+	errReturn := g.errReturn
+	g.errReturn = "return nil, err"
+	fmt.Fprintf(&g.body, "return %s, nil\n}, func(ctx *pongo2.ExecutionContext) error {\n", g.expr(node.objectEvaluator))
+	g.errReturn = errReturn
+	g.nodes(node.bodyWrapper.nodes)
+	g.body.WriteString("return nil\n}, ")
+	if node.emptyWrapper != nil {
+		g.inlined[node.emptyWrapper] = true
+		g.body.WriteString("func(ctx *pongo2.ExecutionContext) error {\n")
+		g.nodes(node.emptyWrapper.nodes)
+		g.body.WriteString("return nil\n}")
+	} else {
+		g.body.WriteString("nil")
+	}
+	fmt.Fprintf(&g.body, "); err != nil {\n%s\n}\n", g.errReturn)
+}
+
+// include generates the code of an include tag. Includes evaluating the
+// filename at runtime or executed in parallel are executed using the
+// interpreter.
+func (g *goGenerator) include(node *tagIncludeNode) {
+	if node.lazy || node.parallel || node.tpl == nil {
+		g.execute(node)
+		return
+	}
+	g.flush()
+	with := "nil"
+	if len(node.withPairs) > 0 {
+		var pairs []string
+		for _, key := range slices.Sorted(maps.Keys(node.withPairs)) {
+			pairs = append(pairs, fmt.Sprintf("%s: %s", strconv.Quote(key), g.expr(node.withPairs[key])))
+		}
+		with = fmt.Sprintf("pongo2.Context{%s}", strings.Join(pairs, ", "))
+	}
+	fmt.Fprintf(&g.body, "if err := nodes.Include(%d, ctx, writer, %s); err != nil {\nreturn err\n}\n", g.enc.refs[node], with)
+}
+
+// expr generates the code evaluating e and returns the name of the variable
+// holding its value. Literals, variables and filters are compiled to Go;
+// other expressions are evaluated by the interpreter.
+func (g *goGenerator) expr(e IEvaluator) string {
+	switch e := e.(type) {
+	case *stringResolver:
+		return g.declare("pongo2.AsValue(%s)", strconv.Quote(e.val))
+	case *intResolver:
+		return g.declare("pongo2.AsValue(%d)", e.val)
+	case *floatResolver:
+		return g.declare("pongo2.AsValue(float64(%s))", strconv.FormatFloat(e.val, 'g', -1, 64))
+	case *boolResolver:
+		return g.declare("pongo2.AsValue(%t)", e.val)
+	case *variableResolver:
+		if len(e.parts) > 0 && e.parts[0].typ != varTypeArray {
+			return g.resolver(e)
+		}
+	case *nodeFilteredVariable:
+		return g.filteredVariable(e)
+	}
+	return g.call("nodes.Evaluate(%d, ctx)", g.enc.refs[e])
+}
+
+// resolver generates the code resolving the parts of a variable one by one.
+func (g *goGenerator) resolver(vr *variableResolver) string {
+	v := g.call("nodes.Resolve(%d, 0, ctx, nil)", g.enc.refs[vr])
+	for i := 1; i < len(vr.parts); i++ {
+		fmt.Fprintf(&g.body, "%s, err = nodes.Resolve(%d, %d, ctx, %s)\nif err != nil {\n%s\n}\n", v, g.enc.refs[vr], i, v, g.errReturn)
+	}
+	return v
+}
+
+// filteredVariable generates the code evaluating a variable and applying its
+// filters.
+func (g *goGenerator) filteredVariable(fv *nodeFilteredVariable) string {
+	v := g.expr(fv.resolver)
+	for i, filter := range fv.filterChain {
+		param := "nil"
+		if filter.parameter != nil {
+			param = g.expr(filter.parameter)
+		}
+		v = g.call("nodes.Filter(%d, %d, ctx, %s, %s)", g.enc.refs[fv], i, v, param)
+	}
+	return v
+}
+
+// declare declares a variable holding the Go expression given by format and
+// args and returns its name.
+func (g *goGenerator) declare(format string, args ...any) string {
+	g.vars++
+	name := fmt.Sprintf("v%d", g.vars)
+	fmt.Fprintf(&g.body, "%s := %s\n", name, fmt.Sprintf(format, args...))
+	return name
+}
+
+// call declares a variable holding the value returned by the call given by
+// format and args, returning the error of the call, and returns its name.
+func (g *goGenerator) call(format string, args ...any) string {
+	g.vars++
+	name := fmt.Sprintf("v%d", g.vars)
+	fmt.Fprintf(&g.body, "%s, err := %s\nif err != nil {\n%s\n}\n", name, fmt.Sprintf(format, args...), g.errReturn)
+	return name
+}
+
+func (g *goGenerator) closeBlocks(n int) {
+	g.body.WriteString(strings.Repeat("}\n", n))
+}
+
+// constantOutput returns the output of a variable node whose expression is
+// constant. Strings which would be escaped at runtime (depending on the
+// context's autoescape setting) aren't constant.
+func (g *goGenerator) constantOutput(node *nodeVariable) (string, bool) {
+	v, ok := g.constant(node.expr)
+	if !ok {
+		return "", false
+	}
+	return constantOutput(node.expr, v)
+}
+
+// constant evaluates e if it consists of literals, operators and pure
+// filters only.
+func (g *goGenerator) constant(e IEvaluator) (*Value, bool) {
+	if !isConstantExpression(e) {
+		return nil, false
+	}
+	v, err := e.Evaluate(g.ctx)
+	if err != nil {
+		// Report the error when executing the template
+		return nil, false
+	}
+	return v, true
+}
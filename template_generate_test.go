@@ -0,0 +1,113 @@
+package pongo2
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGenerateGo(t *testing.T) {
+	set := NewSet("generate", NewMapLoader(map[string]string{
+		"base.html": `<title>{% block title %}Base{% endblock %}</title>`,
+		"page.html": `{% extends "base.html" %}{% block title %}{{ 1 + 2 }} {{ "<b>" }}` +
+			`{% if 1 > 2 %}dead{% elif user %}{{ user }}{% else %}anonymous{% endif %}` +
+			`{% for item in items %}{{ item.name|upper|default:"none" }}{% include "item.html" with n=forloop.Counter %}{% endfor %}{% endblock %}`,
+		"item.html": `({{ n }})`,
+	}))
+	tpl, err := set.FromFile("page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := GenerateGo("views", map[string]*Template{"Page": tpl})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(src)
+	for _, want := range []string{
+		"package views\n",
+		"var Page = &pongo2.GeneratedTemplate{",
+		`writer.WriteString("<title>")`,
+		`writer.WriteString("3 ")`,
+		`writer.WriteString("anonymous")`,
+		"nodes.For(",
+		"nodes.Resolve(",
+		"nodes.Filter(",
+		`pongo2.AsValue("none")`,
+		`nodes.Include(`,
+		`pongo2.Context{"n": `,
+		`writer.WriteString("(")`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("expected generated code to contain %q:\n%s", want, code)
+		}
+	}
+	if strings.Contains(code, `WriteString("dead")`) {
+		t.Errorf("expected branch of constant false condition to be dropped:\n%s", code)
+	}
+
+	if _, err := GenerateGo("views", map[string]*Template{"not an identifier": tpl}); err == nil {
+		t.Error("expected error for invalid identifier")
+	}
+	if _, err := GenerateGo("not a package", map[string]*Template{"Page": tpl}); err == nil {
+		t.Error("expected error for invalid package name")
+	}
+}
+
+func TestFromGenerated(t *testing.T) {
+	loader := NewMapLoader(map[string]string{
+		"page.html": `Hello {% for name in names %}{{ name }}{% endfor %}!`,
+	})
+	set := NewSet("generated", loader)
+	tpl, err := set.FromFile("page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := tpl.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace the body of the for loop by a function as generated by GenerateGo
+	var body int
+	for index, ref := range enc.refOrder {
+		if wrapper, ok := ref.(*NodeWrapper); ok && wrapper.Endtag == "endfor" {
+			body = index
+		}
+	}
+	generated := &GeneratedTemplate{
+		Data: string(enc.buf),
+		Funcs: map[int]GeneratedFunc{
+			body: func(nodes *GeneratedNodes, ctx *ExecutionContext, writer TemplateWriter) error {
+				_, err := writer.WriteString("<" + AsValue(ctx.Private["name"]).String() + ">")
+				return err
+			},
+		},
+	}
+
+	loaded, err := NewSet("loaded", loader).FromGenerated(generated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := loaded.Execute(Context{"names": []string{"a", "b"}})
+	if want := "Hello <a><b>!"; err != nil || got != want {
+		t.Errorf("Execute = %q, %v; want %q", got, err, want)
+	}
+
+	t.Run("stale set", func(t *testing.T) {
+		other := NewSet("options", loader)
+		other.Options.TrimBlocks = true
+		if _, err := other.FromGenerated(generated); !errors.Is(err, ErrStaleTemplate) {
+			t.Errorf("expected ErrStaleTemplate, got: %v", err)
+		}
+	})
+
+	t.Run("invalid index", func(t *testing.T) {
+		invalid := &GeneratedTemplate{
+			Data:  generated.Data,
+			Funcs: map[int]GeneratedFunc{len(enc.refOrder): generated.Funcs[body]},
+		}
+		if _, err := set.FromGenerated(invalid); err == nil {
+			t.Error("expected error for invalid index")
+		}
+	})
+}
@@ -2,12 +2,20 @@ package pongo2
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"io/fs"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 // FSLoader supports the fs.FS interface for loading templates
@@ -32,6 +40,61 @@ func (l *FSLoader) Get(path string) (io.Reader, error) {
 	return l.fs.Open(path)
 }
 
+// Resolve works like Abs, but returns an error if the resulting path
+// isn't a valid fs.FS path (for example because it escapes the root).
+func (l *FSLoader) Resolve(base, name string) (string, error) {
+	path := l.Abs(base, name)
+	if !fs.ValidPath(filepath.ToSlash(path)) {
+		return "", &fs.PathError{Op: "resolve", Path: path, Err: fs.ErrInvalid}
+	}
+	return path, nil
+}
+
+// List returns the paths of all files in the file system.
+func (l *FSLoader) List() ([]string, error) {
+	return listFS(l.fs)
+}
+
+// Stat returns the size and modification time of the template at path.
+func (l *FSLoader) Stat(path string) (*TemplateInfo, error) {
+	fi, err := fs.Stat(l.fs, path)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfoToTemplateInfo(path, fi)
+}
+
+// listFS returns the paths of all regular files in fsys.
+func listFS(fsys fs.FS) ([]string, error) {
+	var names []string
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			names = append(names, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// fileInfoToTemplateInfo converts a file's fs.FileInfo to a TemplateInfo.
+// Directories are reported as an error since they can't be templates.
+func fileInfoToTemplateInfo(path string, fi fs.FileInfo) (*TemplateInfo, error) {
+	if fi.IsDir() {
+		return nil, &fs.PathError{Op: "stat", Path: path, Err: errors.New("is a directory")}
+	}
+	return &TemplateInfo{
+		Name:    path,
+		ModTime: fi.ModTime(),
+		Size:    fi.Size(),
+	}, nil
+}
+
 // LocalFilesystemLoader represents a local filesystem loader with basic
 // BaseDirectory capabilities. The access to the local filesystem is unrestricted.
 type LocalFilesystemLoader struct {
@@ -99,30 +162,513 @@ func (fs *LocalFilesystemLoader) Get(path string) (io.Reader, error) {
 	return bytes.NewReader(buf), nil
 }
 
+// List returns the paths of all files in the base directory, relative to
+// it. Loaders without base directory can't be listed.
+func (fs *LocalFilesystemLoader) List() ([]string, error) {
+	if fs.baseDir == "" {
+		return nil, errors.New("a LocalFilesystemLoader without base directory can't be listed")
+	}
+	return listFS(os.DirFS(fs.baseDir))
+}
+
+// Stat returns the size and modification time of the file at path.
+func (fs *LocalFilesystemLoader) Stat(path string) (*TemplateInfo, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfoToTemplateInfo(path, fi)
+}
+
 // Abs resolves a filename relative to the base directory. Absolute paths are allowed.
 // When there's no base dir set, the absolute path to the filename
 // will be calculated based on either the provided base directory (which
 // might be a path of a template which includes another template) or
 // the current working directory.
 func (fs *LocalFilesystemLoader) Abs(base, name string) string {
+	path, err := fs.Resolve(base, name)
+	if err != nil {
+		panic(err)
+	}
+	return path
+}
+
+// Resolve works like Abs, but returns an error instead of panicking if the
+// current working directory can't be determined.
+func (fs *LocalFilesystemLoader) Resolve(base, name string) (string, error) {
 	if filepath.IsAbs(name) {
-		return name
+		return name, nil
 	}
 
 	// Our own base dir has always priority; if there's none
 	// we use the path provided in base.
-	var err error
 	if fs.baseDir == "" {
 		if base == "" {
-			base, err = os.Getwd()
+			base, err := os.Getwd()
 			if err != nil {
-				panic(err)
+				return "", err
 			}
-			return filepath.Join(base, name)
+			return filepath.Join(base, name), nil
+		}
+
+		return filepath.Join(filepath.Dir(base), name), nil
+	}
+
+	return filepath.Join(fs.baseDir, name), nil
+}
+
+// SandboxedFilesystemLoader loads templates from the local filesystem, but
+// confines every access to a root directory. Absolute template paths and
+// paths escaping the root (using ".." or symbolic links pointing outside
+// of it) are rejected with an error wrapping ErrSandboxViolation (which
+// {% include ... if_exists %} doesn't ignore). It's meant
+// for templates from untrusted sources (e.g. uploaded by users) and can be
+// used as a drop-in replacement for LocalFilesystemLoader with NewSet.
+//
+// Template paths are relative to the root directory; relative paths used in
+// {% include %}, {% extends %} etc. are relative to the including template.
+type SandboxedFilesystemLoader struct {
+	root *os.Root
+
+	// escapeErr is the error os.Root reports for paths escaping the root.
+	escapeErr error
+}
+
+// MustNewSandboxedFileSystemLoader creates a new SandboxedFilesystemLoader
+// and panics if there's any error during instantiation. The parameters
+// are the same like NewSandboxedFileSystemLoader.
+func MustNewSandboxedFileSystemLoader(rootDir string) *SandboxedFilesystemLoader {
+	fs, err := NewSandboxedFileSystemLoader(rootDir)
+	if err != nil {
+		log.Panic(err)
+	}
+	return fs
+}
+
+// NewSandboxedFileSystemLoader creates a new SandboxedFilesystemLoader which
+// only allows access to templates within rootDir. Call Close to release the
+// root directory once the loader isn't used anymore.
+func NewSandboxedFileSystemLoader(rootDir string) (*SandboxedFilesystemLoader, error) {
+	root, err := os.OpenRoot(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// os.Root doesn't export its error for escaping paths; grab it once
+	// to tell escapes apart from other errors.
+	var escapeErr error
+	var pathErr *fs.PathError
+	if _, err := root.Stat(".."); errors.As(err, &pathErr) {
+		escapeErr = pathErr.Err
+	}
+
+	return &SandboxedFilesystemLoader{
+		root:      root,
+		escapeErr: escapeErr,
+	}, nil
+}
+
+// Close releases the root directory.
+func (fs *SandboxedFilesystemLoader) Close() error {
+	return fs.root.Close()
+}
+
+// Abs calculates the path of name relative to the root directory. If base is
+// given, name is relative to base's directory. The returned path isn't
+// validated; use Resolve to detect paths escaping the root.
+func (fs *SandboxedFilesystemLoader) Abs(base, name string) string {
+	if base == "" || filepath.IsAbs(name) {
+		return filepath.Clean(name)
+	}
+	return filepath.Join(filepath.Dir(base), name)
+}
+
+// Resolve works like Abs, but returns an error wrapping ErrSandboxViolation
+// for absolute paths and paths escaping the root directory.
+func (fs *SandboxedFilesystemLoader) Resolve(base, name string) (string, error) {
+	path := fs.Abs(base, name)
+	if err := fs.checkPath(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Get reads the content of the template at path within the root directory.
+func (fs *SandboxedFilesystemLoader) Get(path string) (io.Reader, error) {
+	if err := fs.checkPath(path); err != nil {
+		return nil, err
+	}
+	buf, err := fs.root.ReadFile(path)
+	if err != nil {
+		return nil, fs.wrapError(path, err)
+	}
+	return bytes.NewReader(buf), nil
+}
+
+// List returns the paths of all files within the root directory.
+func (fs *SandboxedFilesystemLoader) List() ([]string, error) {
+	return listFS(fs.root.FS())
+}
+
+// Stat returns the size and modification time of the template at path
+// within the root directory.
+func (fs *SandboxedFilesystemLoader) Stat(path string) (*TemplateInfo, error) {
+	if err := fs.checkPath(path); err != nil {
+		return nil, err
+	}
+	fi, err := fs.root.Stat(path)
+	if err != nil {
+		return nil, fs.wrapError(path, err)
+	}
+	return fileInfoToTemplateInfo(path, fi)
+}
+
+// checkPath returns an error wrapping ErrSandboxViolation if path is absolute
+// or escapes the root directory lexically.
+func (fs *SandboxedFilesystemLoader) checkPath(path string) error {
+	if !filepath.IsLocal(path) {
+		return fmt.Errorf("%w: template path '%s' is outside of the loader's root directory", ErrSandboxViolation, path)
+	}
+	return nil
+}
+
+// wrapError marks errors of os.Root caused by paths escaping the root
+// directory (through symbolic links) by wrapping ErrSandboxViolation.
+func (fs *SandboxedFilesystemLoader) wrapError(path string, err error) error {
+	if fs.escapeErr != nil && errors.Is(err, fs.escapeErr) {
+		return fmt.Errorf("%w: %w", ErrSandboxViolation, err)
+	}
+	return err
+}
+
+// MapLoader is a TemplateLoader serving templates from memory. Templates are
+// identified by slash-separated names (like "emails/welcome.html"); relative
+// names in {% include %}, {% extends %} etc. are resolved relative to the
+// including template's name. It's safe for concurrent use and templates can
+// be added, replaced and removed at runtime. Note that templates which were
+// already compiled (e.g. by FromCache) aren't affected by changes until the
+// cache is cleaned using TemplateSet.CleanCache.
+type MapLoader struct {
+	mu        sync.RWMutex
+	templates map[string]mapLoaderTemplate
+}
+
+// mapLoaderTemplate is a template stored in a MapLoader.
+type mapLoaderTemplate struct {
+	content string
+	modTime time.Time
+}
+
+// NewMapLoader creates a new MapLoader initialized with a copy of the given
+// templates (name → template source). templates may be nil.
+func NewMapLoader(templates map[string]string) *MapLoader {
+	l := &MapLoader{
+		templates: make(map[string]mapLoaderTemplate, len(templates)),
+	}
+	now := time.Now()
+	for name, content := range templates {
+		l.templates[cleanMapLoaderName(name)] = mapLoaderTemplate{content: content, modTime: now}
+	}
+	return l
+}
+
+// Set adds or replaces the template with the given name.
+func (l *MapLoader) Set(name, content string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.templates[cleanMapLoaderName(name)] = mapLoaderTemplate{content: content, modTime: time.Now()}
+}
+
+// Delete removes the template with the given name.
+func (l *MapLoader) Delete(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.templates, cleanMapLoaderName(name))
+}
+
+// Abs resolves name relative to base's directory. Names starting with a
+// slash are relative to the root of the map.
+func (l *MapLoader) Abs(base, name string) string {
+	return slashAbs(base, name)
+}
+
+// Resolve works like Abs, but returns an error if the resulting name
+// escapes the root of the map.
+func (l *MapLoader) Resolve(base, name string) (string, error) {
+	return slashResolve(base, name)
+}
+
+// Get returns the template with the given name.
+func (l *MapLoader) Get(name string) (io.Reader, error) {
+	tpl, err := l.get(name)
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(tpl.content), nil
+}
+
+// List returns the names of all templates in the map.
+func (l *MapLoader) List() ([]string, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	names := make([]string, 0, len(l.templates))
+	for name := range l.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Stat returns the template's size, the time it was last set and a
+// version derived from its content.
+func (l *MapLoader) Stat(name string) (*TemplateInfo, error) {
+	tpl, err := l.get(name)
+	if err != nil {
+		return nil, err
+	}
+	return &TemplateInfo{
+		Name:    name,
+		ModTime: tpl.modTime,
+		Size:    int64(len(tpl.content)),
+		Version: contentVersion([]byte(tpl.content)),
+	}, nil
+}
+
+// contentVersion derives a TemplateInfo.Version from a template's content.
+func contentVersion(content []byte) string {
+	h := fnv.New64a()
+	h.Write(content)
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// cleanMapLoaderName normalizes a template name used as MapLoader key
+// (cleaned, without a leading slash).
+func cleanMapLoaderName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// slashAbs resolves the slash-separated name relative to base's directory.
+// Names starting with a slash are relative to the root.
+func slashAbs(base, name string) string {
+	if strings.HasPrefix(name, "/") {
+		return cleanMapLoaderName(name)
+	}
+	return path.Join(path.Dir(base), name)
+}
+
+// slashResolve works like slashAbs, but returns an error if the resulting
+// name escapes the root.
+func slashResolve(base, name string) (string, error) {
+	p := slashAbs(base, name)
+	if !fs.ValidPath(p) {
+		return "", &fs.PathError{Op: "resolve", Path: p, Err: fs.ErrInvalid}
+	}
+	return p, nil
+}
+
+// get looks up the template with the given name.
+func (l *MapLoader) get(name string) (mapLoaderTemplate, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	tpl, ok := l.templates[name]
+	if !ok {
+		return mapLoaderTemplate{}, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return tpl, nil
+}
+
+// NamespaceLoader is a TemplateLoader routing namespaced template names to
+// the loader registered for the namespace. Namespaced names are written as
+// "@namespace/name" or "namespace:name" (the latter only for registered
+// namespaces, so Windows drive letters aren't mistaken for namespaces).
+// Both forms are normalized to "@namespace/name", which is the name the
+// resulting templates have in error messages and in the template cache.
+//
+// Relative names in {% include %}, {% extends %} etc. are resolved within the
+// namespace of the including template by the namespace's loader. Names
+// without namespace which aren't relative to a namespaced template are not
+// provided by a NamespaceLoader, so other loaders of the set can serve them.
+type NamespaceLoader struct {
+	mu         sync.RWMutex
+	namespaces map[string]TemplateLoader
+}
+
+// MustNewNamespaceLoader creates a new NamespaceLoader and panics if
+// there's an error during instantiation.
+func MustNewNamespaceLoader(namespaces map[string]TemplateLoader) *NamespaceLoader {
+	l, err := NewNamespaceLoader(namespaces)
+	if err != nil {
+		log.Panic(err)
+	}
+	return l
+}
+
+// NewNamespaceLoader creates a new NamespaceLoader with the given loaders
+// (namespace → loader). namespaces may be nil.
+func NewNamespaceLoader(namespaces map[string]TemplateLoader) (*NamespaceLoader, error) {
+	l := &NamespaceLoader{
+		namespaces: make(map[string]TemplateLoader, len(namespaces)),
+	}
+	for namespace, loader := range namespaces {
+		if err := l.Mount(namespace, loader); err != nil {
+			return nil, err
 		}
+	}
+	return l, nil
+}
 
-		return filepath.Join(filepath.Dir(base), name)
+// Mount registers loader for the given namespace, replacing the loader
+// previously registered for it. Namespaces must not be empty nor contain
+// '@', '/', '\' or ':'.
+func (l *NamespaceLoader) Mount(namespace string, loader TemplateLoader) error {
+	if namespace == "" || strings.ContainsAny(namespace, `@/\:`) {
+		return fmt.Errorf("invalid template namespace '%s'", namespace)
+	}
+	if loader == nil {
+		return fmt.Errorf("loader for template namespace '%s' is nil", namespace)
 	}
 
-	return filepath.Join(fs.baseDir, name)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.namespaces[namespace] = loader
+	return nil
+}
+
+// Abs resolves name within its namespace or, if it has none, within the
+// namespace of base. Names which can't be resolved are returned unchanged.
+func (l *NamespaceLoader) Abs(base, name string) string {
+	resolved, err := l.Resolve(base, name)
+	if err != nil {
+		return name
+	}
+	return resolved
+}
+
+// Resolve works like Abs, but returns an error for unknown namespaces and
+// for names without namespace which aren't relative to a namespaced template.
+func (l *NamespaceLoader) Resolve(base, name string) (string, error) {
+	if namespace, rest, ok := l.split(name); ok {
+		return l.resolveIn(namespace, "", rest)
+	}
+	if namespace, rest, ok := l.split(base); ok {
+		return l.resolveIn(namespace, rest, name)
+	}
+	return "", &fs.PathError{Op: "resolve", Path: name, Err: fmt.Errorf("template name has no namespace: %w", fs.ErrNotExist)}
+}
+
+// Get reads the template at the (resolved) namespaced path from the
+// namespace's loader.
+func (l *NamespaceLoader) Get(path string) (io.Reader, error) {
+	loader, rest, err := l.route(path)
+	if err != nil {
+		return nil, err
+	}
+	return loader.Get(rest)
+}
+
+// List returns the namespaced names of the templates of all namespaces
+// whose loaders implement ListingTemplateLoader.
+func (l *NamespaceLoader) List() ([]string, error) {
+	l.mu.RLock()
+	namespaces := make(map[string]TemplateLoader, len(l.namespaces))
+	for namespace, loader := range l.namespaces {
+		namespaces[namespace] = loader
+	}
+	l.mu.RUnlock()
+
+	var names []string
+	for namespace, loader := range namespaces {
+		lister, ok := loader.(ListingTemplateLoader)
+		if !ok {
+			continue
+		}
+		list, err := lister.List()
+		if err != nil {
+			return nil, fmt.Errorf("template namespace '%s': %w", namespace, err)
+		}
+		for _, name := range list {
+			names = append(names, "@"+namespace+"/"+name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Stat returns the metadata reported by the namespace's loader. If the loader
+// doesn't implement ExtendedTemplateLoader, errors.ErrUnsupported is returned.
+func (l *NamespaceLoader) Stat(path string) (*TemplateInfo, error) {
+	loader, rest, err := l.route(path)
+	if err != nil {
+		return nil, err
+	}
+	ext, ok := loader.(ExtendedTemplateLoader)
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	info, err := ext.Stat(rest)
+	if err != nil {
+		return nil, err
+	}
+	info.Name = path
+	return info, nil
+}
+
+// split splits a namespaced name into namespace and name within the
+// namespace. ok is false if name has no namespace.
+func (l *NamespaceLoader) split(name string) (namespace, rest string, ok bool) {
+	if strings.HasPrefix(name, "@") {
+		namespace, rest, _ = strings.Cut(name[1:], "/")
+		return namespace, rest, true
+	}
+	namespace, rest, found := strings.Cut(name, ":")
+	if !found {
+		return "", "", false
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, ok = l.namespaces[namespace]
+	return namespace, rest, ok
+}
+
+// loader returns the loader registered for namespace.
+func (l *NamespaceLoader) loader(namespace string) (TemplateLoader, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	loader, ok := l.namespaces[namespace]
+	if !ok {
+		return nil, fmt.Errorf("unknown template namespace '%s': %w", namespace, fs.ErrNotExist)
+	}
+	return loader, nil
+}
+
+// route returns the loader and its path for a namespaced path.
+func (l *NamespaceLoader) route(path string) (TemplateLoader, string, error) {
+	namespace, rest, ok := l.split(path)
+	if !ok {
+		return nil, "", &fs.PathError{Op: "open", Path: path, Err: fmt.Errorf("template name has no namespace: %w", fs.ErrNotExist)}
+	}
+	loader, err := l.loader(namespace)
+	if err != nil {
+		return nil, "", err
+	}
+	return loader, rest, nil
+}
+
+// resolveIn resolves name relative to base within namespace and returns the
+// normalized namespaced name.
+func (l *NamespaceLoader) resolveIn(namespace, base, name string) (string, error) {
+	loader, err := l.loader(namespace)
+	if err != nil {
+		return "", err
+	}
+	var resolved string
+	if ext, ok := loader.(ExtendedTemplateLoader); ok {
+		resolved, err = ext.Resolve(base, name)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		resolved = loader.Abs(base, name)
+	}
+	return "@" + namespace + "/" + resolved, nil
 }
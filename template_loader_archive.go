@@ -0,0 +1,325 @@
+package pongo2
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// ArchiveLoader is a TemplateLoader serving templates from zip, tar or
+// gzip-compressed tar archives (the format is detected automatically).
+// Archives are read and indexed once when they're loaded; the templates are
+// kept in memory afterwards.
+//
+// Multiple archives can be layered: a template is served from the first
+// archive containing it, so themes can be deployed as an archive overriding
+// some of the templates of a base archive.
+//
+// The archives can be replaced atomically using Swap or SwapFiles (e.g. when
+// deploying a new version of a theme). Lookups always see either the old or
+// the new version of all layers. Templates which were already compiled (e.g.
+// by FromCache) aren't affected by the swap until the cache is cleaned using
+// TemplateSet.CleanCache. ArchiveLoader implements SnapshotTemplateLoader:
+// templates loaded while rendering (dynamic includes like {% include name %})
+// are loaded from the version current when the execution started.
+//
+// The zero value serves no templates until Swap or SwapFiles is called.
+//
+// Template names are slash-separated paths within the archives (like
+// "emails/welcome.html"); relative names in {% include %}, {% extends %} etc.
+// are resolved relative to the including template's name.
+type ArchiveLoader struct {
+	// MaxSize limits the total size of the files of the archives passed to
+	// Swap or SwapFiles after decompressing them (256 MiB if zero, which
+	// also applies to the constructors). It protects against archives
+	// decompressing to huge files.
+	MaxSize int64
+
+	layers atomic.Pointer[archiveLayers]
+}
+
+// defaultArchiveMaxSize is the default ArchiveLoader.MaxSize.
+const defaultArchiveMaxSize = 256 << 20
+
+// archiveLayers is a version of the archives of an ArchiveLoader. It's the
+// loader returned by ArchiveLoader.Snapshot.
+type archiveLayers struct {
+	indexes []archiveIndex
+}
+
+// noArchiveLayers are the layers of the zero value of ArchiveLoader.
+var noArchiveLayers = &archiveLayers{}
+
+// archiveIndex contains all files of an archive by their cleaned name.
+type archiveIndex map[string]archiveFile
+
+// archiveFile is a file read from an archive.
+type archiveFile struct {
+	content []byte
+	modTime time.Time
+}
+
+// NewArchiveLoader creates a new ArchiveLoader serving templates from the
+// given archives (each the content of a zip, tar or tar.gz file). The first
+// archive has the highest priority.
+func NewArchiveLoader(archives ...[]byte) (*ArchiveLoader, error) {
+	l := &ArchiveLoader{}
+	if err := l.Swap(archives...); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// NewArchiveLoaderFromFiles creates a new ArchiveLoader serving templates
+// from the archive files at the given paths. The first archive has the
+// highest priority.
+func NewArchiveLoaderFromFiles(paths ...string) (*ArchiveLoader, error) {
+	l := &ArchiveLoader{}
+	if err := l.SwapFiles(paths...); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Swap atomically replaces all archives of the loader with the given ones.
+// If any of the archives can't be read, the loader is left unchanged.
+func (l *ArchiveLoader) Swap(archives ...[]byte) error {
+	remaining := l.maxSize()
+	layers := make([]archiveIndex, 0, len(archives))
+	for i, archive := range archives {
+		index, err := indexArchive(archive, &remaining)
+		if err != nil {
+			return fmt.Errorf("archive %d: %w", i, err)
+		}
+		layers = append(layers, index)
+	}
+	return l.store(layers)
+}
+
+// SwapFiles works like Swap, but reads the archives from the files at the
+// given paths.
+func (l *ArchiveLoader) SwapFiles(paths ...string) error {
+	remaining := l.maxSize()
+	layers := make([]archiveIndex, 0, len(paths))
+	for _, path := range paths {
+		archive, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		index, err := indexArchive(archive, &remaining)
+		if err != nil {
+			return fmt.Errorf("archive %s: %w", path, err)
+		}
+		layers = append(layers, index)
+	}
+	return l.store(layers)
+}
+
+// maxSize returns the maximum total size of the files of the archives.
+func (l *ArchiveLoader) maxSize() int64 {
+	if l.MaxSize > 0 {
+		return l.MaxSize
+	}
+	return defaultArchiveMaxSize
+}
+
+// store replaces the layers of the loader.
+func (l *ArchiveLoader) store(layers []archiveIndex) error {
+	if len(layers) == 0 {
+		return errors.New("at least one archive must be specified")
+	}
+	l.layers.Store(&archiveLayers{indexes: layers})
+	return nil
+}
+
+// current returns the current layers of the loader.
+func (l *ArchiveLoader) current() *archiveLayers {
+	if layers := l.layers.Load(); layers != nil {
+		return layers
+	}
+	return noArchiveLayers
+}
+
+// Snapshot returns a loader serving the current version of the archives,
+// which isn't affected by later swaps. It returns the same loader until the
+// archives are swapped.
+func (l *ArchiveLoader) Snapshot() TemplateLoader {
+	return l.current()
+}
+
+// Abs resolves name relative to base's directory. Names starting with a
+// slash are relative to the root of the archives.
+func (l *ArchiveLoader) Abs(base, name string) string {
+	return slashAbs(base, name)
+}
+
+// Resolve works like Abs, but returns an error if the resulting name
+// escapes the root of the archives.
+func (l *ArchiveLoader) Resolve(base, name string) (string, error) {
+	return slashResolve(base, name)
+}
+
+// Get returns the template with the given name from the first archive
+// containing it.
+func (l *ArchiveLoader) Get(name string) (io.Reader, error) {
+	return l.current().Get(name)
+}
+
+// List returns the names of all files of all archives.
+func (l *ArchiveLoader) List() ([]string, error) {
+	return l.current().List()
+}
+
+// Stat returns the template's size and modification time as recorded in the
+// archive and a version derived from its content.
+func (l *ArchiveLoader) Stat(name string) (*TemplateInfo, error) {
+	return l.current().Stat(name)
+}
+
+// The methods of archiveLayers work like the ones of ArchiveLoader.
+
+func (layers *archiveLayers) Abs(base, name string) string {
+	return slashAbs(base, name)
+}
+
+func (layers *archiveLayers) Resolve(base, name string) (string, error) {
+	return slashResolve(base, name)
+}
+
+func (layers *archiveLayers) Get(name string) (io.Reader, error) {
+	file, err := layers.get(name)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(file.content), nil
+}
+
+func (layers *archiveLayers) List() ([]string, error) {
+	seen := make(map[string]bool)
+	var names []string
+	for _, index := range layers.indexes {
+		for name := range index {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (layers *archiveLayers) Stat(name string) (*TemplateInfo, error) {
+	file, err := layers.get(name)
+	if err != nil {
+		return nil, err
+	}
+	return &TemplateInfo{
+		Name:    name,
+		ModTime: file.modTime,
+		Size:    int64(len(file.content)),
+		Version: contentVersion(file.content),
+	}, nil
+}
+
+// get looks up the file with the given name in the layers.
+func (layers *archiveLayers) get(name string) (archiveFile, error) {
+	for _, index := range layers.indexes {
+		if file, ok := index[name]; ok {
+			return file, nil
+		}
+	}
+	return archiveFile{}, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// indexArchive reads all regular files of a zip, tar or tar.gz archive.
+// Their total size (decompressed) is subtracted from remaining; reading
+// fails if it's exceeded.
+func indexArchive(archive []byte, remaining *int64) (archiveIndex, error) {
+	switch {
+	case bytes.HasPrefix(archive, []byte("PK\x03\x04")), bytes.HasPrefix(archive, []byte("PK\x05\x06")):
+		return indexZip(archive, remaining)
+	case bytes.HasPrefix(archive, []byte("\x1f\x8b")):
+		gz, err := gzip.NewReader(bytes.NewReader(archive))
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		return indexTar(gz, remaining)
+	case len(archive) >= 262 && string(archive[257:262]) == "ustar":
+		return indexTar(bytes.NewReader(archive), remaining)
+	default:
+		return nil, errors.New("unknown archive format (supported are zip, tar and tar.gz)")
+	}
+}
+
+// indexZip reads all regular files of a zip archive.
+func indexZip(archive []byte, remaining *int64) (archiveIndex, error) {
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, err
+	}
+	index := make(archiveIndex, len(zr.File))
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		content, err := readArchiveFile(rc, remaining)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		index[cleanMapLoaderName(f.Name)] = archiveFile{content: content, modTime: f.Modified}
+	}
+	return index, nil
+}
+
+// indexTar reads all regular files of a tar archive.
+func indexTar(r io.Reader, remaining *int64) (archiveIndex, error) {
+	index := make(archiveIndex)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return index, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := readArchiveFile(tr, remaining)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+		index[cleanMapLoaderName(hdr.Name)] = archiveFile{content: content, modTime: hdr.ModTime}
+	}
+}
+
+// readArchiveFile reads a file of an archive and subtracts its size from
+// remaining. It fails if the file is larger than remaining.
+func readArchiveFile(r io.Reader, remaining *int64) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(r, *remaining+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > *remaining {
+		return nil, errors.New("archive exceeds the maximum size when decompressed")
+	}
+	*remaining -= int64(len(content))
+	return content, nil
+}
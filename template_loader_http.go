@@ -0,0 +1,291 @@
+package pongo2
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// HTTPLoader is a TemplateLoader fetching templates over HTTP(S), for
+// example from a CMS. Template names are slash-separated paths relative to
+// the base URL (like "emails/welcome.html"); relative names in {% include %},
+// {% extends %} etc. are resolved relative to the including template's name.
+//
+// Fetched templates are cached locally and revalidated using conditional
+// requests (If-None-Match/If-Modified-Since) when they're older than MaxAge.
+// If the server can't be reached or responds with an error, the cached copy
+// is used. A 404 or 410 response removes the template from the cache.
+// Concurrent fetches of the same template share a single request, and at
+// most MaxEntries templates are cached (the least recently used ones are
+// evicted).
+//
+// HTTPLoader implements RevalidatingTemplateLoader: FromCache recompiles
+// cached templates only if their content changed on the server.
+type HTTPLoader struct {
+	baseURL *url.URL
+	client  *http.Client
+
+	// MaxAge is the time for which fetched templates are used without
+	// revalidating them (5 seconds by default). If it's zero, templates are
+	// revalidated every time they're used, which costs a request to the
+	// server for every template (and every template it includes, extends or
+	// imports) on every FromCache call. It must be set before the loader is
+	// used.
+	MaxAge time.Duration
+
+	// MaxEntries is the maximum number of templates cached locally (1000 by
+	// default). Evicted templates are fetched again when they're used. If
+	// it's zero, the number isn't limited. It must be set before the loader
+	// is used.
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // of *httpLoaderEntry, most recently used first
+	calls   map[string]*httpLoaderCall
+}
+
+const (
+	// defaultHTTPLoaderMaxAge is the default HTTPLoader.MaxAge.
+	defaultHTTPLoaderMaxAge = 5 * time.Second
+
+	// defaultHTTPLoaderMaxEntries is the default HTTPLoader.MaxEntries.
+	defaultHTTPLoaderMaxEntries = 1000
+
+	// defaultHTTPLoaderTimeout is the timeout of the HTTP client used if
+	// NewHTTPLoader isn't given one.
+	defaultHTTPLoaderTimeout = 10 * time.Second
+)
+
+// httpLoaderEntry is a template fetched by an HTTPLoader.
+type httpLoaderEntry struct {
+	name         string
+	content      []byte
+	version      string
+	etag         string
+	lastModified string
+	fetched      time.Time
+}
+
+// httpLoaderCall is a request fetching or revalidating a template, which
+// concurrent fetches of the template wait for.
+type httpLoaderCall struct {
+	done  chan struct{}
+	entry *httpLoaderEntry
+	err   error
+}
+
+// NewHTTPLoader creates a new HTTPLoader fetching templates relative to
+// baseURL using client. If client is nil, a client with a timeout of 10
+// seconds is used.
+func NewHTTPLoader(baseURL string, client *http.Client) (*HTTPLoader, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("base URL '%s' must be an http or https URL", baseURL)
+	}
+	if client == nil {
+		client = &http.Client{Timeout: defaultHTTPLoaderTimeout}
+	}
+	return &HTTPLoader{
+		baseURL:    u,
+		client:     client,
+		MaxAge:     defaultHTTPLoaderMaxAge,
+		MaxEntries: defaultHTTPLoaderMaxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+		calls:      make(map[string]*httpLoaderCall),
+	}, nil
+}
+
+// Abs resolves name relative to base's directory. Names starting with a
+// slash are relative to the base URL.
+func (l *HTTPLoader) Abs(base, name string) string {
+	return slashAbs(base, name)
+}
+
+// Resolve works like Abs, but returns an error if the resulting name
+// escapes the base URL.
+func (l *HTTPLoader) Resolve(base, name string) (string, error) {
+	return slashResolve(base, name)
+}
+
+// Get returns the template with the given name, fetching or revalidating
+// it if necessary.
+func (l *HTTPLoader) Get(name string) (io.Reader, error) {
+	entry, err := l.fetch(name)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(entry.content), nil
+}
+
+// Stat returns the size, Last-Modified time and a version derived from the
+// content of the cached template. The template is only fetched if it isn't
+// cached yet.
+func (l *HTTPLoader) Stat(name string) (*TemplateInfo, error) {
+	entry := l.cached(name)
+	if entry == nil {
+		var err error
+		entry, err = l.fetch(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	modTime, _ := http.ParseTime(entry.lastModified)
+	return &TemplateInfo{
+		Name:    name,
+		ModTime: modTime,
+		Size:    int64(len(entry.content)),
+		Version: entry.version,
+	}, nil
+}
+
+// Changed reports whether the content of the template with the given name
+// differs from version, revalidating the template if it's older than MaxAge.
+// Templates which were removed from the server are reported as changed;
+// templates which can't be fetched for other reasons (e.g. while the server
+// is unreachable) are not, so the compiled version keeps being used.
+func (l *HTTPLoader) Changed(name, version string) bool {
+	entry, err := l.fetch(name)
+	if err != nil {
+		return errors.Is(err, fs.ErrNotExist)
+	}
+	return entry.version != version
+}
+
+// fetch returns the template with the given name from the local cache,
+// revalidating or fetching it if necessary. If the template is already being
+// fetched, it waits for that request and returns its result instead.
+func (l *HTTPLoader) fetch(name string) (*httpLoaderEntry, error) {
+	cached := l.cached(name)
+	if cached != nil && l.MaxAge > 0 && time.Since(cached.fetched) < l.MaxAge {
+		return cached, nil
+	}
+
+	l.mu.Lock()
+	if call, ok := l.calls[name]; ok {
+		l.mu.Unlock()
+		<-call.done
+		return call.entry, call.err
+	}
+	call := &httpLoaderCall{done: make(chan struct{})}
+	l.calls[name] = call
+	l.mu.Unlock()
+
+	call.entry, call.err = l.revalidate(name, cached)
+
+	l.mu.Lock()
+	delete(l.calls, name)
+	l.mu.Unlock()
+	close(call.done)
+	return call.entry, call.err
+}
+
+// revalidate fetches the template with the given name, using a conditional
+// request if it's cached.
+func (l *HTTPLoader) revalidate(name string, cached *httpLoaderEntry) (*httpLoaderEntry, error) {
+	u := l.baseURL.JoinPath(name)
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		if cached != nil {
+			// Serve the stale copy while the server is unreachable
+			return cached, nil
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		entry := *cached
+		entry.fetched = time.Now()
+		return l.store(name, &entry), nil
+	case resp.StatusCode == http.StatusOK:
+		content, err := io.ReadAll(resp.Body)
+		if err != nil {
+			if cached != nil {
+				return cached, nil
+			}
+			return nil, err
+		}
+		return l.store(name, &httpLoaderEntry{
+			name:         name,
+			content:      content,
+			version:      contentVersion(content),
+			etag:         resp.Header.Get("ETag"),
+			lastModified: resp.Header.Get("Last-Modified"),
+			fetched:      time.Now(),
+		}), nil
+	case resp.StatusCode == http.StatusNotFound, resp.StatusCode == http.StatusGone:
+		l.mu.Lock()
+		if elem, ok := l.entries[name]; ok {
+			l.remove(elem)
+		}
+		l.mu.Unlock()
+		return nil, &fs.PathError{Op: "open", Path: u.String(), Err: fs.ErrNotExist}
+	default:
+		if cached != nil {
+			// Serve the stale copy while the server responds with errors
+			return cached, nil
+		}
+		return nil, fmt.Errorf("fetching template '%s' failed: %s", u, resp.Status)
+	}
+}
+
+// cached returns the cached template with the given name, or nil.
+func (l *HTTPLoader) cached(name string) *httpLoaderEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	elem, ok := l.entries[name]
+	if !ok {
+		return nil
+	}
+	l.order.MoveToFront(elem)
+	return elem.Value.(*httpLoaderEntry)
+}
+
+// store caches entry as the current version of the template with the given
+// name and returns it. If more than MaxEntries templates are cached, the
+// least recently used ones are evicted.
+func (l *HTTPLoader) store(name string, entry *httpLoaderEntry) *httpLoaderEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if elem, ok := l.entries[name]; ok {
+		l.remove(elem)
+	}
+	l.entries[name] = l.order.PushFront(entry)
+	for l.MaxEntries > 0 && l.order.Len() > l.MaxEntries {
+		l.remove(l.order.Back())
+	}
+	return entry
+}
+
+// remove removes elem from the local cache. The caller must hold l.mu.
+func (l *HTTPLoader) remove(elem *list.Element) {
+	entry := l.order.Remove(elem).(*httpLoaderEntry)
+	delete(l.entries, entry.name)
+}
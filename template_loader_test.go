@@ -1,10 +1,23 @@
 package pongo2
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
 	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"testing/fstest"
+	"time"
 )
 
 func TestFSLoader(t *testing.T) {
@@ -175,3 +188,1103 @@ func TestMultipleLoadersWithIncludes(t *testing.T) {
 		t.Errorf("got %q, want %q", out, expected)
 	}
 }
+
+func TestMultipleLocalLoadersWithIncludes(t *testing.T) {
+	// Relative includes must be resolved by each loader on its own, not
+	// only relative to the directory of the first loader
+	primaryDir := t.TempDir()
+	fallbackDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(primaryDir, "main.tpl"), []byte(`Main: {% include "partial.tpl" %}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(fallbackDir, "partial.tpl"), []byte("Partial from fallback"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	set := NewSet("local includes", MustNewLocalFileSystemLoader(primaryDir), MustNewLocalFileSystemLoader(fallbackDir))
+
+	tpl, err := set.FromFile("main.tpl")
+	if err != nil {
+		t.Fatalf("FromFile failed: %v", err)
+	}
+	out, err := tpl.Execute(nil)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if out != "Main: Partial from fallback" {
+		t.Errorf("got %q, want %q", out, "Main: Partial from fallback")
+	}
+}
+
+func TestExtendsSuper(t *testing.T) {
+	tenant := NewMapLoader(map[string]string{
+		"base.html": `{% extends super %}{% block footer %}Tenant footer{% endblock %}`,
+	})
+	theme := NewMapLoader(map[string]string{
+		"base.html": `{% extends super %}{% block title %}Theme title{% endblock %}`,
+	})
+	defaults := NewMapLoader(map[string]string{
+		"base.html": `{% block title %}Default title{% endblock %} | {% block content %}{% endblock %} | {% block footer %}Default footer{% endblock %}`,
+		"page.html": `{% extends "base.html" %}{% block content %}Page{% endblock %}`,
+	})
+
+	set := NewSet("themes", tenant, theme, defaults)
+
+	t.Run("chain across loaders", func(t *testing.T) {
+		tpl, err := set.FromFile("page.html")
+		if err != nil {
+			t.Fatalf("FromFile failed: %v", err)
+		}
+		out, err := tpl.Execute(nil)
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		expected := "Theme title | Page | Tenant footer"
+		if out != expected {
+			t.Errorf("got %q, want %q", out, expected)
+		}
+	})
+
+	t.Run("without a loader override", func(t *testing.T) {
+		tpl, err := NewSet("defaults", defaults).FromFile("page.html")
+		if err != nil {
+			t.Fatalf("FromFile failed: %v", err)
+		}
+		out, err := tpl.Execute(nil)
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		expected := "Default title | Page | Default footer"
+		if out != expected {
+			t.Errorf("got %q, want %q", out, expected)
+		}
+	})
+
+	t.Run("no next loader", func(t *testing.T) {
+		_, err := NewSet("tenant only", tenant).FromFile("base.html")
+		if !errors.Is(err, ErrTemplateNotFound) {
+			t.Errorf("expected ErrTemplateNotFound, got: %v", err)
+		}
+	})
+
+	t.Run("string template", func(t *testing.T) {
+		_, err := set.FromString(`{% extends super %}`)
+		if err == nil || !strings.Contains(err.Error(), "cannot be used in string templates") {
+			t.Errorf("expected error for string template, got: %v", err)
+		}
+	})
+
+	t.Run("named string template", func(t *testing.T) {
+		tpl, err := set.FromStringNamed("base.html", `{% extends super %}{% block content %}Named{% endblock %}`)
+		if err != nil {
+			t.Fatalf("FromStringNamed failed: %v", err)
+		}
+		out, err := tpl.Execute(nil)
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		expected := "Theme title | Named | Tenant footer"
+		if out != expected {
+			t.Errorf("got %q, want %q", out, expected)
+		}
+	})
+}
+
+func TestExtendsCycle(t *testing.T) {
+	loader := NewMapLoader(map[string]string{
+		"self.html":  `{% extends "self.html" %}`,
+		"a.html":     `{% extends "b.html" %}`,
+		"b.html":     `{% extends "a.html" %}`,
+		"theme.html": `{% extends super %}`,
+		"super.html": `{% extends super %}`,
+	})
+	fallback := NewMapLoader(map[string]string{
+		"theme.html": `{% extends "theme.html" %}`,
+		"super.html": `{% block content %}Fallback{% endblock %}`,
+	})
+	set := NewSet("cycles", loader, fallback)
+
+	tests := []struct {
+		name  string
+		cycle string
+	}{
+		{"self.html", "self.html -> self.html"},
+		{"a.html", "a.html -> b.html -> a.html"},
+		{"b.html", "b.html -> a.html -> b.html"},
+		{"theme.html", "theme.html -> theme.html -> theme.html"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := set.FromFile(test.name)
+			if err == nil || !strings.Contains(err.Error(), test.cycle) || !strings.Contains(err.Error(), "{% extends super %}") {
+				t.Errorf("expected cycle error naming %q, got: %v", test.cycle, err)
+			}
+		})
+	}
+
+	t.Run("super", func(t *testing.T) {
+		tpl, err := set.FromFile("super.html")
+		if err != nil {
+			t.Fatalf("FromFile failed: %v", err)
+		}
+		if out, err := tpl.Execute(nil); err != nil || out != "Fallback" {
+			t.Errorf("got %q, %v; want %q", out, err, "Fallback")
+		}
+	})
+}
+
+func TestExtendedTemplateLoader(t *testing.T) {
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	testFS := fstest.MapFS{
+		"templates/base.tpl": {Data: []byte("base content"), ModTime: modTime},
+	}
+
+	t.Run("FSLoader", func(t *testing.T) {
+		loader := NewFSLoader(testFS)
+
+		path, err := loader.Resolve("templates/child.tpl", "base.tpl")
+		if err != nil {
+			t.Fatalf("Resolve failed: %v", err)
+		}
+		if path != filepath.Join("templates", "base.tpl") {
+			t.Errorf("Resolve = %q", path)
+		}
+
+		if _, err := loader.Resolve("templates/child.tpl", "../../etc/passwd"); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("Resolve should reject paths escaping the root, got: %v", err)
+		}
+
+		info, err := loader.Stat("templates/base.tpl")
+		if err != nil {
+			t.Fatalf("Stat failed: %v", err)
+		}
+		if info.Name != "templates/base.tpl" || info.Size != 12 || !info.ModTime.Equal(modTime) {
+			t.Errorf("unexpected info: %+v", info)
+		}
+
+		if _, err := loader.Stat("templates/missing.tpl"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Stat should return fs.ErrNotExist, got: %v", err)
+		}
+		if _, err := loader.Stat("templates"); err == nil {
+			t.Error("Stat should fail for directories")
+		}
+	})
+
+	t.Run("LocalFilesystemLoader", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(tmpDir, "base.tpl"), []byte("base"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		loader := MustNewLocalFileSystemLoader(tmpDir)
+
+		path, err := loader.Resolve("", "base.tpl")
+		if err != nil {
+			t.Fatalf("Resolve failed: %v", err)
+		}
+		if path != loader.Abs("", "base.tpl") {
+			t.Errorf("Resolve = %q, Abs = %q", path, loader.Abs("", "base.tpl"))
+		}
+
+		info, err := loader.Stat(path)
+		if err != nil {
+			t.Fatalf("Stat failed: %v", err)
+		}
+		if info.Size != 4 || info.ModTime.IsZero() {
+			t.Errorf("unexpected info: %+v", info)
+		}
+
+		if _, err := loader.Stat(filepath.Join(tmpDir, "missing.tpl")); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Stat should return fs.ErrNotExist, got: %v", err)
+		}
+	})
+}
+
+// legacyLoader only implements the basic TemplateLoader interface.
+type legacyLoader struct {
+	templates map[string]string
+}
+
+func (l *legacyLoader) Abs(base, name string) string {
+	return name
+}
+
+func (l *legacyLoader) Get(path string) (io.Reader, error) {
+	tpl, ok := l.templates[path]
+	if !ok {
+		return nil, errors.New("no such template")
+	}
+	return strings.NewReader(tpl), nil
+}
+
+func TestTemplateNotFoundDiagnostics(t *testing.T) {
+	fsLoader := NewFSLoader(fstest.MapFS{
+		"a.tpl": {Data: []byte("a")},
+	})
+	legacy := &legacyLoader{templates: map[string]string{"b.tpl": "b"}}
+	set := NewSet("diagnostics", fsLoader, legacy)
+
+	_, err := set.FromFile("missing.tpl")
+	if !errors.Is(err, ErrTemplateNotFound) {
+		t.Fatalf("expected ErrTemplateNotFound, got: %v", err)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the FSLoader's fs.ErrNotExist to be wrapped, got: %v", err)
+	}
+
+	var notFound *TemplateNotFoundError
+	if !errors.As(err, &notFound) {
+		t.Fatalf("expected a *TemplateNotFoundError, got: %v", err)
+	}
+	if notFound.Name != "missing.tpl" || len(notFound.Attempts) != 2 {
+		t.Fatalf("unexpected error: %+v", notFound)
+	}
+	if notFound.Attempts[0].Loader != fsLoader || notFound.Attempts[0].Path != "missing.tpl" {
+		t.Errorf("unexpected first attempt: %+v", notFound.Attempts[0])
+	}
+	if notFound.Attempts[1].Loader != legacy || notFound.Attempts[1].Err.Error() != "no such template" {
+		t.Errorf("unexpected second attempt: %+v", notFound.Attempts[1])
+	}
+	for _, want := range []string{"missing.tpl", "*pongo2.FSLoader", "*pongo2.legacyLoader", "no such template"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error message %q should contain %q", err.Error(), want)
+		}
+	}
+
+	t.Run("Stat", func(t *testing.T) {
+		info, err := set.Stat("a.tpl")
+		if err != nil {
+			t.Fatalf("Stat failed: %v", err)
+		}
+		if info.Name != "a.tpl" || info.Size != 1 {
+			t.Errorf("unexpected info: %+v", info)
+		}
+
+		_, err = set.Stat("b.tpl")
+		if !errors.Is(err, ErrTemplateNotFound) || !errors.Is(err, errors.ErrUnsupported) {
+			t.Errorf("expected not found error with unsupported legacy loader, got: %v", err)
+		}
+	})
+}
+
+// failingLoader fails to load templates with err.
+type failingLoader struct {
+	err error
+}
+
+func (l failingLoader) Abs(base, name string) string {
+	return name
+}
+
+func (l failingLoader) Get(path string) (io.Reader, error) {
+	return nil, &fs.PathError{Op: "open", Path: path, Err: l.err}
+}
+
+// failingExtendedLoader is a failingLoader implementing
+// ExtendedTemplateLoader.
+type failingExtendedLoader struct {
+	failingLoader
+}
+
+func (l failingExtendedLoader) Resolve(base, name string) (string, error) {
+	return name, nil
+}
+
+func (l failingExtendedLoader) Stat(path string) (*TemplateInfo, error) {
+	return nil, &fs.PathError{Op: "stat", Path: path, Err: l.err}
+}
+
+func TestTemplateLoaderErrors(t *testing.T) {
+	fallback := NewMapLoader(map[string]string{"inc.tpl": "fallback"})
+	set := NewSet("loader errors", failingExtendedLoader{failingLoader{err: fs.ErrPermission}}, fallback)
+
+	_, err := set.FromFile("inc.tpl")
+	if !errors.Is(err, fs.ErrPermission) || errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("expected permission error without the not-found kind, got: %v", err)
+	}
+	if _, err := set.FromString(`{% include "inc.tpl" if_exists %}`); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("expected if_exists not to ignore the permission error, got: %v", err)
+	}
+	tpl, err := set.FromString(`{% include name if_exists %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tpl.Execute(Context{"name": "inc.tpl"}); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("expected lazy include with if_exists to fail, got: %v", err)
+	}
+
+	if _, err := set.Stat("inc.tpl"); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("expected Stat to fail with the permission error, got: %v", err)
+	}
+
+	// Missing templates fall through to the next loader, as do all errors
+	// of plain TemplateLoaders except sandbox violations
+	for _, loader := range []TemplateLoader{
+		failingExtendedLoader{failingLoader{err: fs.ErrNotExist}},
+		failingLoader{err: fs.ErrPermission},
+		failingLoader{err: errors.New("not found")},
+	} {
+		set = NewSet("loader missing", loader, fallback)
+		if out, err := set.RenderTemplateFile("inc.tpl", nil); err != nil || out != "fallback" {
+			t.Errorf("%v: expected template of the next loader, got %q, %v", loader, out, err)
+		}
+	}
+	set = NewSet("loader sandbox", failingLoader{err: ErrSandboxViolation}, fallback)
+	if _, err := set.FromFile("inc.tpl"); !errors.Is(err, ErrSandboxViolation) {
+		t.Errorf("expected sandbox violation of plain loader to be returned, got: %v", err)
+	}
+	set = NewSet("loader missing", failingLoader{err: fs.ErrNotExist}, fallback)
+	if out, err := set.RenderTemplateString(`{% include "missing.tpl" if_exists %}ok`, nil); err != nil || out != "ok" {
+		t.Errorf("expected missing template to be skipped, got %q, %v", out, err)
+	}
+}
+
+func TestSandboxedFilesystemLoader(t *testing.T) {
+	tmpDir := t.TempDir()
+	rootDir := filepath.Join(tmpDir, "root")
+	files := map[string]string{
+		filepath.Join(tmpDir, "secret.txt"):               "secret",
+		filepath.Join(rootDir, "base.tpl"):                "base {% block content %}{% endblock %}",
+		filepath.Join(rootDir, "pages", "page.tpl"):       `{% extends "../base.tpl" %}{% block content %}{% include "partial.tpl" %}{% endblock %}`,
+		filepath.Join(rootDir, "pages", "partial.tpl"):    "partial",
+		filepath.Join(rootDir, "pages", "traversal.tpl"):  `{% include "../../secret.txt" %}`,
+		filepath.Join(rootDir, "pages", "absolute.tpl"):   `{% include "` + filepath.Join(tmpDir, "secret.txt") + `" %}`,
+		filepath.Join(rootDir, "pages", "symlinked.tpl"):  `{% include "link.txt" %}`,
+		filepath.Join(rootDir, "pages", "ssi.tpl"):        `{% ssi "../../secret.txt" %}`,
+		filepath.Join(rootDir, "pages", "ssi_parsed.tpl"): `{% ssi "../../secret.txt" parsed %}`,
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hasSymlink := os.Symlink(filepath.Join(tmpDir, "secret.txt"), filepath.Join(rootDir, "pages", "link.txt")) == nil
+
+	loader := MustNewSandboxedFileSystemLoader(rootDir)
+	t.Cleanup(func() {
+		if err := loader.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	set := NewSet("sandboxed", loader)
+
+	t.Run("relative includes and extends", func(t *testing.T) {
+		tpl, err := set.FromFile("pages/page.tpl")
+		if err != nil {
+			t.Fatalf("FromFile failed: %v", err)
+		}
+		out, err := tpl.Execute(nil)
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		if out != "base partial" {
+			t.Errorf("got %q, want %q", out, "base partial")
+		}
+	})
+
+	t.Run("Stat", func(t *testing.T) {
+		info, err := set.Stat("pages/partial.tpl")
+		if err != nil {
+			t.Fatalf("Stat failed: %v", err)
+		}
+		if info.Size != int64(len("partial")) {
+			t.Errorf("unexpected info: %+v", info)
+		}
+	})
+
+	rejected := []string{
+		"pages/traversal.tpl",
+		"pages/absolute.tpl",
+		"pages/ssi.tpl",
+		"pages/ssi_parsed.tpl",
+	}
+	if hasSymlink {
+		rejected = append(rejected, "pages/symlinked.tpl")
+	}
+	for _, name := range rejected {
+		t.Run(name, func(t *testing.T) {
+			_, err := set.FromFile(name)
+			if !errors.Is(err, ErrSandboxViolation) {
+				t.Fatalf("expected ErrSandboxViolation, got: %v", err)
+			}
+		})
+	}
+
+	for _, name := range []string{"../secret.txt", filepath.Join(tmpDir, "secret.txt")} {
+		if _, err := set.FromFile(name); !errors.Is(err, ErrSandboxViolation) {
+			t.Errorf("FromFile(%q): expected ErrSandboxViolation, got: %v", name, err)
+		}
+		if _, err := loader.Get(name); !errors.Is(err, ErrSandboxViolation) {
+			t.Errorf("Get(%q): expected ErrSandboxViolation, got: %v", name, err)
+		}
+	}
+
+	t.Run("if_exists", func(t *testing.T) {
+		if _, err := set.FromString(`{% include "../secret.txt" if_exists %}`); !errors.Is(err, ErrSandboxViolation) ||
+			errors.Is(err, ErrTemplateNotFound) {
+			t.Errorf("expected ErrSandboxViolation only, got: %v", err)
+		}
+		tpl, err := set.FromString(`{% include name if_exists %}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tpl.Execute(Context{"name": "../secret.txt"}); !errors.Is(err, ErrSandboxViolation) ||
+			errors.Is(err, ErrTemplateNotFound) {
+			t.Errorf("expected ErrSandboxViolation only for lazy include, got: %v", err)
+		}
+		if out, err := tpl.Execute(Context{"name": "missing.tpl"}); err != nil || out != "" {
+			t.Errorf("expected missing template to be skipped, got %q, %v", out, err)
+		}
+	})
+
+	if _, err := set.FromFile("missing.tpl"); !errors.Is(err, fs.ErrNotExist) || errors.Is(err, ErrSandboxViolation) {
+		t.Errorf("expected fs.ErrNotExist only, got: %v", err)
+	}
+
+	if _, err := NewSandboxedFileSystemLoader(filepath.Join(tmpDir, "missing")); err == nil {
+		t.Error("expected an error for a missing root directory")
+	}
+}
+
+func TestMapLoader(t *testing.T) {
+	loader := NewMapLoader(map[string]string{
+		"base.html":          "base {% block content %}{% endblock %}",
+		"/pages/page.html":   `{% extends "../base.html" %}{% block content %}{% include "partial.html" %}{% endblock %}`,
+		"pages/partial.html": "partial v1",
+	})
+	set := NewSet("map", loader)
+
+	render := func(name string) (string, error) {
+		tpl, err := set.FromFile(name)
+		if err != nil {
+			return "", err
+		}
+		return tpl.Execute(nil)
+	}
+
+	out, err := render("pages/page.html")
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	if out != "base partial v1" {
+		t.Errorf("got %q, want %q", out, "base partial v1")
+	}
+
+	t.Run("Abs", func(t *testing.T) {
+		tests := []struct{ base, name, want string }{
+			{"", "a.html", "a.html"},
+			{"pages/page.html", "a.html", "pages/a.html"},
+			{"pages/page.html", "../a.html", "a.html"},
+			{"pages/page.html", "/a.html", "a.html"},
+		}
+		for _, tt := range tests {
+			if got := loader.Abs(tt.base, tt.name); got != tt.want {
+				t.Errorf("Abs(%q, %q) = %q, want %q", tt.base, tt.name, got, tt.want)
+			}
+		}
+		if _, err := loader.Resolve("pages/page.html", "../../a.html"); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("Resolve should reject names escaping the root, got: %v", err)
+		}
+	})
+
+	t.Run("runtime updates", func(t *testing.T) {
+		before, err := loader.Stat("pages/partial.html")
+		if err != nil {
+			t.Fatalf("Stat failed: %v", err)
+		}
+
+		loader.Set("pages/partial.html", "partial v2")
+		set.CleanCache() // included templates are shared through the cache
+		out, err := render("pages/page.html")
+		if err != nil {
+			t.Fatalf("render failed: %v", err)
+		}
+		if out != "base partial v2" {
+			t.Errorf("got %q, want %q", out, "base partial v2")
+		}
+
+		after, err := loader.Stat("pages/partial.html")
+		if err != nil {
+			t.Fatalf("Stat failed: %v", err)
+		}
+		if after.Version == before.Version || after.Size != int64(len("partial v2")) {
+			t.Errorf("unexpected info after update: %+v (before: %+v)", after, before)
+		}
+
+		loader.Delete("pages/partial.html")
+		if _, err := render("pages/page.html"); !errors.Is(err, ErrTemplateNotFound) || !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected a not found error, got: %v", err)
+		}
+		if _, err := loader.Stat("pages/partial.html"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected fs.ErrNotExist, got: %v", err)
+		}
+	})
+}
+
+func TestNamespaceLoader(t *testing.T) {
+	mail := NewMapLoader(map[string]string{
+		"layout.html":  "Mail: {% block body %}{% endblock %} {% include \"footer.html\" %}",
+		"footer.html":  "Regards",
+		"welcome.html": `{% extends "layout.html" %}{% block body %}Welcome{% endblock %}`,
+		"admin.html":   `{% include "@admin/layout.html" %}`,
+	})
+	admin := NewFSLoader(fstest.MapFS{
+		"layout.html": {Data: []byte("Admin layout")},
+	})
+	mux := MustNewNamespaceLoader(map[string]TemplateLoader{
+		"mail":  mail,
+		"admin": admin,
+	})
+	app := NewMapLoader(map[string]string{
+		"layout.html": "App layout",
+	})
+	set := NewSet("namespaces", mux, app)
+
+	t.Run("routing and relative paths", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			expected string
+		}{
+			{"@mail/welcome.html", "Mail: Welcome Regards"},
+			{"mail:welcome.html", "Mail: Welcome Regards"},
+			{"@mail/admin.html", "Admin layout"},
+			{"admin:layout.html", "Admin layout"},
+			{"layout.html", "App layout"},
+		}
+		for _, tt := range tests {
+			tpl, err := set.FromFile(tt.name)
+			if err != nil {
+				t.Errorf("FromFile(%q) failed: %v", tt.name, err)
+				continue
+			}
+			out, err := tpl.Execute(nil)
+			if err != nil {
+				t.Errorf("Execute(%q) failed: %v", tt.name, err)
+				continue
+			}
+			if out != tt.expected {
+				t.Errorf("%s: got %q, want %q", tt.name, out, tt.expected)
+			}
+		}
+	})
+
+	t.Run("cache", func(t *testing.T) {
+		tpl1, err := set.FromCache("mail:welcome.html")
+		if err != nil {
+			t.Fatalf("FromCache failed: %v", err)
+		}
+		tpl2, err := set.FromCache("@mail/welcome.html")
+		if err != nil {
+			t.Fatalf("FromCache failed: %v", err)
+		}
+		if tpl1 != tpl2 {
+			t.Error("both forms of a namespaced name should share a cache entry")
+		}
+		set.CleanCache("mail:welcome.html")
+		tpl3, err := set.FromCache("@mail/welcome.html")
+		if err != nil {
+			t.Fatalf("FromCache failed: %v", err)
+		}
+		if tpl3 == tpl1 {
+			t.Error("CleanCache should remove namespaced templates")
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := set.FromFile("@unknown/page.html")
+		if !errors.Is(err, ErrTemplateNotFound) || !strings.Contains(err.Error(), "unknown template namespace 'unknown'") {
+			t.Errorf("expected unknown namespace error, got: %v", err)
+		}
+
+		mail.Set("broken.html", `{% include "missing.html" %}`)
+		_, err = set.FromFile("@mail/broken.html")
+		if !errors.Is(err, ErrTemplateNotFound) || !strings.Contains(err.Error(), "@mail/missing.html") {
+			t.Errorf("expected error mentioning @mail/missing.html, got: %v", err)
+		}
+	})
+
+	t.Run("stat", func(t *testing.T) {
+		info, err := set.Stat("mail:footer.html")
+		if err != nil {
+			t.Fatalf("Stat failed: %v", err)
+		}
+		if info.Name != "@mail/footer.html" || info.Size != int64(len("Regards")) {
+			t.Errorf("unexpected info: %+v", info)
+		}
+	})
+
+	t.Run("invalid namespaces", func(t *testing.T) {
+		for _, namespace := range []string{"", "a/b", "a:b", "@a"} {
+			if err := mux.Mount(namespace, app); err == nil {
+				t.Errorf("Mount(%q) should fail", namespace)
+			}
+		}
+		if err := mux.Mount("app", nil); err == nil {
+			t.Error("Mount with nil loader should fail")
+		}
+	})
+}
+
+// buildZip returns a zip archive containing the given files.
+func buildZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// buildTarGz returns a tar archive (gzip-compressed if compress is true)
+// containing the given files.
+func buildTarGz(t *testing.T, files map[string]string, compress bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(&buf)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	for name, content := range files {
+		hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestArchiveLoader(t *testing.T) {
+	base := buildZip(t, map[string]string{
+		"base.html":          "{% block title %}Base{% endblock %}: {% block body %}{% endblock %}",
+		"pages/home.html":    `{% extends "../base.html" %}{% block body %}{% include "partial.html" %}{% endblock %}`,
+		"pages/partial.html": "Base partial",
+		"emails/":            "",
+	})
+	theme := buildTarGz(t, map[string]string{
+		"./pages/partial.html": "Theme partial",
+	}, true)
+
+	render := func(t *testing.T, set *TemplateSet, name string) string {
+		t.Helper()
+		tpl, err := set.FromFile(name)
+		if err != nil {
+			t.Fatalf("FromFile(%q) failed: %v", name, err)
+		}
+		out, err := tpl.Execute(nil)
+		if err != nil {
+			t.Fatalf("Execute(%q) failed: %v", name, err)
+		}
+		return out
+	}
+
+	t.Run("layers", func(t *testing.T) {
+		loader, err := NewArchiveLoader(theme, base)
+		if err != nil {
+			t.Fatalf("NewArchiveLoader failed: %v", err)
+		}
+		set := NewSet("archives", loader)
+		if out := render(t, set, "pages/home.html"); out != "Base: Theme partial" {
+			t.Errorf("got %q, want %q", out, "Base: Theme partial")
+		}
+		if _, err := set.FromFile("missing.html"); !errors.Is(err, ErrTemplateNotFound) {
+			t.Errorf("expected ErrTemplateNotFound, got: %v", err)
+		}
+		if _, err := loader.Resolve("pages/home.html", "../../etc/passwd"); err == nil {
+			t.Error("expected error for path escaping the archive root")
+		}
+	})
+
+	t.Run("swap", func(t *testing.T) {
+		loader, err := NewArchiveLoader(base)
+		if err != nil {
+			t.Fatalf("NewArchiveLoader failed: %v", err)
+		}
+		set := NewSet("swap", loader)
+		if out := render(t, set, "pages/home.html"); out != "Base: Base partial" {
+			t.Errorf("got %q, want %q", out, "Base: Base partial")
+		}
+		before, _ := loader.Stat("pages/partial.html")
+
+		plainTar := buildTarGz(t, map[string]string{"pages/partial.html": "New partial"}, false)
+		if err := loader.Swap(plainTar, base); err != nil {
+			t.Fatalf("Swap failed: %v", err)
+		}
+		set.CleanCache() // included templates are shared through the cache
+		if out := render(t, set, "pages/home.html"); out != "Base: New partial" {
+			t.Errorf("got %q, want %q", out, "Base: New partial")
+		}
+		after, _ := loader.Stat("pages/partial.html")
+		if before.Version == after.Version {
+			t.Error("Version should change when the content changes")
+		}
+
+		if err := loader.Swap([]byte("no archive")); err == nil {
+			t.Error("expected error for unknown archive format")
+		}
+		if out := render(t, set, "pages/home.html"); out != "Base: New partial" {
+			t.Errorf("failed swap changed the loader: got %q", out)
+		}
+	})
+
+	t.Run("swap during execution", func(t *testing.T) {
+		loader, err := NewArchiveLoader(base)
+		if err != nil {
+			t.Fatalf("NewArchiveLoader failed: %v", err)
+		}
+		set := NewSet("pinned", loader)
+		tpl, err := set.FromString(`{{ swap() }}{% include name %}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		newPartial := buildZip(t, map[string]string{"pages/partial.html": "New partial"})
+		ctx := Context{
+			"name": "pages/partial.html",
+			"swap": func() string {
+				if err := loader.Swap(newPartial); err != nil {
+					t.Errorf("Swap failed: %v", err)
+				}
+				return ""
+			},
+		}
+		if out, err := tpl.Execute(ctx); err != nil || out != "Base partial" {
+			t.Errorf("got %q, %v; want the version current when the execution started", out, err)
+		}
+		if out, err := tpl.Execute(ctx); err != nil || out != "New partial" {
+			t.Errorf("got %q, %v; want the swapped version", out, err)
+		}
+	})
+
+	t.Run("max size", func(t *testing.T) {
+		loader := &ArchiveLoader{MaxSize: 32}
+		if err := loader.Swap(base); err == nil {
+			t.Error("expected error for archive exceeding MaxSize")
+		}
+		loader.MaxSize = 1024
+		if err := loader.Swap(base); err != nil {
+			t.Errorf("Swap failed: %v", err)
+		}
+		bomb := buildTarGz(t, map[string]string{"big.html": strings.Repeat("x", 2048)}, true)
+		if err := loader.Swap(bomb); err == nil {
+			t.Error("expected error for compressed archive exceeding MaxSize")
+		}
+	})
+
+	t.Run("files", func(t *testing.T) {
+		dir := t.TempDir()
+		themePath := filepath.Join(dir, "theme.tar.gz")
+		basePath := filepath.Join(dir, "base.zip")
+		if err := os.WriteFile(themePath, theme, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(basePath, base, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		loader, err := NewArchiveLoaderFromFiles(themePath, basePath)
+		if err != nil {
+			t.Fatalf("NewArchiveLoaderFromFiles failed: %v", err)
+		}
+		if out := render(t, NewSet("files", loader), "pages/home.html"); out != "Base: Theme partial" {
+			t.Errorf("got %q, want %q", out, "Base: Theme partial")
+		}
+		if _, err := NewArchiveLoaderFromFiles(filepath.Join(dir, "missing.zip")); err == nil {
+			t.Error("expected error for missing archive file")
+		}
+	})
+
+	t.Run("zero value", func(t *testing.T) {
+		loader := &ArchiveLoader{}
+		if names, err := loader.List(); err != nil || len(names) != 0 {
+			t.Errorf("List() = %v, %v; want no names", names, err)
+		}
+		if _, err := NewSet("zero", loader).FromFile("base.html"); !errors.Is(err, ErrTemplateNotFound) {
+			t.Errorf("expected ErrTemplateNotFound, got: %v", err)
+		}
+		if err := loader.Swap(base); err != nil {
+			t.Fatalf("Swap failed: %v", err)
+		}
+		if out := render(t, NewSet("zero", loader), "pages/home.html"); out != "Base: Base partial" {
+			t.Errorf("got %q, want %q", out, "Base: Base partial")
+		}
+	})
+}
+
+func TestHTTPLoader(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		templates = map[string]string{
+			"/tpl/page.html":    `Page: {% include "partial.html" %}`,
+			"/tpl/partial.html": "v1",
+		}
+		failing  bool
+		requests int
+		notMod   int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if failing {
+			http.Error(w, "down", http.StatusInternalServerError)
+			return
+		}
+		content, ok := templates[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		etag := `"` + contentVersion([]byte(content)) + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			notMod++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		io.WriteString(w, content)
+	}))
+	defer srv.Close()
+
+	update := func(f func()) {
+		mu.Lock()
+		defer mu.Unlock()
+		f()
+	}
+	render := func(t *testing.T, set *TemplateSet) (*Template, string) {
+		t.Helper()
+		tpl, err := set.FromCache("page.html")
+		if err != nil {
+			t.Fatalf("FromCache failed: %v", err)
+		}
+		out, err := tpl.Execute(nil)
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		return tpl, out
+	}
+
+	loader, err := NewHTTPLoader(srv.URL+"/tpl/", srv.Client())
+	if err != nil {
+		t.Fatalf("NewHTTPLoader failed: %v", err)
+	}
+	if loader.MaxAge != defaultHTTPLoaderMaxAge {
+		t.Errorf("MaxAge = %v, want %v", loader.MaxAge, defaultHTTPLoaderMaxAge)
+	}
+	loader.MaxAge = 0
+	set := NewSet("http", loader)
+
+	tpl1, out := render(t, set)
+	if out != "Page: v1" {
+		t.Errorf("got %q, want %q", out, "Page: v1")
+	}
+
+	t.Run("revalidation", func(t *testing.T) {
+		tpl2, _ := render(t, set)
+		if tpl2 != tpl1 {
+			t.Error("unchanged template should not be recompiled")
+		}
+		update(func() {
+			if notMod == 0 {
+				t.Error("expected conditional requests answered with 304")
+			}
+		})
+
+		update(func() { templates["/tpl/partial.html"] = "v2" })
+		tpl3, out := render(t, set)
+		if tpl3 == tpl1 || out != "Page: v2" {
+			t.Errorf("changed include should be recompiled: got %q", out)
+		}
+	})
+
+	t.Run("stale on failure", func(t *testing.T) {
+		before, _ := render(t, set)
+		update(func() { failing = true })
+		defer update(func() { failing = false })
+
+		tpl, out := render(t, set)
+		if tpl != before || out != "Page: v2" {
+			t.Errorf("expected cached template while the server fails, got %q", out)
+		}
+		if _, err := loader.Get("partial.html"); err != nil {
+			t.Errorf("expected stale copy, got error: %v", err)
+		}
+		if loader.Changed("uncached.html", "") {
+			t.Error("templates which can't be fetched shouldn't be reported as changed")
+		}
+	})
+
+	t.Run("max age", func(t *testing.T) {
+		cachedLoader, err := NewHTTPLoader(srv.URL+"/tpl", nil)
+		if err != nil {
+			t.Fatalf("NewHTTPLoader failed: %v", err)
+		}
+		cachedLoader.MaxAge = time.Hour
+		cachedSet := NewSet("http max age", cachedLoader)
+		render(t, cachedSet)
+
+		var count int
+		update(func() { count = requests })
+		render(t, cachedSet)
+		if _, err := cachedLoader.Get("partial.html"); err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		update(func() {
+			if requests != count {
+				t.Errorf("expected no requests within MaxAge, got %d", requests-count)
+			}
+		})
+	})
+
+	t.Run("max entries", func(t *testing.T) {
+		boundedLoader, err := NewHTTPLoader(srv.URL+"/tpl", srv.Client())
+		if err != nil {
+			t.Fatalf("NewHTTPLoader failed: %v", err)
+		}
+		if boundedLoader.MaxEntries != defaultHTTPLoaderMaxEntries {
+			t.Errorf("MaxEntries = %d, want %d", boundedLoader.MaxEntries, defaultHTTPLoaderMaxEntries)
+		}
+		boundedLoader.MaxEntries = 1
+		for _, name := range []string{"page.html", "partial.html"} {
+			if _, err := boundedLoader.Get(name); err != nil {
+				t.Fatalf("Get(%q) failed: %v", name, err)
+			}
+		}
+		if n := boundedLoader.order.Len(); n != 1 {
+			t.Errorf("expected 1 cached template, got %d", n)
+		}
+		if boundedLoader.cached("page.html") != nil || boundedLoader.cached("partial.html") == nil {
+			t.Error("expected the least recently used template to be evicted")
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		if _, err := set.FromFile("missing.html"); !errors.Is(err, ErrTemplateNotFound) {
+			t.Errorf("expected ErrTemplateNotFound, got: %v", err)
+		}
+		if !loader.Changed("missing.html", "") {
+			t.Error("removed templates should be reported as changed")
+		}
+		if _, err := NewHTTPLoader("ftp://example.com/", nil); err == nil {
+			t.Error("expected error for non-HTTP base URL")
+		}
+	})
+}
+
+func TestHTTPLoaderCoalescing(t *testing.T) {
+	var requests atomic.Int32
+	started, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		io.WriteString(w, "content")
+	}))
+	defer srv.Close()
+
+	loader, err := NewHTTPLoader(srv.URL, nil)
+	if err != nil {
+		t.Fatalf("NewHTTPLoader failed: %v", err)
+	}
+	if loader.client.Timeout != defaultHTTPLoaderTimeout {
+		t.Errorf("client timeout = %v, want %v", loader.client.Timeout, defaultHTTPLoaderTimeout)
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := loader.Get("page.html"); err != nil {
+				t.Errorf("Get failed: %v", err)
+			}
+		}()
+	}
+	<-started
+	time.Sleep(20 * time.Millisecond)
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected concurrent fetches to share 1 request, got %d", n)
+	}
+	close(release)
+	wg.Wait()
+}
+
+func TestListingTemplateLoaders(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "emails"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"base.html", filepath.Join("emails", "welcome.html")} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sandboxed := MustNewSandboxedFileSystemLoader(dir)
+	defer sandboxed.Close()
+	archive, err := NewArchiveLoader(
+		buildZip(t, map[string]string{"base.html": "x", "emails/welcome.html": "x"}),
+		buildTarGz(t, map[string]string{"base.html": "y"}, true),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapLoader := NewMapLoader(map[string]string{"emails/welcome.html": "x", "base.html": "x"})
+
+	expected := []string{"base.html", "emails/welcome.html"}
+	loaders := map[string]ListingTemplateLoader{
+		"FSLoader":                  NewFSLoader(os.DirFS(dir)),
+		"LocalFilesystemLoader":     MustNewLocalFileSystemLoader(dir),
+		"SandboxedFilesystemLoader": sandboxed,
+		"MapLoader":                 mapLoader,
+		"ArchiveLoader":             archive,
+	}
+	for name, loader := range loaders {
+		names, err := loader.List()
+		if err != nil {
+			t.Errorf("%s: List failed: %v", name, err)
+			continue
+		}
+		for i := range names {
+			names[i] = filepath.ToSlash(names[i])
+		}
+		if strings.Join(names, ",") != strings.Join(expected, ",") {
+			t.Errorf("%s: got %v, want %v", name, names, expected)
+		}
+	}
+
+	mux := MustNewNamespaceLoader(map[string]TemplateLoader{
+		"mail": mapLoader,
+		"cms":  &legacyLoader{},
+	})
+	names, err := mux.List()
+	if err != nil {
+		t.Fatalf("NamespaceLoader: List failed: %v", err)
+	}
+	if strings.Join(names, ",") != "@mail/base.html,@mail/emails/welcome.html" {
+		t.Errorf("NamespaceLoader: got %v", names)
+	}
+}
@@ -0,0 +1,270 @@
+package pongo2
+
+import (
+	"strings"
+)
+
+// optimizer rewrites the node tree of a template once before its first
+// execution (see Template.prepare):
+//
+//   - expressions consisting of literals, operators and pure filters (see
+//     TemplateSet.RegisterPureFilter) are evaluated; their output becomes
+//     HTML unless it depends on autoescaping
+//   - if tags with constant conditions are replaced by the branch taken
+//   - comments are removed
+//   - adjacent HTML is merged into a single node with the whitespace control
+//     (including TrimBlocks/LStripBlocks) applied
+//
+// The output of the optimized template is the same.
+type optimizer struct {
+	ctx *ExecutionContext
+}
+
+// optimize optimizes the node tree of the template.
+func (tpl *Template) optimize() {
+	o := &optimizer{ctx: newExecutionContext(tpl, make(Context))}
+
+	// Inner wrappers come first, so the branches of if tags with constant
+	// conditions are optimized before being inlined.
+	for _, wrapper := range tpl.wrappers {
+		wrapper.nodes = o.nodes(wrapper.nodes)
+	}
+	tpl.wrappers = nil
+	if tpl.root != nil {
+		tpl.root.Nodes = o.nodes(tpl.root.Nodes)
+	}
+}
+
+// nodes returns the optimized nodes.
+func (o *optimizer) nodes(nodes []INode) []INode {
+	var folded []INode
+	for _, node := range nodes {
+		folded = o.node(folded, node)
+	}
+	return mergeHTML(folded)
+}
+
+// node appends the optimized node to nodes.
+func (o *optimizer) node(nodes []INode, node INode) []INode {
+	switch node := node.(type) {
+	case *nodeVariable:
+		if v, ok := o.constant(node.expr); ok {
+			if s, ok := constantOutput(node.expr, v); ok {
+				return append(nodes, newHTMLNode(s, node.locationToken))
+			}
+			node.expr = &constantValue{expr: node.expr, value: v}
+		}
+	case *tagIfNode:
+		return o.ifNode(nodes, node)
+	case *tagCommentNode:
+		return nodes
+	}
+	return append(nodes, node)
+}
+
+// ifNode appends the optimized if tag to nodes. Branches whose conditions
+// are constant and false are removed; a constant true condition becomes the
+// else branch. If no condition is left, the branch taken is inlined.
+func (o *optimizer) ifNode(nodes []INode, node *tagIfNode) []INode {
+	var conditions []IEvaluator
+	var wrappers []*NodeWrapper
+	var elseWrapper *NodeWrapper
+	if len(node.wrappers) > len(node.conditions) {
+		elseWrapper = node.wrappers[len(node.conditions)]
+	}
+	for i, condition := range node.conditions {
+		if v, ok := o.constant(condition); ok {
+			if v.IsTrue() {
+				elseWrapper = node.wrappers[i]
+				break
+			}
+			continue
+		}
+		conditions = append(conditions, condition)
+		wrappers = append(wrappers, node.wrappers[i])
+	}
+
+	if len(conditions) == 0 {
+		if elseWrapper != nil {
+			for _, n := range elseWrapper.nodes {
+				nodes = o.node(nodes, n)
+			}
+		}
+		return nodes
+	}
+	if elseWrapper != nil {
+		wrappers = append(wrappers, elseWrapper)
+	}
+	node.conditions, node.wrappers = conditions, wrappers
+	return append(nodes, node)
+}
+
+// constant evaluates e if it's constant. Only values which can be
+// serialized (see constantValue) are returned.
+func (o *optimizer) constant(e IEvaluator) (*Value, bool) {
+	if !isConstantExpression(e) {
+		return nil, false
+	}
+	v, err := e.Evaluate(o.ctx)
+	if err != nil {
+		// Report the error when executing the template
+		return nil, false
+	}
+	switch v.kind {
+	case valueInt, valueFloat, valueString, valueBool:
+		return v, true
+	}
+	return nil, false
+}
+
+// isConstantExpression reports whether e consists of literals, operators and
+// pure filters only.
+func isConstantExpression(e IEvaluator) bool {
+	constant := func(e IEvaluator) bool {
+		return e == nil || isConstantExpression(e)
+	}
+	switch e := e.(type) {
+	case *stringResolver, *intResolver, *floatResolver, *boolResolver, *constantValue:
+		return true
+	case *compiledExpression:
+		return constant(e.tree)
+	case *nodeFilteredVariable:
+		for _, filter := range e.filterChain {
+			if !filter.pure || !constant(filter.parameter) {
+				return false
+			}
+		}
+		return constant(e.resolver)
+	case *Expression:
+		return constant(e.expr1) && constant(e.expr2)
+	case *relationalExpression:
+		return constant(e.expr1) && constant(e.expr2)
+	case *notExpression:
+		return constant(e.expr)
+	case *simpleExpression:
+		return constant(e.term1) && constant(e.term2)
+	case *term:
+		return constant(e.factor1) && constant(e.factor2)
+	case *power:
+		return constant(e.power1) && constant(e.power2)
+	}
+	return false
+}
+
+// constantOutput returns the output of a variable node whose expression expr
+// evaluated to v. Strings which would be escaped at runtime (depending on the
+// context's autoescape setting) have no constant output.
+func constantOutput(expr IEvaluator, v *Value) (string, bool) {
+	s := v.String()
+	if !expr.FilterApplied("safe") && !v.safe && v.IsString() && strings.ContainsAny(s, `<>&"'`) {
+		return "", false
+	}
+	return s, true
+}
+
+// newHTMLNode returns an HTML node for s at the position of token.
+func newHTMLNode(s string, token *Token) *nodeHTML {
+	html := &Token{Typ: TokenHTML, Val: s}
+	if token != nil {
+		html.Filename, html.Line, html.Col = token.Filename, token.Line, token.Col
+	}
+	return &nodeHTML{token: html}
+}
+
+// mergeHTML merges adjacent HTML nodes and applies their whitespace control.
+// Empty HTML is removed.
+func mergeHTML(nodes []INode) []INode {
+	merged := nodes[:0]
+	for i := 0; i < len(nodes); {
+		first, ok := nodes[i].(*nodeHTML)
+		if !ok {
+			merged = append(merged, nodes[i])
+			i++
+			continue
+		}
+
+		var sb strings.Builder
+		j := i
+		for ; j < len(nodes); j++ {
+			html, ok := nodes[j].(*nodeHTML)
+			if !ok {
+				break
+			}
+			sb.WriteString(html.value())
+		}
+		switch {
+		case sb.Len() == 0:
+		case j-i == 1 && !first.trimLeft && !first.trimRight:
+			merged = append(merged, first)
+		default:
+			merged = append(merged, newHTMLNode(sb.String(), first.token))
+		}
+		i = j
+	}
+	return merged
+}
+
+// constantValue is an expression evaluated by the optimizer.
+type constantValue struct {
+	expr  IEvaluator // the expression evaluated
+	value *Value
+}
+
+func (c *constantValue) Execute(ctx *ExecutionContext, writer TemplateWriter) error {
+	return executeEvaluator(c, ctx, writer)
+}
+
+func (c *constantValue) GetPositionToken() *Token {
+	return c.expr.GetPositionToken()
+}
+
+func (c *constantValue) Evaluate(ctx *ExecutionContext) (*Value, error) {
+	return c.value, nil
+}
+
+func (c *constantValue) FilterApplied(name string) bool {
+	return c.expr.FilterApplied(name)
+}
+
+func (c *constantValue) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteEvaluator(c.expr)
+	enc.WriteInt(int(c.value.kind))
+	enc.WriteBool(c.value.safe)
+	switch c.value.kind {
+	case valueInt:
+		enc.WriteInt(int(c.value.n))
+	case valueFloat:
+		enc.WriteFloat(c.value.float64())
+	case valueString:
+		enc.WriteString(c.value.s)
+	case valueBool:
+		enc.WriteBool(c.value.n != 0)
+	}
+	return nil
+}
+
+func (c *constantValue) DecodeNode(dec *NodeDecoder) error {
+	c.expr = dec.ReadEvaluator()
+	kind := valueKind(dec.ReadInt())
+	safe := dec.ReadBool()
+	switch kind {
+	case valueInt:
+		c.value = intValue(dec.ReadInt())
+	case valueFloat:
+		c.value = floatValue(dec.ReadFloat())
+	case valueString:
+		c.value = stringValue(dec.ReadString())
+	case valueBool:
+		c.value = boolValue(dec.ReadBool())
+	default:
+		if dec.err != nil {
+			return nil
+		}
+		return errSerializedCorrupt
+	}
+	if c.expr == nil && dec.err == nil {
+		return errSerializedCorrupt
+	}
+	c.value.safe = safe
+	return nil
+}
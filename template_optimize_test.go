@@ -0,0 +1,188 @@
+package pongo2
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	set := NewSet("optimize", NewMapLoader(map[string]string{
+		"base.html":  "{% if true %}\nbase{% endif %}\n{% block content %}\nbase{% endblock %}",
+		"child.html": `{% extends "base.html" %}`,
+	}))
+	if err := set.RegisterPureFilter("shout", func(in *Value, param *Value) (*Value, error) {
+		return AsValue(in.String() + "!"), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.RegisterFilter("impure", func(in *Value, param *Value) (*Value, error) {
+		return in, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		context  Context
+		nodes    string // types of the optimized root nodes
+		output   string
+	}{
+		{
+			name:     "html merged",
+			template: "a{# comment #}b{% comment %}c{% endcomment %}d  {%- if x %}{% endif %}",
+			nodes:    "*pongo2.nodeHTML *pongo2.tagIfNode",
+			output:   "abd",
+		},
+		{
+			name:     "constant output",
+			template: `<p>{{ "hello"|upper }} {{ 1 + 2 * 3 }} {{ "<b>"|safe }} {{ "hi"|shout }}</p>`,
+			nodes:    "*pongo2.nodeHTML",
+			output:   "<p>HELLO 7 <b> hi!</p>",
+		},
+		{
+			name:     "autoescaped constant",
+			template: `{{ "<b>"|lower }}{{ "a"|impure }}{{ "a"|random }}`,
+			nodes:    "*pongo2.nodeVariable *pongo2.nodeVariable *pongo2.nodeVariable",
+			output:   "&lt;b&gt;aa",
+		},
+		{
+			name:     "constant if",
+			template: "[{% if 1 > 2 %}a{% elif not true %}b{% else %}c{% endif %}]",
+			nodes:    "*pongo2.nodeHTML",
+			output:   "[c]",
+		},
+		{
+			name:     "constant false if without else",
+			template: "[{% if false %}a{% endif %}]",
+			nodes:    "*pongo2.nodeHTML",
+			output:   "[]",
+		},
+		{
+			name:     "constant true if",
+			template: "[{% if x %}a{% elif 'x'|upper == 'X' %}{% if true %}b{% endif %}{% else %}c{% endif %}]",
+			context:  Context{"x": false},
+			nodes:    "*pongo2.nodeHTML *pongo2.tagIfNode *pongo2.nodeHTML",
+			output:   "[b]",
+		},
+		{
+			name:     "errors not folded",
+			template: "{{ 1 / 0 }}",
+			nodes:    "*pongo2.nodeVariable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tpl, err := set.FromString(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := tpl.Execute(tt.context)
+			if err == nil && out != tt.output {
+				t.Errorf("Execute = %q; want %q", out, tt.output)
+			}
+			var types []string
+			for _, node := range tpl.root.Nodes {
+				types = append(types, fmt.Sprintf("%T", node))
+			}
+			if got := strings.Join(types, " "); got != tt.nodes {
+				t.Errorf("optimized nodes = %s; want %s", got, tt.nodes)
+			}
+		})
+	}
+
+	t.Run("constant if branches", func(t *testing.T) {
+		tpl, err := set.FromString("{% if false %}a{% elif x %}b{% elif 1 %}c{% elif y %}d{% else %}e{% endif %}")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tpl.prepare()
+		node := tpl.root.Nodes[0].(*tagIfNode)
+		if len(node.conditions) != 1 || len(node.wrappers) != 2 {
+			t.Errorf("expected one condition and an else branch, got %d conditions and %d branches",
+				len(node.conditions), len(node.wrappers))
+		}
+		for x, want := range map[bool]string{true: "b", false: "c"} {
+			if out, err := tpl.Execute(Context{"x": x}); err != nil || out != want {
+				t.Errorf("Execute(x=%t) = %q, %v; want %q", x, out, err, want)
+			}
+		}
+	})
+
+	t.Run("autoescape off", func(t *testing.T) {
+		tpl, err := set.FromString(`{% autoescape off %}{{ "<b>"|lower }}{% endautoescape %}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out, err := tpl.Execute(nil); err != nil || out != "<b>" {
+			t.Errorf("Execute = %q, %v; want <b>", out, err)
+		}
+	})
+
+	t.Run("whitespace options", func(t *testing.T) {
+		tpl, err := set.FromString("{% if x %}\n  a {% endif %}\n  {% if true %}\nb{% endif %}")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Options may be changed until the template is executed
+		tpl.Options.TrimBlocks = true
+		tpl.Options.LStripBlocks = true
+		want := "  ab"
+		for range 2 {
+			if out, err := tpl.Execute(Context{"x": true}); err != nil || out != want {
+				t.Errorf("Execute = %q, %v; want %q", out, err, want)
+			}
+		}
+	})
+
+	t.Run("shared parent", func(t *testing.T) {
+		trimSet := NewSet("trim", set.loaders...)
+		trimSet.Options.TrimBlocks = true
+		tpl, err := trimSet.FromFile("child.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out, err := tpl.Execute(nil); err != nil || out != "basebase" {
+			t.Errorf("Execute = %q, %v; want basebase", out, err)
+		}
+	})
+
+	t.Run("serialized", func(t *testing.T) {
+		tpl, err := set.FromString(`{{ "<b>"|lower }}{{ 1.5 * 2 }}{{ "a"|shout|safe }}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := tpl.Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := set.FromSerialized(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := decoded.root.Nodes[0].(*nodeVariable).expr.(*constantValue); !ok {
+			t.Errorf("expected folded expression to be decoded, got %T", decoded.root.Nodes[0].(*nodeVariable).expr)
+		}
+		if out, err := decoded.Execute(nil); err != nil || out != "&lt;b&gt;3.000000a!" {
+			t.Errorf("Execute = %q, %v", out, err)
+		}
+	})
+}
+
+func TestReplaceFilterPurity(t *testing.T) {
+	set := NewSet("purity", &DummyLoader{})
+	if err := set.ReplaceFilter("upper", func(in *Value, param *Value) (*Value, error) {
+		return AsValue("replaced"), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	tpl, err := set.FromString(`{{ "a"|upper }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl.prepare()
+	if _, ok := tpl.root.Nodes[0].(*nodeVariable); !ok {
+		t.Errorf("expected replaced filter not to be folded, got %T", tpl.root.Nodes[0])
+	}
+}
@@ -0,0 +1,203 @@
+package pongo2
+
+import (
+	"bytes"
+	"runtime"
+	"slices"
+)
+
+// Parts of a template marked using {% async %} or {% include ... parallel %}
+// are rendered by goroutines while the execution continues. Their output is
+// written to separate buffers (parallelPart), which a parallelWriter writes
+// in document order once they're done.
+//
+// A goroutine renders its part using an isolated context (see
+// ExecutionContext.isolate): it gets a copy of the Private context and its
+// own tag state. The number of goroutines rendering at the same time is
+// limited per execution (see TemplateSet.MaxParallel); if the limit is
+// reached, the part is rendered by the goroutine encountering it instead.
+
+// parallelPart is a part of the output of a parallelWriter.
+type parallelPart struct {
+	buf bytes.Buffer
+
+	// done is closed when the goroutine rendering the part is done (nil
+	// for output written by the parallelWriter's goroutine).
+	done  chan struct{}
+	err   error
+	panic any
+}
+
+// parallelWriter writes the output of a template execution and the parts
+// rendered in parallel in document order. It's used by a single goroutine.
+type parallelWriter struct {
+	w TemplateWriter
+
+	// parts written in order to w. The output written while parts are
+	// pending is buffered in the last part.
+	parts []*parallelPart
+}
+
+// executeDocument executes root, the document of the template executed
+// using ctx. If the templates executed contain parts rendered in parallel,
+// the output is written using a parallelWriter (unless writer is one
+// already, e.g. for included templates).
+func executeDocument(root *nodeDocument, ctx *ExecutionContext, writer TemplateWriter) error {
+	if _, ok := writer.(*parallelWriter); ok || !slices.ContainsFunc(ctx.inheritance, func(t *Template) bool {
+		return t.parallel
+	}) {
+		return root.Execute(ctx, writer)
+	}
+
+	if ctx.parallelLimit == nil {
+		ctx.parallelLimit = newParallelLimit(ctx.template.set.MaxParallel)
+	}
+	pw := &parallelWriter{w: writer}
+	return pw.finish(root.Execute(ctx, pw))
+}
+
+// newParallelLimit returns the semaphore limiting the number of goroutines
+// rendering parts of an execution to n.
+func newParallelLimit(n int) chan struct{} {
+	if n == 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	// An unbuffered channel never has room: parts are rendered sequentially
+	return make(chan struct{}, max(n, 0))
+}
+
+// executeParallel renders a part of the template using render. It's rendered
+// by a new goroutine if writer is a parallelWriter and the limit of
+// goroutines isn't reached, otherwise it's rendered immediately. Either way,
+// it's rendered using an isolated context, so the output doesn't depend on
+// how it's rendered.
+func executeParallel(ctx *ExecutionContext, writer TemplateWriter, render func(*ExecutionContext, TemplateWriter) error) error {
+	part := &parallelPart{}
+	partCtx := ctx.isolate(part)
+
+	pw, ok := writer.(*parallelWriter)
+	if !ok {
+		return render(partCtx, writer)
+	}
+	select {
+	case ctx.parallelLimit <- struct{}{}:
+	default:
+		return render(partCtx, writer)
+	}
+
+	part.done = make(chan struct{})
+	pw.parts = append(pw.parts, part, &parallelPart{})
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				part.panic = r
+			}
+			<-ctx.parallelLimit
+			close(part.done)
+		}()
+		partWriter := &parallelWriter{w: &part.buf}
+		part.err = partWriter.finish(render(partCtx, partWriter))
+	}()
+	return nil
+}
+
+func (pw *parallelWriter) Write(p []byte) (int, error) {
+	if len(pw.parts) == 0 {
+		return pw.w.Write(p)
+	}
+	return pw.parts[len(pw.parts)-1].buf.Write(p)
+}
+
+func (pw *parallelWriter) WriteString(s string) (int, error) {
+	if len(pw.parts) == 0 {
+		return pw.w.WriteString(s)
+	}
+	return pw.parts[len(pw.parts)-1].buf.WriteString(s)
+}
+
+// writeParts waits for the pending parts and writes them in order. It
+// returns the first error of a part; the parts following it aren't written.
+// A panic of a goroutine is passed on.
+func (pw *parallelWriter) writeParts() error {
+	parts := pw.parts
+	pw.parts = nil
+
+	var err error
+	for _, part := range parts {
+		if part.done != nil {
+			<-part.done
+			if part.panic != nil {
+				panic(part.panic)
+			}
+			if err == nil {
+				err = part.err
+			}
+		}
+		if err == nil {
+			_, err = part.buf.WriteTo(pw.w)
+		}
+	}
+	return err
+}
+
+// finish writes the pending parts after the execution using pw ended with
+// err (which is returned unless a part preceding it failed).
+func (pw *parallelWriter) finish(err error) error {
+	if partErr := pw.writeParts(); partErr != nil {
+		return partErr
+	}
+	return err
+}
+
+// flush makes {% flush %} tags (and the end of blocks) wait for the pending
+// parts when streaming (see Template.ExecuteStream).
+func (pw *parallelWriter) flush(block bool) error {
+	sw, ok := pw.w.(*streamWriter)
+	if !ok || (block && !sw.opts.FlushBlocks) {
+		return nil
+	}
+	if err := pw.writeParts(); err != nil {
+		return err
+	}
+	return sw.flush(block)
+}
+
+// isolate returns the context used to render part (possibly by another
+// goroutine): it has a copy of the Private context (including the loop information, which
+// is updated in place by the for tag, and the block information referring
+// to the context) and its own tag state.
+func (ctx *ExecutionContext) isolate(part *parallelPart) *ExecutionContext {
+	partCtx := NewChildExecutionContext(ctx)
+	partCtx.part = part
+	partCtx.tagState = make(map[any]any)
+	for key, value := range partCtx.Private {
+		switch value := value.(type) {
+		case *tagForLoopInformation:
+			partCtx.Private[key] = value.copy()
+		case tagBlockInformation:
+			value.ctx = partCtx
+			partCtx.Private[key] = value
+		}
+	}
+	return partCtx
+}
+
+// copy returns a copy of the loop information and its parent loops.
+func (loop *tagForLoopInformation) copy() *tagForLoopInformation {
+	c := *loop
+	if c.Parentloop != nil {
+		c.Parentloop = c.Parentloop.copy()
+	}
+	return &c
+}
+
+// macroContext returns the context to execute a macro defined in ctx with
+// when called by caller. Macros called within a part rendered in parallel
+// (but defined outside of it) use the caller's context, as ctx might be
+// modified by the goroutine executing it in the meantime.
+func (ctx *ExecutionContext) macroContext(caller *ExecutionContext) *ExecutionContext {
+	if caller != nil && caller.part != ctx.part {
+		return caller
+	}
+	return ctx
+}
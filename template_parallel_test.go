@@ -0,0 +1,233 @@
+package pongo2
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// concurrency records the maximum number of concurrent calls of its slow
+// function.
+type concurrency struct {
+	mu      sync.Mutex
+	current int
+	max     int
+}
+
+// slow returns s after d milliseconds.
+func (c *concurrency) slow(s string, d int) string {
+	c.mu.Lock()
+	c.current++
+	c.max = max(c.max, c.current)
+	c.mu.Unlock()
+	time.Sleep(time.Duration(d) * time.Millisecond)
+	c.mu.Lock()
+	c.current--
+	c.mu.Unlock()
+	return s
+}
+
+func TestParallel(t *testing.T) {
+	set := NewSet("parallel", NewMapLoader(map[string]string{
+		"widget.html":  "[{{ slow(name, delay) }}]",
+		"widgets.html": "{% for w in widgets %}{% include 'widget.html' with name=w delay=10 parallel %}{% endfor %}",
+		"base.html":    "<{% block body %}{% endblock %}>",
+		"page.html":    "{% extends 'base.html' %}{% block body %}{% include 'widgets.html' %}{% endblock %}",
+	}))
+	set.MaxParallel = 4
+
+	execute := func(t *testing.T, tpl *Template, ctx Context) (string, int) {
+		t.Helper()
+		var c concurrency
+		if ctx == nil {
+			ctx = Context{}
+		}
+		ctx["slow"] = c.slow
+		out, err := tpl.Execute(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out, c.max
+	}
+
+	t.Run("document order", func(t *testing.T) {
+		tpl, err := set.FromString(`{% async %}{{ slow("a", 30) }}{% endasync %}-` +
+			`{% async %}{{ slow("b", 10) }}{% endasync %}-{{ slow("c", 20) }}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, n := execute(t, tpl, nil)
+		if out != "a-b-c" || n != 3 {
+			t.Errorf("output %q with %d concurrent calls; want %q with 3", out, n, "a-b-c")
+		}
+	})
+
+	t.Run("include", func(t *testing.T) {
+		tpl, err := set.FromFile("page.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, n := execute(t, tpl, Context{"widgets": []string{"a", "b", "c", "d"}})
+		if out != "<[a][b][c][d]>" || n < 2 {
+			t.Errorf("output %q with %d concurrent calls", out, n)
+		}
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		limited := NewSet("limited", set.loaders[0])
+		tpl, err := limited.FromFile("widgets.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := Context{"widgets": []string{"a", "b", "c", "d", "e", "f"}}
+		for _, test := range []struct {
+			maxParallel int
+			concurrency int // the goroutine executing the template renders as well
+		}{{-1, 1}, {2, 3}} {
+			limited.MaxParallel = test.maxParallel
+			out, n := execute(t, tpl, ctx)
+			if out != "[a][b][c][d][e][f]" || n > test.concurrency {
+				t.Errorf("MaxParallel %d: output %q with %d concurrent calls", test.maxParallel, out, n)
+			}
+		}
+	})
+
+	t.Run("isolation", func(t *testing.T) {
+		tpl, err := set.FromString(`{% macro m(x) %}{{ x }}{{ y }}{% endmacro %}{% set y = "y" %}` +
+			`{% for i in items %}{% async %}{% set y = i %}{{ forloop.Counter }}{% cycle "a" "b" %}` +
+			`{{ m(slow(i, 3 - forloop.Counter0)) }}{% endasync %}{% set y = "z" %}{% endfor %}|{{ y }}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, _ := execute(t, tpl, Context{"items": []string{"1", "2", "3"}})
+		if out != "1a112a223a33|y" {
+			t.Errorf("output %q", out)
+		}
+	})
+
+	t.Run("captured", func(t *testing.T) {
+		tpl, err := set.FromString(`{% filter upper %}{% async %}{{ slow("a", 0) }}{% endasync %}b{% endfilter %}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out, _ := execute(t, tpl, nil); out != "AB" {
+			t.Errorf("output %q", out)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		fail := func(msg string, d int) (string, error) {
+			time.Sleep(time.Duration(d) * time.Millisecond)
+			return "", errors.New(msg)
+		}
+		tpl, err := set.FromString(`{% async %}{{ fail("first", 20) }}{% endasync %}` +
+			`{% async %}{{ fail("second", 0) }}{% endasync %}{{ fail("third", 0) }}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tpl.Execute(Context{"fail": fail}); err == nil || !strings.Contains(err.Error(), "first") {
+			t.Errorf("expected first error in document order, got %v", err)
+		}
+	})
+
+	t.Run("streaming", func(t *testing.T) {
+		tpl, err := set.FromString(`{% async %}{{ slow("a", 10) }}{% endasync %}{% flush %}b`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var c concurrency
+		w := &recordingWriter{}
+		if err := tpl.ExecuteStream(Context{"slow": c.slow}, w, nil); err != nil {
+			t.Fatal(err)
+		}
+		if w.String() != "ab" || len(w.flushes) != 2 || w.flushes[0] != "a" {
+			t.Errorf("output %q with flushes %q", w.String(), w.flushes)
+		}
+	})
+
+	t.Run("serialized", func(t *testing.T) {
+		tpl, err := set.FromFile("widgets.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := tpl.Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := set.FromSerialized(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, n := execute(t, decoded, Context{"widgets": []string{"a", "b"}})
+		if out != "[a][b]" || n != 2 {
+			t.Errorf("output %q with %d concurrent calls", out, n)
+		}
+	})
+}
+
+func TestParallelConcurrentExecutions(t *testing.T) {
+	set := NewSet("parallel concurrent", NewMapLoader(map[string]string{
+		"item.html": "{% cycle 'a' 'b' %}{{ item }}",
+	}))
+	tpl, err := set.FromString(`{% for item in items %}{% include "item.html" parallel %}` +
+		`{% async %}{% ifchanged %}{{ item }}{% endifchanged %}{% endasync %}{% endfor %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			out, err := tpl.Execute(Context{"items": []int{1, 2, 3}})
+			if err != nil || out != "a11a22a33" {
+				failed.Store(true)
+			}
+		})
+	}
+	wg.Wait()
+	if failed.Load() {
+		t.Error("unexpected output of concurrent executions")
+	}
+}
+
+func TestIncludeParallelParser(t *testing.T) {
+	set := NewSet("include parallel", NewMapLoader(map[string]string{
+		"inc.html": "{{ a }}{{ parallel }}",
+	}))
+	tests := []struct {
+		template string
+		output   string
+	}{
+		{`{% include "inc.html" parallel %}`, "1"},
+		{`{% include "inc.html" with a=2 parallel %}`, "2"},
+		{`{% include "inc.html" with a=2 only parallel %}`, "2"},
+		{`{% include "inc.html" with parallel=3 parallel %}`, "13"},
+		{`{% include "inc.html" with parallel=3 %}`, "13"},
+		{`{% include name parallel %}`, "1"},
+	}
+	for _, test := range tests {
+		tpl, err := set.FromString(test.template)
+		if err != nil {
+			t.Errorf("%s: %v", test.template, err)
+			continue
+		}
+		out, err := tpl.Execute(Context{"a": 1, "name": "inc.html"})
+		if err != nil || out != test.output {
+			t.Errorf("%s: got %q, %v; want %q", test.template, out, err, test.output)
+		}
+	}
+
+	for _, template := range []string{
+		`{% include "inc.html" parallel only %}`,
+		`{% async x %}{% endasync %}`,
+		`{% async %}{% endasync x %}`,
+	} {
+		if _, err := set.FromString(template); err == nil {
+			t.Errorf("%s: expected parse error", template)
+		}
+	}
+}
@@ -0,0 +1,1038 @@
+package pongo2
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Serialized templates start with serializedMagic, followed by the format
+// version, the pongo2 version and the fingerprint of the template set (see
+// TemplateSet.fingerprint). Then follow the serialized templates, each
+// preceded by true and its cache key; false ends the list. The data ends
+// with the CRC-32 (Castagnoli) checksum of everything before it, so
+// truncated or corrupted data is detected before decoding it.
+const (
+	serializedMagic = "pongo2\x00T"
+
+	// serializedFormatVersion must be incremented whenever the format or
+	// the encoding of a built-in node changes.
+	serializedFormatVersion = 3
+
+	// serializedChecksumSize is the size of the checksum at the end.
+	serializedChecksumSize = 4
+)
+
+var serializedChecksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// References to tokens, nodes, node wrappers and templates are encoded as
+// nil, as a reference to a previously encoded one (by index) or as a new one
+// followed by its content. This preserves the sharing of tokens (whose
+// values TrimBlocks/LStripBlocks modify), macros and templates. The indexes
+// also identify nodes and wrappers in code generated by GenerateGo.
+const (
+	refNil = iota
+	refBack
+	refNew
+)
+
+// errSerializedCorrupt is returned when decoding malformed serialized templates.
+var errSerializedCorrupt = errors.New("invalid serialized template data")
+
+// EncodableNodeTag is implemented by nodes which can be serialized together
+// with their template (see Template.Serialize). All built-in tags implement
+// it; templates using a tag whose nodes don't implement it can't be
+// serialized. Node types must be pointers to structs and must be registered
+// using RegisterEncodableNode to be decoded.
+//
+// EncodeNode writes the node's state to enc and DecodeNode reads it back
+// (in the same order) into a new node:
+//
+//	func (node *tagGreetNode) EncodeNode(enc *pongo2.NodeEncoder) error {
+//		enc.WriteString(node.greeting)
+//		enc.WriteEvaluator(node.name)
+//		enc.WriteWrapper(node.wrapper)
+//		return nil
+//	}
+//
+//	func (node *tagGreetNode) DecodeNode(dec *pongo2.NodeDecoder) error {
+//		node.greeting = dec.ReadString()
+//		node.name = dec.ReadEvaluator()
+//		node.wrapper = dec.ReadWrapper()
+//		return nil
+//	}
+type EncodableNodeTag interface {
+	INodeTag
+	EncodeNode(enc *NodeEncoder) error
+	DecodeNode(dec *NodeDecoder) error
+}
+
+var (
+	encodableNodesMutex sync.RWMutex
+	encodableNodeTypes  = make(map[string]reflect.Type)
+	encodableNodeNames  = make(map[reflect.Type]string)
+)
+
+// RegisterEncodableNode registers the type of node, so serialized templates
+// containing nodes of this type can be decoded. It's usually called in the
+// init function of the package providing the tag.
+func RegisterEncodableNode(node EncodableNodeTag) error {
+	if node == nil {
+		return errors.New("encodable node must not be nil")
+	}
+	typ := reflect.TypeOf(node)
+	if typ.Kind() != reflect.Pointer || typ.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("encodable node type %s must be a pointer to a struct", typ)
+	}
+	name := typ.Elem().PkgPath() + "." + typ.Elem().Name()
+
+	encodableNodesMutex.Lock()
+	defer encodableNodesMutex.Unlock()
+	if _, existing := encodableNodeTypes[name]; existing {
+		return fmt.Errorf("encodable node type '%s' is already registered", name)
+	}
+	encodableNodeTypes[name] = typ
+	encodableNodeNames[typ] = name
+	return nil
+}
+
+func mustRegisterEncodableNode(node EncodableNodeTag) {
+	if err := RegisterEncodableNode(node); err != nil {
+		panic(err)
+	}
+}
+
+func init() {
+	for _, node := range []EncodableNodeTag{
+		&nodeDocument{},
+		&nodeHTML{},
+		&nodeVariable{},
+		&nodeFilteredVariable{},
+		&variableResolver{},
+		&stringResolver{},
+		&intResolver{},
+		&floatResolver{},
+		&boolResolver{},
+		&Expression{},
+		&compiledExpression{},
+		&constantValue{},
+		&relationalExpression{},
+		&notExpression{},
+		&simpleExpression{},
+		&term{},
+		&power{},
+	} {
+		mustRegisterEncodableNode(node)
+	}
+}
+
+// NodeEncoder writes nodes in the format of serialized templates (see
+// EncodableNodeTag). Errors are sticky: after the first error, all writes
+// are ignored and the error is returned by Template.Serialize.
+type NodeEncoder struct {
+	set *TemplateSet
+	buf []byte
+	err error
+
+	// tpl is the template being encoded (used in error messages).
+	tpl *Template
+
+	// Strings and references already written, by index
+	strings     map[string]int
+	stringOrder []string
+	refs        map[any]int
+	refOrder    []any
+}
+
+// encoderMark records the state of a NodeEncoder (see reset).
+type encoderMark struct {
+	buf, strings, refs int
+}
+
+func newNodeEncoder(set *TemplateSet) *NodeEncoder {
+	return &NodeEncoder{
+		set:     set,
+		strings: make(map[string]int),
+		refs:    make(map[any]int),
+	}
+}
+
+// mark returns the current state of the encoder.
+func (enc *NodeEncoder) mark() encoderMark {
+	return encoderMark{buf: len(enc.buf), strings: len(enc.stringOrder), refs: len(enc.refOrder)}
+}
+
+// reset discards everything written (and the error occurred) since mark.
+func (enc *NodeEncoder) reset(mark encoderMark) {
+	enc.buf = enc.buf[:mark.buf]
+	for _, s := range enc.stringOrder[mark.strings:] {
+		delete(enc.strings, s)
+	}
+	enc.stringOrder = enc.stringOrder[:mark.strings]
+	for _, ref := range enc.refOrder[mark.refs:] {
+		delete(enc.refs, ref)
+	}
+	enc.refOrder = enc.refOrder[:mark.refs]
+	enc.err = nil
+}
+
+// fail records err unless an error occurred already.
+func (enc *NodeEncoder) fail(err error) {
+	if enc.err != nil {
+		return
+	}
+	if _, ok := err.(*Error); !ok {
+		err = &Error{Sender: "serialize", OrigError: err}
+		if enc.tpl != nil {
+			err.(*Error).Filename = enc.tpl.name
+		}
+	}
+	enc.err = err
+}
+
+func (enc *NodeEncoder) writeUvarint(u uint64) {
+	if enc.err == nil {
+		enc.buf = binary.AppendUvarint(enc.buf, u)
+	}
+}
+
+// writeRef writes a reference to ref and returns true if ref must be
+// encoded (it's neither nil nor written already).
+func (enc *NodeEncoder) writeRef(ref any, isNil bool) bool {
+	if enc.err != nil {
+		return false
+	}
+	if isNil {
+		enc.writeUvarint(refNil)
+		return false
+	}
+	if index, ok := enc.refs[ref]; ok {
+		enc.writeUvarint(refBack)
+		enc.writeUvarint(uint64(index))
+		return false
+	}
+	enc.refs[ref] = len(enc.refOrder)
+	enc.refOrder = append(enc.refOrder, ref)
+	enc.writeUvarint(refNew)
+	return true
+}
+
+// WriteBool writes a bool.
+func (enc *NodeEncoder) WriteBool(b bool) {
+	if b {
+		enc.writeUvarint(1)
+	} else {
+		enc.writeUvarint(0)
+	}
+}
+
+// WriteInt writes an int.
+func (enc *NodeEncoder) WriteInt(i int) {
+	if enc.err == nil {
+		enc.buf = binary.AppendVarint(enc.buf, int64(i))
+	}
+}
+
+// WriteFloat writes a float64.
+func (enc *NodeEncoder) WriteFloat(f float64) {
+	if enc.err == nil {
+		enc.buf = binary.LittleEndian.AppendUint64(enc.buf, math.Float64bits(f))
+	}
+}
+
+// WriteString writes a string. Strings occurring more than once are only
+// stored once.
+func (enc *NodeEncoder) WriteString(s string) {
+	if enc.err != nil {
+		return
+	}
+	if index, ok := enc.strings[s]; ok {
+		enc.writeUvarint(uint64(index) + 1)
+		return
+	}
+	enc.strings[s] = len(enc.stringOrder)
+	enc.stringOrder = append(enc.stringOrder, s)
+	enc.writeUvarint(0)
+	enc.writeUvarint(uint64(len(s)))
+	enc.buf = append(enc.buf, s...)
+}
+
+// WriteToken writes a token (may be nil).
+func (enc *NodeEncoder) WriteToken(t *Token) {
+	if !enc.writeRef(t, t == nil) {
+		return
+	}
+	enc.WriteString(t.Filename)
+	enc.WriteInt(int(t.Typ))
+	enc.WriteString(t.Val)
+	enc.WriteInt(t.Line)
+	enc.WriteInt(t.Col)
+	enc.WriteBool(t.TrimWhitespaces)
+}
+
+// WriteNode writes a node (may be nil). The node must implement
+// EncodableNodeTag and its type must be registered.
+func (enc *NodeEncoder) WriteNode(node INode) {
+	if enc.err != nil {
+		return
+	}
+	if node != nil {
+		if _, ok := enc.refs[node]; !ok {
+			encodableNodesMutex.RLock()
+			name, registered := encodableNodeNames[reflect.TypeOf(node)]
+			encodableNodesMutex.RUnlock()
+			encodable, ok := node.(EncodableNodeTag)
+			if !ok || !registered {
+				enc.fail(fmt.Errorf("node of type %T can't be serialized (see EncodableNodeTag)", node))
+				return
+			}
+			enc.writeRef(node, false)
+			enc.WriteString(name)
+			if err := encodable.EncodeNode(enc); err != nil {
+				enc.fail(err)
+			}
+			return
+		}
+	}
+	enc.writeRef(node, node == nil)
+}
+
+// WriteEvaluator writes an evaluator (may be nil), see WriteNode.
+func (enc *NodeEncoder) WriteEvaluator(e IEvaluator) {
+	enc.WriteNode(e)
+}
+
+// WriteWrapper writes a node wrapper (may be nil) including its nodes.
+func (enc *NodeEncoder) WriteWrapper(wrapper *NodeWrapper) {
+	if !enc.writeRef(wrapper, wrapper == nil) {
+		return
+	}
+	enc.WriteString(wrapper.Endtag)
+	enc.writeNodes(wrapper.nodes)
+}
+
+func (enc *NodeEncoder) writeNodes(nodes []INode) {
+	enc.writeUvarint(uint64(len(nodes)))
+	for _, node := range nodes {
+		enc.WriteNode(node)
+	}
+}
+
+func (enc *NodeEncoder) writeEvaluators(evaluators []IEvaluator) {
+	enc.writeUvarint(uint64(len(evaluators)))
+	for _, e := range evaluators {
+		enc.WriteEvaluator(e)
+	}
+}
+
+func (enc *NodeEncoder) writeWrappers(wrappers []*NodeWrapper) {
+	enc.writeUvarint(uint64(len(wrappers)))
+	for _, wrapper := range wrappers {
+		enc.WriteWrapper(wrapper)
+	}
+}
+
+func (enc *NodeEncoder) writeStrings(strs []string) {
+	enc.writeUvarint(uint64(len(strs)))
+	for _, s := range strs {
+		enc.WriteString(s)
+	}
+}
+
+// writeEvaluatorMap writes m in the order of its keys.
+func (enc *NodeEncoder) writeEvaluatorMap(m map[string]IEvaluator) {
+	enc.writeUvarint(uint64(len(m)))
+	for _, key := range slices.Sorted(maps.Keys(m)) {
+		enc.WriteString(key)
+		enc.WriteEvaluator(m[key])
+	}
+}
+
+// writeTemplate writes a template (may be nil) including the templates it
+// references.
+func (enc *NodeEncoder) writeTemplate(tpl *Template) {
+	if !enc.writeRef(tpl, tpl == nil) {
+		return
+	}
+
+	// The nodes are stored prepared for execution (with TrimBlocks/
+	// LStripBlocks applied and optimized)
+	tpl.prepare()
+
+	parentTpl := enc.tpl
+	enc.tpl = tpl
+	defer func() { enc.tpl = parentTpl }()
+
+	enc.WriteString(tpl.name)
+	enc.WriteBool(tpl.isTplString)
+	enc.WriteInt(tpl.origin.loader)
+	enc.WriteString(tpl.origin.lookup.base)
+	enc.WriteString(tpl.origin.lookup.path)
+	enc.WriteInt(tpl.size)
+	enc.WriteBool(tpl.Options.TrimBlocks)
+	enc.WriteBool(tpl.Options.LStripBlocks)
+	enc.WriteBool(tpl.parallel)
+
+	enc.writeUvarint(uint64(len(tpl.sources)))
+	for _, src := range tpl.sources {
+		enc.WriteInt(src.key.loader)
+		enc.WriteString(src.key.name)
+		enc.WriteString(src.hash)
+	}
+
+	enc.writeTemplate(tpl.parent)
+	enc.WriteNode(tpl.root)
+
+	enc.writeUvarint(uint64(len(tpl.blocks)))
+	for _, name := range slices.Sorted(maps.Keys(tpl.blocks)) {
+		enc.WriteString(name)
+		enc.WriteWrapper(tpl.blocks[name])
+	}
+	enc.writeUvarint(uint64(len(tpl.exportedMacros)))
+	for _, name := range slices.Sorted(maps.Keys(tpl.exportedMacros)) {
+		enc.WriteString(name)
+		enc.WriteNode(tpl.exportedMacros[name])
+	}
+}
+
+// writeHeader writes the header of serialized templates.
+func (enc *NodeEncoder) writeHeader() {
+	enc.buf = append(enc.buf, serializedMagic...)
+	enc.writeUvarint(serializedFormatVersion)
+	enc.WriteString(Version)
+	enc.WriteString(enc.set.fingerprint())
+}
+
+// writeChecksum appends the checksum of the data written so far, which ends
+// the serialized templates.
+func (enc *NodeEncoder) writeChecksum() {
+	enc.buf = binary.LittleEndian.AppendUint32(enc.buf, crc32.Checksum(enc.buf, serializedChecksumTable))
+}
+
+// NodeDecoder reads nodes written by a NodeEncoder (see EncodableNodeTag).
+// Errors are sticky: after the first error (e.g. because of malformed
+// data), all reads return zero values.
+type NodeDecoder struct {
+	set  *TemplateSet
+	data []byte
+	pos  int
+	err  error
+
+	strings []string
+	refs    []any
+
+	// Current content hash and dependency of the sources checked by
+	// validate, by source
+	hashes       map[templateKey]string
+	dependencies map[templateKey]*templateDependency
+}
+
+// serializedEntry is a template read from serialized templates along with
+// its cache key.
+type serializedEntry struct {
+	key string
+	tpl *Template
+}
+
+func newNodeDecoder(set *TemplateSet, data []byte) *NodeDecoder {
+	return &NodeDecoder{
+		set:          set,
+		data:         data,
+		hashes:       make(map[templateKey]string),
+		dependencies: make(map[templateKey]*templateDependency),
+	}
+}
+
+// TemplateSet returns the template set templates are decoded for.
+func (dec *NodeDecoder) TemplateSet() *TemplateSet {
+	return dec.set
+}
+
+// fail records err unless an error occurred already.
+func (dec *NodeDecoder) fail(err error) {
+	if dec.err == nil {
+		dec.err = err
+	}
+}
+
+func (dec *NodeDecoder) readUvarint() uint64 {
+	if dec.err != nil {
+		return 0
+	}
+	u, n := binary.Uvarint(dec.data[dec.pos:])
+	if n <= 0 {
+		dec.fail(errSerializedCorrupt)
+		return 0
+	}
+	dec.pos += n
+	return u
+}
+
+// readCount reads the number of elements of a list. Every element takes at
+// least one byte, so larger numbers than the remaining bytes are invalid.
+func (dec *NodeDecoder) readCount() int {
+	n := dec.readUvarint()
+	if n > uint64(len(dec.data)-dec.pos) {
+		dec.fail(errSerializedCorrupt)
+		return 0
+	}
+	return int(n)
+}
+
+// readRef reads a reference. It returns the referenced value if it was
+// decoded already, or isNew if it follows.
+func (dec *NodeDecoder) readRef() (ref any, isNew bool) {
+	switch dec.readUvarint() {
+	case refNil:
+		return nil, false
+	case refBack:
+		index := dec.readUvarint()
+		if index >= uint64(len(dec.refs)) {
+			dec.fail(errSerializedCorrupt)
+			return nil, false
+		}
+		return dec.refs[index], false
+	case refNew:
+		return nil, true
+	default:
+		dec.fail(errSerializedCorrupt)
+		return nil, false
+	}
+}
+
+// ReadBool reads a bool.
+func (dec *NodeDecoder) ReadBool() bool {
+	return dec.readUvarint() != 0
+}
+
+// ReadInt reads an int.
+func (dec *NodeDecoder) ReadInt() int {
+	if dec.err != nil {
+		return 0
+	}
+	i, n := binary.Varint(dec.data[dec.pos:])
+	if n <= 0 {
+		dec.fail(errSerializedCorrupt)
+		return 0
+	}
+	dec.pos += n
+	return int(i)
+}
+
+// ReadFloat reads a float64.
+func (dec *NodeDecoder) ReadFloat() float64 {
+	if dec.err != nil {
+		return 0
+	}
+	if len(dec.data)-dec.pos < 8 {
+		dec.fail(errSerializedCorrupt)
+		return 0
+	}
+	f := math.Float64frombits(binary.LittleEndian.Uint64(dec.data[dec.pos:]))
+	dec.pos += 8
+	return f
+}
+
+// ReadString reads a string.
+func (dec *NodeDecoder) ReadString() string {
+	index := dec.readUvarint()
+	if dec.err != nil {
+		return ""
+	}
+	if index > 0 {
+		if index > uint64(len(dec.strings)) {
+			dec.fail(errSerializedCorrupt)
+			return ""
+		}
+		return dec.strings[index-1]
+	}
+	n := dec.readUvarint()
+	if n > uint64(len(dec.data)-dec.pos) {
+		dec.fail(errSerializedCorrupt)
+		return ""
+	}
+	s := string(dec.data[dec.pos : dec.pos+int(n)])
+	dec.pos += int(n)
+	dec.strings = append(dec.strings, s)
+	return s
+}
+
+// ReadToken reads a token (may be nil).
+func (dec *NodeDecoder) ReadToken() *Token {
+	ref, isNew := dec.readRef()
+	if !isNew {
+		t, ok := ref.(*Token)
+		if !ok && ref != nil {
+			dec.fail(errSerializedCorrupt)
+		}
+		return t
+	}
+	t := &Token{}
+	dec.refs = append(dec.refs, t)
+	t.Filename = dec.ReadString()
+	t.Typ = TokenType(dec.ReadInt())
+	t.Val = dec.ReadString()
+	t.Line = dec.ReadInt()
+	t.Col = dec.ReadInt()
+	t.TrimWhitespaces = dec.ReadBool()
+	return t
+}
+
+// ReadNode reads a node (may be nil).
+func (dec *NodeDecoder) ReadNode() INode {
+	ref, isNew := dec.readRef()
+	if !isNew {
+		node, ok := ref.(INode)
+		if !ok && ref != nil {
+			dec.fail(errSerializedCorrupt)
+		}
+		return node
+	}
+
+	name := dec.ReadString()
+	if dec.err != nil {
+		return nil
+	}
+	encodableNodesMutex.RLock()
+	typ, ok := encodableNodeTypes[name]
+	encodableNodesMutex.RUnlock()
+	if !ok {
+		dec.fail(fmt.Errorf("unknown node type '%s' (see RegisterEncodableNode)", name))
+		return nil
+	}
+
+	node := reflect.New(typ.Elem()).Interface().(EncodableNodeTag)
+	dec.refs = append(dec.refs, node)
+	if err := node.DecodeNode(dec); err != nil {
+		dec.fail(err)
+	}
+	return node
+}
+
+// ReadEvaluator reads an evaluator (may be nil).
+func (dec *NodeDecoder) ReadEvaluator() IEvaluator {
+	node := dec.ReadNode()
+	if node == nil {
+		return nil
+	}
+	e, ok := node.(IEvaluator)
+	if !ok {
+		dec.fail(errSerializedCorrupt)
+	}
+	return e
+}
+
+// readRequiredEvaluator reads an evaluator which must not be nil.
+func (dec *NodeDecoder) readRequiredEvaluator() IEvaluator {
+	e := dec.ReadEvaluator()
+	if e == nil {
+		dec.fail(errSerializedCorrupt)
+	}
+	return e
+}
+
+// ReadWrapper reads a node wrapper (may be nil).
+func (dec *NodeDecoder) ReadWrapper() *NodeWrapper {
+	ref, isNew := dec.readRef()
+	if !isNew {
+		wrapper, ok := ref.(*NodeWrapper)
+		if !ok && ref != nil {
+			dec.fail(errSerializedCorrupt)
+		}
+		return wrapper
+	}
+	wrapper := &NodeWrapper{}
+	dec.refs = append(dec.refs, wrapper)
+	wrapper.Endtag = dec.ReadString()
+	wrapper.nodes = dec.readNodes()
+	return wrapper
+}
+
+func (dec *NodeDecoder) readNodes() []INode {
+	nodes := make([]INode, dec.readCount())
+	for i := range nodes {
+		nodes[i] = dec.ReadNode()
+	}
+	return nodes
+}
+
+func (dec *NodeDecoder) readEvaluators() []IEvaluator {
+	evaluators := make([]IEvaluator, dec.readCount())
+	for i := range evaluators {
+		evaluators[i] = dec.ReadEvaluator()
+	}
+	return evaluators
+}
+
+func (dec *NodeDecoder) readWrappers() []*NodeWrapper {
+	wrappers := make([]*NodeWrapper, dec.readCount())
+	for i := range wrappers {
+		wrappers[i] = dec.ReadWrapper()
+	}
+	return wrappers
+}
+
+func (dec *NodeDecoder) readStrings() []string {
+	strs := make([]string, dec.readCount())
+	for i := range strs {
+		strs[i] = dec.ReadString()
+	}
+	return strs
+}
+
+func (dec *NodeDecoder) readEvaluatorMap() map[string]IEvaluator {
+	n := dec.readCount()
+	m := make(map[string]IEvaluator, n)
+	for range n {
+		key := dec.ReadString()
+		m[key] = dec.ReadEvaluator()
+	}
+	return m
+}
+
+// readMacro reads a reference to a macro.
+func (dec *NodeDecoder) readMacro() *tagMacroNode {
+	macro, ok := dec.ReadNode().(*tagMacroNode)
+	if !ok {
+		dec.fail(errSerializedCorrupt)
+	}
+	return macro
+}
+
+// readTemplate reads a template (may be nil) including the templates it
+// references.
+func (dec *NodeDecoder) readTemplate() *Template {
+	ref, isNew := dec.readRef()
+	if !isNew {
+		tpl, ok := ref.(*Template)
+		if !ok && ref != nil {
+			dec.fail(errSerializedCorrupt)
+		}
+		return tpl
+	}
+
+	tpl := &Template{
+		set:            dec.set,
+		blocks:         make(map[string]*NodeWrapper),
+		exportedMacros: make(map[string]*tagMacroNode),
+		Options:        newOptions(),
+	}
+	dec.refs = append(dec.refs, tpl)
+
+	tpl.name = dec.ReadString()
+	tpl.isTplString = dec.ReadBool()
+	tpl.origin.loader = dec.ReadInt()
+	tpl.origin.lookup.base = dec.ReadString()
+	tpl.origin.lookup.path = dec.ReadString()
+	tpl.size = dec.ReadInt()
+	if tpl.size < 0 {
+		dec.fail(errSerializedCorrupt)
+	}
+	tpl.Options.TrimBlocks = dec.ReadBool()
+	tpl.Options.LStripBlocks = dec.ReadBool()
+	tpl.parallel = dec.ReadBool()
+
+	// The nodes were stored prepared for execution already
+	tpl.prepareOnce.Do(func() {})
+
+	tpl.sources = make([]templateSource, dec.readCount())
+	for i := range tpl.sources {
+		tpl.sources[i].key.loader = dec.ReadInt()
+		tpl.sources[i].key.name = dec.ReadString()
+		tpl.sources[i].hash = dec.ReadString()
+	}
+
+	tpl.parent = dec.readTemplate()
+	root, ok := dec.ReadNode().(*nodeDocument)
+	if !ok {
+		dec.fail(errSerializedCorrupt)
+	}
+	tpl.root = root
+
+	for range dec.readCount() {
+		name := dec.ReadString()
+		tpl.blocks[name] = dec.ReadWrapper()
+	}
+	for range dec.readCount() {
+		name := dec.ReadString()
+		tpl.exportedMacros[name] = dec.readMacro()
+	}
+	return tpl
+}
+
+// readSerialized reads the header and the templates of serialized templates.
+func (dec *NodeDecoder) readSerialized() ([]serializedEntry, error) {
+	if !strings.HasPrefix(string(dec.data), serializedMagic) || len(dec.data) < len(serializedMagic)+serializedChecksumSize {
+		return nil, &Error{Sender: "deserialize", OrigError: errSerializedCorrupt}
+	}
+	end := len(dec.data) - serializedChecksumSize
+	if crc32.Checksum(dec.data[:end], serializedChecksumTable) != binary.LittleEndian.Uint32(dec.data[end:]) {
+		return nil, &Error{Sender: "deserialize", OrigError: errSerializedCorrupt}
+	}
+	dec.data = dec.data[:end]
+	dec.pos = len(serializedMagic)
+
+	formatVersion := dec.readUvarint()
+	version := dec.ReadString()
+	fingerprint := dec.ReadString()
+	if dec.err == nil {
+		var reason string
+		switch {
+		case formatVersion != serializedFormatVersion || version != Version:
+			reason = fmt.Sprintf("serialized by pongo2 %s (format %d)", version, formatVersion)
+		case fingerprint != dec.set.fingerprint():
+			reason = "serialized for a template set with other tags, filters or options"
+		}
+		if reason != "" {
+			return nil, &Error{
+				Sender:    "deserialize",
+				OrigError: errors.New(reason),
+				Kind:      ErrStaleTemplate,
+			}
+		}
+	}
+
+	var entries []serializedEntry
+	for dec.ReadBool() {
+		key := dec.ReadString()
+		entries = append(entries, serializedEntry{key: key, tpl: dec.readTemplate()})
+	}
+	if dec.err == nil && dec.pos != len(dec.data) {
+		dec.fail(errSerializedCorrupt)
+	}
+	if dec.err != nil {
+		if _, ok := dec.err.(*Error); ok {
+			return nil, dec.err
+		}
+		return nil, &Error{Sender: "deserialize", OrigError: dec.err}
+	}
+	return entries, nil
+}
+
+// validate checks that the sources tpl was compiled from didn't change and
+// records the dependencies needed to revalidate it (see
+// RevalidatingTemplateLoader).
+func (dec *NodeDecoder) validate(tpl *Template) error {
+	var dependencies []templateDependency
+	for _, src := range tpl.sources {
+		if dec.sourceHash(src.key) != src.hash {
+			return &Error{
+				Filename:  tpl.name,
+				Sender:    "deserialize",
+				OrigError: fmt.Errorf("template '%s' changed since it was serialized", src.key.name),
+				Kind:      ErrStaleTemplate,
+			}
+		}
+		if dep := dec.dependencies[src.key]; dep != nil {
+			dependencies = append(dependencies, *dep)
+		}
+	}
+	tpl.dependencies = dependencies
+	return nil
+}
+
+// sourceHash returns the hash of the current content of the given source
+// (empty if it can't be read) and records its version if its loader is a
+// RevalidatingTemplateLoader.
+func (dec *NodeDecoder) sourceHash(key templateKey) string {
+	if hash, ok := dec.hashes[key]; ok {
+		return hash
+	}
+	hash := ""
+	if key.loader >= 0 && key.loader < len(dec.set.loaders) {
+		loader := dec.set.loaders[key.loader]
+		if fd, err := loader.Get(key.name); err == nil {
+			buf, err := io.ReadAll(fd)
+			if closer, ok := fd.(io.Closer); ok {
+				closer.Close()
+			}
+			if err == nil {
+				hash = contentVersion(buf)
+			}
+		}
+		if loader, ok := loader.(RevalidatingTemplateLoader); ok && hash != "" {
+			if info, err := loader.Stat(key.name); err == nil {
+				dec.dependencies[key] = &templateDependency{
+					loader:  loader,
+					path:    key.name,
+					version: info.Version,
+				}
+			}
+		}
+	}
+	dec.hashes[key] = hash
+	return hash
+}
+
+// fingerprint identifies the configuration of the set which affects how
+// templates are compiled: its tags, filters and options.
+func (set *TemplateSet) fingerprint() string {
+	set.initOnce.Do(set.initBuiltins)
+
+	var sb strings.Builder
+	for _, name := range slices.Sorted(maps.Keys(set.tags)) {
+		if !set.bannedTags[name] {
+			sb.WriteString(name)
+			sb.WriteByte(0)
+		}
+	}
+	sb.WriteByte(1)
+	for _, name := range slices.Sorted(maps.Keys(set.filters)) {
+		if !set.bannedFilters[name] {
+			sb.WriteString(name)
+			sb.WriteByte(0)
+		}
+	}
+	fmt.Fprintf(&sb, "\x01%t %t", set.Options.TrimBlocks, set.Options.LStripBlocks)
+	return contentVersion([]byte(sb.String()))
+}
+
+// Serialize encodes the compiled template, including the templates it
+// extends, includes or imports, into a versioned binary format. Decode it
+// using FromSerialized, which is much faster than compiling the template.
+//
+// The template's TrimBlocks/LStripBlocks options can't be changed anymore
+// after it was serialized. Templates using tags whose nodes don't implement
+// EncodableNodeTag can't be serialized.
+func (tpl *Template) Serialize() ([]byte, error) {
+	enc, err := tpl.encode()
+	if err != nil {
+		return nil, err
+	}
+	return enc.buf, nil
+}
+
+// encode serializes the template and returns the encoder, which knows the
+// references of the template's nodes.
+func (tpl *Template) encode() (*NodeEncoder, error) {
+	enc := newNodeEncoder(tpl.set)
+	enc.writeHeader()
+	enc.WriteBool(true)
+	enc.WriteString(tpl.name)
+	enc.writeTemplate(tpl)
+	enc.WriteBool(false)
+	if enc.err != nil {
+		return nil, enc.err
+	}
+	enc.writeChecksum()
+	return enc, nil
+}
+
+// FromSerialized decodes a template serialized by Template.Serialize. It
+// returns an error of kind ErrStaleTemplate if the template can't be used
+// anymore:
+//
+//   - a template it was compiled from (itself or the templates it extends,
+//     includes etc.) changed in the set's loaders
+//   - it was serialized by another version of pongo2
+//   - it was serialized for a template set with other tags, filters or
+//     options (TrimBlocks/LStripBlocks); replacing a tag or filter by
+//     another one of the same name isn't detected
+//
+// The sources of the template are read to detect changes, but they aren't
+// compiled. Templates created from strings can't be checked for changes
+// themselves, but the templates they reference can.
+func (set *TemplateSet) FromSerialized(data []byte) (*Template, error) {
+	dec := newNodeDecoder(set, data)
+	entries, err := dec.readSerialized()
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) != 1 {
+		return nil, &Error{Sender: "deserialize", OrigError: errSerializedCorrupt}
+	}
+	tpl := entries[0].tpl
+	if err := dec.validate(tpl); err != nil {
+		return nil, err
+	}
+	return tpl, nil
+}
+
+// SerializeCache writes all templates of the set's cache (see FromCache) to
+// w in the format of Template.Serialize. LoadSerializedCache adds them to
+// the cache of a set again, for example after a restart.
+//
+// The set's cache must implement
+//
+//	Keys() []string
+//
+// (which the built-in caches do). Templates which can't be serialized are
+// skipped and returned in an ErrorList after all other templates have been
+// written.
+func (set *TemplateSet) SerializeCache(w io.Writer) error {
+	cache, _ := set.cache()
+	lister, ok := cache.(interface{ Keys() []string })
+	if !ok {
+		return fmt.Errorf("template cache of type %T can't list its templates", cache)
+	}
+	keys := lister.Keys()
+	slices.Sort(keys)
+
+	enc := newNodeEncoder(set)
+	enc.writeHeader()
+	var errs ErrorList
+	for _, key := range keys {
+		tpl, ok := cache.Get(key)
+		if !ok {
+			continue
+		}
+		mark := enc.mark()
+		enc.WriteBool(true)
+		enc.WriteString(key)
+		enc.writeTemplate(tpl)
+		if enc.err != nil {
+			errs = errs.add(tpl.name, "serialize", enc.err)
+			enc.reset(mark)
+		}
+	}
+	enc.WriteBool(false)
+	enc.writeChecksum()
+
+	if _, err := w.Write(enc.buf); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// LoadSerializedCache reads templates written by SerializeCache from r and
+// adds them to the set's cache. Stale templates (see FromSerialized) are
+// skipped; they're compiled by FromCache when requested. It returns the
+// number of templates added to the cache.
+//
+// An error of kind ErrStaleTemplate is returned if no template can be used
+// because the templates were serialized by another version of pongo2 or for
+// a template set with other tags, filters or options.
+func (set *TemplateSet) LoadSerializedCache(r io.Reader) (int, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	_, generation := set.cache()
+
+	dec := newNodeDecoder(set, data)
+	entries, err := dec.readSerialized()
+	if err != nil {
+		return 0, err
+	}
+	loaded := 0
+	for _, entry := range entries {
+		if dec.validate(entry.tpl) != nil {
+			set.logf("serialized template '%s' is stale", entry.tpl.name)
+			continue
+		}
+		set.addToCache(entry.key, entry.tpl, generation)
+		loaded++
+	}
+	return loaded, nil
+}
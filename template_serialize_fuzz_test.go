@@ -0,0 +1,55 @@
+package pongo2
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+)
+
+// FuzzFromSerialized fuzzes the decoding of serialized templates. Unless
+// keepChecksum is set, the checksum of the mutated data is fixed, so the
+// decoder itself is exercised instead of the checksum check only.
+func FuzzFromSerialized(f *testing.F) {
+	set := NewSet("fuzz serialized", NewMapLoader(map[string]string{
+		"part.html": `{{ n }}`,
+	}))
+	for _, src := range []string{
+		"",
+		"Hello {{ name|upper }}!",
+		`{{ 1 + 2 * 3 ^ 2 - -4 }} {{ a.b.0.c }} {{ a["b"] }} {{ not x or y and z in "xyz" }}`,
+		`{% if a > 1 %}a{% elif b %}b{% else %}c{% endif %}`,
+		`{% for k, v in items reversed sorted %}{{ forloop.Counter }}{{ k }}={{ v }}{% empty %}-{% endfor %}`,
+		`{% set x = 10 %}{% widthratio 5 x 100 %}{% ifequal x 10 %}y{% endifequal %}{% ifnotequal x 1 %}n{% endifnotequal %}`,
+		`{% macro m(a, b=2) %}{{ a }}{{ b }}{% endmacro %}{{ m(1) }}{% filter lower|title %}ABC{% endfilter %}`,
+		`{% include "part.html" with n=2 %}{% with y=x|default:3 %}{{ y }}{% endwith %}{% cycle "a" "b" %}`,
+		`{% autoescape off %}{{ "<b>"|safe }}{% endautoescape %}{% spaceless %} <p> </p> {% endspaceless %}{# c #}`,
+		`{% firstof a b "c" %}{% now "2006" fake %}{% lorem 1 w %}{% templatetag openblock %}{% verbatim %}{{ x }}{% endverbatim %}`,
+	} {
+		tpl, err := set.FromString(src)
+		if err != nil {
+			f.Fatalf("%q: %v", src, err)
+		}
+		data, err := tpl.Serialize()
+		if err != nil {
+			f.Fatalf("%q: %v", src, err)
+		}
+		f.Add(data, false)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, keepChecksum bool) {
+		if !keepChecksum && len(data) >= serializedChecksumSize {
+			end := len(data) - serializedChecksumSize
+			binary.LittleEndian.PutUint32(data[end:], crc32.Checksum(data[:end], serializedChecksumTable))
+		}
+		tpl, err := set.FromSerialized(data)
+		if err != nil {
+			return
+		}
+		// Errors are fine, panics are not.
+		_, _ = tpl.Execute(Context{
+			"name":  "fuzz",
+			"a":     map[string]any{"b": []any{map[string]int{"c": 1}}},
+			"items": map[string]int{"x": 1, "y": 2},
+		})
+	})
+}
@@ -0,0 +1,192 @@
+package pongo2
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+type unencodableNode struct{}
+
+func (node *unencodableNode) Execute(ctx *ExecutionContext, writer TemplateWriter) error {
+	_, err := writer.WriteString("unencodable")
+	return err
+}
+
+func TestSerializeTemplate(t *testing.T) {
+	sources := map[string]string{
+		"base.html":   `<title>{% block title %}Base{% endblock %}</title>{% block content %}{% endblock %}`,
+		"macros.html": `{% macro greet(name="you") export %}Hello {{ name|upper }}!{% endmacro %}`,
+		"page.html": `{% extends "base.html" %}{% import "macros.html" greet %}` +
+			`{% block content %}{{ greet(user) }} {% include "part.html" with n=2 %} {% ssi "raw.txt" %}{% endblock %}`,
+		"part.html": `{% for i in items %}{{ i * n }}{% if not forloop.Last %},{% endif %}{% endfor %}`,
+		"raw.txt":   `{{ raw }}`,
+	}
+	loader := NewMapLoader(sources)
+	set := NewSet("serialize", loader)
+	ctx := Context{"user": "jane", "items": []int{1, 2, 3}}
+
+	tpl, err := set.FromFile("page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := tpl.Execute(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := tpl.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+
+	decoded, err := NewSet("other", loader).FromSerialized(data)
+	if err != nil {
+		t.Fatalf("FromSerialized failed: %v", err)
+	}
+	if got, err := decoded.Execute(ctx); err != nil || got != want {
+		t.Errorf("decoded template = %q, %v; want %q", got, err, want)
+	}
+	if decoded.parent == nil || decoded.parent.name != "base.html" {
+		t.Error("expected the parent template to be decoded")
+	}
+
+	t.Run("stale sources", func(t *testing.T) {
+		for _, name := range []string{"page.html", "base.html", "macros.html", "part.html", "raw.txt"} {
+			changed := NewMapLoader(sources)
+			changed.Set(name, "changed")
+			if _, err := NewSet("changed", changed).FromSerialized(data); !errors.Is(err, ErrStaleTemplate) {
+				t.Errorf("%s changed: expected ErrStaleTemplate, got: %v", name, err)
+			}
+		}
+	})
+
+	t.Run("stale set", func(t *testing.T) {
+		other := NewSet("filters", loader)
+		if err := other.RegisterFilter("shout", filterUpper); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := other.FromSerialized(data); !errors.Is(err, ErrStaleTemplate) {
+			t.Errorf("expected ErrStaleTemplate for other filters, got: %v", err)
+		}
+
+		other = NewSet("options", loader)
+		other.Options.TrimBlocks = true
+		if _, err := other.FromSerialized(data); !errors.Is(err, ErrStaleTemplate) {
+			t.Errorf("expected ErrStaleTemplate for other options, got: %v", err)
+		}
+	})
+
+	t.Run("corrupt data", func(t *testing.T) {
+		for i := range len(data) {
+			if _, err := set.FromSerialized(data[:i]); err == nil {
+				t.Fatalf("expected error for data truncated to %d bytes", i)
+			}
+		}
+	})
+
+	t.Run("unencodable nodes", func(t *testing.T) {
+		custom := NewSet("custom", loader)
+		err := custom.RegisterTag("unencodable", func(doc *Parser, start *Token, arguments *Parser) (INodeTag, error) {
+			return &unencodableNode{}, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tpl, err := custom.FromString("{% unencodable %}")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tpl.Serialize(); err == nil {
+			t.Error("expected error for node not implementing EncodableNodeTag")
+		}
+	})
+}
+
+func TestSerializeCache(t *testing.T) {
+	loader := NewMapLoader(map[string]string{
+		"base.html":  `[{% block content %}{% endblock %}]`,
+		"a.html":     `{% extends "base.html" %}{% block content %}a{% endblock %}`,
+		"b.html":     `{% extends "base.html" %}{% block content %}b{% endblock %}`,
+		"trim.html":  "{% if true %}\n  x\n{% endif %}\n",
+		"other.html": `{% unencodable %}`,
+	})
+	set := NewSet("serialize cache", loader)
+	set.Options.TrimBlocks = true
+	err := set.RegisterTag("unencodable", func(doc *Parser, start *Token, arguments *Parser) (INodeTag, error) {
+		return &unencodableNode{}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.html", "b.html", "trim.html", "other.html"} {
+		if _, err := set.FromCache(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	err = set.SerializeCache(&buf)
+	var list ErrorList
+	if !errors.As(err, &list) || len(list) != 1 || list[0].Filename != "other.html" {
+		t.Fatalf("expected error for other.html, got: %v", err)
+	}
+
+	newSet := func() *TemplateSet {
+		s := NewSet("loaded cache", loader)
+		s.Options.TrimBlocks = true
+		err := s.RegisterTag("unencodable", func(doc *Parser, start *Token, arguments *Parser) (INodeTag, error) {
+			return &unencodableNode{}, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	loaded := newSet()
+	n, err := loaded.LoadSerializedCache(bytes.NewReader(buf.Bytes()))
+	if err != nil || n != 4 {
+		t.Fatalf("LoadSerializedCache = %d, %v; want 4 templates", n, err)
+	}
+	a, _ := loaded.FromCache("a.html")
+	b, _ := loaded.FromCache("b.html")
+	base, _ := loaded.FromCache("base.html")
+	if a.parent != base || b.parent != base {
+		t.Error("expected the parent to be shared by the loaded templates")
+	}
+	for name, want := range map[string]string{"a.html": "[a]", "b.html": "[b]", "trim.html": "  x\n"} {
+		tpl, err := loaded.FromCache(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := tpl.Execute(nil); err != nil || got != want {
+			t.Errorf("%s = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if stats := loaded.CacheStats(); stats.Compilations != 0 {
+		t.Errorf("expected no compilations, got %d", stats.Compilations)
+	}
+
+	t.Run("stale templates are skipped", func(t *testing.T) {
+		loader.Set("b.html", `b changed`)
+		loaded := newSet()
+		n, err := loaded.LoadSerializedCache(bytes.NewReader(buf.Bytes()))
+		if err != nil || n != 3 {
+			t.Fatalf("LoadSerializedCache = %d, %v; want 3 templates", n, err)
+		}
+		tpl, err := loaded.FromCache("b.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := tpl.Execute(nil); got != "b changed" {
+			t.Errorf("expected b.html to be recompiled, got %q", got)
+		}
+	})
+
+	t.Run("stale set", func(t *testing.T) {
+		n, err := NewSet("other set", loader).LoadSerializedCache(bytes.NewReader(buf.Bytes()))
+		if n != 0 || !errors.Is(err, ErrStaleTemplate) {
+			t.Errorf("LoadSerializedCache = %d, %v; want ErrStaleTemplate", n, err)
+		}
+	})
+}
@@ -4,10 +4,19 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
+	"maps"
 	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // TemplateLoader allows to implement a virtual file system.
@@ -17,9 +26,92 @@ type TemplateLoader interface {
 	Abs(base, name string) string
 
 	// Get returns an io.Reader where the template's content can be read from.
+	// If it returns an error, the template set tries the next loader (unless
+	// the error is of kind ErrSandboxViolation).
 	Get(path string) (io.Reader, error)
 }
 
+// ExtendedTemplateLoader is an optional interface a TemplateLoader can
+// implement to provide error-returning path resolution and template metadata.
+// All built-in loaders implement it.
+type ExtendedTemplateLoader interface {
+	TemplateLoader
+
+	// Resolve works like Abs, but reports paths which can't be resolved
+	// (or aren't allowed) by this loader as an error instead of returning
+	// an unusable path. The template set uses Resolve instead of Abs when
+	// looking up templates.
+	//
+	// Unlike for plain TemplateLoaders, the template set only tries the next
+	// loader if Resolve, Get or Stat of an ExtendedTemplateLoader return an
+	// error satisfying errors.Is(err, fs.ErrNotExist); other errors (e.g.
+	// permission or I/O errors) are returned.
+	Resolve(base, name string) (string, error)
+
+	// Stat returns metadata about the template at the given (resolved)
+	// path. If the template doesn't exist, the returned error must satisfy
+	// errors.Is(err, fs.ErrNotExist).
+	Stat(path string) (*TemplateInfo, error)
+}
+
+// ListingTemplateLoader is an optional interface for loaders which can
+// enumerate the templates they provide. It's used by PrecompileAll and
+// implemented by all built-in loaders except HTTPLoader.
+type ListingTemplateLoader interface {
+	TemplateLoader
+
+	// List returns the names of all templates the loader provides, as
+	// accepted by FromFile.
+	List() ([]string, error)
+}
+
+// RevalidatingTemplateLoader is an optional interface for loaders whose
+// templates can change remotely while they're cached (like HTTPLoader).
+// FromCache checks whether cached templates provided by such loaders (or
+// including, extending or importing such templates) changed on every cache
+// hit and recompiles them if they did. Changed should thus be cheap, e.g. by
+// revalidating only from time to time.
+type RevalidatingTemplateLoader interface {
+	ExtendedTemplateLoader
+
+	// Changed reports whether the content of the template at path differs
+	// from the given version (as reported by Stat). If the current version
+	// can't be determined, the template is assumed to be unchanged.
+	Changed(path, version string) bool
+}
+
+// SnapshotTemplateLoader is an optional interface for loaders whose
+// templates can be replaced at once while templates are executed (like
+// ArchiveLoader). When an execution starts, the template set takes a
+// snapshot of such loaders; templates loaded while rendering (like
+// {% include name %} with a name evaluated at runtime) are loaded from the
+// snapshot, so an execution sees a single version of the templates.
+type SnapshotTemplateLoader interface {
+	TemplateLoader
+
+	// Snapshot returns a loader providing the current version of the
+	// templates, which isn't affected by later replacements. It must return
+	// the same (comparable) loader until the templates are replaced.
+	Snapshot() TemplateLoader
+}
+
+// TemplateInfo describes a template provided by an ExtendedTemplateLoader.
+type TemplateInfo struct {
+	// Name is the resolved path of the template within its loader.
+	Name string
+
+	// ModTime is the template's modification time (zero if unknown).
+	ModTime time.Time
+
+	// Size is the template's size in bytes (-1 if unknown).
+	Size int64
+
+	// Version is an opaque version identifier of the template's content
+	// (for example an ETag or a content hash). It's empty if the loader
+	// doesn't support versioning.
+	Version string
+}
+
 // TemplateSet allows you to create your own group of templates with their own
 // global context (which is shared among all members of the set) and their own
 // configuration.
@@ -38,6 +130,17 @@ type TemplateSet struct {
 	// variable during program execution (and template compilation/execution).
 	Debug bool
 
+	// MaxParallel limits the number of goroutines rendering the parts of a
+	// template marked using {% async %} or {% include ... parallel %} at the
+	// same time during an execution. Zero (default) means
+	// runtime.GOMAXPROCS(0); a negative value disables parallel rendering.
+	MaxParallel int
+
+	// FieldNames is the strategy to map attribute names used in templates
+	// to struct fields (see FieldNames). By default, fields are found by
+	// their Go name and their pongo2 struct tag.
+	FieldNames FieldNames
+
 	// autoescape controls whether template output is automatically HTML-escaped.
 	// When true (default), string output will be escaped for safety.
 	autoescape bool
@@ -47,9 +150,10 @@ type TemplateSet struct {
 	Options *Options
 
 	// Per-set tag and filter registries (lazily initialized via initOnce)
-	tags     map[string]*tag
-	filters  map[string]FilterFunction
-	initOnce sync.Once
+	tags        map[string]*tag
+	filters     map[string]ContextFilterFunction
+	pureFilters map[string]bool
+	initOnce    sync.Once
 
 	// Sandbox features
 	// - Disallow access to specific tags and/or filters (using BanTag() and BanFilter())
@@ -61,15 +165,102 @@ type TemplateSet struct {
 	bannedTags           map[string]bool
 	bannedFilters        map[string]bool
 
-	// Template cache (for FromCache())
-	templateCache      map[string]*Template
-	templateCacheMutex sync.Mutex
+	// Template cache (for FromCache()). templateCacheMutex guards the
+	// templateCache field and cacheGeneration, which is incremented whenever
+	// the cache is cleaned. purgedGeneration and cleanedKeys record the
+	// generation in which the whole cache respectively a single template was
+	// cleaned last (compilations started before aren't cached). dependents
+	// maps the names of templates to the cache keys of the templates compiled
+	// from them, which are removed from the cache together with them.
+	templateCache      TemplateCache
+	templateCacheMutex sync.RWMutex
+	cacheGeneration    uint64
+	purgedGeneration   uint64
+	cleanedKeys        map[string]uint64
+	dependents         map[string]map[string]bool
+	cacheStats         cacheStats
+
+	// Templates currently compiled by FromCache (by cache key), to coalesce
+	// concurrent compilations of the same template
+	cacheCalls      map[string]*cacheCall
+	cacheCallsMutex sync.Mutex
 
 	// Track templates currently being parsed to detect recursive includes
-	templatesParsing      map[string]bool
+	templatesParsing      map[templateKey]bool
 	templatesParsingMutex sync.Mutex
 }
 
+// templateKey identifies a template by its resolved name and the index of
+// the loader providing it, as different loaders might use the same names.
+type templateKey struct {
+	loader int
+	name   string
+}
+
+// cacheKey returns the key of the template in the template cache. Templates
+// of the first loader use their name, which is also what FromCache uses.
+func (key templateKey) cacheKey() string {
+	if key.loader == 0 {
+		return key.name
+	}
+	return key.name + "\x00" + strconv.Itoa(key.loader)
+}
+
+// templateLookup records how a template was requested from the loaders: the
+// requested path and the name of the template it is relative to (empty if
+// none). It allows to repeat a lookup in other loaders ({% extends super %}).
+type templateLookup struct {
+	base string
+	path string
+
+	// from is the template which requested the lookup while it's parsed
+	// (nil otherwise). It's used to detect cyclic references (see
+	// parsingCycle).
+	from *Template
+
+	// pinned are the loaders pinned by the execution requesting the lookup
+	// at runtime (see SnapshotTemplateLoader). If it's nil, the set's
+	// loaders are used.
+	pinned []TemplateLoader
+}
+
+// newTemplateLookup creates the lookup for path requested by tpl (may be nil).
+// Paths requested by string templates aren't relative to any template.
+func newTemplateLookup(tpl *Template, path string) templateLookup {
+	var from *Template
+	if tpl != nil && tpl.parsing {
+		from = tpl
+	}
+	if tpl == nil || tpl.isTplString {
+		return templateLookup{path: path, from: from}
+	}
+	return templateLookup{base: tpl.name, path: path, from: from}
+}
+
+// parsingCycle returns the names of the templates forming a cycle if the
+// template identified by key is requested (using lookup) by itself while it's
+// parsed, e.g. "a.html" extending "b.html" extending "a.html". It returns nil
+// if there is no cycle.
+func parsingCycle(key templateKey, lookup templateLookup) []string {
+	var names []string
+	for tpl := lookup.from; tpl != nil; tpl = tpl.origin.lookup.from {
+		names = append(names, tpl.name)
+		if tpl.origin.loader == key.loader && tpl.name == key.name {
+			slices.Reverse(names)
+			return append(names, key.name)
+		}
+	}
+	return nil
+}
+
+// lookupFilename returns the filename used in error messages for lookup.
+func (set *TemplateSet) lookupFilename(lookup templateLookup) string {
+	if lookup.base == "" {
+		return lookup.path
+	}
+	return set.loaders[0].Abs(lookup.base, lookup.path)
+}
+
 // NewSet can be used to create sets with different kind of templates
 // (e. g. web from mail templates), with different globals or
 // other configurations.
@@ -91,8 +282,11 @@ func NewSet(name string, loaders ...TemplateLoader) *TemplateSet {
 		// tags and filters are lazily initialized via initOnce
 		bannedTags:       make(map[string]bool),
 		bannedFilters:    make(map[string]bool),
-		templateCache:    make(map[string]*Template),
-		templatesParsing: make(map[string]bool),
+		templateCache:    newMapTemplateCache(),
+		cleanedKeys:      make(map[string]uint64),
+		dependents:       make(map[string]map[string]bool),
+		cacheCalls:       make(map[string]*cacheCall),
+		templatesParsing: make(map[templateKey]bool),
 		Options:          newOptions(),
 	}
 }
@@ -103,24 +297,24 @@ func (set *TemplateSet) AddLoader(loaders ...TemplateLoader) {
 
 // isTemplateParsing checks if a template is currently being parsed.
 // This is used to detect recursive includes at parse time.
-func (set *TemplateSet) isTemplateParsing(filename string) bool {
+func (set *TemplateSet) isTemplateParsing(key templateKey) bool {
 	set.templatesParsingMutex.Lock()
 	defer set.templatesParsingMutex.Unlock()
-	return set.templatesParsing[filename]
+	return set.templatesParsing[key]
 }
 
 // markTemplateParsing marks a template as currently being parsed.
-func (set *TemplateSet) markTemplateParsing(filename string) {
+func (set *TemplateSet) markTemplateParsing(key templateKey) {
 	set.templatesParsingMutex.Lock()
 	defer set.templatesParsingMutex.Unlock()
-	set.templatesParsing[filename] = true
+	set.templatesParsing[key] = true
 }
 
 // unmarkTemplateParsing removes a template from the parsing set.
-func (set *TemplateSet) unmarkTemplateParsing(filename string) {
+func (set *TemplateSet) unmarkTemplateParsing(key templateKey) {
 	set.templatesParsingMutex.Lock()
 	defer set.templatesParsingMutex.Unlock()
-	delete(set.templatesParsing, filename)
+	delete(set.templatesParsing, key)
 }
 
 // initBuiltins copies the builtin tags and filters into this template set.
@@ -129,6 +323,7 @@ func (set *TemplateSet) unmarkTemplateParsing(filename string) {
 func (set *TemplateSet) initBuiltins() {
 	set.tags = copyTags(builtinTags)
 	set.filters = copyFilters(builtinFilters)
+	set.pureFilters = maps.Clone(builtinPureFilters)
 }
 
 func (set *TemplateSet) resolveFilename(tpl *Template, path string) string {
@@ -187,6 +382,13 @@ func (set *TemplateSet) BanFilter(name string) error {
 
 // RegisterFilter registers a new filter for this template set.
 func (set *TemplateSet) RegisterFilter(name string, fn FilterFunction) error {
+	return set.RegisterContextFilter(name, withoutContext(fn))
+}
+
+// RegisterContextFilter registers a new filter for this template set which
+// depends on the execution context, for example to look up struct fields
+// like templates do (see ExecutionContext.GetItem).
+func (set *TemplateSet) RegisterContextFilter(name string, fn ContextFilterFunction) error {
 	set.initOnce.Do(set.initBuiltins)
 	_, existing := set.filters[name]
 	if existing {
@@ -196,6 +398,19 @@ func (set *TemplateSet) RegisterFilter(name string, fn FilterFunction) error {
 	return nil
 }
 
+// RegisterPureFilter registers a new filter for this template set whose
+// output depends on its input and parameter only: it must not depend on the
+// time, randomness or other state and must not have side effects. Pure
+// filters applied to literals are evaluated once when a template is compiled
+// (e.g. {{ "hello"|upper }}) instead of on every execution.
+func (set *TemplateSet) RegisterPureFilter(name string, fn FilterFunction) error {
+	if err := set.RegisterFilter(name, fn); err != nil {
+		return err
+	}
+	set.pureFilters[name] = true
+	return nil
+}
+
 // RegisterFilter registers a new filter for this template set.
 func (set *TemplateSet) SetAutoescape(v bool) {
 	set.autoescape = v
@@ -203,13 +418,16 @@ func (set *TemplateSet) SetAutoescape(v bool) {
 
 // ReplaceFilter replaces an already registered filter in this template set.
 // Use this function with caution since it allows you to change existing filter behaviour.
+// The replacement isn't pure (see RegisterPureFilter), even if the replaced
+// filter was.
 func (set *TemplateSet) ReplaceFilter(name string, fn FilterFunction) error {
 	set.initOnce.Do(set.initBuiltins)
 	_, existing := set.filters[name]
 	if !existing {
 		return fmt.Errorf("filter with name '%s' does not exist (therefore cannot be overridden)", name)
 	}
-	set.filters[name] = fn
+	set.filters[name] = withoutContext(fn)
+	delete(set.pureFilters, name)
 	return nil
 }
 
@@ -265,12 +483,19 @@ func (set *TemplateSet) TagExists(name string) bool {
 // This is useful for applying set-specific filters, including any custom filters
 // registered with RegisterFilter or replaced with ReplaceFilter.
 func (set *TemplateSet) ApplyFilter(name string, value *Value, param *Value) (*Value, error) {
+	return set.applyFilter(nil, name, value, param)
+}
+
+// applyFilter is ApplyFilter passing ctx to the filter (see
+// ContextFilterFunction).
+func (set *TemplateSet) applyFilter(ctx *ExecutionContext, name string, value *Value, param *Value) (*Value, error) {
 	set.initOnce.Do(set.initBuiltins)
 	fn, existing := set.filters[name]
 	if !existing {
 		return nil, &Error{
 			Sender:    "applyfilter",
 			OrigError: fmt.Errorf("filter with name '%s' not found", name),
+			Kind:      ErrFilterNotFound,
 		}
 	}
 
@@ -279,7 +504,7 @@ func (set *TemplateSet) ApplyFilter(name string, value *Value, param *Value) (*V
 		param = AsValue(nil)
 	}
 
-	return fn(value, param)
+	return fn(ctx, value, param)
 }
 
 // MustApplyFilter behaves like ApplyFilter, but panics on an error.
@@ -292,37 +517,420 @@ func (set *TemplateSet) MustApplyFilter(name string, value *Value, param *Value)
 	return val
 }
 
+// resolvePathForLoader resolves the lookup's path for the given loader using
+// ExtendedTemplateLoader.Resolve if the loader supports it, Abs otherwise.
+func (set *TemplateSet) resolvePathForLoader(loader TemplateLoader, lookup templateLookup) (string, error) {
+	if ext, ok := loader.(ExtendedTemplateLoader); ok {
+		return ext.Resolve(lookup.base, lookup.path)
+	}
+	return loader.Abs(lookup.base, lookup.path), nil
+}
+
 func (set *TemplateSet) resolveTemplate(tpl *Template, path string) (name string, loader TemplateLoader, fd io.Reader, err error) {
+	name, index, fd, err := set.resolveTemplateFrom(newTemplateLookup(tpl, path), 0)
+	if err != nil {
+		return path, nil, nil, err
+	}
+	return name, set.loaders[index], fd, nil
+}
+
+// resolveTemplateFrom looks up a template in the set's loaders, starting at
+// the loader with index start. Each loader resolves the lookup on its own,
+// the first one providing the template wins. It returns the resolved name,
+// the index of the loader and a reader for the template's content.
+//
+// Loaders failing to provide the template are skipped, unless they stop the
+// lookup (see stopsLookup).
+func (set *TemplateSet) resolveTemplateFrom(lookup templateLookup, start int) (name string, index int, fd io.Reader, err error) {
+	notFound := &TemplateNotFoundError{Name: lookup.path}
+	loaders := set.loaders
+	if lookup.pinned != nil {
+		loaders = lookup.pinned
+	}
+
 	// iterate over loaders until we appear to have a valid template
-	for _, loader = range set.loaders {
-		name = set.resolveFilenameForLoader(loader, tpl, path)
-		fd, err = loader.Get(name)
+	for index = start; index < len(loaders); index++ {
+		loader := loaders[index]
+		name, err = set.resolvePathForLoader(loader, lookup)
 		if err == nil {
-			return
+			fd, err = loader.Get(name)
+			if err == nil {
+				return name, index, fd, nil
+			}
+		}
+		if stopsLookup(loader, err) {
+			return "", -1, nil, fmt.Errorf("unable to load template '%s' (%T: '%s'): %w", lookup.path, loader, name, err)
+		}
+		notFound.Attempts = append(notFound.Attempts, LoaderAttempt{
+			Loader: loader,
+			Path:   name,
+			Err:    err,
+		})
+	}
+
+	return "", -1, nil, notFound
+}
+
+// stopsLookup reports whether the error err of loader is returned instead of
+// trying the next loader: sandbox violations, and errors of
+// ExtendedTemplateLoaders except for missing templates (fs.ErrNotExist).
+// Plain TemplateLoaders don't distinguish missing templates, so their other
+// errors are skipped.
+func stopsLookup(loader TemplateLoader, err error) bool {
+	if errors.Is(err, ErrSandboxViolation) {
+		return true
+	}
+	_, extended := loader.(ExtendedTemplateLoader)
+	return extended && !errors.Is(err, fs.ErrNotExist)
+}
+
+// loaderErrorKind returns the kind of an error returned by
+// resolveTemplateFrom: ErrTemplateNotFound if no loader provides the
+// template, ErrSandboxViolation if a loader refused the path, nil otherwise.
+func loaderErrorKind(err error) error {
+	switch {
+	case errors.Is(err, ErrSandboxViolation):
+		return ErrSandboxViolation
+	case errors.Is(err, ErrTemplateNotFound):
+		return ErrTemplateNotFound
+	}
+	return nil
+}
+
+// loadMode controls how loadTemplate uses the template cache.
+type loadMode uint8
+
+const (
+	// loadShared takes the template from the template cache, or compiles it
+	// and adds it to the cache, so templates referenced by other templates
+	// ({% extends %}, {% include %} etc.) are compiled only once and shared
+	// by all of them.
+	loadShared loadMode = iota
+
+	// loadUncached compiles the template without using the cache. The
+	// templates it references are shared (see FromCache).
+	loadUncached
+
+	// loadFresh compiles the template and all templates it references from
+	// their current sources without using the cache (see FromFile).
+	loadFresh
+)
+
+// loadTemplate looks up (see resolveTemplateFrom) and compiles a template,
+// using the template cache as requested by mode. Shared templates compiled
+// concurrently by different templates may be compiled more than once; one
+// of the results is cached.
+func (set *TemplateSet) loadTemplate(lookup templateLookup, start int, mode loadMode) (*Template, error) {
+	tpl, _, err := set.loadTemplateUnlessParsing(lookup, start, mode, false)
+	return tpl, err
+}
+
+// loadTemplateUnlessParsing works like loadTemplate. If skipParsing is true
+// and the template is currently being parsed (which means it includes itself),
+// it isn't compiled again; parsing is true and the returned template nil then.
+func (set *TemplateSet) loadTemplateUnlessParsing(lookup templateLookup, start int, mode loadMode, skipParsing bool) (tpl *Template, parsing bool, err error) {
+	resolvedName, index, fd, err := set.resolveTemplateFrom(lookup, start)
+	if err != nil {
+		return nil, false, &Error{
+			Filename:  set.lookupFilename(lookup),
+			Sender:    "fromfile",
+			OrigError: err,
+			Kind:      loaderErrorKind(err),
+		}
+	}
+
+	key := templateKey{loader: index, name: resolvedName}
+	if set.pinnedOutdated(lookup, index) {
+		// The cache contains the current version of the loader's templates
+		mode = loadUncached
+	}
+	shared := mode == loadShared && !set.Debug
+	cache, generation := set.cache()
+	if shared {
+		if cached, ok := cache.Get(key.cacheKey()); ok && !set.changed(cached) {
+			tpl = cached
+		}
+	}
+	parsing = tpl == nil && skipParsing && set.isTemplateParsing(key)
+	if tpl == nil && !skipParsing {
+		if cycle := parsingCycle(key, lookup); cycle != nil {
+			err = fmt.Errorf("cyclic template reference (%s); use {%% extends super %%} to extend the template of the same name provided by the next loader",
+				strings.Join(cycle, " -> "))
+		}
+	}
+
+	var buf []byte
+	if tpl == nil && !parsing && err == nil {
+		buf, err = io.ReadAll(fd)
+	}
+	if closer, ok := fd.(io.Closer); ok {
+		if closeErr := closer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return nil, false, &Error{
+			Filename:  set.lookupFilename(lookup),
+			Sender:    "fromfile",
+			OrigError: err,
+		}
+	}
+	if tpl != nil || parsing {
+		return tpl, parsing, nil
+	}
+
+	tpl, err = set.compileTemplate(key, templateOrigin{loader: key.loader, lookup: lookup, fresh: mode == loadFresh}, buf)
+	if err != nil {
+		return nil, false, err
+	}
+	if shared {
+		set.addToCache(key.cacheKey(), tpl, generation)
+	}
+	return tpl, false, nil
+}
+
+// pinLoaders returns the set's loaders with the SnapshotTemplateLoaders
+// replaced by their current snapshot, or nil if the set has no such loaders.
+// It's called when an execution starts.
+func (set *TemplateSet) pinLoaders() []TemplateLoader {
+	var pinned []TemplateLoader
+	for i, loader := range set.loaders {
+		if snapshotter, ok := loader.(SnapshotTemplateLoader); ok {
+			if pinned == nil {
+				pinned = slices.Clone(set.loaders)
+			}
+			pinned[i] = snapshotter.Snapshot()
+		}
+	}
+	return pinned
+}
+
+// pinnedOutdated reports whether the loader with the given index was
+// pinned by the execution requesting lookup and its templates were replaced
+// since.
+func (set *TemplateSet) pinnedOutdated(lookup templateLookup, index int) bool {
+	if lookup.pinned == nil {
+		return false
+	}
+	snapshotter, ok := set.loaders[index].(SnapshotTemplateLoader)
+	return ok && snapshotter.Snapshot() != lookup.pinned[index]
+}
+
+// loadPinned loads the template at path requested at runtime by the
+// template executed using ctx, like {% include name %} does. It's loaded
+// from the loaders pinned when the execution started, without using the
+// template cache if they were replaced since.
+func (set *TemplateSet) loadPinned(ctx *ExecutionContext, path string) (*Template, error) {
+	lookup := newTemplateLookup(ctx.template, path)
+	lookup.pinned = ctx.loaders
+	return set.loadTemplate(lookup, 0, loadShared)
+}
+
+// compileTemplate compiles the template identified by key (which was loaded
+// as described by origin) from its source.
+func (set *TemplateSet) compileTemplate(key templateKey, origin templateOrigin, buf []byte) (*Template, error) {
+	// Mark this template as being parsed to detect recursive includes
+	set.markTemplateParsing(key)
+	defer set.unmarkTemplateParsing(key)
+
+	tpl, err := newTemplate(set, key.name, false, origin, buf)
+	if err != nil {
+		return nil, err
+	}
+	tpl.sources = append(tpl.sources, templateSource{key: key, hash: contentVersion(buf)})
+
+	// Remember the version of templates which can change remotely to be
+	// able to revalidate them in FromCache
+	if loader, ok := set.loaders[key.loader].(RevalidatingTemplateLoader); ok {
+		info, err := loader.Stat(key.name)
+		if err == nil {
+			tpl.dependencies = append(tpl.dependencies, templateDependency{
+				loader:  loader,
+				path:    key.name,
+				version: info.Version,
+			})
+		}
+	}
+	return tpl, nil
+}
+
+// fromFile loads the template at path, which is relative to tpl, while tpl
+// is parsed. It's used by tags like {% extends %}. The loaded template is
+// shared through the template cache unless tpl was compiled fresh (see
+// Template.dependencyMode).
+func (set *TemplateSet) fromFile(tpl *Template, path string) (*Template, error) {
+	loaded, err := set.loadTemplate(newTemplateLookup(tpl, path), 0, tpl.dependencyMode())
+	if err != nil {
+		return nil, err
+	}
+	tpl.addDependencies(loaded)
+	return loaded, nil
+}
+
+// changed reports whether tpl or any template it depends on changed
+// remotely since tpl was compiled. Templates not provided by a loader (see
+// FromStringNamed) can't be recompiled and are never reported as changed.
+func (set *TemplateSet) changed(tpl *Template) bool {
+	if tpl.origin.loader < 0 {
+		return false
+	}
+	for _, dep := range tpl.dependencies {
+		if dep.loader.Changed(dep.path, dep.version) {
+			return true
+		}
+	}
+	return false
+}
+
+// Stat returns the metadata of the template with the given filename as
+// reported by the first loader providing it. Loaders which don't implement
+// ExtendedTemplateLoader are skipped. If no loader provides the template, a
+// *TemplateNotFoundError is returned; other errors of a loader are returned
+// as they are.
+func (set *TemplateSet) Stat(filename string) (*TemplateInfo, error) {
+	notFound := &TemplateNotFoundError{Name: filename}
+
+	for _, loader := range set.loaders {
+		ext, ok := loader.(ExtendedTemplateLoader)
+		if !ok {
+			notFound.Attempts = append(notFound.Attempts, LoaderAttempt{
+				Loader: loader,
+				Path:   set.resolveFilenameForLoader(loader, nil, filename),
+				Err:    errors.ErrUnsupported,
+			})
+			continue
+		}
+		name, err := ext.Resolve("", filename)
+		if err == nil {
+			var info *TemplateInfo
+			info, err = ext.Stat(name)
+			if err == nil {
+				return info, nil
+			}
 		}
+		if stopsLookup(loader, err) {
+			return nil, fmt.Errorf("unable to stat template '%s' (%T: '%s'): %w", filename, loader, name, err)
+		}
+		notFound.Attempts = append(notFound.Attempts, LoaderAttempt{
+			Loader: loader,
+			Path:   name,
+			Err:    err,
+		})
 	}
 
-	return path, nil, nil, fmt.Errorf("unable to resolve template")
+	return nil, notFound
+}
+
+// cacheKey returns the key of the template with the given filename in the
+// template cache. Namespaced names are normalized by the NamespaceLoader
+// handling them, so "ns:name" and "@ns/name" share a cache entry.
+func (set *TemplateSet) cacheKey(filename string) string {
+	for _, loader := range set.loaders {
+		if mux, ok := loader.(*NamespaceLoader); ok {
+			if _, _, ok := mux.split(filename); ok {
+				return mux.Abs("", filename)
+			}
+		}
+	}
+	return set.resolveFilename(nil, filename)
 }
 
 // CleanCache cleans the template cache. If filenames is not empty,
-// it will remove the template caches of those filenames.
-// Or it will empty the whole template cache. It is thread-safe.
+// it will remove the template caches of those filenames and of all templates
+// extending, including or importing them.
+// Or it will empty the whole template cache. Compilations of the removed
+// templates which are in progress aren't cached. It is thread-safe.
 func (set *TemplateSet) CleanCache(filenames ...string) {
 	set.templateCacheMutex.Lock()
 	defer set.templateCacheMutex.Unlock()
 
+	set.cacheGeneration++
 	if len(filenames) == 0 {
-		set.templateCache = make(map[string]*Template, len(set.templateCache))
+		set.purge()
+		return
 	}
 
+	keys := make([]string, 0, len(filenames))
 	for _, filename := range filenames {
-		delete(set.templateCache, set.resolveFilename(nil, filename))
+		key := set.cacheKey(filename)
+		set.templateCache.Remove(key)
+		set.cleanedKeys[key] = set.cacheGeneration
+		keys = append(keys, key)
+		for dependent := range set.dependents[key] {
+			set.templateCache.Remove(dependent)
+			keys = append(keys, dependent)
+		}
+		delete(set.dependents, key)
 	}
+	set.forgetCacheCalls(keys...)
+}
+
+// purge drops all templates of the cache and the compilations in flight. It
+// must be called with templateCacheMutex held, after cacheGeneration was
+// incremented.
+func (set *TemplateSet) purge() {
+	set.templateCache.Purge()
+	set.purgedGeneration = set.cacheGeneration
+	clear(set.cleanedKeys)
+	clear(set.dependents)
+	set.forgetCacheCalls()
+}
+
+// forgetCacheCalls makes compilations in flight for the given cache keys (or
+// all of them if no key is given) invisible to subsequent FromCache calls,
+// which start a new compilation then.
+func (set *TemplateSet) forgetCacheCalls(keys ...string) {
+	set.cacheCallsMutex.Lock()
+	defer set.cacheCallsMutex.Unlock()
+	if len(keys) == 0 {
+		clear(set.cacheCalls)
+	}
+	for _, key := range keys {
+		delete(set.cacheCalls, key)
+	}
+}
+
+// SetCache replaces the set's template cache (by default an unbounded
+// in-memory cache), e.g. by an LRUTemplateCache. Templates cached so far
+// are dropped. It is thread-safe.
+func (set *TemplateSet) SetCache(cache TemplateCache) {
+	if cache == nil {
+		cache = newMapTemplateCache()
+	}
+	set.templateCacheMutex.Lock()
+	defer set.templateCacheMutex.Unlock()
+	set.cacheGeneration++
+	set.templateCache = cache
+	set.purge()
+}
+
+// cache returns the set's current template cache and its generation.
+func (set *TemplateSet) cache() (TemplateCache, uint64) {
+	set.templateCacheMutex.RLock()
+	defer set.templateCacheMutex.RUnlock()
+	return set.templateCache, set.cacheGeneration
+}
+
+// CacheStats returns the counters of the set's template cache.
+func (set *TemplateSet) CacheStats() CacheStats {
+	cache, _ := set.cache()
+
+	stats := CacheStats{
+		Hits:         set.cacheStats.hits.Load(),
+		Misses:       set.cacheStats.misses.Load(),
+		Compilations: set.cacheStats.compilations.Load(),
+		CompileTime:  time.Duration(set.cacheStats.compileTime.Load()),
+	}
+	if counter, ok := cache.(interface{ Evictions() uint64 }); ok {
+		stats.Evictions = counter.Evictions()
+	}
+	return stats
 }
 
 // FromCache is a convenient method to cache templates. It is thread-safe
 // and will only compile the template associated with a filename once.
+// Cache hits don't wait for the compilation of other templates; concurrent
+// calls for a template which isn't cached yet wait for a single compilation.
 // If TemplateSet.Debug is true (for example during development phase),
 // FromCache() will not cache the template and instead recompile it on any
 // call (to make changes to a template live instantaneously).
@@ -332,25 +940,182 @@ func (set *TemplateSet) FromCache(filename string) (*Template, error) {
 		return set.FromFile(filename)
 	}
 	// Cache the template
-	cleanedFilename := set.resolveFilename(nil, filename)
+	cleanedFilename := set.cacheKey(filename)
+
+	cache, _ := set.cache()
+	tpl, has := cache.Get(cleanedFilename)
+
+	// Cache miss (or the template changed remotely)
+	if !has || set.changed(tpl) {
+		set.cacheStats.misses.Add(1)
+		return set.compileForCache(filename, cleanedFilename)
+	}
+
+	// Cache hit
+	set.cacheStats.hits.Add(1)
+	return tpl, nil
+}
+
+// cacheCall is a compilation of a template for the cache by compileForCache.
+type cacheCall struct {
+	done chan struct{}
+	tpl  *Template
+	err  error
+}
+
+// compileForCache compiles the template with the given filename and adds it
+// to the cache under key. If the template is already being compiled for the
+// cache, it waits for that compilation and returns its result instead. A
+// panic during the compilation is returned as error (to all waiters).
+func (set *TemplateSet) compileForCache(filename, key string) (tpl *Template, err error) {
+	set.cacheCallsMutex.Lock()
+	if call, ok := set.cacheCalls[key]; ok {
+		set.cacheCallsMutex.Unlock()
+		<-call.done
+		return call.tpl, call.err
+	}
+	call := &cacheCall{done: make(chan struct{})}
+	set.cacheCalls[key] = call
+	set.cacheCallsMutex.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			call.tpl, call.err = nil, fmt.Errorf("compiling template '%s' panicked: %v", filename, r)
+			tpl, err = call.tpl, call.err
+		}
+		set.cacheCallsMutex.Lock()
+		if set.cacheCalls[key] == call {
+			delete(set.cacheCalls, key)
+		}
+		set.cacheCallsMutex.Unlock()
+		close(call.done)
+	}()
+
+	_, generation := set.cache()
+
+	// Load by the given filename (not the cleaned one), which is
+	// specific to the first loader.
+	start := time.Now()
+	call.tpl, call.err = set.loadTemplate(newTemplateLookup(nil, filename), 0, loadUncached)
+	if call.err != nil {
+		return nil, call.err
+	}
+	set.cacheStats.compiled(start)
+
+	set.addToCache(key, call.tpl, generation)
+	return call.tpl, nil
+}
 
+// addToCache adds tpl to the cache unless the cache (or the template under
+// key) was cleaned since the given generation (then tpl might have been
+// compiled from outdated sources).
+func (set *TemplateSet) addToCache(key string, tpl *Template, generation uint64) {
 	set.templateCacheMutex.Lock()
 	defer set.templateCacheMutex.Unlock()
+	if set.purgedGeneration > generation || set.cleanedKeys[key] > generation {
+		return
+	}
+	for _, src := range tpl.sources {
+		if set.cleanedKeys[src.key.name] > generation {
+			return
+		}
+	}
+	set.templateCache.Add(key, tpl)
+	set.addDependents(key, tpl)
+}
 
-	tpl, has := set.templateCache[cleanedFilename]
+// addDependents records that the template cached under key was compiled from
+// its sources. It must be called with templateCacheMutex held.
+func (set *TemplateSet) addDependents(key string, tpl *Template) {
+	for _, src := range tpl.sources {
+		if set.dependents[src.key.name] == nil {
+			set.dependents[src.key.name] = make(map[string]bool)
+		}
+		set.dependents[src.key.name][key] = true
+	}
+}
 
-	// Cache miss
-	if !has {
-		tpl, err := set.FromFile(cleanedFilename)
+// PrecompileAll compiles all templates provided by the set's loaders which
+// implement ListingTemplateLoader (other loaders are skipped) and adds them to
+// the template cache (unless Debug is true, in which case they're only
+// compiled). It's meant to warm the cache at startup and to find broken
+// templates before they're rendered.
+//
+// If patterns are given, only templates whose names match at least one of
+// them (see path.Match, e.g. "emails/*.html") are compiled. Templates are
+// compiled in parallel. All problems are reported together in an ErrorList.
+func (set *TemplateSet) PrecompileAll(patterns ...string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+	}
+
+	var (
+		errs  ErrorList
+		names []string
+		seen  = make(map[string]bool)
+	)
+	for _, loader := range set.loaders {
+		lister, ok := loader.(ListingTemplateLoader)
+		if !ok {
+			continue
+		}
+		list, err := lister.List()
 		if err != nil {
-			return nil, err
+			errs = errs.add(fmt.Sprintf("%T", loader), "precompile", err)
+			continue
+		}
+		for _, name := range list {
+			if seen[name] || !matchesAny(filepath.ToSlash(name), patterns) {
+				continue
+			}
+			seen[name] = true
+			names = append(names, name)
 		}
-		set.templateCache[cleanedFilename] = tpl
-		return tpl, nil
 	}
 
-	// Cache hit
-	return tpl, nil
+	results := make([]error, len(names))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for range min(runtime.GOMAXPROCS(0), len(names)) {
+		wg.Go(func() {
+			for i := range work {
+				if set.Debug {
+					_, results[i] = set.FromFile(names[i])
+				} else {
+					_, results[i] = set.compileForCache(names[i], set.cacheKey(names[i]))
+				}
+			}
+		})
+	}
+	for i := range names {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	for i, err := range results {
+		errs = errs.add(names[i], "precompile", err)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// matchesAny reports whether name matches any of the patterns (see
+// path.Match). Every name matches if there are no patterns.
+func matchesAny(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
 }
 
 // FromString loads a template from string and returns a Template instance.
@@ -363,35 +1128,46 @@ func (set *TemplateSet) FromBytes(tpl []byte) (*Template, error) {
 	return newTemplateString(set, tpl)
 }
 
-// FromFile loads a template from a filename and returns a Template instance.
-func (set *TemplateSet) FromFile(filename string) (*Template, error) {
-	resolvedName, _, fd, err := set.resolveTemplate(nil, filename)
+// FromStringNamed loads a template from string, but gives it a name as if it
+// had been loaded from a file (for example by FromFile) by the set's first
+// loader. The name is used in error messages, relative paths used in
+// {% include %}, {% extends %} etc. are resolved relative to it, and the
+// compiled template is added to the template cache, so FromCache(name)
+// returns it. It stays there until it's replaced by another call to
+// FromStringNamed or removed by CleanCache(name) or by a bounded cache (see
+// LRUTemplateCache) evicting it; FromCache can't recompile it then and loads
+// name from the set's loaders instead. In debug mode, the template isn't
+// cached. This is useful for templates stored in a database or defined in
+// tests.
+func (set *TemplateSet) FromStringNamed(name, tpl string) (*Template, error) {
+	resolvedName := set.cacheKey(name)
+
+	// Mark this template as being parsed to detect recursive includes
+	key := templateKey{loader: -1, name: resolvedName}
+	set.markTemplateParsing(key)
+	defer set.unmarkTemplateParsing(key)
+
+	t, err := newTemplate(set, resolvedName, false, templateOrigin{loader: -1, lookup: templateLookup{path: name}}, []byte(tpl))
 	if err != nil {
-		return nil, &Error{
-			Filename:  filename,
-			Sender:    "fromfile",
-			OrigError: err,
-		}
+		return nil, err
 	}
-	buf, err := io.ReadAll(fd)
-	if closer, ok := fd.(io.Closer); ok {
-		if closeErr := closer.Close(); closeErr != nil && err == nil {
-			err = closeErr
-		}
-	}
-	if err != nil {
-		return nil, &Error{
-			Filename:  filename,
-			Sender:    "fromfile",
-			OrigError: err,
-		}
+	if set.Debug {
+		return t, nil
 	}
 
-	// Mark this template as being parsed to detect recursive includes
-	set.markTemplateParsing(resolvedName)
-	defer set.unmarkTemplateParsing(resolvedName)
+	set.templateCacheMutex.Lock()
+	defer set.templateCacheMutex.Unlock()
+	set.templateCache.Add(resolvedName, t)
+	set.addDependents(resolvedName, t)
+
+	return t, nil
+}
 
-	return newTemplate(set, resolvedName, false, buf)
+// FromFile loads a template from a filename and returns a Template instance.
+// The template and all templates it extends, includes or imports are
+// compiled from their current sources; the template cache isn't used.
+func (set *TemplateSet) FromFile(filename string) (*Template, error) {
+	return set.loadTemplate(newTemplateLookup(nil, filename), 0, loadFresh)
 }
 
 // RenderTemplateString is a shortcut and renders a template string directly.
@@ -456,6 +1232,11 @@ var (
 	// This is a convenience function that delegates to DefaultSet.FromBytes.
 	FromBytes = DefaultSet.FromBytes
 
+	// FromStringNamed loads a template from string, using the given name as
+	// its filename. This is a convenience function that delegates to
+	// DefaultSet.FromStringNamed.
+	FromStringNamed = DefaultSet.FromStringNamed
+
 	// FromFile loads a template from a filename and returns a Template instance.
 	// This is a convenience function that delegates to DefaultSet.FromFile.
 	FromFile = DefaultSet.FromFile
@@ -477,6 +1258,15 @@ var (
 	// Returns an error if a filter with the same name already exists.
 	RegisterFilter = DefaultSet.RegisterFilter
 
+	// RegisterPureFilter registers a new pure filter for the DefaultSet.
+	// Returns an error if a filter with the same name already exists.
+	RegisterPureFilter = DefaultSet.RegisterPureFilter
+
+	// RegisterContextFilter registers a new filter depending on the
+	// execution context for the DefaultSet.
+	// Returns an error if a filter with the same name already exists.
+	RegisterContextFilter = DefaultSet.RegisterContextFilter
+
 	// ReplaceFilter replaces an existing filter in the DefaultSet.
 	// Use with caution since it changes existing filter behaviour.
 	ReplaceFilter = DefaultSet.ReplaceFilter
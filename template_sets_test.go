@@ -1,10 +1,12 @@
 package pongo2
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"testing/fstest"
 )
 
 func TestTemplateSetAddLoader(t *testing.T) {
@@ -42,7 +44,7 @@ func TestTemplateSetCleanCache(t *testing.T) {
 	}
 
 	set.templateCacheMutex.Lock()
-	initialCacheSize := len(set.templateCache)
+	initialCacheSize := set.templateCache.Len()
 	set.templateCacheMutex.Unlock()
 
 	if initialCacheSize != 2 {
@@ -51,7 +53,7 @@ func TestTemplateSetCleanCache(t *testing.T) {
 
 	set.CleanCache("file1.tpl")
 	set.templateCacheMutex.Lock()
-	cacheAfterClean := len(set.templateCache)
+	cacheAfterClean := set.templateCache.Len()
 	set.templateCacheMutex.Unlock()
 
 	if cacheAfterClean != 1 {
@@ -60,7 +62,7 @@ func TestTemplateSetCleanCache(t *testing.T) {
 
 	set.CleanCache()
 	set.templateCacheMutex.Lock()
-	if len(set.templateCache) != 0 {
+	if set.templateCache.Len() != 0 {
 		t.Error("CleanCache() did not clear all cache")
 	}
 	set.templateCacheMutex.Unlock()
@@ -240,3 +242,151 @@ func TestOptions(t *testing.T) {
 		t.Errorf("TrimBlocks should remove leading newline, got %q", result)
 	}
 }
+
+func TestTemplateSetFromStringNamed(t *testing.T) {
+	loader := NewMapLoader(map[string]string{
+		"emails/footer.html": "Regards",
+	})
+	set := NewSet("named", loader)
+
+	tpl, err := set.FromStringNamed("emails/welcome.html", `Hello {{ name }}. {% include "footer.html" %}`)
+	if err != nil {
+		t.Fatalf("FromStringNamed failed: %v", err)
+	}
+	out, err := tpl.Execute(Context{"name": "Jane"})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if out != "Hello Jane. Regards" {
+		t.Errorf("got %q, want %q", out, "Hello Jane. Regards")
+	}
+
+	t.Run("cache participation", func(t *testing.T) {
+		cached, err := set.FromCache("emails/welcome.html")
+		if err != nil {
+			t.Fatalf("FromCache failed: %v", err)
+		}
+		if cached != tpl {
+			t.Error("FromCache should return the template compiled by FromStringNamed")
+		}
+
+		replaced, err := set.FromStringNamed("emails/welcome.html", "Bye")
+		if err != nil {
+			t.Fatalf("FromStringNamed failed: %v", err)
+		}
+		if cached, _ := set.FromCache("emails/welcome.html"); cached != replaced {
+			t.Error("FromStringNamed should replace the cached template")
+		}
+
+		set.CleanCache("emails/welcome.html")
+		if _, err := set.FromCache("emails/welcome.html"); !errors.Is(err, ErrTemplateNotFound) {
+			t.Errorf("expected ErrTemplateNotFound after CleanCache, got: %v", err)
+		}
+	})
+
+	t.Run("evicted", func(t *testing.T) {
+		lruSet := NewSet("named lru", NewMapLoader(map[string]string{
+			"emails/welcome.html": "From loader",
+			"other.html":          "Other",
+		}))
+		lruSet.SetCache(NewLRUTemplateCache(LRUCacheOptions{MaxEntries: 1}))
+		if _, err := lruSet.FromStringNamed("emails/welcome.html", "Named"); err != nil {
+			t.Fatalf("FromStringNamed failed: %v", err)
+		}
+		if _, err := lruSet.FromCache("other.html"); err != nil {
+			t.Fatalf("FromCache failed: %v", err)
+		}
+		cached, err := lruSet.FromCache("emails/welcome.html")
+		if err != nil {
+			t.Fatalf("FromCache failed: %v", err)
+		}
+		if out, _ := cached.Execute(nil); out != "From loader" {
+			t.Errorf("got %q from the evicted template, want it loaded from the loader", out)
+		}
+	})
+
+	t.Run("errors use the name", func(t *testing.T) {
+		_, err := set.FromStringNamed("emails/broken.html", "{{ (1 }}")
+		var e *Error
+		if !errors.As(err, &e) || e.Filename != "emails/broken.html" {
+			t.Errorf("expected error for emails/broken.html, got: %v", err)
+		}
+	})
+
+	t.Run("debug", func(t *testing.T) {
+		debugSet := NewSet("named debug", loader)
+		debugSet.Debug = true
+		if _, err := debugSet.FromStringNamed("emails/debug.html", "debug"); err != nil {
+			t.Fatalf("FromStringNamed failed: %v", err)
+		}
+		if _, ok := debugSet.templateCache.Get(debugSet.cacheKey("emails/debug.html")); ok {
+			t.Error("expected the template not to be cached in debug mode")
+		}
+	})
+}
+
+func TestTemplateSetPrecompileAll(t *testing.T) {
+	mapLoader := NewMapLoader(map[string]string{
+		"emails/welcome.html": "Welcome {{ name }}",
+		"emails/broken.html":  "{% if %}",
+		"pages/home.html":     `{% include "../emails/welcome.html" %}`,
+	})
+	fsLoader := NewFSLoader(fstest.MapFS{
+		"pages/about.html":  {Data: []byte("About")},
+		"pages/broken.html": {Data: []byte("{{ (1 }}")},
+	})
+
+	t.Run("all", func(t *testing.T) {
+		set := NewSet("precompile", mapLoader, fsLoader, &legacyLoader{})
+		err := set.PrecompileAll()
+		var list ErrorList
+		if !errors.As(err, &list) || len(list) != 2 {
+			t.Fatalf("expected ErrorList with 2 errors, got: %v", err)
+		}
+		if list[0].Filename != "emails/broken.html" || list[1].Filename != "pages/broken.html" {
+			t.Errorf("unexpected errors: %v", list)
+		}
+
+		home, err := set.FromFile("pages/home.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cached, err := set.FromCache("pages/home.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cached == home || cached.name != "pages/home.html" {
+			t.Error("expected pages/home.html in cache")
+		}
+		set.templateCacheMutex.Lock()
+		n := set.templateCache.Len()
+		set.templateCacheMutex.Unlock()
+		if n != 3 {
+			t.Errorf("expected 3 cached templates, got %d", n)
+		}
+	})
+
+	t.Run("patterns", func(t *testing.T) {
+		set := NewSet("precompile patterns", mapLoader, fsLoader)
+		if err := set.PrecompileAll("pages/h*.html", "*/about.html"); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		// pages/home.html, emails/welcome.html (included by it) and pages/about.html
+		if set.templateCache.Len() != 3 {
+			t.Errorf("expected 3 cached templates, got %d", set.templateCache.Len())
+		}
+		if err := set.PrecompileAll("[broken"); err == nil {
+			t.Error("expected error for invalid pattern")
+		}
+	})
+
+	t.Run("listing errors", func(t *testing.T) {
+		loader, err := NewLocalFileSystemLoader("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := NewSet("precompile local", loader).PrecompileAll(); err == nil {
+			t.Error("expected error for LocalFilesystemLoader without base directory")
+		}
+	})
+}
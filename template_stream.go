@@ -0,0 +1,137 @@
+package pongo2
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// StreamOptions configure Template.ExecuteStream.
+type StreamOptions struct {
+	// FlushBlocks flushes the output at the end of each block
+	// ({% endblock %}) in addition to the {% flush %} tags.
+	FlushBlocks bool
+
+	// MaxBuffer is the number of bytes after which buffered output is
+	// written (but not flushed) without reaching a flush point. Zero
+	// means output is buffered until the next flush point.
+	MaxBuffer int
+
+	// OnError is called if the execution fails after output was written.
+	// It can write to w to end the output gracefully (e.g. close open
+	// elements and show an error message). The output buffered since the
+	// last flush point is discarded before.
+	OnError func(w io.Writer, err error)
+}
+
+// StreamError is returned by Template.ExecuteStream if the execution failed
+// after output was written. The output can't be taken back anymore, so
+// (for HTTP responses) it's too late to send an error status.
+type StreamError struct {
+	// Err is the error the execution failed with.
+	Err error
+
+	// Written is the number of bytes written to the writer.
+	Written int64
+}
+
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("[streaming failed after %d bytes written] %v", e.Written, e.Err)
+}
+
+func (e *StreamError) Unwrap() error {
+	return e.Err
+}
+
+// flushWriter is implemented by TemplateWriters which can flush their
+// output (see {% flush %}).
+type flushWriter interface {
+	TemplateWriter
+
+	// flush writes the buffered output to the underlying writer and
+	// flushes it. block reports whether the flush point is the end of a
+	// block.
+	flush(block bool) error
+}
+
+// streamWriter buffers the output of Template.ExecuteStream between flush
+// points.
+type streamWriter struct {
+	w       io.Writer
+	opts    *StreamOptions
+	buf     bytes.Buffer
+	written int64
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	n, _ := sw.buf.Write(p)
+	return n, sw.writeIfFull()
+}
+
+func (sw *streamWriter) WriteString(s string) (int, error) {
+	n, _ := sw.buf.WriteString(s)
+	return n, sw.writeIfFull()
+}
+
+func (sw *streamWriter) writeIfFull() error {
+	if sw.opts.MaxBuffer > 0 && sw.buf.Len() >= sw.opts.MaxBuffer {
+		return sw.write()
+	}
+	return nil
+}
+
+// write writes the buffered output to the underlying writer.
+func (sw *streamWriter) write() error {
+	n, err := sw.buf.WriteTo(sw.w)
+	sw.written += n
+	return err
+}
+
+func (sw *streamWriter) flush(block bool) error {
+	if block && !sw.opts.FlushBlocks {
+		return nil
+	}
+	if err := sw.write(); err != nil {
+		return err
+	}
+	switch w := sw.w.(type) {
+	case interface{ Flush() error }: // e.g. bufio.Writer, gzip.Writer
+		return w.Flush()
+	case http.Flusher:
+		w.Flush()
+	}
+	return nil
+}
+
+// ExecuteStream executes the template and streams the output to writer: the
+// output is buffered until a flush point ({% flush %} tags and, if enabled in
+// opts, the end of blocks) is reached, then it's written and flushed (using
+// http.Flusher or a Flush() error method of writer). A browser can fetch the
+// assets referenced in the <head> while the rest of the page is rendered.
+// opts may be nil.
+//
+// If the execution fails before output was written, the error is returned
+// and nothing is written, like ExecuteWriter. Otherwise, the output buffered
+// since the last flush point is discarded, opts.OnError is called (if set)
+// and a *StreamError wrapping the error is returned.
+//
+// {% flush %} tags within tags capturing their content (e.g. filter or
+// spaceless) don't flush; they are no-ops when using the other Execute
+// methods.
+func (tpl *Template) ExecuteStream(context Context, writer io.Writer, opts *StreamOptions) error {
+	if opts == nil {
+		opts = &StreamOptions{}
+	}
+	sw := &streamWriter{w: writer, opts: opts}
+	if err := tpl.execute(context, sw); err != nil {
+		if sw.written == 0 {
+			return err
+		}
+		if opts.OnError != nil {
+			opts.OnError(writer, err)
+		}
+		return &StreamError{Err: err, Written: sw.written}
+	}
+	return sw.flush(false)
+}
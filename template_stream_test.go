@@ -0,0 +1,127 @@
+package pongo2
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// recordingWriter records the output written at each flush.
+type recordingWriter struct {
+	strings.Builder
+	flushes []string
+}
+
+func (w *recordingWriter) Flush() {
+	w.flushes = append(w.flushes, w.String())
+}
+
+func TestExecuteStream(t *testing.T) {
+	set := NewSet("stream", NewMapLoader(map[string]string{
+		"base.html":   "<head></head>{% flush %}{% block body %}{% endblock %}|{% include 'inc.html' %}",
+		"page.html":   "{% extends 'base.html' %}{% block body %}{{ body }}{% endblock %}",
+		"inc.html":    "inc{% flush %}end",
+		"filter.html": "{% filter upper %}a{% flush %}b{% endfilter %}",
+	}))
+	page, err := set.FromFile("page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("flush points", func(t *testing.T) {
+		w := &recordingWriter{}
+		if err := page.ExecuteStream(Context{"body": "body"}, w, nil); err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"<head></head>", "<head></head>body|inc", "<head></head>body|incend"}
+		if w.String() != want[2] || fmt.Sprint(w.flushes) != fmt.Sprint(want) {
+			t.Errorf("output %q with flushes %q; want flushes %q", w.String(), w.flushes, want)
+		}
+	})
+
+	t.Run("flush blocks", func(t *testing.T) {
+		w := &recordingWriter{}
+		if err := page.ExecuteStream(Context{"body": "body"}, w, &StreamOptions{FlushBlocks: true}); err != nil {
+			t.Fatal(err)
+		}
+		if len(w.flushes) != 4 || w.flushes[1] != "<head></head>body" {
+			t.Errorf("unexpected flushes %q", w.flushes)
+		}
+	})
+
+	t.Run("http", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		if err := page.ExecuteStream(Context{"body": "body"}, rec, nil); err != nil {
+			t.Fatal(err)
+		}
+		if !rec.Flushed || rec.Body.String() != "<head></head>body|incend" {
+			t.Errorf("flushed = %t, body = %q", rec.Flushed, rec.Body.String())
+		}
+	})
+
+	t.Run("captured", func(t *testing.T) {
+		tpl, err := set.FromFile("filter.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := &recordingWriter{}
+		if err := tpl.ExecuteStream(nil, w, nil); err != nil {
+			t.Fatal(err)
+		}
+		if w.String() != "AB" || len(w.flushes) != 1 {
+			t.Errorf("output %q with flushes %q", w.String(), w.flushes)
+		}
+		if out, err := tpl.Execute(nil); err != nil || out != "AB" {
+			t.Errorf("Execute = %q, %v", out, err)
+		}
+	})
+
+	t.Run("max buffer", func(t *testing.T) {
+		tpl, err := set.FromString("{% for i in items %}{{ i }}{% endfor %}")
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := &recordingWriter{}
+		err = tpl.ExecuteStream(Context{"items": []int{1, 2, 3, 4}}, w, &StreamOptions{MaxBuffer: 2})
+		if err != nil || w.String() != "1234" || len(w.flushes) != 1 {
+			t.Errorf("output %q with flushes %q, %v", w.String(), w.flushes, err)
+		}
+	})
+
+	t.Run("error before output", func(t *testing.T) {
+		tpl, err := set.FromString("a{{ fail() }}{% flush %}")
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := &recordingWriter{}
+		err = tpl.ExecuteStream(Context{"fail": func() (string, error) { return "", errors.New("failed") }}, w,
+			&StreamOptions{OnError: func(w io.Writer, err error) { t.Error("unexpected call of OnError") }})
+		var streamErr *StreamError
+		if err == nil || errors.As(err, &streamErr) || w.String() != "" {
+			t.Errorf("expected plain error and no output, got %q, %v", w.String(), err)
+		}
+	})
+
+	t.Run("error after flush", func(t *testing.T) {
+		w := &recordingWriter{}
+		var handled error
+		err := page.ExecuteStream(Context{"body": func() (string, error) { return "", errors.New("failed") }}, w,
+			&StreamOptions{OnError: func(w io.Writer, err error) {
+				handled = err
+				_, _ = io.WriteString(w, "<p>error</p>")
+			}})
+		var streamErr *StreamError
+		if !errors.As(err, &streamErr) || streamErr.Written != int64(len("<head></head>")) {
+			t.Fatalf("expected StreamError, got %v", err)
+		}
+		if handled == nil || !strings.Contains(err.Error(), "failed") {
+			t.Errorf("expected OnError to be called with the error, got %v", handled)
+		}
+		if w.String() != "<head></head><p>error</p>" {
+			t.Errorf("output = %q", w.String())
+		}
+	})
+}
@@ -3,6 +3,7 @@ package pongo2
 import (
 	"bytes"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -72,3 +73,159 @@ func TestTokenString(t *testing.T) {
 		t.Errorf("Token.String() should contain value, got %q", str)
 	}
 }
+
+func TestSharedTemplates(t *testing.T) {
+	loader := NewMapLoader(map[string]string{
+		"base.html":    `<{% block title %}Base{% endblock %}|{% block content %}{% endblock %}|{% include "footer.html" %}>`,
+		"footer.html":  "Footer",
+		"a.html":       `{% extends "base.html" %}{% block title %}A {{ block.Super }}{% endblock %}{% block content %}{% include "footer.html" %}{% endblock %}`,
+		"b.html":       `{% extends "base.html" %}{% block content %}B{% endblock %}`,
+		"nested.html":  `{% extends "a.html" %}{% block content %}Nested{% endblock %}`,
+		"dynamic.html": `{% include name %}`,
+	})
+
+	set := NewSet("shared", loader)
+	a, err := set.FromCache("a.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := set.FromCache("b.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nested, err := set.FromCache("nested.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := set.FromCache("base.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.parent != base || b.parent != base || nested.parent != a {
+		t.Error("parents should be compiled once and shared")
+	}
+	if _, ok := set.templateCache.Get("footer.html"); !ok {
+		t.Error("included templates should be added to the cache")
+	}
+
+	// Execute concurrently to make sure blocks are resolved per execution
+	expected := map[*Template]string{
+		a:      "<A Base|Footer|Footer>",
+		b:      "<Base|B|Footer>",
+		nested: "<A Base|Nested|Footer>",
+		base:   "<Base||Footer>",
+	}
+	var wg sync.WaitGroup
+	for range 10 {
+		for tpl, want := range expected {
+			wg.Go(func() {
+				out, err := tpl.Execute(nil)
+				if err != nil {
+					t.Errorf("%s: Execute failed: %v", tpl.name, err)
+				} else if out != want {
+					t.Errorf("%s: got %q, want %q", tpl.name, out, want)
+				}
+			})
+		}
+	}
+	wg.Wait()
+
+	// Templates included at runtime are shared as well
+	dynamic, err := set.FromCache("dynamic.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := dynamic.Execute(Context{"name": "b.html"}); err != nil || out != "<Base|B|Footer>" {
+		t.Errorf("got %q (%v), want %q", out, err, "<Base|B|Footer>")
+	}
+	if cached, _ := set.templateCache.Get("b.html"); cached != b {
+		t.Error("runtime include should use the cached template")
+	}
+
+	t.Run("fresh", func(t *testing.T) {
+		loader.Set("footer.html", "Changed")
+		defer loader.Set("footer.html", "Footer")
+
+		// FromCache reuses the compiled templates until the cache is cleaned
+		set.CleanCache("b.html")
+		tpl, err := set.FromCache("b.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out, _ := tpl.Execute(nil); out != "<Base|B|Footer>" {
+			t.Errorf("got %q, want %q", out, "<Base|B|Footer>")
+		}
+
+		// FromFile compiles the whole chain from the current sources
+		tpl, err = set.FromFile("b.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out, _ := tpl.Execute(nil); out != "<Base|B|Changed>" {
+			t.Errorf("got %q, want %q", out, "<Base|B|Changed>")
+		}
+		if tpl.parent == base {
+			t.Error("FromFile should not use the cached parent")
+		}
+		if cached, _ := set.templateCache.Get("base.html"); cached != base {
+			t.Error("FromFile should not change the cache")
+		}
+
+		// Parents changed after the child was compiled
+		loader.Set("base.html", `<{% block content %}{% endblock %}>`)
+		defer loader.Set("base.html", `<{% block title %}Base{% endblock %}|{% block content %}{% endblock %}|{% include "footer.html" %}>`)
+		tpl, err = set.FromFile("b.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out, _ := tpl.Execute(nil); out != "<B>" {
+			t.Errorf("got %q, want %q", out, "<B>")
+		}
+	})
+
+	t.Run("clean dependents", func(t *testing.T) {
+		defer set.CleanCache()
+		for _, name := range []string{"a.html", "b.html", "nested.html"} {
+			if _, err := set.FromCache(name); err != nil {
+				t.Fatal(err)
+			}
+		}
+		loader.Set("footer.html", "Changed")
+		defer loader.Set("footer.html", "Footer")
+
+		// Cleaning a template removes the templates compiled from it
+		set.CleanCache("footer.html")
+		for _, name := range []string{"a.html", "b.html", "nested.html", "base.html", "footer.html"} {
+			if _, ok := set.templateCache.Get(name); ok {
+				t.Errorf("%s should have been removed from the cache", name)
+			}
+		}
+		if _, ok := set.templateCache.Get("dynamic.html"); !ok {
+			t.Error("dynamic.html doesn't depend on footer.html and should stay cached")
+		}
+		tpl, err := set.FromCache("nested.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out, _ := tpl.Execute(nil); out != "<A Base|Nested|Changed>" {
+			t.Errorf("got %q, want %q", out, "<A Base|Nested|Changed>")
+		}
+	})
+
+	t.Run("debug", func(t *testing.T) {
+		debugSet := NewSet("shared debug", loader)
+		debugSet.Debug = true
+		a, err := debugSet.FromFile("a.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := debugSet.FromFile("b.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.parent == b.parent {
+			t.Error("templates should be recompiled in debug mode")
+		}
+	})
+}
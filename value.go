@@ -8,13 +8,45 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
+// Value wraps a value used in templates. The common scalar types int,
+// int64, float64, string, bool and time.Time are stored without reflection;
+// all other values are accessed using reflect.
 type Value struct {
-	val  reflect.Value
+	kind valueKind
 	safe bool // used to indicate whether a Value needs explicit escaping in the template
+
+	n    uint64 // int, int64, float64 (bits) and bool values
+	s    string // string values
+	orig any    // time.Time values, which can't be stored in n or s
+
+	val reflect.Value // all other values (kind valueReflect)
 }
 
+// valueKind is the type of the value stored in a Value.
+type valueKind uint8
+
+const (
+	valueReflect valueKind = iota // val (invalid for nil)
+	valueInt
+	valueInt64
+	valueFloat
+	valueString
+	valueBool
+	valueTime // orig
+)
+
+var (
+	typeOfInt     = reflect.TypeFor[int]()
+	typeOfInt64   = reflect.TypeFor[int64]()
+	typeOfFloat64 = reflect.TypeFor[float64]()
+	typeOfString  = reflect.TypeFor[string]()
+	typeOfBool    = reflect.TypeFor[bool]()
+	typeOfTime    = reflect.TypeFor[time.Time]()
+)
+
 // AsValue converts any given value to a pongo2.Value
 // Usually being used within own functions passed to a template
 // through a Context or within filter functions.
@@ -23,21 +55,124 @@ type Value struct {
 //
 //	AsValue("my string")
 func AsValue(i any) *Value {
-	return &Value{
-		val: reflect.ValueOf(i),
-	}
+	v := &Value{}
+	v.set(i)
+	return v
 }
 
 // AsSafeValue works like AsValue, but does not apply the 'escape' filter.
 func AsSafeValue(i any) *Value {
-	return &Value{
-		val:  reflect.ValueOf(i),
-		safe: true,
+	v := &Value{safe: true}
+	v.set(i)
+	return v
+}
+
+func (v *Value) set(i any) {
+	switch x := i.(type) {
+	case int:
+		v.kind, v.n = valueInt, uint64(x)
+	case int64:
+		v.kind, v.n = valueInt64, uint64(x)
+	case float64:
+		v.kind, v.n = valueFloat, math.Float64bits(x)
+	case string:
+		v.kind, v.s = valueString, x
+	case bool:
+		v.kind = valueBool
+		if x {
+			v.n = 1
+		}
+	case time.Time:
+		v.kind, v.orig = valueTime, x
+	default:
+		v.val = reflect.ValueOf(i)
+	}
+}
+
+// Values computed by pongo2 are created without converting them to an
+// interface first.
+
+func intValue(i int) *Value {
+	return &Value{kind: valueInt, n: uint64(i)}
+}
+
+func floatValue(f float64) *Value {
+	return &Value{kind: valueFloat, n: math.Float64bits(f)}
+}
+
+func stringValue(s string) *Value {
+	return &Value{kind: valueString, s: s}
+}
+
+func boolValue(b bool) *Value {
+	v := &Value{kind: valueBool}
+	if b {
+		v.n = 1
+	}
+	return v
+}
+
+// reflectedValue returns the Value of a value obtained using reflect.
+// Scalars (also if wrapped in an interface) are stored without reflection.
+func reflectedValue(rv reflect.Value, safe bool) *Value {
+	v := new(Value)
+	v.setReflected(rv, safe)
+	return v
+}
+
+// setReflected sets v to the Value of a value obtained using reflect (see
+// reflectedValue).
+func (v *Value) setReflected(rv reflect.Value, safe bool) {
+	*v = Value{val: rv, safe: safe}
+	inner := rv
+	if inner.IsValid() && inner.Kind() == reflect.Interface {
+		inner = inner.Elem()
+	}
+	if !inner.IsValid() || !inner.CanInterface() {
+		return
+	}
+	switch inner.Type() {
+	case typeOfInt:
+		v.kind, v.n = valueInt, uint64(inner.Int())
+	case typeOfInt64:
+		v.kind, v.n = valueInt64, uint64(inner.Int())
+	case typeOfFloat64:
+		v.kind, v.n = valueFloat, math.Float64bits(inner.Float())
+	case typeOfString:
+		v.kind, v.s = valueString, inner.String()
+	case typeOfBool:
+		v.kind = valueBool
+		if inner.Bool() {
+			v.n = 1
+		}
+	case typeOfTime:
+		v.kind, v.orig = valueTime, inner.Interface()
+	default:
+		return
+	}
+	v.val = reflect.Value{}
+}
+
+func (v *Value) float64() float64 {
+	return math.Float64frombits(v.n)
+}
+
+// reflectValue returns the value as a reflect.Value.
+func (v *Value) reflectValue() reflect.Value {
+	if v.kind == valueReflect {
+		return v.val
 	}
+	return reflect.ValueOf(v.Interface())
+}
+
+// isValid reports whether the value isn't nil (before unwrapping pointers
+// and interfaces).
+func (v *Value) isValid() bool {
+	return v.kind != valueReflect || v.val.IsValid()
 }
 
 func (v *Value) getResolvedValue() reflect.Value {
-	rv := v.val
+	rv := v.reflectValue()
 	// Unwrap pointers and interfaces to get to the underlying value
 	for rv.IsValid() && (rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface) {
 		rv = rv.Elem()
@@ -47,22 +182,34 @@ func (v *Value) getResolvedValue() reflect.Value {
 
 // IsString checks whether the underlying value is a string
 func (v *Value) IsString() bool {
+	if v.kind != valueReflect {
+		return v.kind == valueString
+	}
 	return v.getResolvedValue().Kind() == reflect.String
 }
 
 // IsBool checks whether the underlying value is a bool
 func (v *Value) IsBool() bool {
+	if v.kind != valueReflect {
+		return v.kind == valueBool
+	}
 	return v.getResolvedValue().Kind() == reflect.Bool
 }
 
 // IsFloat checks whether the underlying value is a float
 func (v *Value) IsFloat() bool {
+	if v.kind != valueReflect {
+		return v.kind == valueFloat
+	}
 	kind := v.getResolvedValue().Kind()
 	return kind == reflect.Float32 || kind == reflect.Float64
 }
 
 // IsInteger checks whether the underlying value is an integer
 func (v *Value) IsInteger() bool {
+	if v.kind != valueReflect {
+		return v.kind == valueInt || v.kind == valueInt64
+	}
 	kind := v.getResolvedValue().Kind()
 	return kind == reflect.Int ||
 		kind == reflect.Int8 ||
@@ -84,13 +231,18 @@ func (v *Value) IsNumber() bool {
 
 // IsTime checks whether the underlying value is a time.Time.
 func (v *Value) IsTime() bool {
+	if v.kind != valueReflect {
+		return v.kind == valueTime
+	}
 	_, ok := v.Interface().(time.Time)
 	return ok
 }
 
 // IsNil checks whether the underlying value is NIL
 func (v *Value) IsNil() bool {
-	// fmt.Printf("%+v\n", v.getResolvedValue().Type().String())
+	if v.kind != valueReflect {
+		return false
+	}
 	return !v.getResolvedValue().IsValid()
 }
 
@@ -108,10 +260,29 @@ func (v *Value) IsNil() bool {
 // NIL values will lead to an empty string. Unsupported types are leading
 // to their respective type name.
 func (v *Value) String() string {
+	switch v.kind {
+	case valueString:
+		return v.s
+	case valueInt, valueInt64:
+		return strconv.FormatInt(int64(v.n), 10)
+	case valueFloat:
+		return fmt.Sprintf("%f", v.float64())
+	case valueBool:
+		if v.n != 0 {
+			return "True"
+		}
+		return "False"
+	case valueTime:
+		return v.orig.(time.Time).String()
+	}
+
 	if v.IsNil() {
 		return ""
 	}
 
+	if t, ok := valuer[PongoStringer](v, valuerString); ok {
+		return t.PongoString()
+	}
 	if t, ok := v.Interface().(fmt.Stringer); ok {
 		return t.String()
 	}
@@ -141,6 +312,12 @@ func (v *Value) String() string {
 // value, if necessary). If it's not possible to convert the underlying value,
 // it will return 0.
 func (v *Value) Integer() int {
+	switch v.kind {
+	case valueInt, valueInt64:
+		return int(int64(v.n))
+	case valueFloat:
+		return int(v.float64())
+	}
 	rv := v.getResolvedValue()
 	switch rv.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
@@ -170,6 +347,12 @@ func (v *Value) Integer() int {
 // value, if necessary). If it's not possible to convert the underlying value,
 // it will return 0.0.
 func (v *Value) Float() float64 {
+	switch v.kind {
+	case valueInt, valueInt64:
+		return float64(int64(v.n))
+	case valueFloat:
+		return v.float64()
+	}
 	rv := v.getResolvedValue()
 	switch rv.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
@@ -195,6 +378,9 @@ func (v *Value) Float() float64 {
 // will always be returned. If you're looking for true/false-evaluation of the
 // underlying value, have a look on the IsTrue()-function.
 func (v *Value) Bool() bool {
+	if v.kind == valueBool {
+		return v.n != 0
+	}
 	rv := v.getResolvedValue()
 	switch rv.Kind() {
 	case reflect.Bool:
@@ -228,6 +414,19 @@ func (v *Value) Time() time.Time {
 //
 // Otherwise returns always FALSE.
 func (v *Value) IsTrue() bool {
+	switch v.kind {
+	case valueInt, valueInt64, valueBool:
+		return v.n != 0
+	case valueFloat:
+		return v.float64() != 0
+	case valueString:
+		return len(v.s) > 0
+	case valueTime:
+		return true // struct instance is always true
+	}
+	if t, ok := valuer[PongoTruther](v, valuerTruth); ok {
+		return t.PongoTruth()
+	}
 	rv := v.getResolvedValue()
 	switch rv.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
@@ -242,6 +441,13 @@ func (v *Value) IsTrue() bool {
 		return rv.Bool()
 	case reflect.Struct:
 		return true // struct instance is always true
+	case reflect.Func:
+		// Iterators would have to be consumed to check for items
+		if isSeq(rv) {
+			return !rv.IsNil()
+		}
+		logf("Value.IsTrue() not available for type: %s\n", rv.Kind().String())
+		return false
 	default:
 		logf("Value.IsTrue() not available for type: %s\n", rv.Kind().String())
 		return false
@@ -256,6 +462,27 @@ func (v *Value) IsTrue() bool {
 //
 //	AsValue(1).Negate().IsTrue() == false
 func (v *Value) Negate() *Value {
+	switch v.kind {
+	case valueInt, valueInt64:
+		if v.n != 0 {
+			return intValue(0)
+		}
+		return intValue(1)
+	case valueFloat:
+		if v.float64() != 0.0 {
+			return floatValue(0.0)
+		}
+		return floatValue(1.0)
+	case valueString:
+		return boolValue(len(v.s) == 0)
+	case valueBool:
+		return boolValue(v.n == 0)
+	case valueTime:
+		return boolValue(false)
+	}
+	if t, ok := valuer[PongoTruther](v, valuerTruth); ok {
+		return boolValue(!t.PongoTruth())
+	}
 	rv := v.getResolvedValue()
 	switch rv.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
@@ -281,13 +508,26 @@ func (v *Value) Negate() *Value {
 	}
 }
 
-// Len returns the length for an array, chan, map, slice or string.
-// Otherwise it will return 0.
+// Len returns the length for an array, map, slice or string. The length of
+// range-over-func iterators (iter.Seq and iter.Seq2) and channels is unknown
+// without consuming them, so it's 0 unless they implement PongoLener, as for
+// all other types.
 func (v *Value) Len() int {
+	if v.kind == valueString {
+		return utf8.RuneCountInString(v.s)
+	}
+	if l, ok := valuer[PongoLener](v, valuerLen); ok {
+		return l.PongoLen()
+	}
+	if it, ok := valuer[PongoIterator](v, valuerIter); ok {
+		return AsValue(it.PongoIter()).Len()
+	}
 	rv := v.getResolvedValue()
 	switch rv.Kind() {
-	case reflect.Array, reflect.Chan, reflect.Map, reflect.Slice:
+	case reflect.Array, reflect.Map, reflect.Slice:
 		return rv.Len()
+	case reflect.Chan, reflect.Func:
+		return 0
 	case reflect.String:
 		runes := []rune(rv.String())
 		return len(runes)
@@ -353,14 +593,29 @@ func (v *Value) Index(i int) *Value {
 //
 //	AsValue("Hello, World!").Contains(AsValue("World")) == true
 func (v *Value) Contains(other *Value) bool {
+	return v.contains(other, 0)
+}
+
+// contains is Contains looking up struct fields using the strategy fields
+// (see TemplateSet.FieldNames).
+func (v *Value) contains(other *Value, fields FieldNames) bool {
+	if v.kind == valueString {
+		return strings.Contains(v.s, other.String())
+	}
+	if it, ok := valuer[PongoIterator](v, valuerIter); ok {
+		return AsValue(it.PongoIter()).contains(other, fields)
+	}
+	if _, ok := pongoGetAttr(v.val, other.String()); ok {
+		return true
+	}
 	baseValue := v.getResolvedValue()
 	switch baseValue.Kind() {
 	case reflect.Struct:
-		fieldValue := baseValue.FieldByName(other.String())
+		fieldValue := fieldByName(baseValue, other.String(), fields)
 		return fieldValue.IsValid()
 	case reflect.Map:
 		// We can't check against invalid types
-		if !other.val.IsValid() {
+		if !other.isValid() {
 			return false
 		}
 		otherResolved := other.getResolvedValue()
@@ -383,6 +638,18 @@ func (v *Value) Contains(other *Value) bool {
 		}
 		return false
 
+	case reflect.Func:
+		// Iterators contain their items (or keys for iter.Seq2)
+		if !isSeq(baseValue) || baseValue.IsNil() {
+			return false
+		}
+		found := false
+		rangeSeq(baseValue, func(key, _ *Value) bool {
+			found = other.EqualValueTo(key)
+			return !found
+		})
+		return found
+
 	default:
 		logf("Value.Contains() not available for type: %s\n", baseValue.Kind().String())
 		return false
@@ -423,9 +690,20 @@ func (v *Value) IsStruct() bool {
 // For structs, it uses the key's string representation as the field name.
 // Returns nil Value if the key/field doesn't exist or the type doesn't support item access.
 func (v *Value) GetItem(key *Value) *Value {
+	return v.getItem(key, 0)
+}
+
+// getItem is GetItem looking up struct fields using the strategy fields
+// (see TemplateSet.FieldNames).
+func (v *Value) getItem(key *Value, fields FieldNames) *Value {
 	if key.IsNil() {
 		return AsValue(nil)
 	}
+	if key.IsString() {
+		if attr, ok := pongoGetAttr(v.val, key.String()); ok {
+			return reflectedValue(attr, false)
+		}
+	}
 
 	rv := v.getResolvedValue()
 	switch rv.Kind() {
@@ -452,14 +730,14 @@ func (v *Value) GetItem(key *Value) *Value {
 
 		val := rv.MapIndex(mapKey)
 		if val.IsValid() {
-			return &Value{val: val}
+			return reflectedValue(val, false)
 		}
 		return AsValue(nil)
 
 	case reflect.Struct:
-		field := rv.FieldByName(key.String())
+		field := fieldByName(rv, key.String(), fields)
 		if field.IsValid() {
-			return &Value{val: field}
+			return reflectedValue(field, false)
 		}
 		return AsValue(nil)
 
@@ -468,13 +746,18 @@ func (v *Value) GetItem(key *Value) *Value {
 	}
 }
 
-// Iterate iterates over a map, array, slice or a string. It calls the
-// function's first argument for every value with the following arguments:
+// Iterate iterates over a map, array, slice, string, range-over-func
+// iterator (iter.Seq or iter.Seq2) or channel. It calls the function's first
+// argument for every value with the following arguments:
 //
 //	idx      current 0-index
-//	count    total amount of items
+//	count    total amount of items (-1 if unknown, see below)
 //	key      *Value for the key or item
-//	value    *Value (only for maps, the respective value for a specific key)
+//	value    *Value (only for maps and iter.Seq2, the respective value for a specific key)
+//
+// Iterators and channels are consumed lazily, so the total amount of items
+// is unknown until the last item: it's read ahead by one item and count is
+// known for the last item only.
 //
 // If the underlying value has no items or is not one of the types above,
 // the empty function (function's second argument) will be called.
@@ -485,9 +768,27 @@ func (v *Value) Iterate(fn func(idx, count int, key, value *Value) bool, empty f
 // IterateOrder behaves like Value.Iterate, but can iterate through an array/slice/string in reverse. Does
 // not affect the iteration through a map because maps don't have any particular order.
 // However, you can force an order using the `sorted` keyword (and even use `reversed sorted`).
+// Iterators and channels are consumed entirely before if their order is changed.
 func (v *Value) IterateOrder(fn func(idx, count int, key, value *Value) bool, empty func(), reverse bool, sorted bool) {
+	if it, ok := valuer[PongoIterator](v, valuerIter); ok {
+		AsValue(it.PongoIter()).IterateOrder(fn, empty, reverse, sorted)
+		return
+	}
 	rv := v.getResolvedValue()
 	switch rv.Kind() {
+	case reflect.Func, reflect.Chan:
+		switch {
+		case !isSeq(rv):
+			logf("Value.Iterate() not available for type: %s\n", rv.Type().String())
+			empty()
+		case rv.IsNil():
+			empty()
+		case reverse || sorted:
+			iterateSeqOrder(rv, fn, empty, reverse, sorted)
+		default:
+			iterateSeq(rv, fn, empty)
+		}
+		return // done
 	case reflect.Map:
 		keys := sortedKeys(rv.MapKeys())
 		if sorted {
@@ -500,7 +801,7 @@ func (v *Value) IterateOrder(fn func(idx, count int, key, value *Value) bool, em
 		keyLen := len(keys)
 		for idx, key := range keys {
 			value := rv.MapIndex(key)
-			if !fn(idx, keyLen, &Value{val: key}, &Value{val: value}) {
+			if !fn(idx, keyLen, reflectedValue(key, false), reflectedValue(value, false)) {
 				return
 			}
 		}
@@ -513,7 +814,7 @@ func (v *Value) IterateOrder(fn func(idx, count int, key, value *Value) bool, em
 
 		itemCount := rv.Len()
 		for i := range itemCount {
-			items = append(items, &Value{val: rv.Index(i)})
+			items = append(items, reflectedValue(rv.Index(i), false))
 		}
 
 		if sorted {
@@ -558,7 +859,7 @@ func (v *Value) IterateOrder(fn func(idx, count int, key, value *Value) bool, em
 			}
 
 			for i := range charCount {
-				if !fn(i, charCount, &Value{val: reflect.ValueOf(string(rs[i]))}, nil) {
+				if !fn(i, charCount, stringValue(string(rs[i])), nil) {
 					return
 				}
 			}
@@ -572,44 +873,183 @@ func (v *Value) IterateOrder(fn func(idx, count int, key, value *Value) bool, em
 	empty()
 }
 
+// isSeq reports whether rv is a range-over-func iterator (iter.Seq or
+// iter.Seq2) or a channel which can be received from.
+func isSeq(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Func:
+		return rv.Type().CanSeq() || rv.Type().CanSeq2()
+	case reflect.Chan:
+		return rv.Type().ChanDir()&reflect.RecvDir != 0
+	}
+	return false
+}
+
+// isSeq reports whether the value is a range-over-func iterator or a channel
+// (see isSeq).
+func (v *Value) isSeq() bool {
+	return v.kind == valueReflect && isSeq(v.getResolvedValue())
+}
+
+// rangeSeq calls yield for the items of the non-nil sequence rv (see isSeq)
+// until it returns false. value is only set for iter.Seq2 iterators.
+func rangeSeq(rv reflect.Value, yield func(key, value *Value) bool) {
+	if rv.Kind() == reflect.Func && rv.Type().CanSeq2() {
+		for k, v := range rv.Seq2() {
+			if !yield(reflectedValue(k, false), reflectedValue(v, false)) {
+				return
+			}
+		}
+		return
+	}
+	for k := range rv.Seq() {
+		if !yield(reflectedValue(k, false), nil) {
+			return
+		}
+	}
+}
+
+// iterateSeq iterates lazily over the sequence rv (see Value.Iterate).
+func iterateSeq(rv reflect.Value, fn func(idx, count int, key, value *Value) bool, empty func()) {
+	// The items are passed to fn when the next one arrived, so the last
+	// one is known
+	idx := 0
+	var key, value *Value
+	pending, stopped := false, false
+	rangeSeq(rv, func(k, v *Value) bool {
+		if pending {
+			if !fn(idx, -1, key, value) {
+				stopped = true
+				return false
+			}
+			idx++
+		}
+		key, value, pending = k, v, true
+		return true
+	})
+	switch {
+	case stopped:
+	case pending:
+		fn(idx, idx+1, key, value)
+	default:
+		empty()
+	}
+}
+
+// iterateSeqOrder iterates over the items of the sequence rv in the order
+// requested, like for slices (or maps for iter.Seq2 iterators).
+func iterateSeqOrder(rv reflect.Value, fn func(idx, count int, key, value *Value) bool, empty func(), reverse bool, sorted bool) {
+	var items seqItems
+	rangeSeq(rv, func(key, value *Value) bool {
+		items.keys = append(items.keys, key)
+		items.values = append(items.values, value)
+		return true
+	})
+
+	count := items.Len()
+	switch {
+	case sorted && reverse:
+		sort.Stable(sort.Reverse(items))
+	case sorted:
+		sort.Stable(items)
+	case reverse:
+		for i := 0; i < count/2; i++ {
+			items.Swap(i, count-1-i)
+		}
+	}
+
+	for idx, key := range items.keys {
+		if !fn(idx, count, key, items.values[idx]) {
+			return
+		}
+	}
+	if count == 0 {
+		empty()
+	}
+}
+
+// seqItems are the items of a sequence, sorted by their keys.
+type seqItems struct {
+	keys   valuesList
+	values []*Value
+}
+
+func (si seqItems) Len() int {
+	return len(si.keys)
+}
+
+func (si seqItems) Less(i, j int) bool {
+	return si.keys.Less(i, j)
+}
+
+func (si seqItems) Swap(i, j int) {
+	si.keys.Swap(i, j)
+	si.values[i], si.values[j] = si.values[j], si.values[i]
+}
+
 // Interface gives you access to the underlying value.
 func (v *Value) Interface() any {
-	if v.val.IsValid() {
-		return v.val.Interface()
+	switch v.kind {
+	case valueReflect:
+		if v.val.IsValid() {
+			return v.val.Interface()
+		}
+		return nil
+	case valueTime:
+		return v.orig
+	case valueInt:
+		return int(v.n)
+	case valueInt64:
+		return int64(v.n)
+	case valueFloat:
+		return v.float64()
+	case valueString:
+		return v.s
+	default: // valueBool
+		return v.n != 0
 	}
-	return nil
 }
 
 // EqualValueTo checks whether two values are containing the same value or object (if comparable).
 func (v *Value) EqualValueTo(other *Value) bool {
+	if cmp, ok := pongoCompare(v, other); ok {
+		return cmp == 0
+	}
 	// Handle numeric comparison: float vs int should compare by value (e.g., 8.0 == 8)
 	// Also handles uint vs int comparison (see issue #64)
 	if v.IsNumber() && other.IsNumber() {
-		// If either is a float, compare as floats
-		if v.IsFloat() || other.IsFloat() {
-			return v.Float() == other.Float()
-		}
-		// Both are integers (includes uint vs int)
-		return v.Integer() == other.Integer()
+		c, ok := compareNumbers(v, other)
+		return ok && c == 0
 	}
 	if v.IsTime() && other.IsTime() {
 		return v.Time().Equal(other.Time())
 	}
 	// Handle nil/undefined values (see issue #341)
 	// Two nil values are considered equal
-	if !v.val.IsValid() && !other.val.IsValid() {
+	if !v.isValid() && !other.isValid() {
 		return true
 	}
 	// One nil and one non-nil are not equal
-	if !v.val.IsValid() || !other.val.IsValid() {
+	if !v.isValid() || !other.isValid() {
 		return false
 	}
+	if v.kind == other.kind {
+		switch v.kind {
+		case valueString:
+			return v.s == other.s
+		case valueBool:
+			return v.n == other.n
+		}
+	}
 	// Note: reflect.Value.Equal() and Value.Comparable() (Go 1.20+) were considered
 	// but benchmarking showed they are slower. Type().Comparable() and
 	// Interface() == Interface() is faster due to Go's interface comparison optimization.
-	return v.val.CanInterface() && other.val.CanInterface() &&
-		v.val.Type().Comparable() && other.val.Type().Comparable() &&
-		v.Interface() == other.Interface()
+	return v.comparable() && other.comparable() && v.Interface() == other.Interface()
+}
+
+// comparable reports whether the value can be compared using ==.
+func (v *Value) comparable() bool {
+	return v.kind != valueReflect || (v.val.CanInterface() && v.val.Type().Comparable())
 }
 
 type sortedKeys []reflect.Value
@@ -619,14 +1059,7 @@ func (sk sortedKeys) Len() int {
 }
 
 func (sk sortedKeys) Less(i, j int) bool {
-	vi := &Value{val: sk[i]}
-	vj := &Value{val: sk[j]}
-	switch {
-	case vi.IsNumber() && vj.IsNumber():
-		return vi.Float() < vj.Float()
-	default:
-		return vi.String() < vj.String()
-	}
+	return sortCompare(reflectedValue(sk[i], false), reflectedValue(sk[j], false)) < 0
 }
 
 func (sk sortedKeys) Swap(i, j int) {
@@ -640,14 +1073,7 @@ func (vl valuesList) Len() int {
 }
 
 func (vl valuesList) Less(i, j int) bool {
-	vi := vl[i]
-	vj := vl[j]
-	switch {
-	case vi.IsNumber() && vj.IsNumber():
-		return vi.Float() < vj.Float()
-	default:
-		return vi.String() < vj.String()
-	}
+	return sortCompare(vl[i], vl[j]) < 0
 }
 
 func (vl valuesList) Swap(i, j int) {
@@ -0,0 +1,167 @@
+package pongo2
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// Values are ordered (by the operators <, <=, > and >= and when sorting)
+// using compareValues:
+//
+//   - values of types implementing PongoComparer using PongoCompare
+//   - numbers by their value: integers (signed and unsigned, including
+//     time.Duration) exactly, floats and integers as floats
+//   - strings lexicographically (byte-wise)
+//   - time.Time values chronologically
+//   - bools like the numbers 0 and 1 (as in Python, e.g. 1 < 2 == true is
+//     1 < false)
+//
+// nil (e.g. an undefined variable) and NaN are unordered: the operators are
+// false if an operand is nil or NaN (and NaN isn't equal to itself), so
+// {% if missing > 0 %} works. Sorting orders nil first and NaN before the
+// other numbers. Other operands (e.g. a string and a number) can't be
+// compared: the operators fail with an error of kind ErrIncomparable.
+// Sorting orders them by type instead (see sortCompare).
+
+// errUnordered is returned by compareValues if an operand is nil or NaN.
+var errUnordered = errors.New("nil and NaN are unordered")
+
+// compareValues returns a negative number, zero or a positive number if v is
+// less than, equal to or greater than other, or an error if they can't be
+// compared (errUnordered for nil and NaN).
+func compareValues(v, other *Value) (int, error) {
+	if c, ok := pongoCompare(v, other); ok {
+		return c, nil
+	}
+	switch {
+	case v.IsNil() || other.IsNil():
+		return 0, errUnordered
+	case v.isOrdinal() && other.isOrdinal():
+		c, ok := compareNumbers(v.ordinal(), other.ordinal())
+		if !ok {
+			return 0, errUnordered
+		}
+		return c, nil
+	case v.IsString() && other.IsString():
+		return strings.Compare(v.rawString(), other.rawString()), nil
+	case v.IsTime() && other.IsTime():
+		return v.Time().Compare(other.Time()), nil
+	}
+	return 0, fmt.Errorf("can't compare %s with %s", v.typeName(), other.typeName())
+}
+
+// compareNumbers compares the numbers v and other. Integers are compared
+// exactly, so large unsigned integers don't overflow. Returns false if v or
+// other is NaN.
+func compareNumbers(v, other *Value) (int, bool) {
+	if v.IsFloat() || other.IsFloat() {
+		f, g := v.Float(), other.Float()
+		if math.IsNaN(f) || math.IsNaN(g) {
+			return 0, false
+		}
+		return cmp.Compare(f, g), true
+	}
+	i, u, unsigned := v.integerParts()
+	j, w, otherUnsigned := other.integerParts()
+	switch {
+	case !unsigned && !otherUnsigned:
+		return cmp.Compare(i, j), true
+	case unsigned && otherUnsigned:
+		return cmp.Compare(u, w), true
+	case unsigned:
+		if j < 0 {
+			return 1, true
+		}
+		return cmp.Compare(u, uint64(j)), true
+	default:
+		if i < 0 {
+			return -1, true
+		}
+		return cmp.Compare(uint64(i), w), true
+	}
+}
+
+// integerParts returns the integer v as int64, or as uint64 if it's of an
+// unsigned type.
+func (v *Value) integerParts() (i int64, u uint64, unsigned bool) {
+	if v.kind != valueReflect {
+		return int64(v.n), 0, false
+	}
+	rv := v.getResolvedValue()
+	switch rv.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return 0, rv.Uint(), true
+	}
+	return rv.Int(), 0, false
+}
+
+// rawString returns the string v without calling its String methods (for
+// types based on string).
+func (v *Value) rawString() string {
+	if v.kind == valueString {
+		return v.s
+	}
+	return v.getResolvedValue().String()
+}
+
+// typeName returns the name of the type of v for error messages.
+func (v *Value) typeName() string {
+	if v.IsNil() {
+		return "nil"
+	}
+	return v.getResolvedValue().Type().String()
+}
+
+// isOrdinal reports whether v is a number or a bool.
+func (v *Value) isOrdinal() bool {
+	return v.IsNumber() || v.IsBool()
+}
+
+// ordinal returns the number v, or 0 or 1 for bools.
+func (v *Value) ordinal() *Value {
+	if !v.IsBool() {
+		return v
+	}
+	if v.Bool() {
+		return intValue(1)
+	}
+	return intValue(0)
+}
+
+// sortCompare compares v and other for sorting (the for tag's sorted
+// option, the dictsort filters, etc.). Values which can't be compared are
+// ordered by type: nil, numbers and bools, strings, times and everything
+// else (by their string representation).
+func sortCompare(v, other *Value) int {
+	c, err := compareValues(v, other)
+	switch {
+	case err == nil:
+		return c
+	case errors.Is(err, errUnordered) && v.isOrdinal() && other.isOrdinal():
+		// NaN comes first (cmp.Compare orders floats like this)
+		return cmp.Compare(v.ordinal().Float(), other.ordinal().Float())
+	}
+	if c := v.sortRank() - other.sortRank(); c != 0 {
+		return c
+	}
+	return strings.Compare(v.String(), other.String())
+}
+
+// sortRank returns the position of v's type in the order of sortCompare.
+func (v *Value) sortRank() int {
+	switch {
+	case v.IsNil():
+		return 0
+	case v.isOrdinal():
+		return 1
+	case v.IsString():
+		return 2
+	case v.IsTime():
+		return 3
+	}
+	return 4
+}
@@ -0,0 +1,150 @@
+package pongo2
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCompareValues(t *testing.T) {
+	type name string
+	now := time.Now()
+	tests := []struct {
+		a, b any
+		cmp  int
+	}{
+		{1, 2, -1},
+		{2.5, 2, 1},
+		{int8(-1), uint8(0), -1},
+		{uint64(math.MaxUint64), math.MaxInt64, 1},
+		{math.MaxInt64, uint64(math.MaxUint64), -1},
+		{uint64(math.MaxUint64), uint64(math.MaxUint64 - 1), 1},
+		{-1, uint(1), -1},
+		{uint(1), -1, 1},
+		{time.Second, time.Minute, -1},
+		{time.Duration(0), 0, 0},
+		{"abc", "abd", -1},
+		{"b", "abc", 1},
+		{"", "a", -1},
+		{name("x"), "x", 0},
+		{now, now.Add(time.Second), -1},
+		{false, true, -1},
+		{true, 1, 0},
+		{false, 0.5, -1},
+	}
+	for _, test := range tests {
+		c, err := compareValues(AsValue(test.a), AsValue(test.b))
+		if err != nil || c != test.cmp {
+			t.Errorf("compareValues(%#v, %#v) = %d, %v; want %d", test.a, test.b, c, err, test.cmp)
+		}
+	}
+
+	for _, test := range [][2]any{{"a", 1}, {now, 1}, {[]int{1}, []int{2}}, {struct{}{}, "a"}} {
+		if _, err := compareValues(AsValue(test[0]), AsValue(test[1])); err == nil {
+			t.Errorf("compareValues(%#v, %#v): expected error", test[0], test[1])
+		}
+	}
+
+	for _, test := range [][2]any{{math.NaN(), 1}, {1, math.NaN()}, {math.NaN(), math.NaN()}, {float32(math.NaN()), true}, {nil, 1}, {"a", nil}, {nil, nil}} {
+		if _, err := compareValues(AsValue(test[0]), AsValue(test[1])); !errors.Is(err, errUnordered) {
+			t.Errorf("compareValues(%#v, %#v): expected errUnordered, got %v", test[0], test[1], err)
+		}
+	}
+	if AsValue(math.NaN()).EqualValueTo(AsValue(math.NaN())) {
+		t.Error("expected NaN not to be equal to NaN")
+	}
+
+	// The expression tree evaluates the operators on NaN like the VM
+	tpl, err := FromString(`{{ nan >= 1 }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := tpl.root.Nodes[0].(*nodeVariable).expr.(*compiledExpression).tree
+	if v, err := tree.Evaluate(newExecutionContext(tpl, Context{"nan": math.NaN()})); err != nil || v.IsTrue() {
+		t.Errorf("tree: got %v, %v; want False", v, err)
+	}
+}
+
+func TestCompareOperators(t *testing.T) {
+	ctx := Context{
+		"name":  "pongo2",
+		"big":   uint64(math.MaxUint64),
+		"small": int64(-1),
+		"d":     90 * time.Second,
+		"limit": time.Minute,
+		"nan":   math.NaN(),
+	}
+	tests := []struct {
+		template string
+		output   string
+	}{
+		{`{{ name < "m" }} {{ name > "m" }} {{ "a" <= "a" }} {{ "b" >= "ab" }}`, "False True True True"},
+		{`{{ big > 1 }} {{ big > small }} {{ small < big }} {{ big == 1 }}`, "True True True False"},
+		{`{{ d > limit }} {{ limit <= d }}`, "True True"},
+		{`{{ 1 < 2.5 }} {{ 3 >= 3.0 }}`, "True True"},
+		// NaN is unordered
+		{`{{ nan < 1 }} {{ nan <= 1 }} {{ nan > 1 }} {{ nan >= 1 }} {{ 1 < nan }} {{ nan <= nan }}`, "False False False False False False"},
+		{`{{ nan + 0 < 1 }} {{ 1.5 >= nan * 1 }} {{ nan == nan }} {{ nan != nan }}`, "False False False True"},
+		// nil is unordered
+		{`{{ missing > 0 }} {{ missing <= 0 }} {{ 0 < missing }} {{ missing >= missing }} {{ name < missing }}`, "False False False False False"},
+		{`{% if missing > 0 %}yes{% else %}no{% endif %}`, "no"},
+	}
+	for _, test := range tests {
+		tpl, err := FromString(test.template)
+		if err != nil {
+			t.Errorf("%s: %v", test.template, err)
+			continue
+		}
+		out, err := tpl.Execute(ctx)
+		if err != nil || out != test.output {
+			t.Errorf("%s: got %q, %v; want %q", test.template, out, err, test.output)
+		}
+	}
+
+	for _, template := range []string{`{{ name < 5 }}`, `{{ d >= name }}`, `{% if 1 > "a" %}{% endif %}`} {
+		tpl, err := FromString(template)
+		if err != nil {
+			t.Errorf("%s: %v", template, err)
+			continue
+		}
+		if _, err := tpl.Execute(ctx); !errors.Is(err, ErrIncomparable) {
+			t.Errorf("%s: expected error of kind ErrIncomparable, got %v", template, err)
+		}
+		// The expression tree reports the same error as the VM
+		node := tpl.root.Nodes[0]
+		var expr IEvaluator
+		switch node := node.(type) {
+		case *nodeVariable:
+			expr = node.expr.(*compiledExpression).tree
+		case *tagIfNode:
+			expr = node.conditions[0].(*compiledExpression).tree
+		}
+		if _, err := expr.Evaluate(newExecutionContext(tpl, ctx)); !errors.Is(err, ErrIncomparable) {
+			t.Errorf("%s: expected error of kind ErrIncomparable from the tree, got %v", template, err)
+		}
+	}
+}
+
+func TestSortCompare(t *testing.T) {
+	tpl, err := FromString(`{% for x in items sorted %}{{ x }},{% endfor %}|{% for x in items reversed sorted %}{{ x }},{% endfor %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := []any{"b", uint64(math.MaxUint64), nil, -1, "B", 2.5, math.NaN(), "a"}
+	out, err := tpl.Execute(Context{"items": items})
+	want := ",NaN,-1,2.500000,18446744073709551615,B,a,b,|b,a,B,18446744073709551615,2.500000,-1,NaN,,"
+	if err != nil || out != want {
+		t.Errorf("got %q, %v; want %q", out, err, want)
+	}
+
+	people := []map[string]any{{"name": "c", "age": 10}, {"name": "a", "age": 9}, {"name": "b"}}
+	tpl, err = FromString(`{% for p in people|dictsort:"age" %}{{ p.name }}{% endfor %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = tpl.Execute(Context{"people": people})
+	if err != nil || out != "bac" {
+		t.Errorf("dictsort: got %q, %v; want %q", out, err, "bac")
+	}
+}
@@ -1,7 +1,11 @@
 package pongo2
 
 import (
+	"fmt"
+	"iter"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestValueIterate(t *testing.T) {
@@ -669,6 +673,109 @@ func TestValueIterateOrder(t *testing.T) {
 	})
 }
 
+func TestValueIterateSeq(t *testing.T) {
+	// produced counts the items produced, to check the lookahead
+	produced := 0
+	seq := func(yield func(string) bool) {
+		for _, s := range []string{"b", "c", "a"} {
+			produced++
+			if !yield(s) {
+				return
+			}
+		}
+	}
+	seq2 := func(yield func(string, int) bool) {
+		_ = yield("b", 2) && yield("a", 1)
+	}
+	ch := make(chan int, 3)
+	ch <- 1
+	ch <- 2
+	close(ch)
+
+	t.Run("lazy", func(t *testing.T) {
+		produced = 0
+		var items []string
+		AsValue(seq).Iterate(func(idx, count int, key, value *Value) bool {
+			if produced != idx+2 && count < 0 || value != nil {
+				t.Errorf("item %d: %d items produced, count %d", idx, produced, count)
+			}
+			items = append(items, fmt.Sprintf("%s:%d", key, count))
+			return true
+		}, func() { t.Error("unexpected call of empty") })
+		if fmt.Sprint(items) != "[b:-1 c:-1 a:3]" {
+			t.Errorf("items = %v", items)
+		}
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		produced = 0
+		AsValue(seq).Iterate(func(idx, count int, key, value *Value) bool {
+			return false
+		}, func() { t.Error("unexpected call of empty") })
+		if produced != 2 {
+			t.Errorf("%d items produced, want 2", produced)
+		}
+	})
+
+	tests := []struct {
+		name            string
+		value           any
+		reverse, sorted bool
+		items           string
+	}{
+		{"seq sorted", iter.Seq[string](seq), false, true, "[a:3 b:3 c:3]"},
+		{"seq reversed", iter.Seq[string](seq), true, false, "[a:3 c:3 b:3]"},
+		{"seq2", seq2, false, false, "[b=2:-1 a=1:2]"},
+		{"seq2 sorted", seq2, false, true, "[a=1:2 b=2:2]"},
+		{"channel", ch, false, false, "[1:-1 2:2]"},
+		{"nil seq", iter.Seq[int](nil), false, false, "[]"},
+		{"nil channel", (chan int)(nil), false, false, "[]"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			items := []string{}
+			empty := false
+			AsValue(test.value).IterateOrder(func(idx, count int, key, value *Value) bool {
+				item := key.String()
+				if value != nil {
+					item += "=" + value.String()
+				}
+				items = append(items, fmt.Sprintf("%s:%d", item, count))
+				return true
+			}, func() { empty = true }, test.reverse, test.sorted)
+			if fmt.Sprint(items) != test.items || empty != (test.items == "[]") {
+				t.Errorf("items = %v (empty called: %t), want %s", items, empty, test.items)
+			}
+		})
+	}
+
+	for _, test := range []struct {
+		value any
+		want  bool
+	}{
+		{iter.Seq[string](seq), true},
+		{seq2, true},
+		{iter.Seq[int](nil), false},
+		{iter.Seq2[int, int](nil), false},
+	} {
+		if got := AsValue(test.value).IsTrue(); got != test.want {
+			t.Errorf("IsTrue() of %T (nil: %t) = %t, want %t", test.value, !test.want, got, test.want)
+		}
+	}
+	produced = 0
+	if AsValue(seq).IsTrue(); produced != 0 {
+		t.Errorf("IsTrue() produced %d items, want 0", produced)
+	}
+
+	produced = 0
+	if n := AsValue(seq).Len(); n != 0 || produced != 0 {
+		t.Errorf("Len() = %d (%d items produced), want 0", n, produced)
+	}
+	if n := AsValue(seq2).Len(); n != 0 {
+		t.Errorf("Len() of iter.Seq2 = %d, want 0", n)
+	}
+}
+
 // TestValueContainsMapKeys tests Contains with various map key types.
 // This is a regression test for the bug where Contains only worked with
 // string and int keys, failing silently for float64 and other types.
@@ -900,3 +1007,98 @@ func TestBugSortedKeysMixedIntFloat(t *testing.T) {
 		t.Errorf("got %q, want %q", result, expected)
 	}
 }
+
+// TestValueScalars compares values stored without reflection to values
+// accessed using reflect.
+func TestValueScalars(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	scalars := []any{0, 42, -7, int64(0), int64(1 << 40), 0.0, 2.5, -1.25, "", "abc", "3.7", "你好", true, false, now, time.Time{}}
+	others := []*Value{AsValue(42), AsValue(2.5), AsValue("b"), AsValue(true), AsValue(now), AsValue(nil), AsValue(int64(42))}
+
+	for _, x := range scalars {
+		fast, slow := AsValue(x), &Value{val: reflect.ValueOf(x)}
+		if fast.kind == valueReflect {
+			t.Fatalf("%#v: expected value to be stored without reflection", x)
+		}
+		for name, check := range map[string]func(v *Value) any{
+			"IsString":  func(v *Value) any { return v.IsString() },
+			"IsBool":    func(v *Value) any { return v.IsBool() },
+			"IsFloat":   func(v *Value) any { return v.IsFloat() },
+			"IsInteger": func(v *Value) any { return v.IsInteger() },
+			"IsNumber":  func(v *Value) any { return v.IsNumber() },
+			"IsTime":    func(v *Value) any { return v.IsTime() },
+			"IsNil":     func(v *Value) any { return v.IsNil() },
+			"String":    func(v *Value) any { return v.String() },
+			"Integer":   func(v *Value) any { return v.Integer() },
+			"Float":     func(v *Value) any { return v.Float() },
+			"Bool":      func(v *Value) any { return v.Bool() },
+			"Time":      func(v *Value) any { return v.Time() },
+			"IsTrue":    func(v *Value) any { return v.IsTrue() },
+			"Negate":    func(v *Value) any { return v.Negate().Interface() },
+			"Len":       func(v *Value) any { return v.Len() },
+			"Interface": func(v *Value) any { return v.Interface() },
+			"Equal": func(v *Value) any {
+				var equal []bool
+				for _, other := range others {
+					equal = append(equal, v.EqualValueTo(other), other.EqualValueTo(v))
+				}
+				return equal
+			},
+			"Contains": func(v *Value) any {
+				if !v.IsString() {
+					return nil
+				}
+				var contains []bool
+				for _, other := range others {
+					contains = append(contains, v.Contains(other))
+				}
+				return contains
+			},
+		} {
+			if got, want := check(fast), check(slow); !reflect.DeepEqual(got, want) {
+				t.Errorf("%#v: %s = %#v; want %#v", x, name, got, want)
+			}
+		}
+	}
+
+	t.Run("reflected", func(t *testing.T) {
+		items := []any{7, "x", nil}
+		v := AsValue(items)
+		if item := v.Index(0); item.kind != valueInt || item.Integer() != 7 {
+			t.Errorf("expected interface element to be stored without reflection, got %#v", item)
+		}
+		if item := v.Index(2); !item.IsNil() {
+			t.Errorf("expected nil element, got %#v", item.Interface())
+		}
+		type myString string
+		if v := AsValue(myString("s")); v.kind != valueReflect || v.Interface() != myString("s") {
+			t.Errorf("expected named type to keep its type, got %#v", v.Interface())
+		}
+	})
+}
+
+func TestValueScalarAllocs(t *testing.T) {
+	v := AsValue("abc")
+	other := AsValue("b")
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = v.IsString() && v.IsTrue() && v.Len() == 3 && v.Contains(other) && v.String() == "abc"
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations, got %v", allocs)
+	}
+}
+
+func BenchmarkValue(b *testing.B) {
+	values := map[string]any{"int": 42, "float": 2.5, "string": "pongo2", "bool": true}
+	for name, x := range values {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				v := AsValue(x)
+				_ = v.IsTrue()
+				_ = v.String()
+				_ = v.Float()
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package pongo2
+
+import (
+	"reflect"
+	"sync"
+)
+
+// The following interfaces can be implemented by Go types to control how
+// their values behave in templates. Value consults them before applying the
+// behavior for the kind of the type, e.g.:
+//
+//	type Money struct {
+//	    Cents    int64
+//	    Currency string
+//	}
+//
+//	func (m Money) PongoString() string {
+//	    return fmt.Sprintf("%d.%02d %s", m.Cents/100, m.Cents%100, m.Currency)
+//	}
+//
+//	func (m Money) PongoTruth() bool {
+//	    return m.Cents != 0
+//	}
+//
+// The methods are called for the value as stored in the context (or
+// returned by a function, field, etc.): methods with pointer receivers are
+// only found if the value is a pointer. They aren't called for nil pointers.
+
+// PongoStringer is implemented by types controlling their output (e.g. in
+// {{ value }}). It takes precedence over fmt.Stringer.
+type PongoStringer interface {
+	PongoString() string
+}
+
+// PongoTruther is implemented by types controlling whether they're true
+// (e.g. in {% if value %}). By default, structs are always true.
+type PongoTruther interface {
+	PongoTruth() bool
+}
+
+// PongoLener is implemented by types controlling their length (e.g. of the
+// length filter).
+type PongoLener interface {
+	PongoLen() int
+}
+
+// PongoIterator is implemented by types which can be iterated over (e.g.
+// using {% for %}) or contain items (the in operator). PongoIter returns
+// the value iterated over instead: an array, slice, map, string, iterator
+// (iter.Seq or iter.Seq2) or channel.
+type PongoIterator interface {
+	PongoIter() any
+}
+
+// PongoComparer is implemented by types which can be compared (e.g. using
+// ==). PongoCompare returns a negative number, zero or a positive number if
+// the value is less than, equal to or greater than other. ok is false if the
+// value can't be compared with other.
+type PongoComparer interface {
+	PongoCompare(other any) (cmp int, ok bool)
+}
+
+// PongoAttrGetter is implemented by types providing attributes (e.g. in
+// {{ value.name }} or {{ value["name"] }}). PongoGetAttr returns the value
+// of the attribute name; if ok is false, the methods, fields or map keys of
+// the value are looked up as usual.
+type PongoAttrGetter interface {
+	PongoGetAttr(name string) (value any, ok bool)
+}
+
+// valuerMethods is a set of the interfaces above implemented by a type.
+type valuerMethods uint8
+
+const (
+	valuerString valuerMethods = 1 << iota
+	valuerTruth
+	valuerLen
+	valuerIter
+	valuerCompare
+	valuerGetAttr
+)
+
+var valuerInterfaces = []reflect.Type{
+	reflect.TypeFor[PongoStringer](),
+	reflect.TypeFor[PongoTruther](),
+	reflect.TypeFor[PongoLener](),
+	reflect.TypeFor[PongoIterator](),
+	reflect.TypeFor[PongoComparer](),
+	reflect.TypeFor[PongoAttrGetter](),
+}
+
+// valuerTypes maps types with methods to their valuerMethods.
+var valuerTypes sync.Map
+
+// valuerMethodsOf returns the interfaces above implemented by t.
+func valuerMethodsOf(t reflect.Type) valuerMethods {
+	if t.NumMethod() == 0 {
+		return 0
+	}
+	if m, ok := valuerTypes.Load(t); ok {
+		return m.(valuerMethods)
+	}
+	var m valuerMethods
+	for i, iface := range valuerInterfaces {
+		if t.Implements(iface) {
+			m |= 1 << i
+		}
+	}
+	valuerTypes.Store(t, m)
+	return m
+}
+
+// valuer returns the value as T if it implements the interface m (one of the
+// interfaces above).
+func valuer[T any](v *Value, m valuerMethods) (T, bool) {
+	var zero T
+	if v.kind != valueReflect {
+		return zero, false
+	}
+	return valuerOf[T](v.val, m)
+}
+
+// valuerOf returns rv as T if it implements the interface m.
+func valuerOf[T any](rv reflect.Value, m valuerMethods) (T, bool) {
+	var zero T
+	if rv.Kind() == reflect.Interface {
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() || valuerMethodsOf(rv.Type())&m == 0 || !rv.CanInterface() ||
+		(rv.Kind() == reflect.Ptr && rv.IsNil()) {
+		return zero, false
+	}
+	return rv.Interface().(T), true
+}
+
+// pongoGetAttr returns the attribute name of rv if it implements
+// PongoAttrGetter and provides the attribute.
+func pongoGetAttr(rv reflect.Value, name string) (reflect.Value, bool) {
+	getter, ok := valuerOf[PongoAttrGetter](rv, valuerGetAttr)
+	if !ok {
+		return reflect.Value{}, false
+	}
+	value, ok := getter.PongoGetAttr(name)
+	if !ok {
+		return reflect.Value{}, false
+	}
+	return reflect.ValueOf(value), true
+}
+
+// pongoCompare compares v with other using PongoCompare if one of them
+// implements PongoComparer and can be compared with the other.
+func pongoCompare(v, other *Value) (int, bool) {
+	if c, ok := valuer[PongoComparer](v, valuerCompare); ok {
+		if cmp, ok := c.PongoCompare(other.Interface()); ok {
+			return cmp, true
+		}
+	}
+	if c, ok := valuer[PongoComparer](other, valuerCompare); ok {
+		if cmp, ok := c.PongoCompare(v.Interface()); ok {
+			return -max(min(cmp, 1), -1), true
+		}
+	}
+	return 0, false
+}
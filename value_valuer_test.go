@@ -0,0 +1,161 @@
+package pongo2
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// money implements PongoStringer, PongoTruther and PongoComparer.
+type money struct {
+	cents    int64
+	currency string
+}
+
+func (m money) PongoString() string {
+	return fmt.Sprintf("%d.%02d %s", m.cents/100, m.cents%100, m.currency)
+}
+
+func (m money) PongoTruth() bool {
+	return m.cents != 0
+}
+
+func (m money) PongoCompare(other any) (int, bool) {
+	switch other := other.(type) {
+	case money:
+		if other.currency != m.currency {
+			return 0, false
+		}
+		return int(m.cents - other.cents), true
+	case int:
+		return int(m.cents - int64(other)*100), true
+	}
+	return 0, false
+}
+
+// lazyList implements PongoLener and PongoIterator using pointer receivers.
+type lazyList struct {
+	items []string
+	loads int
+}
+
+func (l *lazyList) PongoLen() int {
+	return len(l.items)
+}
+
+func (l *lazyList) PongoIter() any {
+	l.loads++
+	return slices.Values(l.items)
+}
+
+// record implements PongoAttrGetter.
+type record struct {
+	Name   string
+	fields map[string]any
+}
+
+func (r *record) PongoGetAttr(name string) (any, bool) {
+	value, ok := r.fields[name]
+	return value, ok
+}
+
+func TestValueValuer(t *testing.T) {
+	eur := func(cents int64) money { return money{cents, "EUR"} }
+
+	t.Run("string and truth", func(t *testing.T) {
+		if s := AsValue(eur(1250)).String(); s != "12.50 EUR" {
+			t.Errorf("String() = %q", s)
+		}
+		if AsValue(eur(0)).IsTrue() || !AsValue(eur(1)).IsTrue() {
+			t.Error("expected IsTrue to use PongoTruth")
+		}
+		if !AsValue(eur(0)).Negate().IsTrue() {
+			t.Error("expected Negate to use PongoTruth")
+		}
+		if s := AsValue((*lazyList)(nil)).String(); s != "" {
+			t.Errorf("expected empty string for nil pointer, got %q", s)
+		}
+	})
+
+	t.Run("compare", func(t *testing.T) {
+		if !AsValue(eur(100)).EqualValueTo(AsValue(1)) || !AsValue(1).EqualValueTo(AsValue(eur(100))) {
+			t.Error("expected EqualValueTo to use PongoCompare in both directions")
+		}
+		if AsValue(eur(100)).EqualValueTo(AsValue(money{100, "USD"})) {
+			t.Error("expected different currencies not to be equal")
+		}
+	})
+
+	t.Run("len and iterate", func(t *testing.T) {
+		l := &lazyList{items: []string{"a", "b"}}
+		v := AsValue(l)
+		if v.Len() != 2 || l.loads != 0 {
+			t.Errorf("Len() = %d with %d loads", v.Len(), l.loads)
+		}
+		var items []string
+		v.Iterate(func(idx, count int, key, value *Value) bool {
+			items = append(items, key.String())
+			return true
+		}, func() {})
+		if fmt.Sprint(items) != "[a b]" || !v.Contains(AsValue("b")) || v.Contains(AsValue("c")) {
+			t.Errorf("unexpected items %q", items)
+		}
+		if AsValue(lazyList{}).Len() != 0 {
+			t.Error("expected pointer receivers not to be used for values")
+		}
+	})
+
+	t.Run("get attr", func(t *testing.T) {
+		r := &record{Name: "name", fields: map[string]any{"title": "Title"}}
+		v := AsValue(r)
+		if s := v.GetItem(AsValue("title")).String(); s != "Title" {
+			t.Errorf("GetItem(title) = %q", s)
+		}
+		if s := v.GetItem(AsValue("Name")).String(); s != "name" {
+			t.Errorf("GetItem(Name) = %q", s)
+		}
+		if !v.Contains(AsValue("title")) {
+			t.Error("expected Contains to find the attribute")
+		}
+	})
+}
+
+func TestValuerTemplates(t *testing.T) {
+	eur := func(cents int64) money { return money{cents, "EUR"} }
+	ctx := Context{
+		"price":  eur(1250),
+		"free":   eur(0),
+		"prices": []money{eur(300), eur(100), eur(200)},
+		"list":   &lazyList{items: []string{"a", "b", "c"}},
+		"record": &record{Name: "name", fields: map[string]any{"title": "Title", "nothing": nil}},
+		"key":    "title",
+	}
+	tests := []struct {
+		template string
+		output   string
+	}{
+		{"{{ price }}", "12.50 EUR"},
+		{"{{ price|upper }}", "12.50 EUR"},
+		{"{% if free %}yes{% else %}no{% endif %}", "no"},
+		{"{{ free|default:'gratis' }}", "gratis"},
+		{"{{ price > free }} {{ price < 20 }} {{ price >= 13 }} {{ price == 12 }}", "True True False False"},
+		{"{{ price > 2 && price < 20 }}", "True"},
+		{"{% for p in prices sorted %}{{ p }};{% endfor %}", "1.00 EUR;2.00 EUR;3.00 EUR;"},
+		{"{{ list|length }}", "3"},
+		{"{% for x in list %}{{ forloop.Counter }}{{ x }}{% endfor %}", "1a2b3c"},
+		{"{{ 'b' in list }} {{ 'd' in list }}", "True False"},
+		{"{{ record.title }} {{ record[key] }} {{ record.Name }}", "Title Title name"},
+		{"{{ record.nothing|default:'-' }} {{ record.missing|default:'-' }}", "- -"},
+	}
+	for _, test := range tests {
+		tpl, err := FromString(test.template)
+		if err != nil {
+			t.Errorf("%s: %v", test.template, err)
+			continue
+		}
+		out, err := tpl.Execute(ctx)
+		if err != nil || out != test.output {
+			t.Errorf("%s: got %q, %v; want %q", test.template, out, err, test.output)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync/atomic"
 )
 
 const (
@@ -30,6 +31,21 @@ type variablePart struct {
 
 	isFunctionCall bool
 	callingArgs    []functionCallArgument // needed for a function call, represents all argument nodes (INode supports nested function calls)
+
+	attr atomic.Pointer[typeAttr] // attribute of the type the identifier was last resolved on
+}
+
+// attrOf returns the attribute of type t named by the identifier, looking up
+// fields using the strategy fields. The part keeps the attribute last used,
+// so resolving it on values of the same type (e.g. in loops) skips the cache
+// lookup.
+func (p *variablePart) attrOf(t reflect.Type, fields FieldNames) *typeAttr {
+	if attr := p.attr.Load(); attr != nil && attr.typ == t && attr.fields == fields {
+		return attr
+	}
+	attr := lookupAttr(t, p.s, fields)
+	p.attr.Store(attr)
+	return attr
 }
 
 func (p *variablePart) String() string {
@@ -191,12 +207,16 @@ func (nv *nodeVariable) Execute(ctx *ExecutionContext, writer TemplateWriter) er
 	if err != nil {
 		return err
 	}
+	return nv.write(ctx, writer, value)
+}
 
+// write writes the evaluated value of the expression, escaping it if needed.
+func (nv *nodeVariable) write(ctx *ExecutionContext, writer TemplateWriter, value *Value) (err error) {
 	if !nv.expr.FilterApplied("safe") && !value.safe && value.IsString() && ctx.Autoescape {
 		// apply escape filter
 		escapeFn := ctx.template.set.filters["escape"]
 		if escapeFn != nil {
-			value, err = escapeFn(value, nil)
+			value, err = escapeFn(ctx, value, nil)
 			if err != nil {
 				return err
 			}
@@ -233,48 +253,61 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 	var current reflect.Value
 	var isSafe bool
 
-	for idx, part := range vr.parts {
-		if idx == 0 {
-			current = vr.lookupInitialValue(ctx)
-		} else {
-			resolved, isNil, err := vr.resolveNextPart(ctx, current, part)
-			if err != nil {
-				return nil, err
-			}
-			if isNil {
-				return AsValue(nil), nil
-			}
-			current = resolved
+	for idx := range vr.parts {
+		var isNil bool
+		var err error
+		current, isSafe, isNil, err = vr.resolvePart(ctx, idx, current, isSafe)
+		if err != nil {
+			return nil, err
 		}
-
-		if !current.IsValid() {
+		if isNil {
 			return AsValue(nil), nil
 		}
+	}
 
-		// Unpack *Value if needed
-		current, isSafe = vr.unpackValue(current, isSafe)
+	return reflectedValue(current, isSafe), nil
+}
 
-		// Resolve interface to concrete value
-		if current.Kind() == reflect.Interface {
-			current = reflect.ValueOf(current.Interface())
+// resolvePart resolves the part with index idx of the variable from current
+// (the value of the previous parts, which is ignored for the first part).
+// Returns (resolved value, isSafe, isNil, error); if isNil is true, the
+// variable is nil.
+func (vr *variableResolver) resolvePart(ctx *ExecutionContext, idx int, current reflect.Value, isSafe bool) (reflect.Value, bool, bool, error) {
+	part := vr.parts[idx]
+	if idx == 0 {
+		current = vr.lookupInitialValue(ctx)
+	} else {
+		resolved, isNil, err := vr.resolveNextPart(ctx, current, part)
+		if err != nil || isNil {
+			return reflect.Value{}, false, isNil, err
 		}
+		current = resolved
+	}
 
-		// Handle function call
-		if part.isFunctionCall || current.Kind() == reflect.Func {
-			result, err := vr.handleFunctionCall(ctx, current, part)
-			if err != nil {
-				return nil, err
-			}
-			current = result.value
-			isSafe = result.isSafe
-		}
+	if !current.IsValid() {
+		return reflect.Value{}, false, true, nil
+	}
 
-		if !current.IsValid() {
-			return AsValue(nil), nil
+	// Unpack *Value if needed
+	current, isSafe = vr.unpackValue(current, isSafe)
+
+	// Resolve interface to concrete value
+	if current.Kind() == reflect.Interface {
+		current = reflect.ValueOf(current.Interface())
+	}
+
+	// Handle function call (functions are called without parentheses
+	// as well, except iterators, which are values to iterate over)
+	if part.isFunctionCall || (current.Kind() == reflect.Func && !isSeq(current)) {
+		result, err := vr.handleFunctionCall(ctx, current, part)
+		if err != nil {
+			return reflect.Value{}, false, false, err
 		}
+		current = result.value
+		isSafe = result.isSafe
 	}
 
-	return &Value{val: current, safe: isSafe}, nil
+	return current, isSafe, !current.IsValid(), nil
 }
 
 // resolveArrayDefinition handles in-template array definitions like [a, b, c].
@@ -291,7 +324,7 @@ func (vr *variableResolver) resolveArrayDefinition(ctx *ExecutionContext) (*Valu
 		}
 		items = append(items, item)
 	}
-	return &Value{val: reflect.ValueOf(items), safe: true}, nil
+	return AsSafeValue(items), nil
 }
 
 // lookupInitialValue looks up the first part of the variable in the context.
@@ -307,7 +340,7 @@ func (vr *variableResolver) lookupInitialValue(ctx *ExecutionContext) reflect.Va
 func (vr *variableResolver) unpackValue(current reflect.Value, isSafe bool) (reflect.Value, bool) {
 	if current.Type() == typeOfValuePtr {
 		tmpValue := current.Interface().(*Value)
-		return tmpValue.val, tmpValue.safe
+		return tmpValue.reflectValue(), tmpValue.safe
 	}
 	return current, isSafe
 }
@@ -319,12 +352,45 @@ func (vr *variableResolver) resolveNextPart(
 	current reflect.Value,
 	part *variablePart,
 ) (reflect.Value, bool, error) {
-	// Check for method call first
+	// Identifiers are resolved using the attributes cached for the type
 	if part.typ == varTypeIdent {
-		funcValue := current.MethodByName(part.s)
-		if funcValue.IsValid() {
-			return funcValue, false, nil
+		attr := part.attrOf(current.Type(), ctx.fieldNames())
+		if attr.getAttr {
+			if value, ok := pongoGetAttr(current, part.s); ok {
+				return value, !value.IsValid(), nil
+			}
+		}
+		// Check for method call first
+		if attr.method >= 0 {
+			return current.Method(attr.method), false, nil
 		}
+		if attr.deref {
+			current = current.Elem()
+			if !current.IsValid() {
+				return reflect.Value{}, true, nil
+			}
+		}
+		return vr.resolveAttr(current, attr)
+	}
+
+	// Subscripts with string values are attributes for PongoAttrGetter
+	if part.typ == varTypeSubscript && valuerMethodsOf(current.Type())&valuerGetAttr != 0 {
+		sv, err := part.subscript.Evaluate(ctx)
+		if err != nil {
+			return reflect.Value{}, false, err
+		}
+		if sv.IsString() {
+			if value, ok := pongoGetAttr(current, sv.String()); ok {
+				return value, !value.IsValid(), nil
+			}
+		}
+		if current.Kind() == reflect.Ptr {
+			current = current.Elem()
+			if !current.IsValid() {
+				return reflect.Value{}, true, nil
+			}
+		}
+		return vr.resolveSubscriptValue(current, sv, ctx.fieldNames())
 	}
 
 	// Resolve pointer
@@ -348,7 +414,7 @@ func (vr *variableResolver) resolvePartByType(
 	case varTypeInt:
 		return vr.resolveIntIndex(current, part)
 	case varTypeIdent:
-		return vr.resolveIdentifier(current, part)
+		return vr.resolveIdentifier(ctx, current, part)
 	case varTypeSubscript:
 		return vr.resolveSubscript(ctx, current, part)
 	default:
@@ -378,12 +444,21 @@ func (vr *variableResolver) resolveIntIndex(current reflect.Value, part *variabl
 }
 
 // resolveIdentifier resolves a field or map key access by name.
-func (vr *variableResolver) resolveIdentifier(current reflect.Value, part *variablePart) (reflect.Value, bool, error) {
+func (vr *variableResolver) resolveIdentifier(ctx *ExecutionContext, current reflect.Value, part *variablePart) (reflect.Value, bool, error) {
+	return vr.resolveAttr(current, part.attrOf(current.Type(), ctx.fieldNames()))
+}
+
+// resolveAttr resolves a field or map key access using the attribute of
+// current's type (after dereferencing pointers).
+func (vr *variableResolver) resolveAttr(current reflect.Value, attr *typeAttr) (reflect.Value, bool, error) {
 	switch current.Kind() {
 	case reflect.Struct:
-		return current.FieldByName(part.s), false, nil
+		return fieldByAttr(current, attr), false, nil
 	case reflect.Map:
-		return current.MapIndex(reflect.ValueOf(part.s)), false, nil
+		if attr.mapKey == nil {
+			return reflect.Value{}, true, nil
+		}
+		return current.MapIndex(*attr.mapKey), false, nil
 	default:
 		return reflect.Value{}, false, fmt.Errorf("can't access a field by name on type %s (variable %s)",
 			current.Kind().String(), vr.String())
@@ -400,7 +475,12 @@ func (vr *variableResolver) resolveSubscript(
 	if err != nil {
 		return reflect.Value{}, false, err
 	}
+	return vr.resolveSubscriptValue(current, sv, ctx.fieldNames())
+}
 
+// resolveSubscriptValue resolves a subscript access using the evaluated
+// subscript sv, looking up fields using the strategy fields.
+func (vr *variableResolver) resolveSubscriptValue(current reflect.Value, sv *Value, fields FieldNames) (reflect.Value, bool, error) {
 	switch current.Kind() {
 	case reflect.String:
 		// For strings, return the character (rune) at the index (Django-compatible behavior)
@@ -417,13 +497,13 @@ func (vr *variableResolver) resolveSubscript(
 		}
 		return reflect.Value{}, true, nil
 	case reflect.Struct:
-		return current.FieldByName(sv.String()), false, nil
+		return fieldByName(current, sv.String(), fields), false, nil
 	case reflect.Map:
 		if sv.IsNil() {
 			return reflect.Value{}, true, nil
 		}
-		if sv.val.Type().AssignableTo(current.Type().Key()) {
-			return current.MapIndex(sv.val), false, nil
+		if key := sv.reflectValue(); key.Type().AssignableTo(current.Type().Key()) {
+			return current.MapIndex(key), false, nil
 		}
 		return reflect.Value{}, true, nil
 	default:
@@ -570,7 +650,7 @@ func (vr *variableResolver) executeCall(
 		result.value = reflect.ValueOf(rv.Interface())
 	} else {
 		val := rv.Interface().(*Value)
-		result.value = val.val
+		result.value = val.reflectValue()
 		result.isSafe = val.safe
 	}
 
@@ -580,7 +660,7 @@ func (vr *variableResolver) executeCall(
 func (vr *variableResolver) Evaluate(ctx *ExecutionContext) (*Value, error) {
 	value, err := vr.resolve(ctx)
 	if err != nil {
-		return AsValue(nil), ctx.Error(err.Error(), vr.locationToken)
+		return AsValue(nil), ctx.OrigError(err, vr.locationToken)
 	}
 	return value, nil
 }
@@ -875,7 +955,8 @@ filterLoop:
 
 		// Check sandbox filter restriction
 		if _, isBanned := p.template.set.bannedFilters[filter.name]; isBanned {
-			return nil, p.Error(fmt.Sprintf("Usage of filter '%s' is not allowed (sandbox restriction active).", filter.name), nil)
+			return nil, p.errorOfKind(ErrSandboxViolation,
+				fmt.Sprintf("Usage of filter '%s' is not allowed (sandbox restriction active).", filter.name), nil)
 		}
 
 		v.filterChain = append(v.filterChain, filter)
@@ -905,3 +986,132 @@ func (p *Parser) parseVariableElement() (INode, error) {
 
 	return node, nil
 }
+
+func (nv *nodeVariable) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteToken(nv.locationToken)
+	enc.WriteEvaluator(nv.expr)
+	return nil
+}
+
+func (nv *nodeVariable) DecodeNode(dec *NodeDecoder) error {
+	nv.locationToken = dec.ReadToken()
+	nv.expr = dec.readRequiredEvaluator()
+	return nil
+}
+
+func (v *nodeFilteredVariable) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteToken(v.locationToken)
+	enc.WriteEvaluator(v.resolver)
+	enc.writeUvarint(uint64(len(v.filterChain)))
+	for _, fc := range v.filterChain {
+		fc.encode(enc)
+	}
+	return nil
+}
+
+func (v *nodeFilteredVariable) DecodeNode(dec *NodeDecoder) error {
+	v.locationToken = dec.ReadToken()
+	v.resolver = dec.readRequiredEvaluator()
+	v.filterChain = make([]*filterCall, dec.readCount())
+	for i := range v.filterChain {
+		v.filterChain[i] = decodeFilterCall(dec)
+	}
+	return nil
+}
+
+func (vr *variableResolver) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteToken(vr.locationToken)
+	enc.writeUvarint(uint64(len(vr.parts)))
+	for _, part := range vr.parts {
+		enc.WriteInt(part.typ)
+		enc.WriteString(part.s)
+		enc.WriteInt(part.i)
+		enc.WriteEvaluator(part.subscript)
+		enc.WriteBool(part.isNil)
+		enc.WriteBool(part.isFunctionCall)
+		enc.writeUvarint(uint64(len(part.callingArgs)))
+		for _, arg := range part.callingArgs {
+			// Arguments are expressions until the call is executed
+			e, ok := arg.(IEvaluator)
+			if !ok {
+				return fmt.Errorf("function call argument of type %T can't be serialized", arg)
+			}
+			enc.WriteEvaluator(e)
+		}
+	}
+	return nil
+}
+
+func (vr *variableResolver) DecodeNode(dec *NodeDecoder) error {
+	vr.locationToken = dec.ReadToken()
+	vr.parts = make([]*variablePart, dec.readCount())
+	for i := range vr.parts {
+		part := &variablePart{
+			typ:            dec.ReadInt(),
+			s:              dec.ReadString(),
+			i:              dec.ReadInt(),
+			subscript:      dec.ReadEvaluator(),
+			isNil:          dec.ReadBool(),
+			isFunctionCall: dec.ReadBool(),
+		}
+		if part.typ == varTypeSubscript && part.subscript == nil {
+			return errSerializedCorrupt
+		}
+		if n := dec.readCount(); n > 0 {
+			part.callingArgs = make([]functionCallArgument, n)
+			for j := range part.callingArgs {
+				part.callingArgs[j] = dec.readRequiredEvaluator()
+			}
+		}
+		vr.parts[i] = part
+	}
+	return nil
+}
+
+func (s *stringResolver) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteToken(s.locationToken)
+	enc.WriteString(s.val)
+	return nil
+}
+
+func (s *stringResolver) DecodeNode(dec *NodeDecoder) error {
+	s.locationToken = dec.ReadToken()
+	s.val = dec.ReadString()
+	return nil
+}
+
+func (i *intResolver) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteToken(i.locationToken)
+	enc.WriteInt(i.val)
+	return nil
+}
+
+func (i *intResolver) DecodeNode(dec *NodeDecoder) error {
+	i.locationToken = dec.ReadToken()
+	i.val = dec.ReadInt()
+	return nil
+}
+
+func (f *floatResolver) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteToken(f.locationToken)
+	enc.WriteFloat(f.val)
+	return nil
+}
+
+func (f *floatResolver) DecodeNode(dec *NodeDecoder) error {
+	f.locationToken = dec.ReadToken()
+	f.val = dec.ReadFloat()
+	return nil
+}
+
+func (b *boolResolver) EncodeNode(enc *NodeEncoder) error {
+	enc.WriteToken(b.locationToken)
+	enc.WriteBool(b.val)
+	return nil
+}
+
+func (b *boolResolver) DecodeNode(dec *NodeDecoder) error {
+	b.locationToken = dec.ReadToken()
+	b.val = dec.ReadBool()
+	return nil
+}
@@ -0,0 +1,241 @@
+package pongo2
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// FieldNames is the strategy to map attribute names used in templates (e.g.
+// first_name in {{ user.first_name }}) to struct fields, set per template
+// set (see TemplateSet.FieldNames). Fields are always found by their Go name
+// and by the name of their pongo2 struct tag; fields tagged with pongo2:"-"
+// (and the fields promoted from them) can't be accessed at all:
+//
+//	type User struct {
+//	    FirstName string `pongo2:"first_name"`
+//	    Password  string `pongo2:"-"`
+//	}
+//
+// The flags enable additional names. The names are looked up in this order:
+// pongo2 tags, json tags, Go names and snake_case names. Methods and map keys
+// aren't affected.
+type FieldNames uint8
+
+const (
+	// FieldNamesJSON finds fields by the name of their json struct tag if
+	// they have no pongo2 tag. Fields tagged with json:"-" are hidden.
+	FieldNamesJSON FieldNames = 1 << iota
+
+	// FieldNamesSnakeCase finds fields by snake_case names of their Go name
+	// (first_name or user_id for FirstName or UserID). Underscores are
+	// ignored and the case doesn't matter.
+	FieldNamesSnakeCase
+)
+
+// attrKey identifies an attribute (method, field or map key) of a type.
+type attrKey struct {
+	typ    reflect.Type
+	name   string
+	fields FieldNames
+}
+
+// typeAttr describes how an attribute of a type is resolved. Looking up
+// methods and fields by name using reflect is slow, so the result is cached
+// per type and name and reused by every access (e.g. in each iteration of a
+// loop).
+type typeAttr struct {
+	typ    reflect.Type // the type the attribute belongs to
+	fields FieldNames   // the strategy the field was looked up with
+
+	// getAttr is set if the type implements PongoAttrGetter, which is
+	// asked for the attribute first.
+	getAttr bool
+
+	// method is the index of the method in the type's method set, -1 if
+	// the type has no exported method of this name.
+	method int
+
+	// deref is set if the type is a pointer, which is dereferenced before
+	// accessing the field or map key.
+	deref bool
+
+	// kind is the kind of the (dereferenced) type.
+	kind reflect.Kind
+
+	// field is the index path of the struct field, nil if there is no such
+	// field.
+	field []int
+
+	// mapKey is the key of the map, nil if the map's key type can't hold
+	// the name.
+	mapKey *reflect.Value
+}
+
+// attrCache maps attrKey to *typeAttr.
+var attrCache sync.Map
+
+// lookupAttr returns how the attribute name of values of type t is resolved
+// using the strategy fields. Names must come from the template source, not
+// from data, as misses are cached as well.
+func lookupAttr(t reflect.Type, name string, fields FieldNames) *typeAttr {
+	key := attrKey{typ: t, name: name, fields: fields}
+	if attr, ok := attrCache.Load(key); ok {
+		return attr.(*typeAttr)
+	}
+	attr, _ := attrCache.LoadOrStore(key, newTypeAttr(t, name, fields))
+	return attr.(*typeAttr)
+}
+
+func newTypeAttr(t reflect.Type, name string, fields FieldNames) *typeAttr {
+	attr := &typeAttr{typ: t, fields: fields, method: -1, getAttr: valuerMethodsOf(t)&valuerGetAttr != 0}
+	if m, ok := t.MethodByName(name); ok {
+		attr.method = m.Index
+	}
+	if t.Kind() == reflect.Ptr {
+		attr.deref = true
+		t = t.Elem()
+	}
+	attr.kind = t.Kind()
+	switch attr.kind {
+	case reflect.Struct:
+		attr.field = structFieldsOf(t, fields).lookup(name)
+	case reflect.Map:
+		key := reflect.ValueOf(name)
+		switch {
+		case key.Type().AssignableTo(t.Key()):
+			attr.mapKey = &key
+		case t.Key().Kind() == reflect.String:
+			key = key.Convert(t.Key())
+			attr.mapKey = &key
+		}
+	}
+	return attr
+}
+
+// fieldByName returns the field name of the struct v using the strategy
+// fields. It works like reflect.Value.FieldByName, but caches the field's
+// index path. Unlike lookupAttr, name may come from data: only fields found
+// are cached.
+func fieldByName(v reflect.Value, name string, fields FieldNames) reflect.Value {
+	key := attrKey{typ: v.Type(), name: name, fields: fields}
+	if attr, ok := attrCache.Load(key); ok {
+		return fieldByAttr(v, attr.(*typeAttr))
+	}
+	attr := newTypeAttr(v.Type(), name, fields)
+	if attr.field != nil {
+		attrCache.Store(key, attr)
+	}
+	return fieldByAttr(v, attr)
+}
+
+func fieldByAttr(v reflect.Value, attr *typeAttr) reflect.Value {
+	if attr.field == nil {
+		return reflect.Value{}
+	}
+	if len(attr.field) == 1 {
+		return v.Field(attr.field[0])
+	}
+	return v.FieldByIndex(attr.field)
+}
+
+// structFields maps the names of the fields of a struct type to their index
+// paths for a strategy (see FieldNames).
+type structFields struct {
+	names  map[string][]int // pongo2 tags, json tags and Go names
+	folded map[string][]int // folded Go names (for FieldNamesSnakeCase)
+}
+
+// structFieldsKey identifies the structFields of a type and strategy.
+type structFieldsKey struct {
+	typ    reflect.Type
+	fields FieldNames
+}
+
+// structFieldsCache maps structFieldsKey to *structFields.
+var structFieldsCache sync.Map
+
+// structFieldsOf returns the field names of the struct type t.
+func structFieldsOf(t reflect.Type, fields FieldNames) *structFields {
+	key := structFieldsKey{typ: t, fields: fields}
+	if sf, ok := structFieldsCache.Load(key); ok {
+		return sf.(*structFields)
+	}
+	sf, _ := structFieldsCache.LoadOrStore(key, newStructFields(t, fields))
+	return sf.(*structFields)
+}
+
+func newStructFields(t reflect.Type, fields FieldNames) *structFields {
+	// Fields of embedded structs come after them, so fields promoted from
+	// hidden ones are hidden as well
+	var visible []reflect.StructField
+	var hidden [][]int
+	for _, f := range reflect.VisibleFields(t) {
+		// Unexported fields can't be accessed (embedded structs are kept for
+		// their promoted fields)
+		if !f.IsExported() && !f.Anonymous {
+			continue
+		}
+		if slices.ContainsFunc(hidden, func(index []int) bool {
+			return len(f.Index) > len(index) && slices.Equal(f.Index[:len(index)], index)
+		}) {
+			continue
+		}
+		if name := tagName(f, "pongo2"); name == "-" || (name == "" && fields&FieldNamesJSON != 0 && tagName(f, "json") == "-") {
+			hidden = append(hidden, f.Index)
+			continue
+		}
+		visible = append(visible, f)
+	}
+	// Names of less deeply embedded fields take precedence
+	slices.SortStableFunc(visible, func(a, b reflect.StructField) int {
+		return len(a.Index) - len(b.Index)
+	})
+
+	sf := &structFields{names: make(map[string][]int)}
+	add := func(names map[string][]int, name string, index []int) {
+		if _, exists := names[name]; !exists && name != "" {
+			names[name] = index
+		}
+	}
+	for _, f := range visible {
+		add(sf.names, tagName(f, "pongo2"), f.Index)
+	}
+	if fields&FieldNamesJSON != 0 {
+		for _, f := range visible {
+			if tagName(f, "pongo2") == "" {
+				add(sf.names, tagName(f, "json"), f.Index)
+			}
+		}
+	}
+	for _, f := range visible {
+		add(sf.names, f.Name, f.Index)
+	}
+	if fields&FieldNamesSnakeCase != 0 {
+		sf.folded = make(map[string][]int)
+		for _, f := range visible {
+			add(sf.folded, strings.ToLower(f.Name), f.Index)
+		}
+	}
+	return sf
+}
+
+// tagName returns the name of the struct tag key of f (without options
+// like omitempty).
+func tagName(f reflect.StructField, key string) string {
+	name, _, _ := strings.Cut(f.Tag.Get(key), ",")
+	return name
+}
+
+// lookup returns the index path of the field name, nil if there is no such
+// field.
+func (sf *structFields) lookup(name string) []int {
+	if index, ok := sf.names[name]; ok {
+		return index
+	}
+	if sf.folded != nil {
+		return sf.folded[strings.ToLower(strings.ReplaceAll(name, "_", ""))]
+	}
+	return nil
+}
@@ -1,8 +1,10 @@
 package pongo2
 
 import (
+	"io"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -289,6 +291,30 @@ func TestResolveIdentifier(t *testing.T) {
 			context:  Context{"m": map[string]string{}},
 			expected: "",
 		},
+		{
+			name:     "map named string key",
+			template: "{{ m.foo }}",
+			context:  Context{"m": map[stringWithMethods]int{"foo": 1}},
+			expected: "1",
+		},
+		{
+			name:     "map non-string key returns empty",
+			template: "{{ m.foo }}",
+			context:  Context{"m": map[int]int{1: 1}},
+			expected: "",
+		},
+		{
+			name:     "pointer to struct field",
+			template: "{{ s.Public }}",
+			context:  Context{"s": &TestStruct{Public: "pointer"}},
+			expected: "pointer",
+		},
+		{
+			name:     "nil pointer returns empty",
+			template: "{{ s.Public }}",
+			context:  Context{"s": (*TestStruct)(nil)},
+			expected: "",
+		},
 	}
 
 	set := NewSet("test", &DummyLoader{})
@@ -317,6 +343,230 @@ func TestResolveIdentifier(t *testing.T) {
 	}
 }
 
+// attrUser and attrProfile test cached attribute lookups.
+type attrProfile struct {
+	Name string
+}
+
+type attrUser struct {
+	*attrProfile
+	Profile attrProfile
+}
+
+func (u *attrUser) Greeting() string {
+	return "Hello " + u.Profile.Name
+}
+
+func TestLookupAttr(t *testing.T) {
+	typ := reflect.TypeFor[*attrUser]()
+	attr := lookupAttr(typ, "Greeting", 0)
+	if attr.method < 0 || !attr.deref || attr.kind != reflect.Struct {
+		t.Errorf("unexpected attribute for method: %+v", attr)
+	}
+	if lookupAttr(typ, "Greeting", 0) != attr {
+		t.Error("expected attribute to be cached")
+	}
+	if attr := lookupAttr(typ, "Name", 0); attr.method >= 0 || !reflect.DeepEqual(attr.field, []int{0, 0}) {
+		t.Errorf("unexpected attribute for promoted field: %+v", attr)
+	}
+	if attr := lookupAttr(typ, "Missing", 0); attr.method >= 0 || attr.field != nil {
+		t.Errorf("unexpected attribute for missing field: %+v", attr)
+	}
+
+	// Names from data are cached only if the field exists
+	v := reflect.ValueOf(attrUser{})
+	fieldByName(v, "Profile", 0)
+	fieldByName(v, "Unknown", 0)
+	if _, ok := attrCache.Load(attrKey{typ: v.Type(), name: "Profile"}); !ok {
+		t.Error("expected existing field to be cached")
+	}
+	if _, ok := attrCache.Load(attrKey{typ: v.Type(), name: "Unknown"}); ok {
+		t.Error("expected missing field not to be cached")
+	}
+
+	tpl, err := FromString("{% for u in users %}{{ u.Greeting }}/{{ u.Profile.Name }}/{% with p=u['Profile'] %}{{ p.Name }}{% endwith %};{% endfor %}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := []*attrUser{{Profile: attrProfile{Name: "a"}}, {Profile: attrProfile{Name: "b"}}}
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Go(func() {
+			if got, err := tpl.Execute(Context{"users": users}); err != nil || got != "Hello a/a/a;Hello b/b/b;" {
+				t.Errorf("Execute = %q, %v", got, err)
+			}
+		})
+	}
+	wg.Wait()
+
+	// Promoted fields of nil embedded pointers panic like reflect.Value.FieldByName
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic for field of nil embedded pointer")
+			}
+		}()
+		fieldByName(reflect.ValueOf(attrUser{}), "Name", 0)
+	}()
+}
+
+// tagged tests the field name strategies.
+type taggedBase struct {
+	ID      int
+	Created string `pongo2:"created_at"`
+}
+
+type taggedSecret struct {
+	Token string
+}
+
+type tagged struct {
+	taggedBase
+	taggedSecret `pongo2:"-"`
+	FirstName    string `json:"firstName"`
+	LastName     string `pongo2:"last" json:"lastName,omitempty"`
+	Password     string `pongo2:"-"`
+	Internal     string `json:"-"`
+	Other        string `json:"FirstName"`
+}
+
+func TestFieldNames(t *testing.T) {
+	user := &tagged{
+		taggedBase:   taggedBase{ID: 1, Created: "today"},
+		taggedSecret: taggedSecret{Token: "token"},
+		FirstName:    "first", LastName: "last", Password: "secret", Internal: "internal", Other: "other",
+	}
+	tests := []struct {
+		fields   FieldNames
+		template string
+		output   string
+	}{
+		{0, "{{ u.FirstName }} {{ u.last }} {{ u.LastName }} {{ u.created_at }} {{ u.ID }}", "first last last today 1"},
+		{0, "{{ u.Password }}|{{ u['Password'] }}|{{ u.Token }}|{{ u.taggedSecret }}", "|||"},
+		{0, "{{ u.firstName }}|{{ u.first_name }}|{{ u.Internal }}", "||internal"},
+		{FieldNamesJSON, "{{ u.firstName }} {{ u.lastName }} {{ u.last }} {{ u.FirstName }}", "first  last other"},
+		{FieldNamesJSON, "{{ u.Internal }}|{{ u.Password }}", "|"},
+		{FieldNamesSnakeCase, "{{ u.first_name }} {{ u.last_name }} {{ u.id }} {{ u['internal'] }}", "first last 1 internal"},
+		{FieldNamesSnakeCase, "{{ u.password }}|{{ u.token }}", "|"},
+		{FieldNamesJSON | FieldNamesSnakeCase, "{{ u.firstName }} {{ u.first_name }} {{ u.internal }}", "first first "},
+		// The in operator and the dictsort filters use the strategy as well
+		{0, `{{ "FirstName" in u }} {{ "firstName" in u }} {{ "Internal" in u }} {{ "Password" in u }}`, "True False True False"},
+		{FieldNamesJSON, `{{ "firstName" in u }} {{ "Internal" in u }}`, "True False"},
+		{FieldNamesSnakeCase, `{{ "first_name" in u }}`, "True"},
+		{0, `{% for x in users|dictsort:"first_name" %}{{ x.FirstName }}{% endfor %}`, "ba"},
+		{FieldNamesSnakeCase, `{% for x in users|dictsort:"first_name" %}{{ x.FirstName }}{% endfor %}`, "ab"},
+		{FieldNamesSnakeCase, `{% for x in users|dictsortreversed:"last_name" %}{{ x.FirstName }}{% endfor %}`, "ab"},
+		{0, `{% for x in users|dictsort:"Internal" %}{{ x.FirstName }}{% endfor %}`, "ab"},
+		{FieldNamesJSON, `{% for x in users|dictsort:"Internal" %}{{ x.firstName }}{% endfor %}`, "ba"},
+		// So do custom filters using ExecutionContext.GetItem
+		{0, `{{ u|field:"first_name" }}|{{ u|field:"FirstName" }}`, "|first"},
+		{FieldNamesSnakeCase, `{{ u|field:"first_name" }}|{{ u|field:"password" }}`, "first|"},
+	}
+	field := func(ctx *ExecutionContext, in, param *Value) (*Value, error) {
+		return ctx.GetItem(in, param), nil
+	}
+	users := []*tagged{
+		{FirstName: "b", LastName: "y", Internal: "2"},
+		{FirstName: "a", LastName: "z", Internal: "1"},
+	}
+	for _, test := range tests {
+		set := NewSet("field names", &DummyLoader{})
+		set.FieldNames = test.fields
+		if err := set.RegisterContextFilter("field", field); err != nil {
+			t.Fatal(err)
+		}
+		tpl, err := set.FromString(test.template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Executed twice to use the cached attributes
+		for range 2 {
+			if out, err := tpl.Execute(Context{"u": user, "users": users}); err != nil || out != test.output {
+				t.Errorf("%d: %s: got %q, %v; want %q", test.fields, test.template, out, err, test.output)
+			}
+		}
+	}
+
+	// Without an execution context, fields are found by their Go name and tag
+	snake := NewSet("field names apply", &DummyLoader{})
+	snake.FieldNames = FieldNamesSnakeCase
+	if err := snake.RegisterContextFilter("field", field); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := snake.ApplyFilter("field", AsValue(user), AsValue("last")); err != nil || out.String() != "last" {
+		t.Errorf("field applied without context: got %q, %v", out, err)
+	}
+	if out, err := snake.ApplyFilter("dictsort", AsValue(users), AsValue("FirstName")); err != nil || out.Index(0).Interface() != users[1] {
+		t.Errorf("dictsort applied without context: got %v, %v", out, err)
+	}
+
+	// Replaced filters don't depend on the context
+	replaced := NewSet("replaced dictsort", &DummyLoader{})
+	replaced.FieldNames = FieldNamesSnakeCase
+	if err := replaced.ReplaceFilter("dictsort", func(in, param *Value) (*Value, error) {
+		return AsValue("replaced"), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := replaced.RenderTemplateString(`{{ users|dictsort:"first_name" }}`, Context{"users": users}); err != nil || out != "replaced" {
+		t.Errorf("replaced dictsort: got %q, %v", out, err)
+	}
+
+	// Unexported fields are ignored, also if their names match
+	type unexported struct {
+		firstName string
+		FirstName string
+	}
+	for _, fields := range []FieldNames{0, FieldNamesJSON, FieldNamesSnakeCase} {
+		set := NewSet("unexported field names", &DummyLoader{})
+		set.FieldNames = fields
+		tpl, err := set.FromString("{{ u.firstName }}|{{ u.first_name }}|{{ u.FirstName }}")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[FieldNames]string{0: "||first", FieldNamesJSON: "||first", FieldNamesSnakeCase: "first|first|first"}[fields]
+		out, err := tpl.Execute(Context{"u": unexported{firstName: "unexported", FirstName: "first"}})
+		if err != nil || out != want {
+			t.Errorf("%d: got %q, %v; want %q", fields, out, err, want)
+		}
+	}
+
+	// The strategy can be changed after compiling the template
+	set := NewSet("field names changed", &DummyLoader{})
+	tpl, err := set.FromString("{{ u.first_name }}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fields := range []FieldNames{0, FieldNamesSnakeCase, 0} {
+		set.FieldNames = fields
+		want := map[FieldNames]string{0: "", FieldNamesSnakeCase: "first"}[fields]
+		if out, err := tpl.Execute(Context{"u": user}); err != nil || out != want {
+			t.Errorf("%d: got %q, %v; want %q", fields, out, err, want)
+		}
+	}
+}
+
+func BenchmarkResolveAttr(b *testing.B) {
+	type item struct {
+		User *attrUser
+	}
+	items := make([]item, 100)
+	for i := range items {
+		items[i].User = &attrUser{Profile: attrProfile{Name: "pongo2"}}
+	}
+	tpl, err := FromString("{% for item in items %}{{ item.User.Profile.Name }}{% endfor %}")
+	if err != nil {
+		b.Fatal(err)
+	}
+	ctx := Context{"items": items}
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := tpl.ExecuteWriterUnbuffered(ctx, io.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 // TestResolveSubscript tests the resolveSubscript helper via templates.
 func TestResolveSubscript(t *testing.T) {
 	tests := []struct {
@@ -550,8 +800,8 @@ func TestUnpackValue(t *testing.T) {
 		val := AsValue("inner")
 		input := reflect.ValueOf(val)
 		result, isSafe := vr.unpackValue(input, false)
-		if result.Interface() != val.val.Interface() {
-			t.Errorf("expected %v, got %v", val.val, result)
+		if result.Interface() != val.Interface() {
+			t.Errorf("expected %v, got %v", val, result)
 		}
 		if isSafe {
 			t.Error("expected isSafe to be false")
@@ -562,8 +812,8 @@ func TestUnpackValue(t *testing.T) {
 		val := AsSafeValue("safe inner")
 		input := reflect.ValueOf(val)
 		result, isSafe := vr.unpackValue(input, false)
-		if result.Interface() != val.val.Interface() {
-			t.Errorf("expected %v, got %v", val.val, result)
+		if result.Interface() != val.Interface() {
+			t.Errorf("expected %v, got %v", val, result)
 		}
 		if !isSafe {
 			t.Error("expected isSafe to be true")